@@ -0,0 +1,102 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ComplianceSummarySpec defines the PolicyControls whose PolicyReports are aggregated
+type ComplianceSummarySpec struct {
+	// PolicyControls of all namespaces whose workspaces are aggregated. All PolicyControls are aggregated when omitted.
+	PolicyControlSelector *metav1.LabelSelector `json:"policyControlSelector,omitempty"`
+	// How often the PolicyReports are collected again. Defaults to 5m.
+	RefreshInterval metav1.Duration `json:"refreshInterval,omitempty"`
+}
+
+// ComplianceCounts are the numbers of PolicyReport results by result.
+type ComplianceCounts struct {
+	Pass  int32 `json:"pass"`
+	Fail  int32 `json:"fail"`
+	Warn  int32 `json:"warn"`
+	Error int32 `json:"error"`
+	Skip  int32 `json:"skip"`
+}
+
+// PolicyCompliance are the results of a Kyverno policy over all aggregated workspaces and edge clusters.
+type PolicyCompliance struct {
+	Policy           string `json:"policy"`
+	ComplianceCounts `json:",inline"`
+}
+
+// EdgeClusterCompliance are the results reported by the Kyverno on an edge cluster, i.e. the
+// PolicyReports carrying the state label of its SyncTarget.
+type EdgeClusterCompliance struct {
+	SyncTarget       string `json:"syncTarget"`
+	ComplianceCounts `json:",inline"`
+}
+
+// WorkspaceCompliance are the results in a workspace and the edge clusters bound to it.
+type WorkspaceCompliance struct {
+	Workspace string `json:"workspace"`
+	// PolicyControl managing the workspace as <namespace>/<name>
+	PolicyControl    string `json:"policyControl"`
+	ComplianceCounts `json:",inline"`
+	EdgeClusters     []EdgeClusterCompliance `json:"edgeClusters,omitempty"`
+	// Error that prevented the PolicyReports of the workspace from being collected.
+	Message string `json:"message,omitempty"`
+}
+
+// ComplianceSummaryStatus defines the observed state of ComplianceSummary
+type ComplianceSummaryStatus struct {
+	Total           ComplianceCounts      `json:"total,omitempty"`
+	Policies        []PolicyCompliance    `json:"policies,omitempty"`
+	Workspaces      []WorkspaceCompliance `json:"workspaces,omitempty"`
+	LastRefreshTime *metav1.Time          `json:"lastRefreshTime,omitempty"`
+	Conditions      []metav1.Condition    `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Pass",type=integer,JSONPath=`.status.total.pass`
+//+kubebuilder:printcolumn:name="Fail",type=integer,JSONPath=`.status.total.fail`
+//+kubebuilder:printcolumn:name="Warn",type=integer,JSONPath=`.status.total.warn`
+//+kubebuilder:printcolumn:name="Error",type=integer,JSONPath=`.status.total.error`
+//+kubebuilder:printcolumn:name="Refreshed",type=date,JSONPath=`.status.lastRefreshTime`
+
+// ComplianceSummary is the Schema for the compliancesummaries API
+type ComplianceSummary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ComplianceSummarySpec   `json:"spec,omitempty"`
+	Status ComplianceSummaryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ComplianceSummaryList contains a list of ComplianceSummary
+type ComplianceSummaryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ComplianceSummary `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ComplianceSummary{}, &ComplianceSummaryList{})
+}
@@ -0,0 +1,144 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PolicyBundleSpec defines the desired state of PolicyBundle
+type PolicyBundleSpec struct {
+	// Kyverno ClusterPolicy or Policy manifests given inline.
+	//+kubebuilder:pruning:PreserveUnknownFields
+	//+kubebuilder:validation:EmbeddedResource
+	Policies []runtime.RawExtension `json:"policies,omitempty"`
+	// ConfigMap in the namespace of the PolicyBundle whose data values are Kyverno policy manifests.
+	ConfigMapRef *corev1.LocalObjectReference `json:"configMapRef,omitempty"`
+	// OCI artifact whose layers are Kyverno policy manifests (e.g. pushed with "kyverno oci push").
+	OCIArtifact *OCIArtifact `json:"ociArtifact,omitempty"`
+	// Targets the policies are placed into.
+	Targets PolicyBundleTargets `json:"targets,omitempty"`
+	// Rollout strategy of the policies. Policies are applied as given when omitted.
+	Rollout *PolicyBundleRollout `json:"rollout,omitempty"`
+}
+
+type PolicyBundleRollout struct {
+	// "Direct" applies the policies as given. "Staged" applies them with validationFailureAction Audit first
+	// and promotes them to Enforce once the soak period passed with few enough violations.
+	//+kubebuilder:validation:Enum=Direct;Staged
+	Strategy string `json:"strategy,omitempty"`
+	// How long the policies stay in Audit before they can be promoted.
+	SoakDuration metav1.Duration `json:"soakDuration,omitempty"`
+	// Maximum number of failed PolicyReport results in the targets that still allows the promotion.
+	MaxViolations int32 `json:"maxViolations,omitempty"`
+	// Number of admission requests denied by the policies within the rollback window, in the workspaces and on the
+	// edge clusters together, that triggers a rollback to Audit after the promotion. Zero disables the rollback.
+	RollbackDenialThreshold int32 `json:"rollbackDenialThreshold,omitempty"`
+	// Window the admission denials are counted over for the rollback. Defaults to 10m.
+	RollbackWindow metav1.Duration `json:"rollbackWindow,omitempty"`
+	// Paused holds the rollout in its current phase until it is set back to false.
+	Paused bool `json:"paused,omitempty"`
+}
+
+type OCIArtifact struct {
+	// Image reference such as ghcr.io/org/policies:v1
+	Image string `json:"image,omitempty"`
+	// Secret of type kubernetes.io/dockerconfigjson in the namespace of the PolicyBundle used to pull the image.
+	PullSecret string `json:"pullSecret,omitempty"`
+}
+
+type PolicyBundleTargets struct {
+	// PolicyControls in the namespace of the PolicyBundle whose workspaces receive the policies.
+	PolicyControlSelector *metav1.LabelSelector `json:"policyControlSelector,omitempty"`
+	// Workspaces receiving the policies. Each of them has to be managed by a PolicyControl in the namespace of the PolicyBundle.
+	Workspaces []string `json:"workspaces,omitempty"`
+	// Namespaces in the workspaces where the policies are placed as namespaced Policies so that
+	// kcp syncs them to the edge clusters of the SyncTargets the workspaces are bound to.
+	// ClusterPolicies are converted to Policies.
+	EdgeNamespaces []string `json:"edgeNamespaces,omitempty"`
+}
+
+// PolicyBundleTargetStatus is the rollout status of the bundle in a workspace or on the edge clusters bound to it.
+type PolicyBundleTargetStatus struct {
+	Workspace string `json:"workspace"`
+	// "Workspace" or "Edge"
+	Type string `json:"type"`
+	// "Applied", "Pending" while edge policies are not synced to all SyncTargets, or "Failed"
+	Phase string `json:"phase"`
+	// Policies placed into the target, as <namespace>/<name> or <name> for ClusterPolicies.
+	Policies           []string    `json:"policies,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// PolicyBundleRolloutStatus is the progress of a staged rollout.
+type PolicyBundleRolloutStatus struct {
+	// "Auditing", "Enforcing" or "RolledBack"
+	Phase string `json:"phase,omitempty"`
+	// Hash of the policies being rolled out. A change restarts the rollout from Audit.
+	PoliciesHash     string       `json:"policiesHash,omitempty"`
+	AuditStartTime   *metav1.Time `json:"auditStartTime,omitempty"`
+	EnforceStartTime *metav1.Time `json:"enforceStartTime,omitempty"`
+	// Failed PolicyReport results of the policies at the last check.
+	Violations int32 `json:"violations,omitempty"`
+	// Admission requests denied by the policies in the workspaces within the current rollback window.
+	Denials int32 `json:"denials,omitempty"`
+	// Failed results of the policies of the edge namespaces within the current rollback window, in the PolicyReports
+	// synced back from the edge clusters, whose admission events are not synced back.
+	EdgeDenials int32 `json:"edgeDenials,omitempty"`
+	// Start of the current rollback window.
+	DenialWindowStartTime *metav1.Time `json:"denialWindowStartTime,omitempty"`
+	// Counts of the denials when the window started, subtracted from the current ones.
+	DenialBaseline     int32  `json:"denialBaseline,omitempty"`
+	EdgeDenialBaseline int32  `json:"edgeDenialBaseline,omitempty"`
+	Message            string `json:"message,omitempty"`
+}
+
+// PolicyBundleStatus defines the observed state of PolicyBundle
+type PolicyBundleStatus struct {
+	ObservedGeneration int64                      `json:"observedGeneration,omitempty"`
+	Targets            []PolicyBundleTargetStatus `json:"targets,omitempty"`
+	Rollout            *PolicyBundleRolloutStatus `json:"rollout,omitempty"`
+	Conditions         []metav1.Condition         `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// PolicyBundle is the Schema for the policybundles API
+type PolicyBundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PolicyBundleSpec   `json:"spec,omitempty"`
+	Status PolicyBundleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PolicyBundleList contains a list of PolicyBundle
+type PolicyBundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PolicyBundle `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PolicyBundle{}, &PolicyBundleList{})
+}
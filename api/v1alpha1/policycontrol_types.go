@@ -17,6 +17,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,7 +29,9 @@ type PolicyControlSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	Workspace            string               `json:"workspace,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+	// Name of a cluster-scoped PolicyControlTemplate providing defaults for the fields left empty in this spec.
+	TemplateRef          string               `json:"templateRef,omitempty"`
 	PolicyControlCluster PolicyControlCluster `json:"policy_control_cluster,omitempty"`
 	KyvernoInWorkspace   KyvernoInWorkspace   `json:"kyverno_in_workspace,omitempty"`
 	KyvernoInCluster     KyvernoInCluster     `json:"kyverno_in_cluster,omitempty"`
@@ -42,6 +45,38 @@ type PolicyControlCluster struct {
 	IngressPort         int32               `json:"ingressPort,omitempty"`
 	IngressTLSSecret    TLSSecret           `json:"ingressTLSSecret,omitempty"`
 	KcpKubeConfigSecret KcpKubeConfigSecret `json:"kcpKubeConfigSecret,omitempty"`
+	// KyvernoMode selects whether the workspace gets its own standalone Kyverno ("Standalone", default)
+	// or is served by one of a pool of shared Kyverno instances ("Shared").
+	//+kubebuilder:validation:Enum=Standalone;Shared
+	KyvernoMode   string        `json:"kyvernoMode,omitempty"`
+	SharedKyverno SharedKyverno `json:"sharedKyverno,omitempty"`
+	// InstallSyncer registers the Policy Control Cluster as a SyncTarget of the workspace, importing
+	// its Kyverno APIs through the syncer. The operator needs the RBAC of config/rbac/syncer_role.yaml for it.
+	// An explicit false on a PolicyControl overrides true in its PolicyControlTemplate.
+	InstallSyncer *bool `json:"installSyncer,omitempty"`
+	// Isolation "Namespace" runs the standalone Kyverno of the workspace in a namespace of its own, named after
+	// the workspace, instead of Namespace, with the NetworkPolicy, ResourceQuota and ServiceAccount of
+	// namespaceIsolation. "None" (default) keeps it in Namespace. It does not apply to shared Kyverno instances.
+	//+kubebuilder:validation:Enum=None;Namespace
+	Isolation          string             `json:"isolation,omitempty"`
+	NamespaceIsolation NamespaceIsolation `json:"namespaceIsolation,omitempty"`
+}
+
+type NamespaceIsolation struct {
+	// Namespace of the ingress controller, the only one the NetworkPolicy of the workspace namespace admits
+	// traffic to Kyverno from. Defaults to "ingress-nginx".
+	IngressControllerNamespace string `json:"ingressControllerNamespace,omitempty"`
+	// Hard limits of the ResourceQuota of the workspace namespace. Defaults to 2 pods, 1 service and 2 secrets.
+	// Limits on compute resources also need default requests, e.g. from a LimitRange, as the Kyverno container
+	// does not set any.
+	ResourceQuota corev1.ResourceList `json:"resourceQuota,omitempty"`
+}
+
+type SharedKyverno struct {
+	// Number of shared Kyverno instances (shards) the workspaces are spread over.
+	Shards int32 `json:"shards,omitempty"`
+	// Kyverno image serving multiple workspaces. It has to accept the kubeconfig bundle directory.
+	KyvernoImage string `json:"kyvernoImage,omitempty"`
 }
 
 type KcpKubeConfigSecret struct {
@@ -59,6 +94,55 @@ type KyvernoInWorkspace struct {
 	// Namespace in the target workspace where resources (e.g. cert) needed for Kyverno to start up will be placed.
 	NamespaceForAPIResources string `json:"namespaceForAPIResources,omitempty"`
 	KyvernoImage             string `json:"kyvernoImage,omitempty"`
+	// Version of the Kyverno manifests (CRDs, RBAC) installed into the workspace, matching KyvernoImage.
+	// It selects one of the bundles embedded in the operator and defaults to the newest supported version.
+	// WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR on the operator overrides the bundle for all workspaces.
+	KyvernoVersion string `json:"kyvernoVersion,omitempty"`
+	// APIBinding importing the basic Kubernetes resources (e.g. Pods, Deployments) a standalone Kyverno needs
+	// into the workspace. Defaults to the export "kubernetes" of the workspace "root:policy-control-cluster".
+	KubernetesAPIBinding APIBinding `json:"kubernetesAPIBinding,omitempty"`
+	// Further APIBindings created in the workspace, e.g. for the APIs the policies refer to.
+	AdditionalAPIBindings []APIBinding `json:"additionalAPIBindings,omitempty"`
+	// APIExport publishing the kyverno.io CRDs of the Kyverno manifests, bound into the workspace
+	// instead of installing the CRDs there.
+	KyvernoAPIExport KyvernoAPIExport `json:"kyvernoAPIExport,omitempty"`
+	// FailurePolicy set on all ClusterPolicies and Policies in the workspace, which Kyverno applies to the webhooks
+	// it registers for them: "Fail" blocks admission while Kyverno is unreachable, "Ignore" lets requests through.
+	// Left to the policies when empty.
+	//+kubebuilder:validation:Enum=Fail;Ignore
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// Time the Kyverno Deployment may be unavailable before the policies are switched to "Ignore" (fail open)
+	// until it is available again. Never switched when empty.
+	DegradedFailOpenAfter *metav1.Duration `json:"degradedFailOpenAfter,omitempty"`
+}
+
+// KyvernoAPIExport is the APIExport serving the Kyverno APIs to the workspaces.
+type KyvernoAPIExport struct {
+	// Path of the workspace the APIResourceSchemas and the APIExport are created in.
+	// Defaults to root:policy-control-cluster.
+	Path string `json:"path,omitempty"`
+	// Name of the APIExport. Defaults to "kyverno".
+	Name string `json:"name,omitempty"`
+}
+
+// APIBinding binds an APIExport of another kcp workspace into the target workspace.
+type APIBinding struct {
+	// Name of the APIBinding object. Defaults to the export name.
+	Name string `json:"name,omitempty"`
+	// Path of the workspace providing the APIExport, e.g. root:policy-control-cluster.
+	Path string `json:"path,omitempty"`
+	// Name of the APIExport.
+	ExportName string `json:"exportName,omitempty"`
+	// Permission claims of the APIExport accepted by the binding.
+	AcceptedPermissionClaims []PermissionClaim `json:"acceptedPermissionClaims,omitempty"`
+}
+
+// PermissionClaim identifies resources of the workspace an APIExport asks access to.
+type PermissionClaim struct {
+	Group    string `json:"group,omitempty"`
+	Resource string `json:"resource"`
+	// Identity hash of the APIExport serving the resource, for resources not built into kcp.
+	IdentityHash string `json:"identityHash,omitempty"`
 }
 
 type KyvernoInCluster struct {
@@ -91,6 +175,82 @@ type PolicyControlStatus struct {
 	// are considered a guaranteed API.
 	// PolicyController.status.conditions.Message is a human readable message indicating details about the transition.
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+	// Name of the workspace in the Policy Control Cluster: the name of its standalone Kyverno Deployment, Service
+	// and credentials secret, its ingress path and its key in the bundle of a shared Kyverno. It is chosen on the
+	// first reconcile and kept afterwards.
+	WorkspaceName string `json:"workspaceName,omitempty"`
+	// Shared Kyverno instance the workspace is assigned to when kyvernoMode is "Shared".
+	Shard string `json:"shard,omitempty"`
+	// PolicyReport results of the workspace and its edge clusters, refreshed by the ComplianceSummaries covering it.
+	Compliance *ComplianceCounts `json:"compliance,omitempty"`
+	// Time the compliance counts were last refreshed.
+	ComplianceRefreshTime *metav1.Time `json:"complianceRefreshTime,omitempty"`
+	// Changes computed while the PolicyControl is in dry-run mode.
+	Plan *PolicyControlPlan `json:"plan,omitempty"`
+	// State of the APIBindings created in the workspace.
+	APIBindings []APIBindingStatus `json:"apiBindings,omitempty"`
+	// State of the Kyverno installation on every edge cluster the workspace is synced to.
+	EdgeClusters []EdgeClusterStatus `json:"edgeClusters,omitempty"`
+	// Outcome of the enforcement canary probes of the workspace and of every edge cluster.
+	Enforcement []EnforcementStatus `json:"enforcement,omitempty"`
+	// Failure policy currently set on the Kyverno policies of the workspace.
+	EffectiveFailurePolicy string `json:"effectiveFailurePolicy,omitempty"`
+}
+
+// EnforcementStatus tells whether a canary resource violating the canary policy was caught on a target.
+type EnforcementStatus struct {
+	// "Workspace", or the key of the SyncTarget of an edge cluster.
+	Target string `json:"target"`
+	// Workspace and name of the SyncTarget of an edge cluster, when known.
+	Name string `json:"name,omitempty"`
+	// Whether the canary was denied (workspace) or reported (edge cluster) since the previous probe.
+	Verified bool `json:"verified"`
+	// Time of the last probe.
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+	// Time enforcement was last verified.
+	LastVerifiedTime *metav1.Time `json:"lastVerifiedTime,omitempty"`
+	Message          string       `json:"message,omitempty"`
+}
+
+// EdgeClusterStatus is the state of the Kyverno installation on a physical cluster bound to the workspace
+// through a SyncTarget.
+type EdgeClusterStatus struct {
+	// Key of the SyncTarget, as in the state.workload.kcp.dev/<key> labels of the synced objects.
+	SyncTarget string `json:"syncTarget"`
+	// Name and workspace of the SyncTarget, when it is found in the Location of a Placement of the workspace.
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Pending until the Subscription is synced to the cluster, then Installing until OLM reports the
+	// Kyverno operator at the latest known version, then Installed.
+	Phase string `json:"phase"`
+	// ClusterServiceVersion installed by the Subscription on the cluster.
+	InstalledCSV string `json:"installedCSV,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// APIBindingStatus is the observed state of an APIBinding in the workspace.
+type APIBindingStatus struct {
+	Name       string `json:"name"`
+	Path       string `json:"path,omitempty"`
+	ExportName string `json:"exportName,omitempty"`
+	// Whether the binding reports InitialBindingCompleted and Ready.
+	Ready bool `json:"ready"`
+	// Permission claims of the APIExport the binding does not accept.
+	UnacceptedPermissionClaims []PermissionClaim `json:"unacceptedPermissionClaims,omitempty"`
+	// Reasons the binding is not ready, from its conditions.
+	Message string `json:"message,omitempty"`
+}
+
+// PolicyControlPlan summarizes the changes a reconcile would make to the Policy Control Cluster and the workspace.
+type PolicyControlPlan struct {
+	// ConfigMap in the namespace of the PolicyControl listing the planned change of every object.
+	ConfigMap string `json:"configMap,omitempty"`
+	Create    int32  `json:"create"`
+	Update    int32  `json:"update"`
+	Unchanged int32  `json:"unchanged"`
+	// Objects whose change could not be computed.
+	Failed        int32        `json:"failed"`
+	GeneratedTime *metav1.Time `json:"generatedTime,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,59 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PolicyControlTemplateSpec defines the defaults shared by the PolicyControls referring to the template.
+// Any field set on a PolicyControl takes precedence over the same field in the template.
+type PolicyControlTemplateSpec struct {
+	PolicyControlCluster PolicyControlCluster `json:"policy_control_cluster,omitempty"`
+	KyvernoInWorkspace   KyvernoInWorkspace   `json:"kyverno_in_workspace,omitempty"`
+	KyvernoInCluster     KyvernoInCluster     `json:"kyverno_in_cluster,omitempty"`
+}
+
+// PolicyControlTemplateStatus defines the observed state of PolicyControlTemplate
+type PolicyControlTemplateStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// PolicyControlTemplate is the Schema for the policycontroltemplates API
+type PolicyControlTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PolicyControlTemplateSpec   `json:"spec,omitempty"`
+	Status PolicyControlTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PolicyControlTemplateList contains a list of PolicyControlTemplate
+type PolicyControlTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PolicyControlTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PolicyControlTemplate{}, &PolicyControlTemplateList{})
+}
@@ -22,10 +22,239 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIBinding) DeepCopyInto(out *APIBinding) {
+	*out = *in
+	if in.AcceptedPermissionClaims != nil {
+		in, out := &in.AcceptedPermissionClaims, &out.AcceptedPermissionClaims
+		*out = make([]PermissionClaim, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIBinding.
+func (in *APIBinding) DeepCopy() *APIBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(APIBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIBindingStatus) DeepCopyInto(out *APIBindingStatus) {
+	*out = *in
+	if in.UnacceptedPermissionClaims != nil {
+		in, out := &in.UnacceptedPermissionClaims, &out.UnacceptedPermissionClaims
+		*out = make([]PermissionClaim, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIBindingStatus.
+func (in *APIBindingStatus) DeepCopy() *APIBindingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(APIBindingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComplianceCounts) DeepCopyInto(out *ComplianceCounts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceCounts.
+func (in *ComplianceCounts) DeepCopy() *ComplianceCounts {
+	if in == nil {
+		return nil
+	}
+	out := new(ComplianceCounts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComplianceSummary) DeepCopyInto(out *ComplianceSummary) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceSummary.
+func (in *ComplianceSummary) DeepCopy() *ComplianceSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ComplianceSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ComplianceSummary) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComplianceSummaryList) DeepCopyInto(out *ComplianceSummaryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ComplianceSummary, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceSummaryList.
+func (in *ComplianceSummaryList) DeepCopy() *ComplianceSummaryList {
+	if in == nil {
+		return nil
+	}
+	out := new(ComplianceSummaryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ComplianceSummaryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComplianceSummarySpec) DeepCopyInto(out *ComplianceSummarySpec) {
+	*out = *in
+	if in.PolicyControlSelector != nil {
+		in, out := &in.PolicyControlSelector, &out.PolicyControlSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	out.RefreshInterval = in.RefreshInterval
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceSummarySpec.
+func (in *ComplianceSummarySpec) DeepCopy() *ComplianceSummarySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ComplianceSummarySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComplianceSummaryStatus) DeepCopyInto(out *ComplianceSummaryStatus) {
+	*out = *in
+	out.Total = in.Total
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]PolicyCompliance, len(*in))
+		copy(*out, *in)
+	}
+	if in.Workspaces != nil {
+		in, out := &in.Workspaces, &out.Workspaces
+		*out = make([]WorkspaceCompliance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastRefreshTime != nil {
+		in, out := &in.LastRefreshTime, &out.LastRefreshTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceSummaryStatus.
+func (in *ComplianceSummaryStatus) DeepCopy() *ComplianceSummaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComplianceSummaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeClusterCompliance) DeepCopyInto(out *EdgeClusterCompliance) {
+	*out = *in
+	out.ComplianceCounts = in.ComplianceCounts
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeClusterCompliance.
+func (in *EdgeClusterCompliance) DeepCopy() *EdgeClusterCompliance {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeClusterCompliance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeClusterStatus) DeepCopyInto(out *EdgeClusterStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeClusterStatus.
+func (in *EdgeClusterStatus) DeepCopy() *EdgeClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnforcementStatus) DeepCopyInto(out *EnforcementStatus) {
+	*out = *in
+	if in.LastProbeTime != nil {
+		in, out := &in.LastProbeTime, &out.LastProbeTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastVerifiedTime != nil {
+		in, out := &in.LastVerifiedTime, &out.LastVerifiedTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnforcementStatus.
+func (in *EnforcementStatus) DeepCopy() *EnforcementStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EnforcementStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KcpKubeConfigSecret) DeepCopyInto(out *KcpKubeConfigSecret) {
 	*out = *in
@@ -41,6 +270,21 @@ func (in *KcpKubeConfigSecret) DeepCopy() *KcpKubeConfigSecret {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KyvernoAPIExport) DeepCopyInto(out *KyvernoAPIExport) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KyvernoAPIExport.
+func (in *KyvernoAPIExport) DeepCopy() *KyvernoAPIExport {
+	if in == nil {
+		return nil
+	}
+	out := new(KyvernoAPIExport)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KyvernoCR) DeepCopyInto(out *KyvernoCR) {
 	*out = *in
@@ -77,6 +321,20 @@ func (in *KyvernoInCluster) DeepCopy() *KyvernoInCluster {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KyvernoInWorkspace) DeepCopyInto(out *KyvernoInWorkspace) {
 	*out = *in
+	in.KubernetesAPIBinding.DeepCopyInto(&out.KubernetesAPIBinding)
+	if in.AdditionalAPIBindings != nil {
+		in, out := &in.AdditionalAPIBindings, &out.AdditionalAPIBindings
+		*out = make([]APIBinding, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.KyvernoAPIExport = in.KyvernoAPIExport
+	if in.DegradedFailOpenAfter != nil {
+		in, out := &in.DegradedFailOpenAfter, &out.DegradedFailOpenAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KyvernoInWorkspace.
@@ -89,6 +347,43 @@ func (in *KyvernoInWorkspace) DeepCopy() *KyvernoInWorkspace {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceIsolation) DeepCopyInto(out *NamespaceIsolation) {
+	*out = *in
+	if in.ResourceQuota != nil {
+		in, out := &in.ResourceQuota, &out.ResourceQuota
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceIsolation.
+func (in *NamespaceIsolation) DeepCopy() *NamespaceIsolation {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIsolation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OCIArtifact) DeepCopyInto(out *OCIArtifact) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCIArtifact.
+func (in *OCIArtifact) DeepCopy() *OCIArtifact {
+	if in == nil {
+		return nil
+	}
+	out := new(OCIArtifact)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OperatorGroup) DeepCopyInto(out *OperatorGroup) {
 	*out = *in
@@ -104,12 +399,269 @@ func (in *OperatorGroup) DeepCopy() *OperatorGroup {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PermissionClaim) DeepCopyInto(out *PermissionClaim) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PermissionClaim.
+func (in *PermissionClaim) DeepCopy() *PermissionClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(PermissionClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundle) DeepCopyInto(out *PolicyBundle) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundle.
+func (in *PolicyBundle) DeepCopy() *PolicyBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PolicyBundle) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundleList) DeepCopyInto(out *PolicyBundleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PolicyBundle, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundleList.
+func (in *PolicyBundleList) DeepCopy() *PolicyBundleList {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PolicyBundleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundleRollout) DeepCopyInto(out *PolicyBundleRollout) {
+	*out = *in
+	out.SoakDuration = in.SoakDuration
+	out.RollbackWindow = in.RollbackWindow
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundleRollout.
+func (in *PolicyBundleRollout) DeepCopy() *PolicyBundleRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundleRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundleRolloutStatus) DeepCopyInto(out *PolicyBundleRolloutStatus) {
+	*out = *in
+	if in.AuditStartTime != nil {
+		in, out := &in.AuditStartTime, &out.AuditStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.EnforceStartTime != nil {
+		in, out := &in.EnforceStartTime, &out.EnforceStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.DenialWindowStartTime != nil {
+		in, out := &in.DenialWindowStartTime, &out.DenialWindowStartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundleRolloutStatus.
+func (in *PolicyBundleRolloutStatus) DeepCopy() *PolicyBundleRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundleRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundleSpec) DeepCopyInto(out *PolicyBundleSpec) {
+	*out = *in
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]runtime.RawExtension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.OCIArtifact != nil {
+		in, out := &in.OCIArtifact, &out.OCIArtifact
+		*out = new(OCIArtifact)
+		**out = **in
+	}
+	in.Targets.DeepCopyInto(&out.Targets)
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(PolicyBundleRollout)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundleSpec.
+func (in *PolicyBundleSpec) DeepCopy() *PolicyBundleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundleStatus) DeepCopyInto(out *PolicyBundleStatus) {
+	*out = *in
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]PolicyBundleTargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(PolicyBundleRolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundleStatus.
+func (in *PolicyBundleStatus) DeepCopy() *PolicyBundleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundleTargetStatus) DeepCopyInto(out *PolicyBundleTargetStatus) {
+	*out = *in
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundleTargetStatus.
+func (in *PolicyBundleTargetStatus) DeepCopy() *PolicyBundleTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundleTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyBundleTargets) DeepCopyInto(out *PolicyBundleTargets) {
+	*out = *in
+	if in.PolicyControlSelector != nil {
+		in, out := &in.PolicyControlSelector, &out.PolicyControlSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Workspaces != nil {
+		in, out := &in.Workspaces, &out.Workspaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EdgeNamespaces != nil {
+		in, out := &in.EdgeNamespaces, &out.EdgeNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyBundleTargets.
+func (in *PolicyBundleTargets) DeepCopy() *PolicyBundleTargets {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyBundleTargets)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyCompliance) DeepCopyInto(out *PolicyCompliance) {
+	*out = *in
+	out.ComplianceCounts = in.ComplianceCounts
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyCompliance.
+func (in *PolicyCompliance) DeepCopy() *PolicyCompliance {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyCompliance)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PolicyControl) DeepCopyInto(out *PolicyControl) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -136,6 +688,13 @@ func (in *PolicyControlCluster) DeepCopyInto(out *PolicyControlCluster) {
 	*out = *in
 	out.IngressTLSSecret = in.IngressTLSSecret
 	out.KcpKubeConfigSecret = in.KcpKubeConfigSecret
+	out.SharedKyverno = in.SharedKyverno
+	if in.InstallSyncer != nil {
+		in, out := &in.InstallSyncer, &out.InstallSyncer
+		*out = new(bool)
+		**out = **in
+	}
+	in.NamespaceIsolation.DeepCopyInto(&out.NamespaceIsolation)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyControlCluster.
@@ -180,11 +739,30 @@ func (in *PolicyControlList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyControlPlan) DeepCopyInto(out *PolicyControlPlan) {
+	*out = *in
+	if in.GeneratedTime != nil {
+		in, out := &in.GeneratedTime, &out.GeneratedTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyControlPlan.
+func (in *PolicyControlPlan) DeepCopy() *PolicyControlPlan {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyControlPlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PolicyControlSpec) DeepCopyInto(out *PolicyControlSpec) {
 	*out = *in
-	out.PolicyControlCluster = in.PolicyControlCluster
-	out.KyvernoInWorkspace = in.KyvernoInWorkspace
+	in.PolicyControlCluster.DeepCopyInto(&out.PolicyControlCluster)
+	in.KyvernoInWorkspace.DeepCopyInto(&out.KyvernoInWorkspace)
 	out.KyvernoInCluster = in.KyvernoInCluster
 }
 
@@ -208,6 +786,39 @@ func (in *PolicyControlStatus) DeepCopyInto(out *PolicyControlStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Compliance != nil {
+		in, out := &in.Compliance, &out.Compliance
+		*out = new(ComplianceCounts)
+		**out = **in
+	}
+	if in.ComplianceRefreshTime != nil {
+		in, out := &in.ComplianceRefreshTime, &out.ComplianceRefreshTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(PolicyControlPlan)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.APIBindings != nil {
+		in, out := &in.APIBindings, &out.APIBindings
+		*out = make([]APIBindingStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EdgeClusters != nil {
+		in, out := &in.EdgeClusters, &out.EdgeClusters
+		*out = make([]EdgeClusterStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Enforcement != nil {
+		in, out := &in.Enforcement, &out.Enforcement
+		*out = make([]EnforcementStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyControlStatus.
@@ -220,6 +831,113 @@ func (in *PolicyControlStatus) DeepCopy() *PolicyControlStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyControlTemplate) DeepCopyInto(out *PolicyControlTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyControlTemplate.
+func (in *PolicyControlTemplate) DeepCopy() *PolicyControlTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyControlTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PolicyControlTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyControlTemplateList) DeepCopyInto(out *PolicyControlTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PolicyControlTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyControlTemplateList.
+func (in *PolicyControlTemplateList) DeepCopy() *PolicyControlTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyControlTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PolicyControlTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyControlTemplateSpec) DeepCopyInto(out *PolicyControlTemplateSpec) {
+	*out = *in
+	in.PolicyControlCluster.DeepCopyInto(&out.PolicyControlCluster)
+	in.KyvernoInWorkspace.DeepCopyInto(&out.KyvernoInWorkspace)
+	out.KyvernoInCluster = in.KyvernoInCluster
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyControlTemplateSpec.
+func (in *PolicyControlTemplateSpec) DeepCopy() *PolicyControlTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyControlTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyControlTemplateStatus) DeepCopyInto(out *PolicyControlTemplateStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyControlTemplateStatus.
+func (in *PolicyControlTemplateStatus) DeepCopy() *PolicyControlTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyControlTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SharedKyverno) DeepCopyInto(out *SharedKyverno) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SharedKyverno.
+func (in *SharedKyverno) DeepCopy() *SharedKyverno {
+	if in == nil {
+		return nil
+	}
+	out := new(SharedKyverno)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Subscription) DeepCopyInto(out *Subscription) {
 	*out = *in
@@ -249,3 +967,24 @@ func (in *TLSSecret) DeepCopy() *TLSSecret {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceCompliance) DeepCopyInto(out *WorkspaceCompliance) {
+	*out = *in
+	out.ComplianceCounts = in.ComplianceCounts
+	if in.EdgeClusters != nil {
+		in, out := &in.EdgeClusters, &out.EdgeClusters
+		*out = make([]EdgeClusterCompliance, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceCompliance.
+func (in *WorkspaceCompliance) DeepCopy() *WorkspaceCompliance {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceCompliance)
+	in.DeepCopyInto(out)
+	return out
+}
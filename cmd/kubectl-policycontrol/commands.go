@@ -0,0 +1,291 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+// resyncAnnotation is bumped by "resync". Any change of a PolicyControl triggers a full reconcile.
+const resyncAnnotation = "ibm.github.com/resync"
+
+func newListCommand(o *options) *command {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	o.bind(fs)
+	return &command{flags: fs, run: runList}
+}
+
+func runList(ctx context.Context, o *options, args []string) error {
+	if err := o.connect(); err != nil {
+		return err
+	}
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := o.client.List(ctx, &pcList, o.listOptions()...); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tWORKSPACE\tMODE\tKYVERNO\tREADY\tVIOLATIONS")
+	for i := range pcList.Items {
+		pc := &pcList.Items[i]
+		mode, kyverno, ready := "-", "-", "Unknown"
+		if effective, err := o.effectivePolicyControl(ctx, pc); err == nil {
+			mode = "Standalone"
+			if resources.IsSharedKyverno(effective) {
+				mode = "Shared"
+			}
+			kyverno = resources.KyvernoInstanceName(effective)
+			ready = kyvernoReadiness(ctx, o.client, effective)
+		}
+		violations := "-"
+		if pc.Status.Compliance != nil {
+			violations = fmt.Sprint(pc.Status.Compliance.Fail)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", pc.GetNamespace(), pc.GetName(), pc.Spec.Workspace, mode, kyverno, ready, violations)
+	}
+	return w.Flush()
+}
+
+// kyvernoReadiness reports the ready replicas of the Kyverno Deployment serving the workspace of pc.
+func kyvernoReadiness(ctx context.Context, c client.Client, pc *kcptoolsv1alpha1.PolicyControl) string {
+	var deployment appsv1.Deployment
+	key := client.ObjectKey{Namespace: resources.KyvernoNamespace(pc), Name: resources.KyvernoInstanceName(pc)}
+	if err := c.Get(ctx, key, &deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "NotDeployed"
+		}
+		return "Unknown"
+	}
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return fmt.Sprintf("%d/%d", deployment.Status.ReadyReplicas, replicas)
+}
+
+func newShowCommand(o *options) *command {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	o.bind(fs)
+	return &command{flags: fs, run: runShow}
+}
+
+func runShow(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("show takes exactly one PolicyControl or workspace name")
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+	pc, err := o.findPolicyControl(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	effective, err := o.effectivePolicyControl(ctx, pc)
+	if err != nil {
+		return err
+	}
+	effective.SetManagedFields(nil)
+	effective.SetGroupVersionKind(kcptoolsv1alpha1.GroupVersion.WithKind("PolicyControl"))
+	out, err := yaml.Marshal(effective)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func newWebhookCommand(o *options) *command {
+	fs := flag.NewFlagSet("webhook", flag.ExitOnError)
+	o.bind(fs)
+	return &command{flags: fs, run: runWebhook}
+}
+
+func runWebhook(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("webhook takes exactly one PolicyControl or workspace name")
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+	pc, err := o.findPolicyControl(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	effective, err := o.effectivePolicyControl(ctx, pc)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("URL:                 https://%s\n", resources.AdvertisedURL(effective))
+
+	tlsSecret := effective.Spec.PolicyControlCluster.IngressTLSSecret
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: effective.Spec.PolicyControlCluster.Namespace, Name: tlsSecret.Name}
+	if err := o.client.Get(ctx, key, &secret); err != nil {
+		return fmt.Errorf("failed to get ingress TLS secret %s: %w", key, err)
+	}
+	notAfter, err := resources.CertificateNotAfter(secret.Data[tlsSecret.KeyForCert])
+	if err != nil {
+		return fmt.Errorf("failed to read certificate %s of secret %s: %w", tlsSecret.KeyForCert, key, err)
+	}
+	fmt.Printf("Certificate secret:  %s\n", key)
+	fmt.Printf("Certificate expiry:  %s (%.0f days)\n", notAfter.UTC().Format(time.RFC3339), time.Until(notAfter).Hours()/24)
+	return nil
+}
+
+func newResyncCommand(o *options) *command {
+	fs := flag.NewFlagSet("resync", flag.ExitOnError)
+	o.bind(fs)
+	return &command{flags: fs, run: runResync}
+}
+
+func runResync(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("resync takes exactly one PolicyControl or workspace name")
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+	pc, err := o.findPolicyControl(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(pc.DeepCopy())
+	annotations := pc.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[resyncAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+	pc.SetAnnotations(annotations)
+	if err := o.client.Patch(ctx, pc, patch); err != nil {
+		return err
+	}
+	fmt.Printf("policycontrol %s/%s resync requested\n", pc.GetNamespace(), pc.GetName())
+	return nil
+}
+
+type logsOptions struct {
+	follow bool
+	tail   int64
+}
+
+func newLogsCommand(o *options) *command {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	o.bind(fs)
+	lo := &logsOptions{}
+	fs.BoolVar(&lo.follow, "f", false, "Stream the logs.")
+	fs.BoolVar(&lo.follow, "follow", false, "Stream the logs.")
+	fs.Int64Var(&lo.tail, "tail", 100, "Lines of recent log to print per pod, -1 for all.")
+	return &command{flags: fs, run: func(ctx context.Context, o *options, args []string) error {
+		return runLogs(ctx, o, lo, args)
+	}}
+}
+
+func runLogs(ctx context.Context, o *options, lo *logsOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("logs takes exactly one PolicyControl or workspace name")
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+	pc, err := o.findPolicyControl(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	effective, err := o.effectivePolicyControl(ctx, pc)
+	if err != nil {
+		return err
+	}
+	namespace := resources.KyvernoNamespace(effective)
+	var pods corev1.PodList
+	if err := o.client.List(ctx, &pods, client.InNamespace(namespace), client.MatchingLabels(resources.KyvernoPodLabels(effective))); err != nil {
+		return err
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("no Kyverno pod found for workspace %s in namespace %s", effective.Spec.Workspace, namespace)
+	}
+	if resources.IsSharedKyverno(effective) {
+		fmt.Fprintf(os.Stderr, "workspace %s is served by shared Kyverno %s, its logs cover all workspaces of the shard\n",
+			effective.Spec.Workspace, resources.KyvernoInstanceName(effective))
+	}
+	clientset, err := o.clientset()
+	if err != nil {
+		return err
+	}
+
+	logOptions := &corev1.PodLogOptions{Follow: lo.follow}
+	if lo.tail >= 0 {
+		logOptions.TailLines = &lo.tail
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, pod := range pods.Items {
+		prefix := ""
+		if len(pods.Items) > 1 {
+			prefix = fmt.Sprintf("[%s] ", pod.GetName())
+		}
+		wg.Add(1)
+		go func(pod string, prefix string) {
+			defer wg.Done()
+			stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, logOptions).Stream(ctx)
+			if err == nil {
+				err = copyLines(os.Stdout, stream, prefix, &mu)
+				stream.Close()
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("pod %s: %w", pod, err))
+				mu.Unlock()
+			}
+		}(pod.GetName(), prefix)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// copyLines writes r line by line to w so that the logs of concurrent pods do not interleave mid-line.
+func copyLines(w io.Writer, r io.Reader, prefix string, mu *sync.Mutex) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		mu.Lock()
+		fmt.Fprintf(w, "%s%s\n", prefix, scanner.Text())
+		mu.Unlock()
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,201 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// kubectl-policycontrol is a kubectl plugin for inspecting and operating PolicyControls.
+// Install it on the PATH and run it as "kubectl policycontrol <command>".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(kcptoolsv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(operatorsv1.AddToScheme(scheme))
+	utilruntime.Must(operatorsv1alpha1.AddToScheme(scheme))
+}
+
+const usage = `kubectl policycontrol inspects and operates PolicyControls.
+
+Usage:
+  kubectl policycontrol <command> [flags] [args]
+
+Commands:
+  list              List the workspaces and the readiness of their Kyverno
+  show NAME         Show the effective spec of a PolicyControl after the template defaults
+  webhook NAME      Print the advertised webhook URL and the ingress certificate expiry
+  resync NAME       Force the operator to reconcile a PolicyControl
+  render -f FILE    Render the manifests generated for a PolicyControl YAML, without a cluster
+  logs NAME         Print the logs of the Kyverno serving the workspace
+
+NAME is the name of a PolicyControl or the workspace it manages.
+Run "kubectl policycontrol <command> -h" for the flags of a command.
+`
+
+type command struct {
+	flags *flag.FlagSet
+	run   func(ctx context.Context, o *options, args []string) error
+}
+
+// options are the connection flags shared by the commands talking to the cluster.
+type options struct {
+	kubeconfig    string
+	context       string
+	namespace     string
+	allNamespaces bool
+
+	restConfig *rest.Config
+	client     client.Client
+}
+
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file of the Policy Control Cluster.")
+	fs.StringVar(&o.context, "context", "", "Name of the kubeconfig context to use.")
+	fs.StringVar(&o.namespace, "namespace", "", "Namespace of the PolicyControls. Defaults to the namespace of the kubeconfig context.")
+	fs.StringVar(&o.namespace, "n", "", "Shorthand for --namespace.")
+	fs.BoolVar(&o.allNamespaces, "A", false, "Look for PolicyControls in all namespaces.")
+}
+
+// connect loads the kubeconfig and creates the client of the Policy Control Cluster, unless a client is set.
+func (o *options) connect() error {
+	if o.client != nil {
+		return nil
+	}
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: o.context})
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if o.namespace == "" {
+		if o.namespace, _, err = clientConfig.Namespace(); err != nil {
+			return fmt.Errorf("failed to get namespace from kubeconfig: %w", err)
+		}
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	o.restConfig = cfg
+	o.client = c
+	return nil
+}
+
+func (o *options) clientset() (*kubernetes.Clientset, error) {
+	return kubernetes.NewForConfig(o.restConfig)
+}
+
+// listOptions restricts a list to the selected namespace unless all namespaces are requested.
+func (o *options) listOptions() []client.ListOption {
+	if o.allNamespaces {
+		return nil
+	}
+	return []client.ListOption{client.InNamespace(o.namespace)}
+}
+
+// findPolicyControl returns the PolicyControl called name or, failing that, the one managing the workspace name.
+func (o *options) findPolicyControl(ctx context.Context, name string) (*kcptoolsv1alpha1.PolicyControl, error) {
+	if !o.allNamespaces {
+		var pc kcptoolsv1alpha1.PolicyControl
+		err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, &pc)
+		if err == nil {
+			return &pc, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := o.client.List(ctx, &pcList, o.listOptions()...); err != nil {
+		return nil, err
+	}
+	var found []kcptoolsv1alpha1.PolicyControl
+	for _, pc := range pcList.Items {
+		if pc.GetName() == name || pc.Spec.Workspace == name {
+			found = append(found, pc)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no PolicyControl or workspace %q found", name)
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d PolicyControls, select one with --namespace", name, len(found))
+	}
+}
+
+// effectivePolicyControl merges the PolicyControlTemplate referred to by pc, the same way the operator does.
+func (o *options) effectivePolicyControl(ctx context.Context, pc *kcptoolsv1alpha1.PolicyControl) (*kcptoolsv1alpha1.PolicyControl, error) {
+	if pc.Spec.TemplateRef == "" {
+		return pc.DeepCopy(), nil
+	}
+	var tmpl kcptoolsv1alpha1.PolicyControlTemplate
+	if err := o.client.Get(ctx, client.ObjectKey{Name: pc.Spec.TemplateRef}, &tmpl); err != nil {
+		return nil, fmt.Errorf("failed to get PolicyControlTemplate %s: %w", pc.Spec.TemplateRef, err)
+	}
+	return resources.MergeTemplate(pc, &tmpl)
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	o := &options{}
+	commands := map[string]*command{
+		"list":    newListCommand(o),
+		"show":    newShowCommand(o),
+		"webhook": newWebhookCommand(o),
+		"resync":  newResyncCommand(o),
+		"render":  newRenderCommand(),
+		"logs":    newLogsCommand(o),
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err := cmd.flags.Parse(os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+	if err := cmd.run(context.Background(), o, cmd.flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
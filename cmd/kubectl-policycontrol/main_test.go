@@ -0,0 +1,192 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+func policyControl(namespace, name, workspace string) *kcptoolsv1alpha1.PolicyControl {
+	return &kcptoolsv1alpha1.PolicyControl{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: kcptoolsv1alpha1.PolicyControlSpec{
+			Workspace:            workspace,
+			PolicyControlCluster: kcptoolsv1alpha1.PolicyControlCluster{Namespace: "pcc"},
+		},
+	}
+}
+
+// newOptions returns the options of a command connected to a fake cluster holding objs.
+func newOptions(namespace string, objs ...client.Object) *options {
+	return &options{
+		namespace: namespace,
+		client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+	}
+}
+
+// captureStdout returns what run prints to stdout.
+func captureStdout(t *testing.T, run func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	runErr := run()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runErr != nil {
+		t.Fatalf("command failed: %v", runErr)
+	}
+	return string(out)
+}
+
+func TestFindPolicyControl(t *testing.T) {
+	objs := []client.Object{
+		policyControl("tenants", "edge1", "root:edge1"),
+		policyControl("tenants", "edge2", "root:edge2"),
+		policyControl("other", "edge2", "root:other:edge2"),
+	}
+	tests := []struct {
+		name          string
+		namespace     string
+		allNamespaces bool
+		arg           string
+		want          string
+		wantErr       string
+	}{
+		{name: "by name", namespace: "tenants", arg: "edge1", want: "tenants/edge1"},
+		{name: "by workspace", namespace: "tenants", arg: "root:edge2", want: "tenants/edge2"},
+		{name: "by workspace in all namespaces", allNamespaces: true, arg: "root:other:edge2", want: "other/edge2"},
+		{name: "ambiguous name", allNamespaces: true, arg: "edge2", wantErr: `"edge2" matches 2 PolicyControls`},
+		{name: "not found", namespace: "tenants", arg: "root:edge3", wantErr: `no PolicyControl or workspace "root:edge3" found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(tt.namespace, objs...)
+			o.allNamespaces = tt.allNamespaces
+			pc, err := o.findPolicyControl(context.Background(), tt.arg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("findPolicyControl() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findPolicyControl() error = %v", err)
+			}
+			if got := pc.GetNamespace() + "/" + pc.GetName(); got != tt.want {
+				t.Errorf("findPolicyControl() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunList(t *testing.T) {
+	shared := policyControl("tenants", "edge2", "root:edge2")
+	shared.Spec.TemplateRef = "shared"
+	replicas := int32(2)
+	o := newOptions("tenants",
+		policyControl("tenants", "edge1", "root:edge1"),
+		shared,
+		&kcptoolsv1alpha1.PolicyControlTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+			Spec: kcptoolsv1alpha1.PolicyControlTemplateSpec{
+				PolicyControlCluster: kcptoolsv1alpha1.PolicyControlCluster{KyvernoMode: resources.KyvernoModeShared},
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "pcc", Name: "root--edge1"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+	)
+
+	out := captureStdout(t, func() error { return runList(context.Background(), o, nil) })
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("runList() printed %d lines, want 3:\n%s", len(lines), out)
+	}
+	if got := strings.Fields(lines[1]); strings.Join(got, " ") != "tenants edge1 root:edge1 Standalone root--edge1 1/2 -" {
+		t.Errorf("runList() line of edge1 = %v", got)
+	}
+	if got := strings.Fields(lines[2]); got[3] != "Shared" || got[5] != "NotDeployed" {
+		t.Errorf("runList() line of edge2 = %v, want a shared Kyverno that is not deployed", got)
+	}
+}
+
+func TestRunShow(t *testing.T) {
+	pc := policyControl("tenants", "edge1", "root:edge1")
+	pc.Spec.TemplateRef = "defaults"
+	o := newOptions("tenants", pc, &kcptoolsv1alpha1.PolicyControlTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "defaults"},
+		Spec: kcptoolsv1alpha1.PolicyControlTemplateSpec{
+			KyvernoInWorkspace: kcptoolsv1alpha1.KyvernoInWorkspace{KyvernoImage: "kyverno-template:1.0.0"},
+		},
+	})
+
+	out := captureStdout(t, func() error { return runShow(context.Background(), o, []string{"root:edge1"}) })
+	for _, want := range []string{"kind: PolicyControl", "workspace: root:edge1", "kyverno-template:1.0.0"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("runShow() output misses %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunResync(t *testing.T) {
+	o := newOptions("tenants", policyControl("tenants", "edge1", "root:edge1"))
+
+	out := captureStdout(t, func() error { return runResync(context.Background(), o, []string{"edge1"}) })
+	if !strings.Contains(out, "policycontrol tenants/edge1 resync requested") {
+		t.Errorf("runResync() output = %q", out)
+	}
+	var pc kcptoolsv1alpha1.PolicyControl
+	if err := o.client.Get(context.Background(), client.ObjectKey{Namespace: "tenants", Name: "edge1"}, &pc); err != nil {
+		t.Fatal(err)
+	}
+	if pc.GetAnnotations()[resyncAnnotation] == "" {
+		t.Errorf("annotations = %v, want %s", pc.GetAnnotations(), resyncAnnotation)
+	}
+}
+
+func TestCopyLines(t *testing.T) {
+	var out strings.Builder
+	if err := copyLines(&out, strings.NewReader("first\nsecond"), "[pod] ", &sync.Mutex{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "[pod] first\n[pod] second\n"; got != want {
+		t.Errorf("copyLines() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/IBM/policy-control-operator/render"
+)
+
+type renderOptions struct {
+	files     []string
+	template  string
+	opts      render.Options
+	outputDir string
+}
+
+func newRenderCommand() *command {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	ro := &renderOptions{}
+	fs.Func("f", "YAML file with PolicyControls to render, \"-\" for stdin. Can be repeated.", func(v string) error {
+		ro.files = append(ro.files, v)
+		return nil
+	})
+	fs.StringVar(&ro.template, "template", "", "YAML file with the PolicyControlTemplates the PolicyControls refer to.")
+	fs.StringVar(&ro.opts.KyvernoManifestsDir, "kyverno-manifests", os.Getenv("WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR"),
+		"Directory of Kyverno manifests overriding the embedded bundle selected by the PolicyControls.")
+	fs.StringVar(&ro.opts.APIBindingsManifest, "apibindings-manifest", os.Getenv("WORKSPACE_APIBINDINGS_MANIFEST"),
+		"APIBindings manifest overriding the embedded one.")
+	fs.StringVar(&ro.outputDir, "output-dir", "", "Write one file per target cluster into this directory instead of printing to stdout.")
+	return &command{flags: fs, run: func(ctx context.Context, _ *options, args []string) error {
+		return runRender(ro)
+	}}
+}
+
+func runRender(ro *renderOptions) error {
+	if len(ro.files) == 0 {
+		return fmt.Errorf("render needs a PolicyControl YAML, set it with -f")
+	}
+	files := ro.files
+	if ro.template != "" {
+		files = append(files, ro.template)
+	}
+	pcs, templates, err := render.ReadFiles(files)
+	if err != nil {
+		return err
+	}
+	if len(pcs) == 0 {
+		return fmt.Errorf("no PolicyControl found in the given files")
+	}
+	ro.opts.Templates = templates
+	groups, err := render.Render(pcs, ro.opts)
+	if err != nil {
+		return err
+	}
+	if ro.outputDir != "" {
+		return render.WriteDir(ro.outputDir, groups)
+	}
+	return render.Write(os.Stdout, groups)
+}
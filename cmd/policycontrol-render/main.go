@@ -0,0 +1,76 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// policycontrol-render prints the manifests the operator would create for PolicyControls, grouped by target cluster,
+// so that they can be applied by a GitOps tool such as Argo CD. No cluster is contacted.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/policy-control-operator/render"
+)
+
+// fileList collects the values of a repeated flag.
+type fileList []string
+
+func (f *fileList) String() string     { return strings.Join(*f, ",") }
+func (f *fileList) Set(v string) error { *f = append(*f, v); return nil }
+
+func main() {
+	var (
+		files     fileList
+		opts      render.Options
+		outputDir string
+	)
+	flag.Var(&files, "f", "YAML file with PolicyControls and the PolicyControlTemplates they refer to, \"-\" for stdin. Can be repeated.")
+	flag.StringVar(&opts.KyvernoManifestsDir, "kyverno-manifests", os.Getenv("WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR"),
+		"Directory of Kyverno manifests overriding the embedded bundle selected by the PolicyControls.")
+	flag.StringVar(&opts.APIBindingsManifest, "apibindings-manifest", os.Getenv("WORKSPACE_APIBINDINGS_MANIFEST"),
+		"APIBindings manifest overriding the embedded one.")
+	flag.StringVar(&outputDir, "output-dir", "", "Write one file per target cluster into this directory instead of printing to stdout.")
+	flag.Parse()
+
+	if err := run(files, opts, outputDir); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(files []string, opts render.Options, outputDir string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("no PolicyControl YAML given, set it with -f")
+	}
+	pcs, templates, err := render.ReadFiles(files)
+	if err != nil {
+		return err
+	}
+	if len(pcs) == 0 {
+		return fmt.Errorf("no PolicyControl found in %s", strings.Join(files, ", "))
+	}
+	opts.Templates = templates
+	groups, err := render.Render(pcs, opts)
+	if err != nil {
+		return err
+	}
+	if outputDir != "" {
+		return render.WriteDir(outputDir, groups)
+	}
+	return render.Write(os.Stdout, groups)
+}
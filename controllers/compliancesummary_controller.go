@@ -0,0 +1,287 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+const (
+	defaultComplianceRefreshInterval = 5 * time.Minute
+
+	// maxConcurrentReportCollections bounds the workspaces whose PolicyReports are collected at the same time.
+	maxConcurrentReportCollections = 8
+
+	// syncTargetStateLabelPrefix prefixes the label kcp sets on the resources synced with a SyncTarget.
+	syncTargetStateLabelPrefix = "state.workload.kcp.dev/"
+)
+
+// ComplianceSummaryReconciler reconciles a ComplianceSummary object
+type ComplianceSummaryReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=ibm.github.com,resources=compliancesummaries,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=ibm.github.com,resources=compliancesummaries/status,verbs=get;update;patch
+
+// Reconcile collects the PolicyReports of the workspaces of the selected PolicyControls and aggregates their
+// results per policy, workspace and edge cluster into the ComplianceSummary and the PolicyControl status.
+func (r *ComplianceSummaryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var summary kcptoolsv1alpha1.ComplianceSummary
+	if err := r.Get(ctx, req.NamespacedName, &summary); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	refreshInterval := summary.Spec.RefreshInterval.Duration
+	if refreshInterval == 0 {
+		refreshInterval = defaultComplianceRefreshInterval
+	}
+
+	opts := []client.ListOption{}
+	if summary.Spec.PolicyControlSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(summary.Spec.PolicyControlSelector)
+		if err != nil {
+			logger.Error(err, "invalid policyControlSelector")
+			return ctrl.Result{}, err
+		}
+		opts = append(opts, client.MatchingLabelsSelector{Selector: selector})
+	}
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := r.List(ctx, &pcList, opts...); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	var total kcptoolsv1alpha1.ComplianceCounts
+	perPolicy := map[string]*kcptoolsv1alpha1.ComplianceCounts{}
+	workspaces := []kcptoolsv1alpha1.WorkspaceCompliance{}
+	failed := 0
+	collected := r.collectPolicyReports(ctx, logger, pcList.Items)
+	for i, pc := range pcList.Items {
+		ws := kcptoolsv1alpha1.WorkspaceCompliance{
+			Workspace:     pc.Spec.Workspace,
+			PolicyControl: fmt.Sprintf("%s/%s", pc.GetNamespace(), pc.GetName()),
+		}
+		reports, err := collected[i].reports, collected[i].err
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("failed to collect PolicyReports of workspace %s", pc.Spec.Workspace))
+			ws.Message = err.Error()
+			workspaces = append(workspaces, ws)
+			failed++
+			continue
+		}
+
+		edges := map[string]*kcptoolsv1alpha1.ComplianceCounts{}
+		for _, report := range reports {
+			counts := &ws.ComplianceCounts
+			if syncTarget := reportSyncTarget(report); syncTarget != "" {
+				if edges[syncTarget] == nil {
+					edges[syncTarget] = &kcptoolsv1alpha1.ComplianceCounts{}
+				}
+				counts = edges[syncTarget]
+			}
+			for _, result := range policyReportResults(report) {
+				policy := fmt.Sprint(result["policy"])
+				if perPolicy[policy] == nil {
+					perPolicy[policy] = &kcptoolsv1alpha1.ComplianceCounts{}
+				}
+				outcome := fmt.Sprint(result["result"])
+				addResult(counts, outcome)
+				addResult(perPolicy[policy], outcome)
+				addResult(&total, outcome)
+			}
+		}
+		for _, syncTarget := range sortedKeys(edges) {
+			ws.EdgeClusters = append(ws.EdgeClusters, kcptoolsv1alpha1.EdgeClusterCompliance{
+				SyncTarget:       syncTarget,
+				ComplianceCounts: *edges[syncTarget],
+			})
+		}
+		workspaces = append(workspaces, ws)
+
+		if err := r.updatePolicyControlCompliance(ctx, pc, ws, now); err != nil {
+			logger.Error(err, fmt.Sprintf("failed to update compliance of PolicyControl %s", ws.PolicyControl))
+		}
+	}
+
+	policies := []kcptoolsv1alpha1.PolicyCompliance{}
+	for _, policy := range sortedKeys(perPolicy) {
+		policies = append(policies, kcptoolsv1alpha1.PolicyCompliance{Policy: policy, ComplianceCounts: *perPolicy[policy]})
+	}
+
+	summary.Status.Total = total
+	summary.Status.Policies = policies
+	summary.Status.Workspaces = workspaces
+	summary.Status.LastRefreshTime = &now
+	condition := metav1.Condition{
+		Type:    ConditionTypeReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Aggregated",
+		Message: fmt.Sprintf("PolicyReports of %d workspaces aggregated", len(workspaces)),
+	}
+	if failed > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CollectionFailed"
+		condition.Message = fmt.Sprintf("PolicyReports of %d of %d workspaces could not be collected", failed, len(workspaces))
+	}
+	meta.SetStatusCondition(&summary.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, &summary); err != nil {
+		logger.Error(err, "failed to update status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: refreshInterval}, nil
+}
+
+// workspaceReports holds the PolicyReports collected from the workspace of a PolicyControl, or the error
+// collecting them.
+type workspaceReports struct {
+	reports []unstructured.Unstructured
+	err     error
+}
+
+// collectPolicyReports collects the PolicyReports of the workspaces of pcs concurrently, at most
+// maxConcurrentReportCollections at a time, and returns them in the order of pcs.
+func (r *ComplianceSummaryReconciler) collectPolicyReports(
+	ctx context.Context,
+	logger logr.Logger,
+	pcs []kcptoolsv1alpha1.PolicyControl,
+) []workspaceReports {
+	collected := make([]workspaceReports, len(pcs))
+	slots := make(chan struct{}, maxConcurrentReportCollections)
+	var wg sync.WaitGroup
+	for i := range pcs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			collected[i].reports, collected[i].err = r.workspacePolicyReports(ctx, logger, pcs[i])
+		}(i)
+	}
+	wg.Wait()
+	return collected
+}
+
+// workspacePolicyReports lists the PolicyReports and ClusterPolicyReports in the workspace of pc.
+func (r *ComplianceSummaryReconciler) workspacePolicyReports(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) ([]unstructured.Unstructured, error) {
+	pc, err := applyTemplate(ctx, r.Client, logger, pc)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := getPolicyControlWorkspaceConfigs(ctx, r.Client, logger, pc)
+	if err != nil {
+		return nil, err
+	}
+	dyClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return listPolicyReports(ctx, dyClient)
+}
+
+// updatePolicyControlCompliance records the counts of the workspace and its edge clusters in the PolicyControl status.
+// pc comes from the list of the reconcile and may be stale, so only the compliance fields are merge patched.
+func (r *ComplianceSummaryReconciler) updatePolicyControlCompliance(
+	ctx context.Context,
+	pc kcptoolsv1alpha1.PolicyControl,
+	ws kcptoolsv1alpha1.WorkspaceCompliance,
+	now metav1.Time,
+) error {
+	counts := ws.ComplianceCounts
+	for _, edge := range ws.EdgeClusters {
+		counts.Pass += edge.Pass
+		counts.Fail += edge.Fail
+		counts.Warn += edge.Warn
+		counts.Error += edge.Error
+		counts.Skip += edge.Skip
+	}
+	if pc.Status.Compliance != nil && equality.Semantic.DeepEqual(*pc.Status.Compliance, counts) {
+		return nil
+	}
+	base := pc.DeepCopy()
+	pc.Status.Compliance = &counts
+	pc.Status.ComplianceRefreshTime = &now
+	return r.Status().Patch(ctx, &pc, client.MergeFrom(base))
+}
+
+// reportSyncTarget returns the SyncTarget of the edge cluster a PolicyReport was synced from, or "" for
+// the reports produced in the workspace itself.
+func reportSyncTarget(report unstructured.Unstructured) string {
+	for k := range report.GetLabels() {
+		if strings.HasPrefix(k, syncTargetStateLabelPrefix) {
+			return strings.TrimPrefix(k, syncTargetStateLabelPrefix)
+		}
+	}
+	return ""
+}
+
+func addResult(counts *kcptoolsv1alpha1.ComplianceCounts, result string) {
+	switch result {
+	case "pass":
+		counts.Pass++
+	case "fail":
+		counts.Fail++
+	case "warn":
+		counts.Warn++
+	case "error":
+		counts.Error++
+	case "skip":
+		counts.Skip++
+	}
+}
+
+func sortedKeys(m map[string]*kcptoolsv1alpha1.ComplianceCounts) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ComplianceSummaryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kcptoolsv1alpha1.ComplianceSummary{}).
+		Complete(r)
+}
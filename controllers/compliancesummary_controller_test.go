@@ -0,0 +1,185 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+var (
+	policyReportsAPI        = fakeAPI{policyReportGVR, "PolicyReport", true}
+	clusterPolicyReportsAPI = fakeAPI{clusterPolicyReportGVR, "ClusterPolicyReport", false}
+)
+
+// staleListClient changes the status of the PolicyControls it lists right after listing them, so that the
+// reconciler works on stale copies as it does when a PolicyControl is reconciled concurrently.
+type staleListClient struct {
+	client.Client
+}
+
+func (c staleListClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	pcList, ok := list.(*kcptoolsv1alpha1.PolicyControlList)
+	if !ok {
+		return nil
+	}
+	for _, pc := range pcList.Items {
+		live := pc.DeepCopy()
+		live.Status.WorkspaceName = "renamed-" + live.Name
+		if err := c.Client.Status().Update(ctx, live); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// policyReport returns a PolicyReport, or a ClusterPolicyReport without namespace, with a result per policy
+// and outcome of results.
+func policyReport(namespace, name string, labels map[string]interface{}, results ...[2]string) *unstructured.Unstructured {
+	kind := "ClusterPolicyReport"
+	if namespace != "" {
+		kind = "PolicyReport"
+	}
+	items := []interface{}{}
+	for _, result := range results {
+		items = append(items, map[string]interface{}{"policy": result[0], "result": result[1]})
+	}
+	metadata := map[string]interface{}{"name": name, "labels": labels}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "wgpolicyk8s.io/v1alpha2",
+		"kind":       kind,
+		"metadata":   metadata,
+		"results":    items,
+	}}
+}
+
+var _ = Describe("ComplianceSummary", func() {
+	var (
+		env        *policyControlEnv
+		reconciler *ComplianceSummaryReconciler
+		summary    *kcptoolsv1alpha1.ComplianceSummary
+	)
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		reconciler = &ComplianceSummaryReconciler{Client: staleListClient{env.pcc}, Scheme: scheme.Scheme}
+		for _, path := range []string{"root:team-a", "root:team-b"} {
+			env.kcp.addWorkspace(path, policyReportsAPI, clusterPolicyReportsAPI)
+			env.kcp.create(path, namespaceGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{"name": "apps"},
+			}})
+		}
+		env.kcp.create("root:team-a", policyReportGVR, policyReport("apps", "polr-apps", nil,
+			[2]string{"require-labels", "pass"}, [2]string{"require-labels", "fail"}, [2]string{"disallow-latest", "pass"}))
+		env.kcp.create("root:team-a", clusterPolicyReportGVR, policyReport("", "clusterpolr",
+			map[string]interface{}{syncTargetStateLabelPrefix + "cluster-a": syncTargetStateSync},
+			[2]string{"require-labels", "warn"}, [2]string{"disallow-latest", "skip"}))
+		env.kcp.create("root:team-b", policyReportGVR, policyReport("apps", "polr-apps", nil,
+			[2]string{"require-labels", "error"}))
+
+		for _, pc := range []*kcptoolsv1alpha1.PolicyControl{
+			newTestPolicyControl("pccr-team-a", "root:team-a"),
+			newTestPolicyControl("pccr-team-b", "root:team-b"),
+			newTestPolicyControl("pccr-gone", "root:gone"),
+		} {
+			pc.Labels = map[string]string{"compliance": "tracked"}
+			Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		}
+		untracked := newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, untracked)).To(Succeed())
+
+		summary = &kcptoolsv1alpha1.ComplianceSummary{
+			ObjectMeta: metav1.ObjectMeta{Name: "fleet", Namespace: testNamespace},
+			Spec: kcptoolsv1alpha1.ComplianceSummarySpec{
+				PolicyControlSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"compliance": "tracked"}},
+			},
+		}
+		Expect(env.pcc.Create(env.ctx, summary)).To(Succeed())
+	})
+
+	It("aggregates the PolicyReports of the selected workspaces and their edge clusters", func() {
+		result, err := reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(summary)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(defaultComplianceRefreshInterval))
+
+		var live kcptoolsv1alpha1.ComplianceSummary
+		Expect(env.pcc.Get(env.ctx, client.ObjectKeyFromObject(summary), &live)).To(Succeed())
+		Expect(live.Status.Total).To(Equal(kcptoolsv1alpha1.ComplianceCounts{Pass: 2, Fail: 1, Warn: 1, Error: 1, Skip: 1}))
+		Expect(live.Status.Policies).To(Equal([]kcptoolsv1alpha1.PolicyCompliance{
+			{Policy: "disallow-latest", ComplianceCounts: kcptoolsv1alpha1.ComplianceCounts{Pass: 1, Skip: 1}},
+			{Policy: "require-labels", ComplianceCounts: kcptoolsv1alpha1.ComplianceCounts{Pass: 1, Fail: 1, Warn: 1, Error: 1}},
+		}))
+
+		By("recording the counts of each workspace and its edge clusters")
+		Expect(live.Status.Workspaces).To(HaveLen(3))
+		workspaces := map[string]kcptoolsv1alpha1.WorkspaceCompliance{}
+		for _, ws := range live.Status.Workspaces {
+			workspaces[ws.Workspace] = ws
+		}
+		Expect(workspaces["root:team-a"].ComplianceCounts).To(Equal(kcptoolsv1alpha1.ComplianceCounts{Pass: 2, Fail: 1}))
+		Expect(workspaces["root:team-a"].EdgeClusters).To(Equal([]kcptoolsv1alpha1.EdgeClusterCompliance{
+			{SyncTarget: "cluster-a", ComplianceCounts: kcptoolsv1alpha1.ComplianceCounts{Warn: 1, Skip: 1}},
+		}))
+		Expect(workspaces["root:team-b"].ComplianceCounts).To(Equal(kcptoolsv1alpha1.ComplianceCounts{Error: 1}))
+		Expect(workspaces["root:gone"].Message).NotTo(BeEmpty())
+		Expect(workspaces).NotTo(HaveKey("root:edge1"))
+
+		condition := meta.FindStatusCondition(live.Status.Conditions, ConditionTypeReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("CollectionFailed"))
+		Expect(condition.Message).To(Equal("PolicyReports of 1 of 3 workspaces could not be collected"))
+	})
+
+	It("patches the compliance of PolicyControls changed since they were listed", func() {
+		_, err := reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(summary)})
+		Expect(err).NotTo(HaveOccurred())
+
+		teamA := env.latest(newTestPolicyControl("pccr-team-a", "root:team-a"))
+		Expect(teamA.Status.Compliance).To(Equal(&kcptoolsv1alpha1.ComplianceCounts{Pass: 2, Fail: 1, Warn: 1, Skip: 1}))
+		Expect(teamA.Status.ComplianceRefreshTime).NotTo(BeNil())
+		Expect(teamA.Status.WorkspaceName).To(Equal("renamed-pccr-team-a"))
+		teamB := env.latest(newTestPolicyControl("pccr-team-b", "root:team-b"))
+		Expect(teamB.Status.Compliance).To(Equal(&kcptoolsv1alpha1.ComplianceCounts{Error: 1}))
+		Expect(teamB.Status.WorkspaceName).To(Equal("renamed-pccr-team-b"))
+		gone := env.latest(newTestPolicyControl("pccr-gone", "root:gone"))
+		Expect(gone.Status.Compliance).To(BeNil())
+
+		By("leaving unchanged counts alone")
+		refreshed := teamA.Status.ComplianceRefreshTime
+		_, err = reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(summary)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env.latest(teamA).Status.ComplianceRefreshTime).To(Equal(refreshed))
+	})
+})
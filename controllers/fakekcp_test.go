@@ -0,0 +1,788 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeAPI is a resource served by a logical cluster of fakeKcp.
+type fakeAPI struct {
+	schema.GroupVersionResource
+	Kind       string
+	Namespaced bool
+}
+
+// APIs kcp serves in every workspace
+var fakeKcpBuiltinAPIs = []fakeAPI{
+	{schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, "Namespace", false},
+	{schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "ConfigMap", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "Secret", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, "ServiceAccount", true},
+	{schema.GroupVersionResource{Version: "v1", Resource: "events"}, "Event", true},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, "ClusterRole", false},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}, "ClusterRoleBinding", false},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, "Role", true},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, "RoleBinding", true},
+	{schema.GroupVersionResource{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingwebhookconfigurations"}, "ValidatingWebhookConfiguration", false},
+	{schema.GroupVersionResource{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "mutatingwebhookconfigurations"}, "MutatingWebhookConfiguration", false},
+	{schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}, "CustomResourceDefinition", false},
+	{apiResourceSchemaResource, "APIResourceSchema", false},
+	{apiExportResource, "APIExport", false},
+	{schema.GroupVersionResource{Group: "apis.kcp.dev", Version: "v1alpha1", Resource: "apibindings"}, "APIBinding", false},
+	{schema.GroupVersionResource{Group: "tenancy.kcp.dev", Version: "v1beta1", Resource: "workspaces"}, "Workspace", false},
+	{schema.GroupVersionResource{Group: "scheduling.kcp.dev", Version: "v1alpha1", Resource: "placements"}, "Placement", false},
+	{schema.GroupVersionResource{Group: "scheduling.kcp.dev", Version: "v1alpha1", Resource: "locations"}, "Location", false},
+	{schema.GroupVersionResource{Group: "workload.kcp.dev", Version: "v1alpha1", Resource: "synctargets"}, "SyncTarget", false},
+}
+
+var (
+	namespaceAPI = fakeKcpBuiltinAPIs[0]
+	workspaceGVR = schema.GroupVersionResource{Group: "tenancy.kcp.dev", Version: "v1beta1", Resource: "workspaces"}
+	crdGVR       = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+	kcpUseCommand        = regexp.MustCompile(`^KUBECONFIG=(\S+) kubectl kcp ws use (\S+)$`)
+	kcpConfigViewCommand = regexp.MustCompile(`^KUBECONFIG=(\S+) kubectl config view --minify --raw$`)
+)
+
+// fakeCluster is a logical cluster (workspace) of fakeKcp.
+type fakeCluster struct {
+	apis    map[schema.GroupVersionResource]fakeAPI
+	objects map[schema.GroupVersionResource]map[string]*unstructured.Unstructured
+}
+
+// fakeKcp stands in for kcp in the controller tests. It is an API server serving each workspace under
+// /clusters/<path>, the way kcp routes logical clusters, with an in-memory store per workspace, and runs the
+// kubectl kcp commands of the reconciler against it in place of runKcpCommand.
+//
+// Only what the reconciler relies on is modelled: CRDs are Established and served as soon as they are created,
+// APIBindings are bound to the resources of their APIExport when it exists, Namespaces are Active and delete their
+// objects with them, and server-side apply merges the applied configuration into the live object like a JSON
+// merge patch. Updates have to carry the resourceVersion of the live object. Watches are not served. Writes and
+// deletions are admitted unless a spec installs an admission function with setAdmission.
+type fakeKcp struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	clusters map[string]*fakeCluster
+	version  int64
+	// commands run in place of runKcpCommand
+	commands []string
+	// admit rejects a write to the workspace path, or a deletion, by returning an error, as an admission webhook would
+	admit func(path string, obj *unstructured.Unstructured) error
+}
+
+func newFakeKcp() *fakeKcp {
+	k := &fakeKcp{clusters: map[string]*fakeCluster{}}
+	k.server = httptest.NewServer(http.HandlerFunc(k.serveHTTP))
+	k.addWorkspace("root")
+	return k
+}
+
+func (k *fakeKcp) close() {
+	k.server.Close()
+}
+
+// kubeConfig returns a kubeconfig of the root workspace, as stored in the kcp kubeconfig secret.
+func (k *fakeKcp) kubeConfig() []byte {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kcp"] = &clientcmdapi.Cluster{Server: k.server.URL + "/clusters/root"}
+	config.AuthInfos["admin"] = &clientcmdapi.AuthInfo{Token: "admin-token"}
+	config.Contexts["kcp"] = &clientcmdapi.Context{Cluster: "kcp", AuthInfo: "admin"}
+	config.CurrentContext = "kcp"
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// addWorkspace creates the workspace path and its Workspace object in the parent workspace, and serves apis in
+// it besides the builtin ones.
+func (k *fakeKcp) addWorkspace(path string, apis ...fakeAPI) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cluster := &fakeCluster{
+		apis:    map[schema.GroupVersionResource]fakeAPI{},
+		objects: map[schema.GroupVersionResource]map[string]*unstructured.Unstructured{},
+	}
+	for _, api := range append(append([]fakeAPI{}, fakeKcpBuiltinAPIs...), apis...) {
+		cluster.apis[api.GroupVersionResource] = api
+	}
+	k.clusters[path] = cluster
+
+	if i := strings.LastIndex(path, ":"); i > 0 {
+		if parent := k.clusters[path[:i]]; parent != nil {
+			ws := &unstructured.Unstructured{}
+			ws.SetAPIVersion(workspaceGVR.GroupVersion().String())
+			ws.SetKind("Workspace")
+			ws.SetName(path[i+1:])
+			_ = unstructured.SetNestedField(ws.Object, "Ready", "status", "phase")
+			_ = unstructured.SetNestedField(ws.Object, k.server.URL+"/clusters/"+path, "status", "URL")
+			k.store(parent, workspaceGVR, ws)
+		}
+	}
+}
+
+// addAPIExport creates the APIExport name in the workspace path, exporting apis through APIResourceSchemas.
+func (k *fakeKcp) addAPIExport(path, name string, apis ...fakeAPI) {
+	var schemas []interface{}
+	for _, api := range apis {
+		scope := "Cluster"
+		if api.Namespaced {
+			scope = "Namespaced"
+		}
+		group := api.Group
+		if group == "" {
+			group = "core"
+		}
+		s := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apis.kcp.dev/v1alpha1",
+			"kind":       "APIResourceSchema",
+			"metadata":   map[string]interface{}{"name": "today." + api.Resource + "." + group},
+			"spec": map[string]interface{}{
+				"group": api.Group,
+				"scope": scope,
+				"names": map[string]interface{}{
+					"kind":     api.Kind,
+					"plural":   api.Resource,
+					"singular": strings.ToLower(api.Kind),
+				},
+				"versions": []interface{}{map[string]interface{}{"name": api.Version, "served": true, "storage": true}},
+			},
+		}}
+		k.create(path, apiResourceSchemaResource, s)
+		schemas = append(schemas, s.GetName())
+	}
+	export := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apis.kcp.dev/v1alpha1",
+		"kind":       "APIExport",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       map[string]interface{}{"latestResourceSchemas": schemas},
+	}}
+	k.create(path, apiExportResource, export)
+}
+
+// create stores obj in the workspace path, failing the test when it cannot.
+func (k *fakeKcp) create(path string, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cluster := k.clusters[path]
+	if cluster == nil {
+		panic(fmt.Sprintf("workspace %s does not exist", path))
+	}
+	api, ok := cluster.apis[gvr]
+	if !ok {
+		panic(fmt.Sprintf("%s is not served in workspace %s", gvr, path))
+	}
+	obj.SetAPIVersion(gvr.GroupVersion().String())
+	obj.SetKind(api.Kind)
+	if _, err := k.write(path, cluster, api, obj, nil, false); err != nil {
+		panic(err)
+	}
+}
+
+// get returns the object of the workspace path, nil when it does not exist.
+func (k *fakeKcp) get(path string, gvr schema.GroupVersionResource, namespace, name string) *unstructured.Unstructured {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if cluster := k.clusters[path]; cluster != nil {
+		if obj := cluster.objects[gvr][objectKey(namespace, name)]; obj != nil {
+			return obj.DeepCopy()
+		}
+	}
+	return nil
+}
+
+// list returns the objects of gvr in the workspace path, sorted by namespace and name.
+func (k *fakeKcp) list(path string, gvr schema.GroupVersionResource) []unstructured.Unstructured {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var items []unstructured.Unstructured
+	if cluster := k.clusters[path]; cluster != nil {
+		for _, key := range sortedMapKeys(cluster.objects[gvr]) {
+			items = append(items, *cluster.objects[gvr][key].DeepCopy())
+		}
+	}
+	return items
+}
+
+// update replaces the object of the workspace path by the result of mutate, as another client would.
+func (k *fakeKcp) update(path string, gvr schema.GroupVersionResource, namespace, name string, mutate func(*unstructured.Unstructured)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	obj := k.clusters[path].objects[gvr][objectKey(namespace, name)]
+	if obj == nil {
+		panic(fmt.Sprintf("%s %s does not exist in workspace %s", gvr.Resource, objectKey(namespace, name), path))
+	}
+	mutate(obj)
+	k.version++
+	obj.SetResourceVersion(strconv.FormatInt(k.version, 10))
+}
+
+// delete removes the object of the workspace path, as another client would.
+func (k *fakeKcp) delete(path string, gvr schema.GroupVersionResource, namespace, name string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.remove(k.clusters[path], gvr, namespace, name)
+}
+
+// setAdmission makes admit decide on every later write and deletion, including dry-run ones.
+func (k *fakeKcp) setAdmission(admit func(path string, obj *unstructured.Unstructured) error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.admit = admit
+}
+
+// run executes the kubectl kcp commands of the reconciler against the fake.
+func (k *fakeKcp) run(ctx context.Context, command string) ([]byte, error) {
+	k.mu.Lock()
+	k.commands = append(k.commands, command)
+	k.mu.Unlock()
+	if m := kcpUseCommand.FindStringSubmatch(command); m != nil {
+		return k.use(m[1], m[2])
+	}
+	if m := kcpConfigViewCommand.FindStringSubmatch(command); m != nil {
+		return os.ReadFile(m[1])
+	}
+	return nil, fmt.Errorf("fake kcp does not support %q", command)
+}
+
+// use points the current context of the kubeconfig at the workspace path.
+func (k *fakeKcp) use(kubeConfig, path string) ([]byte, error) {
+	k.mu.Lock()
+	_, found := k.clusters[path]
+	k.mu.Unlock()
+	if !found {
+		return nil, fmt.Errorf("workspace %q not found", path)
+	}
+	config, err := clientcmd.LoadFromFile(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	context := config.Contexts[config.CurrentContext]
+	if context == nil || config.Clusters[context.Cluster] == nil {
+		return nil, fmt.Errorf("current context of %s is not set", kubeConfig)
+	}
+	config.Clusters[context.Cluster].Server = k.server.URL + "/clusters/" + path
+	if err := clientcmd.WriteToFile(*config, kubeConfig); err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("Current workspace is %q.\n", path)), nil
+}
+
+// fakeRequest is a request to a resource of a logical cluster.
+type fakeRequest struct {
+	path        string
+	cluster     *fakeCluster
+	api         fakeAPI
+	namespace   string
+	name        string
+	subresource string
+}
+
+func (k *fakeKcp) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 3 || segments[0] != "clusters" {
+		writeStatus(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	}
+	path, segments := segments[1], segments[2:]
+	cluster := k.clusters[path]
+	if cluster == nil {
+		writeStatus(w, apierrors.NewForbidden(schema.GroupResource{Group: "tenancy.kcp.dev", Resource: "workspaces"}, path,
+			fmt.Errorf("workspace %s does not exist", path)))
+		return
+	}
+
+	var gv schema.GroupVersion
+	switch {
+	case segments[0] == "api" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, &metav1.APIVersions{TypeMeta: metav1.TypeMeta{Kind: "APIVersions"}, Versions: []string{"v1"}})
+		return
+	case segments[0] == "apis" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, cluster.groups())
+		return
+	case segments[0] == "api":
+		gv, segments = schema.GroupVersion{Version: segments[1]}, segments[2:]
+	case segments[0] == "apis" && len(segments) >= 3:
+		gv, segments = schema.GroupVersion{Group: segments[1], Version: segments[2]}, segments[3:]
+	default:
+		writeStatus(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	}
+	if len(segments) == 0 {
+		list := cluster.resources(gv)
+		if list == nil {
+			writeStatus(w, apierrors.NewNotFound(schema.GroupResource{Group: gv.Group}, gv.Version))
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	req := fakeRequest{path: path, cluster: cluster}
+	if segments[0] == "namespaces" && len(segments) >= 3 {
+		if _, ok := cluster.apis[gv.WithResource(segments[2])]; ok {
+			req.namespace, segments = segments[1], segments[2:]
+		}
+	}
+	var ok bool
+	if req.api, ok = cluster.apis[gv.WithResource(segments[0])]; !ok {
+		writeStatus(w, apierrors.NewNotFound(gv.WithResource(segments[0]).GroupResource(), ""))
+		return
+	}
+	if len(segments) > 1 {
+		req.name = segments[1]
+	}
+	if len(segments) > 2 {
+		req.subresource = segments[2]
+	}
+
+	obj, err := k.serveResource(r, req)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+	code := http.StatusOK
+	if r.Method == http.MethodPost {
+		code = http.StatusCreated
+	}
+	writeJSON(w, code, obj)
+}
+
+func (k *fakeKcp) serveResource(r *http.Request, req fakeRequest) (interface{}, error) {
+	gr := req.api.GroupResource()
+	live := req.cluster.objects[req.api.GroupVersionResource][objectKey(req.namespace, req.name)]
+	dryRun := r.URL.Query().Get("dryRun") == metav1.DryRunAll
+
+	switch {
+	case r.Method == http.MethodGet && req.name == "":
+		if r.URL.Query().Get("watch") == "true" {
+			return nil, apierrors.NewMethodNotSupported(gr, "watch")
+		}
+		return k.listObjects(req, r.URL.Query().Get("labelSelector"))
+	case r.Method == http.MethodGet:
+		if live == nil {
+			return nil, apierrors.NewNotFound(gr, req.name)
+		}
+		return live, nil
+	case r.Method == http.MethodDelete:
+		if live == nil {
+			return nil, apierrors.NewNotFound(gr, req.name)
+		}
+		if k.admit != nil {
+			if err := k.admit(req.path, live); err != nil {
+				return nil, err
+			}
+		}
+		if !dryRun {
+			k.remove(req.cluster, req.api.GroupVersionResource, req.namespace, req.name)
+		}
+		return &metav1.Status{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusSuccess}, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	var desired *unstructured.Unstructured
+	switch r.Method {
+	case http.MethodPost:
+		if desired, err = decodeObject(body); err != nil {
+			return nil, err
+		}
+		if req.namespace != "" {
+			desired.SetNamespace(req.namespace)
+		}
+		if desired.GetName() == "" && desired.GetGenerateName() != "" {
+			desired.SetName(desired.GetGenerateName() + string(uuid.NewUUID())[:5])
+		}
+		if req.cluster.objects[req.api.GroupVersionResource][objectKey(desired.GetNamespace(), desired.GetName())] != nil {
+			return nil, apierrors.NewAlreadyExists(gr, desired.GetName())
+		}
+		return k.write(req.path, req.cluster, req.api, desired, nil, dryRun)
+	case http.MethodPut:
+		if live == nil {
+			return nil, apierrors.NewNotFound(gr, req.name)
+		}
+		if desired, err = decodeObject(body); err != nil {
+			return nil, err
+		}
+		// like kube-apiserver for custom resources, an update has to name the version of the object it replaces
+		if desired.GetResourceVersion() == "" {
+			return nil, apierrors.NewInvalid(schema.GroupKind{Group: gr.Group, Kind: req.api.Kind}, req.name, field.ErrorList{
+				field.Invalid(field.NewPath("metadata", "resourceVersion"), "", "must be specified for an update"),
+			})
+		}
+		if desired.GetResourceVersion() != live.GetResourceVersion() {
+			return nil, apierrors.NewConflict(gr, req.name, fmt.Errorf("the object has been modified"))
+		}
+	case http.MethodPatch:
+		if live == nil && types.PatchType(r.Header.Get("Content-Type")) != types.ApplyPatchType {
+			return nil, apierrors.NewNotFound(gr, req.name)
+		}
+		var patch map[string]interface{}
+		if err := yaml.Unmarshal(body, &patch); err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+		switch types.PatchType(r.Header.Get("Content-Type")) {
+		case types.ApplyPatchType:
+			if live == nil {
+				desired = &unstructured.Unstructured{Object: patch}
+				desired.SetNamespace(req.namespace)
+				return k.write(req.path, req.cluster, req.api, desired, nil, dryRun)
+			}
+			delete(patch, "status")
+		case types.MergePatchType, types.StrategicMergePatchType:
+		default:
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("unsupported patch type %s", r.Header.Get("Content-Type")))
+		}
+		desired = &unstructured.Unstructured{Object: mergePatch(live.DeepCopy().Object, patch).(map[string]interface{})}
+	default:
+		return nil, apierrors.NewMethodNotSupported(gr, r.Method)
+	}
+
+	// writes of the object keep its status, writes of the status subresource keep the rest
+	if req.subresource == "status" {
+		status := desired.Object["status"]
+		desired = live.DeepCopy()
+		desired.Object["status"] = status
+	} else if status, ok := live.Object["status"]; ok {
+		desired.Object["status"] = status
+	}
+	return k.write(req.path, req.cluster, req.api, desired, live, dryRun)
+}
+
+func (k *fakeKcp) listObjects(req fakeRequest, labelSelector string) (*unstructured.UnstructuredList, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(req.api.GroupVersion().String())
+	list.SetKind(req.api.Kind + "List")
+	list.SetResourceVersion(strconv.FormatInt(k.version, 10))
+	objects := req.cluster.objects[req.api.GroupVersionResource]
+	for _, key := range sortedMapKeys(objects) {
+		obj := objects[key]
+		if req.namespace != "" && obj.GetNamespace() != req.namespace {
+			continue
+		}
+		if selector.Matches(labels.Set(obj.GetLabels())) {
+			list.Items = append(list.Items, *obj.DeepCopy())
+		}
+	}
+	return list, nil
+}
+
+// write validates and stores obj, replacing live, and lets the workspace react to it as kcp would.
+func (k *fakeKcp) write(
+	path string,
+	cluster *fakeCluster,
+	api fakeAPI,
+	obj *unstructured.Unstructured,
+	live *unstructured.Unstructured,
+	dryRun bool,
+) (*unstructured.Unstructured, error) {
+	obj = obj.DeepCopy()
+	obj.SetAPIVersion(api.GroupVersion().String())
+	obj.SetKind(api.Kind)
+	if obj.GetName() == "" {
+		return nil, apierrors.NewBadRequest("metadata.name is required")
+	}
+	if !api.Namespaced {
+		obj.SetNamespace("")
+	} else if obj.GetNamespace() == "" {
+		return nil, apierrors.NewBadRequest("metadata.namespace is required")
+	} else if cluster.objects[namespaceAPI.GroupVersionResource][obj.GetNamespace()] == nil {
+		return nil, apierrors.NewNotFound(namespaceAPI.GroupResource(), obj.GetNamespace())
+	}
+	if live != nil {
+		obj.SetUID(live.GetUID())
+		obj.SetCreationTimestamp(live.GetCreationTimestamp())
+	} else {
+		obj.SetUID(uuid.NewUUID())
+		obj.SetCreationTimestamp(metav1.Now())
+	}
+	if k.admit != nil {
+		if err := k.admit(path, obj); err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return obj, nil
+	}
+
+	switch api.Kind {
+	case "Namespace":
+		_ = unstructured.SetNestedField(obj.Object, "Active", "status", "phase")
+	case "CustomResourceDefinition":
+		cluster.serveCRD(obj)
+	case "APIBinding":
+		k.bind(cluster, obj)
+	}
+	k.store(cluster, api.GroupVersionResource, obj)
+	return obj.DeepCopy(), nil
+}
+
+func (k *fakeKcp) store(cluster *fakeCluster, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	k.version++
+	obj.SetResourceVersion(strconv.FormatInt(k.version, 10))
+	if cluster.objects[gvr] == nil {
+		cluster.objects[gvr] = map[string]*unstructured.Unstructured{}
+	}
+	cluster.objects[gvr][objectKey(obj.GetNamespace(), obj.GetName())] = obj
+}
+
+// remove deletes an object, together with the objects of a Namespace and the resources of a CRD.
+func (k *fakeKcp) remove(cluster *fakeCluster, gvr schema.GroupVersionResource, namespace, name string) {
+	obj := cluster.objects[gvr][objectKey(namespace, name)]
+	if obj == nil {
+		return
+	}
+	delete(cluster.objects[gvr], objectKey(namespace, name))
+	k.version++
+	switch gvr {
+	case namespaceAPI.GroupVersionResource:
+		for _, objects := range cluster.objects {
+			for key, o := range objects {
+				if o.GetNamespace() == name {
+					delete(objects, key)
+				}
+			}
+		}
+	case crdGVR:
+		for _, api := range crdAPIs(obj) {
+			delete(cluster.apis, api.GroupVersionResource)
+			delete(cluster.objects, api.GroupVersionResource)
+		}
+	}
+}
+
+// serveCRD serves the resources of crd and marks it Established.
+func (c *fakeCluster) serveCRD(crd *unstructured.Unstructured) {
+	for _, api := range crdAPIs(crd) {
+		c.apis[api.GroupVersionResource] = api
+	}
+	conditions := []interface{}{
+		map[string]interface{}{"type": "NamesAccepted", "status": "True", "reason": "NoConflicts"},
+		map[string]interface{}{"type": "Established", "status": "True", "reason": "InitialNamesAccepted"},
+	}
+	_ = unstructured.SetNestedSlice(crd.Object, conditions, "status", "conditions")
+}
+
+// bind serves the resources of the APIExport referred by binding and reports the binding Ready, or not Ready
+// when the export does not exist.
+func (k *fakeKcp) bind(cluster *fakeCluster, binding *unstructured.Unstructured) {
+	path, _, _ := unstructured.NestedString(binding.Object, "spec", "reference", "workspace", "path")
+	name, _, _ := unstructured.NestedString(binding.Object, "spec", "reference", "workspace", "exportName")
+	var export *unstructured.Unstructured
+	provider := k.clusters[path]
+	if provider != nil {
+		export = provider.objects[apiExportResource][name]
+	}
+	if export == nil {
+		conditions := []interface{}{
+			map[string]interface{}{"type": "InitialBindingCompleted", "status": "False", "reason": "APIExportNotFound",
+				"message": fmt.Sprintf("APIExport %s|%s not found", path, name)},
+			map[string]interface{}{"type": "Ready", "status": "False", "reason": "APIExportNotFound"},
+		}
+		_ = unstructured.SetNestedSlice(binding.Object, conditions, "status", "conditions")
+		_ = unstructured.SetNestedField(binding.Object, "Binding", "status", "phase")
+		return
+	}
+
+	names, _, _ := unstructured.NestedStringSlice(export.Object, "spec", "latestResourceSchemas")
+	var bound []interface{}
+	for _, schemaName := range names {
+		s := provider.objects[apiResourceSchemaResource][schemaName]
+		if s == nil {
+			continue
+		}
+		for _, api := range crdAPIs(s) {
+			cluster.apis[api.GroupVersionResource] = api
+			bound = append(bound, map[string]interface{}{"group": api.Group, "resource": api.Resource, "schema": schemaName})
+		}
+	}
+	conditions := []interface{}{
+		map[string]interface{}{"type": "InitialBindingCompleted", "status": "True"},
+		map[string]interface{}{"type": "Ready", "status": "True"},
+	}
+	_ = unstructured.SetNestedSlice(binding.Object, conditions, "status", "conditions")
+	_ = unstructured.SetNestedField(binding.Object, "Bound", "status", "phase")
+	_ = unstructured.SetNestedSlice(binding.Object, bound, "status", "boundResources")
+}
+
+// crdAPIs returns the served resources of a CRD or an APIResourceSchema.
+func crdAPIs(obj *unstructured.Unstructured) []fakeAPI {
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+	versions, _, _ := unstructured.NestedSlice(obj.Object, "spec", "versions")
+	var apis []fakeAPI
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok || version["served"] == false {
+			continue
+		}
+		name, _ := version["name"].(string)
+		apis = append(apis, fakeAPI{
+			GroupVersionResource: schema.GroupVersionResource{Group: group, Version: name, Resource: plural},
+			Kind:                 kind,
+			Namespaced:           scope == "Namespaced",
+		})
+	}
+	return apis
+}
+
+// groups returns the discovery document of the API groups served by the cluster.
+func (c *fakeCluster) groups() *metav1.APIGroupList {
+	versions := map[string][]string{}
+	for gvr := range c.apis {
+		if gvr.Group == "" {
+			continue
+		}
+		found := false
+		for _, v := range versions[gvr.Group] {
+			found = found || v == gvr.Version
+		}
+		if !found {
+			versions[gvr.Group] = append(versions[gvr.Group], gvr.Version)
+		}
+	}
+	list := &metav1.APIGroupList{TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+	for _, group := range sortedMapKeys(versions) {
+		sort.Strings(versions[group])
+		g := metav1.APIGroup{Name: group}
+		for _, v := range versions[group] {
+			g.Versions = append(g.Versions, metav1.GroupVersionForDiscovery{GroupVersion: group + "/" + v, Version: v})
+		}
+		g.PreferredVersion = g.Versions[0]
+		list.Groups = append(list.Groups, g)
+	}
+	return list
+}
+
+// resources returns the discovery document of the resources of gv, nil when gv is not served.
+func (c *fakeCluster) resources(gv schema.GroupVersion) *metav1.APIResourceList {
+	var list *metav1.APIResourceList
+	for gvr, api := range c.apis {
+		if gvr.GroupVersion() != gv {
+			continue
+		}
+		if list == nil {
+			list = &metav1.APIResourceList{TypeMeta: metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"}, GroupVersion: gv.String()}
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       gvr.Resource,
+			Kind:       api.Kind,
+			Namespaced: api.Namespaced,
+			Verbs:      metav1.Verbs{"create", "delete", "get", "list", "patch", "update"},
+		})
+	}
+	if list != nil {
+		sort.Slice(list.APIResources, func(i, j int) bool { return list.APIResources[i].Name < list.APIResources[j].Name })
+	}
+	return list
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to target.
+func mergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetMap, ok := target.(map[string]interface{})
+	if !ok {
+		targetMap = map[string]interface{}{}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(targetMap, key)
+			continue
+		}
+		targetMap[key] = mergePatch(targetMap[key], value)
+	}
+	return targetMap
+}
+
+func decodeObject(body []byte) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(body, &obj.Object); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return obj, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func writeStatus(w http.ResponseWriter, err error) {
+	status := apierrors.NewInternalError(err).ErrStatus
+	if apiStatus, ok := err.(apierrors.APIStatus); ok {
+		status = apiStatus.Status()
+	}
+	status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	writeJSON(w, int(status.Code), &status)
+}
+
+func objectKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+func sortedMapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
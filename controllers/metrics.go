@@ -0,0 +1,178 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	phaseSyncPCO                   = "syncPCO"
+	phasePublishKyvernoAPIs        = "publishKyvernoAPIs"
+	phaseInstallKyvernoOnEdge      = "installKyvernoOnEdge"
+	phaseInstallKyvernoOnWorkspace = "installKyvernoOnWorkspace"
+	phaseProbeEnforcement          = "probeEnforcement"
+	phaseProbeWebhook              = "probeWebhook"
+	phaseEnforceFailurePolicy      = "enforceFailurePolicy"
+
+	kcpOperationSwitchWorkspace = "switchWorkspace"
+	kcpOperationSyncWorkspace   = "syncWorkspace"
+	kcpOperationGetKubeConfig   = "getKubeConfig"
+	kcpOperationDiscovery       = "discovery"
+
+	fleetCollectTimeout = 10 * time.Second
+)
+
+var (
+	reconcilePhaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "policycontrol_reconcile_phase_duration_seconds",
+			Help:    "Duration of the phases of a PolicyControl reconciliation.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+		},
+		[]string{"phase", "result"},
+	)
+	kcpFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "policycontrol_kcp_failures_total",
+			Help: "Number of failed kcp CLI invocations and API requests.",
+		},
+		[]string{"operation"},
+	)
+
+	managedWorkspacesDesc = prometheus.NewDesc(
+		"policycontrol_managed_workspaces",
+		"Number of workspaces managed by PolicyControls.",
+		nil, nil,
+	)
+	readyKyvernoDeploymentsDesc = prometheus.NewDesc(
+		"policycontrol_kyverno_ready_deployments",
+		"Number of standalone Kyverno Deployments whose replicas are all ready.",
+		nil, nil,
+	)
+	certificateExpiryDaysDesc = prometheus.NewDesc(
+		"policycontrol_certificate_expiry_days",
+		"Days until the certificate in the ingress TLS secret of the Policy Control Cluster expires.",
+		[]string{"namespace", "secret"}, nil,
+	)
+	policyViolationsDesc = prometheus.NewDesc(
+		"policycontrol_policy_violations",
+		"Failed PolicyReport results of a workspace and its edge clusters as aggregated by the ComplianceSummaries.",
+		[]string{"namespace", "policycontrol", "workspace"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcilePhaseDuration, kcpFailures)
+}
+
+func observeReconcilePhase(phase string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	reconcilePhaseDuration.WithLabelValues(phase, result).Observe(time.Since(start).Seconds())
+}
+
+// fleetCollector reports the state of the managed Kyverno fleet at scrape time. PolicyControls and their
+// templates are read from the cache the controllers watch anyway, the Deployments and Secrets are read from
+// the API server so that scraping does not start cluster-wide informers for them.
+type fleetCollector struct {
+	client    client.Reader
+	apiReader client.Reader
+}
+
+func newFleetCollector(c client.Reader, apiReader client.Reader) prometheus.Collector {
+	return &fleetCollector{client: c, apiReader: apiReader}
+}
+
+func (f *fleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedWorkspacesDesc
+	ch <- readyKyvernoDeploymentsDesc
+	ch <- certificateExpiryDaysDesc
+	ch <- policyViolationsDesc
+}
+
+func (f *fleetCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), fleetCollectTimeout)
+	defer cancel()
+
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := f.client.List(ctx, &pcList); err != nil {
+		ch <- prometheus.NewInvalidMetric(managedWorkspacesDesc, err)
+		return
+	}
+	workspaces := map[string]bool{}
+	secrets := map[client.ObjectKey]kcptoolsv1alpha1.TLSSecret{}
+	for _, pc := range pcList.Items {
+		workspaces[pc.Spec.Workspace] = true
+		if pc.Status.Compliance != nil {
+			ch <- prometheus.MustNewConstMetric(policyViolationsDesc, prometheus.GaugeValue,
+				float64(pc.Status.Compliance.Fail), pc.GetNamespace(), pc.GetName(), pc.Spec.Workspace)
+		}
+		effective, err := applyTemplate(ctx, f.client, logr.Discard(), pc)
+		if err != nil {
+			continue
+		}
+		tlsSecret := effective.Spec.PolicyControlCluster.IngressTLSSecret
+		if tlsSecret.Name != "" {
+			secrets[client.ObjectKey{Namespace: effective.Spec.PolicyControlCluster.Namespace, Name: tlsSecret.Name}] = tlsSecret
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(managedWorkspacesDesc, prometheus.GaugeValue, float64(len(workspaces)))
+
+	var deployments appsv1.DeploymentList
+	if err := f.apiReader.List(ctx, &deployments, client.MatchingLabels{naming.AppLabel: naming.KyvernoAppLabelValue}); err != nil {
+		ch <- prometheus.NewInvalidMetric(readyKyvernoDeploymentsDesc, err)
+	} else {
+		ready := 0
+		for _, d := range deployments.Items {
+			if _, shared := d.GetLabels()[resources.ShardLabel]; shared {
+				continue
+			}
+			if d.Spec.Replicas != nil && *d.Spec.Replicas > 0 && d.Status.ReadyReplicas >= *d.Spec.Replicas {
+				ready++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(readyKyvernoDeploymentsDesc, prometheus.GaugeValue, float64(ready))
+	}
+
+	for key, tlsSecret := range secrets {
+		var secret corev1.Secret
+		if err := f.apiReader.Get(ctx, key, &secret); err != nil {
+			continue
+		}
+		notAfter, err := resources.CertificateNotAfter(secret.Data[tlsSecret.KeyForCert])
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(certificateExpiryDaysDesc, prometheus.GaugeValue,
+			time.Until(notAfter).Hours()/24, key.Namespace, key.Name)
+	}
+}
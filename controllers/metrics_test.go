@@ -0,0 +1,157 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+// recordingReader records the types of the objects read through it.
+type recordingReader struct {
+	client.Reader
+	mu    sync.Mutex
+	types []string
+}
+
+func (r *recordingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	r.record(obj)
+	return r.Reader.Get(ctx, key, obj, opts...)
+}
+
+func (r *recordingReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	r.record(list)
+	return r.Reader.List(ctx, list, opts...)
+}
+
+func (r *recordingReader) record(obj interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types = append(r.types, fmt.Sprintf("%T", obj))
+}
+
+// selfSignedCertificate returns a PEM certificate expiring at notAfter.
+func selfSignedCertificate(notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "policy-control-cluster.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// gatherFleet scrapes the collector and returns its metrics by name.
+func gatherFleet(collector prometheus.Collector) map[string][]*dto.Metric {
+	registry := prometheus.NewPedanticRegistry()
+	Expect(registry.Register(collector)).To(Succeed())
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	metrics := map[string][]*dto.Metric{}
+	for _, family := range families {
+		metrics[family.GetName()] = family.GetMetric()
+	}
+	return metrics
+}
+
+var _ = Describe("Fleet metrics", func() {
+	kyvernoDeployment := func(name string, labels map[string]string, ready int32) *appsv1.Deployment {
+		labels[naming.AppLabel] = naming.KyvernoAppLabelValue
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: defaultTestNamespace, Name: name, Labels: labels},
+			Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(1)},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: ready},
+		}
+	}
+
+	It("reads the Deployments and Secrets from the API server and the PolicyControls from the cache", func() {
+		edge1 := newTestPolicyControl("pccr-edge1", "root:edge1")
+		edge1.Namespace = defaultTestNamespace
+		edge1.Spec.PolicyControlCluster.Namespace = defaultTestNamespace
+		edge1.Status.Compliance = &kcptoolsv1alpha1.ComplianceCounts{Pass: 4, Fail: 2}
+		edge2 := newTestPolicyControl("pccr-edge2", "root:edge2")
+		edge2.Namespace = defaultTestNamespace
+		edge2.Spec.PolicyControlCluster.Namespace = defaultTestNamespace
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			edge1, edge2,
+			kyvernoDeployment("root--edge1", map[string]string{}, 1),
+			kyvernoDeployment("root--edge2", map[string]string{}, 0),
+			kyvernoDeployment("kyverno-shard-0", map[string]string{resources.ShardLabel: "0"}, 1),
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: defaultTestNamespace, Name: "policy-control-cluster-tls-secret"},
+				Data:       map[string][]byte{"tls.crt": selfSignedCertificate(time.Now().Add(30 * 24 * time.Hour))},
+			},
+		).Build()
+		cache := &recordingReader{Reader: c}
+		apiReader := &recordingReader{Reader: c}
+
+		metrics := gatherFleet(newFleetCollector(cache, apiReader))
+		Expect(metrics["policycontrol_managed_workspaces"][0].GetGauge().GetValue()).To(Equal(2.0))
+		Expect(metrics["policycontrol_kyverno_ready_deployments"][0].GetGauge().GetValue()).To(Equal(1.0))
+		Expect(metrics["policycontrol_certificate_expiry_days"]).To(HaveLen(1))
+		Expect(metrics["policycontrol_certificate_expiry_days"][0].GetGauge().GetValue()).To(BeNumerically("~", 30, 0.1))
+		Expect(metrics["policycontrol_policy_violations"]).To(HaveLen(1))
+		Expect(metrics["policycontrol_policy_violations"][0].GetGauge().GetValue()).To(Equal(2.0))
+
+		By("keeping the Deployments and Secrets out of the cache")
+		Expect(cache.types).To(ContainElement("*v1alpha1.PolicyControlList"))
+		Expect(cache.types).NotTo(ContainElement("*v1.DeploymentList"))
+		Expect(cache.types).NotTo(ContainElement("*v1.Secret"))
+		Expect(apiReader.types).To(ConsistOf("*v1.DeploymentList", "*v1.Secret"))
+	})
+
+	It("reports a failed list of the PolicyControls as an invalid metric", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		// the PolicyControl API is not registered in the scheme of the cache
+		cache := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()
+		registry := prometheus.NewPedanticRegistry()
+		Expect(registry.Register(newFleetCollector(cache, c))).To(Succeed())
+		_, err := registry.Gather()
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,551 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+const (
+	policyBundleFinalizer      = "ibm.github.com/policybundle-cleanup"
+	policyBundleLabel          = "ibm.github.com/policybundle"
+	configMapRefIndexKey       = "spec.configMapRef.name"
+	policyBundleOCIResyncAfter = 10 * time.Minute
+	policyBundleRetryAfter     = time.Minute
+
+	TargetTypeWorkspace = "Workspace"
+	TargetTypeEdge      = "Edge"
+
+	TargetPhaseApplied = "Applied"
+	TargetPhasePending = "Pending"
+	TargetPhaseFailed  = "Failed"
+
+	// field manager of the policies placed by PolicyBundles
+	policyBundleFieldManager = "policy-control-operator-policybundle"
+
+	ConditionTypeReady = "Ready"
+)
+
+// PolicyBundleReconciler reconciles a PolicyBundle object
+type PolicyBundleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=ibm.github.com,resources=policybundles,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=ibm.github.com,resources=policybundles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=ibm.github.com,resources=policybundles/finalizers,verbs=update
+
+// Reconcile places the Kyverno policies of a PolicyBundle into the target workspaces and,
+// as namespaced Policies synced to the SyncTargets of the workspaces, into their edge clusters.
+func (r *PolicyBundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var bundle kcptoolsv1alpha1.PolicyBundle
+	if err := r.Get(ctx, req.NamespacedName, &bundle); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !bundle.GetDeletionTimestamp().IsZero() {
+		if controllerutil.ContainsFinalizer(&bundle, policyBundleFinalizer) {
+			for _, target := range bundle.Status.Targets {
+				if err := r.removePolicies(ctx, logger, &bundle, target.Workspace, target.Policies); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			controllerutil.RemoveFinalizer(&bundle, policyBundleFinalizer)
+			if err := r.Update(ctx, &bundle); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(&bundle, policyBundleFinalizer) {
+		controllerutil.AddFinalizer(&bundle, policyBundleFinalizer)
+		if err := r.Update(ctx, &bundle); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	observed := bundle.Status.DeepCopy()
+
+	policies, err := loadPolicies(ctx, r.Client, &bundle)
+	if err != nil {
+		logger.Error(err, "failed to load policies")
+		meta.SetStatusCondition(&bundle.Status.Conditions, metav1.Condition{
+			Type:    ConditionTypeReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "SourceError",
+			Message: err.Error(),
+		})
+		if err := r.updateStatus(ctx, &bundle, observed); err != nil {
+			logger.Error(err, "failed to update status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	pcs, err := r.targetPolicyControls(ctx, &bundle)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	action, checkRolloutAfter := r.progressRollout(ctx, logger, &bundle, pcs, policies)
+	staged, err := withValidationFailureAction(policies, action)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var targets []kcptoolsv1alpha1.PolicyBundleTargetStatus
+	for _, pc := range pcs {
+		targets = append(targets, r.placePolicies(ctx, logger, &bundle, pc, staged)...)
+	}
+
+	// remove the policies dropped from the bundle or placed into targets no longer selected
+	for _, prev := range bundle.Status.Targets {
+		stale := prev.Policies
+		for _, cur := range targets {
+			if cur.Workspace == prev.Workspace && cur.Type == prev.Type {
+				stale = nil
+				if cur.Phase != TargetPhaseFailed {
+					stale = subtractPolicyRefs(prev.Policies, cur.Policies)
+				}
+			}
+		}
+		if err := r.removePolicies(ctx, logger, &bundle, prev.Workspace, stale); err != nil {
+			logger.Error(err, fmt.Sprintf("failed to remove stale policies from workspace %s", prev.Workspace))
+		}
+	}
+
+	failed, pending := 0, 0
+	for i, cur := range targets {
+		for _, prev := range bundle.Status.Targets {
+			if cur.Workspace == prev.Workspace && cur.Type == prev.Type && cur.Phase == prev.Phase && cur.Message == prev.Message {
+				targets[i].LastTransitionTime = prev.LastTransitionTime
+			}
+		}
+		switch cur.Phase {
+		case TargetPhaseFailed:
+			failed++
+		case TargetPhasePending:
+			pending++
+		}
+	}
+	bundle.Status.Targets = targets
+	bundle.Status.ObservedGeneration = bundle.GetGeneration()
+	condition := metav1.Condition{
+		Type:    ConditionTypeReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "RolledOut",
+		Message: fmt.Sprintf("%d policies placed into %d targets", len(policies), len(targets)),
+	}
+	if failed > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "RolloutFailed"
+		condition.Message = fmt.Sprintf("%d of %d targets failed", failed, len(targets))
+	} else if pending > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "RollingOut"
+		condition.Message = fmt.Sprintf("%d of %d targets are not synced to their edge clusters yet", pending, len(targets))
+	}
+	meta.SetStatusCondition(&bundle.Status.Conditions, condition)
+	if err := r.updateStatus(ctx, &bundle, observed); err != nil {
+		logger.Error(err, "failed to update status")
+		return ctrl.Result{}, err
+	}
+
+	requeueAfter := checkRolloutAfter
+	if failed > 0 || pending > 0 {
+		requeueAfter = shorterRequeue(requeueAfter, policyBundleRetryAfter)
+	}
+	if bundle.Spec.OCIArtifact != nil {
+		// tags may move, so pull the artifact again from time to time
+		requeueAfter = shorterRequeue(requeueAfter, policyBundleOCIResyncAfter)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// shorterRequeue returns the shorter of two requeue durations, where 0 means no requeue.
+func shorterRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// targetPolicyControls returns the PolicyControls, with their templates applied, whose workspaces are targeted by the bundle.
+// updateStatus writes the status of bundle unless it is still the observed one.
+func (r *PolicyBundleReconciler) updateStatus(
+	ctx context.Context,
+	bundle *kcptoolsv1alpha1.PolicyBundle,
+	observed *kcptoolsv1alpha1.PolicyBundleStatus,
+) error {
+	if equality.Semantic.DeepEqual(*observed, bundle.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, bundle)
+}
+
+func (r *PolicyBundleReconciler) targetPolicyControls(
+	ctx context.Context,
+	bundle *kcptoolsv1alpha1.PolicyBundle,
+) ([]kcptoolsv1alpha1.PolicyControl, error) {
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := r.List(ctx, &pcList, client.InNamespace(bundle.GetNamespace())); err != nil {
+		return nil, err
+	}
+	selector := labels.Nothing()
+	if bundle.Spec.Targets.PolicyControlSelector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(bundle.Spec.Targets.PolicyControlSelector); err != nil {
+			return nil, err
+		}
+	}
+	workspaces := map[string]bool{}
+	for _, ws := range bundle.Spec.Targets.Workspaces {
+		workspaces[ws] = true
+	}
+
+	var pcs []kcptoolsv1alpha1.PolicyControl
+	seen := map[string]bool{}
+	for _, pc := range pcList.Items {
+		if !selector.Matches(labels.Set(pc.GetLabels())) && !workspaces[pc.Spec.Workspace] {
+			continue
+		}
+		if seen[pc.Spec.Workspace] {
+			continue
+		}
+		seen[pc.Spec.Workspace] = true
+		effective, err := applyTemplate(ctx, r.Client, log.FromContext(ctx), pc)
+		if err != nil {
+			return nil, err
+		}
+		pcs = append(pcs, effective)
+	}
+	return pcs, nil
+}
+
+// placePolicies creates or updates the policies in the workspace of pc and in its edge namespaces.
+func (r *PolicyBundleReconciler) placePolicies(
+	ctx context.Context,
+	logger logr.Logger,
+	bundle *kcptoolsv1alpha1.PolicyBundle,
+	pc kcptoolsv1alpha1.PolicyControl,
+	policies []unstructured.Unstructured,
+) []kcptoolsv1alpha1.PolicyBundleTargetStatus {
+
+	workspaceTarget := kcptoolsv1alpha1.PolicyBundleTargetStatus{
+		Workspace:          pc.Spec.Workspace,
+		Type:               TargetTypeWorkspace,
+		Phase:              TargetPhaseApplied,
+		LastTransitionTime: metav1.Now(),
+	}
+	edgeTarget := workspaceTarget
+	edgeTarget.Type = TargetTypeEdge
+	failAll := func(err error) []kcptoolsv1alpha1.PolicyBundleTargetStatus {
+		workspaceTarget.Phase, workspaceTarget.Message = TargetPhaseFailed, err.Error()
+		edgeTarget.Phase, edgeTarget.Message = TargetPhaseFailed, err.Error()
+		if len(bundle.Spec.Targets.EdgeNamespaces) == 0 {
+			return []kcptoolsv1alpha1.PolicyBundleTargetStatus{workspaceTarget}
+		}
+		return []kcptoolsv1alpha1.PolicyBundleTargetStatus{workspaceTarget, edgeTarget}
+	}
+
+	config, mapper, err := getPolicyControlWorkspaceConfigs(ctx, r.Client, logger, pc)
+	if err != nil {
+		return failAll(err)
+	}
+	dyClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return failAll(err)
+	}
+
+	// placed is the last policy applied, read back to check where it is synced
+	var placed unstructured.Unstructured
+	apply := func(target *kcptoolsv1alpha1.PolicyBundleTargetStatus, obj unstructured.Unstructured) bool {
+		obj.SetLabels(labels.Merge(obj.GetLabels(), map[string]string{policyBundleLabel: bundle.GetName()}))
+		mapping, err := getMapping(logger, obj, mapper)
+		if err == nil {
+			var live *unstructured.Unstructured
+			live, err = applyPolicy(ctx, dyClient, *mapping, obj)
+			if err == nil {
+				placed = *live
+			}
+		}
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("failed to apply %s to workspace %s", policyRef(obj), pc.Spec.Workspace))
+			target.Phase = TargetPhaseFailed
+			target.Message = fmt.Sprintf("%s: %s", policyRef(obj), err.Error())
+			return false
+		}
+		target.Policies = append(target.Policies, policyRef(obj))
+		return true
+	}
+
+	for _, p := range policies {
+		obj := *p.DeepCopy()
+		if obj.GetKind() == kyvernoPolicyKind && obj.GetNamespace() == "" {
+			obj.SetNamespace(corev1.NamespaceDefault)
+		}
+		apply(&workspaceTarget, obj)
+	}
+	if len(bundle.Spec.Targets.EdgeNamespaces) == 0 {
+		return []kcptoolsv1alpha1.PolicyBundleTargetStatus{workspaceTarget}
+	}
+
+	// the Policies of the edge namespaces reach the edge clusters through the SyncTargets the workspace is bound to
+	logger.V(4).Info("enumerate the SyncTargets the edge policies are synced to")
+	syncTargets, err := placedSyncTargets(ctx, logger, dyClient, config)
+	if err != nil {
+		edgeTarget.Phase, edgeTarget.Message = TargetPhaseFailed, err.Error()
+		return []kcptoolsv1alpha1.PolicyBundleTargetStatus{workspaceTarget, edgeTarget}
+	}
+	if len(syncTargets) == 0 {
+		edgeTarget.Phase = TargetPhaseFailed
+		edgeTarget.Message = "the workspace is not bound to any SyncTarget, so no edge cluster receives the policies"
+		return []kcptoolsv1alpha1.PolicyBundleTargetStatus{workspaceTarget, edgeTarget}
+	}
+	unsynced := map[string]bool{}
+	for _, ns := range bundle.Spec.Targets.EdgeNamespaces {
+		for _, p := range policies {
+			obj := *p.DeepCopy()
+			obj.SetKind(kyvernoPolicyKind)
+			obj.SetNamespace(ns)
+			if !apply(&edgeTarget, obj) {
+				continue
+			}
+			states := syncTargetStates(&placed)
+			for _, st := range syncTargets {
+				if states[st.SyncTarget] != syncTargetStateSync {
+					unsynced[st.Path+":"+st.Name] = true
+				}
+			}
+		}
+	}
+	if edgeTarget.Phase == TargetPhaseApplied && len(unsynced) > 0 {
+		names := make([]string, 0, len(unsynced))
+		for name := range unsynced {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		edgeTarget.Phase = TargetPhasePending
+		edgeTarget.Message = fmt.Sprintf("the policies are not synced to the SyncTargets %s yet", strings.Join(names, ", "))
+	}
+	return []kcptoolsv1alpha1.PolicyBundleTargetStatus{workspaceTarget, edgeTarget}
+}
+
+// applyPolicy server-side applies a policy, so that it is created or updated without a read-modify-write cycle.
+func applyPolicy(
+	ctx context.Context,
+	dyClient dynamic.Interface,
+	mapping meta.RESTMapping,
+	obj unstructured.Unstructured,
+) (*unstructured.Unstructured, error) {
+	ri := dyClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return ri.Namespace(obj.GetNamespace()).Apply(ctx, obj.GetName(), &obj,
+			metav1.ApplyOptions{FieldManager: policyBundleFieldManager, Force: true})
+	}
+	return ri.Apply(ctx, obj.GetName(), &obj, metav1.ApplyOptions{FieldManager: policyBundleFieldManager, Force: true})
+}
+
+// removePolicies deletes the given policies from the workspace. The workspace must still be managed by a PolicyControl.
+func (r *PolicyBundleReconciler) removePolicies(
+	ctx context.Context,
+	logger logr.Logger,
+	bundle *kcptoolsv1alpha1.PolicyBundle,
+	workspace string,
+	refs []string,
+) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := r.List(ctx, &pcList, client.InNamespace(bundle.GetNamespace())); err != nil {
+		return err
+	}
+	for _, pc := range pcList.Items {
+		if pc.Spec.Workspace != workspace {
+			continue
+		}
+		effective, err := applyTemplate(ctx, r.Client, logger, pc)
+		if err != nil {
+			return err
+		}
+		config, mapper, err := getPolicyControlWorkspaceConfigs(ctx, r.Client, logger, effective)
+		if err != nil {
+			return err
+		}
+		dyClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			obj := policyFromRef(ref)
+			mapping, err := getMapping(logger, obj, mapper)
+			if err != nil {
+				return err
+			}
+			err = dyClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, fmt.Sprintf("failed to delete %s from workspace %s", ref, workspace))
+				return err
+			}
+		}
+		return nil
+	}
+	logger.Info(fmt.Sprintf("workspace %s is no longer managed by a PolicyControl, leaving %d policies in place", workspace, len(refs)))
+	return nil
+}
+
+// policyRef identifies a placed policy as <namespace>/<name> for Policies and <name> for ClusterPolicies.
+func policyRef(obj unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func policyFromRef(ref string) unstructured.Unstructured {
+	obj := unstructured.Unstructured{}
+	obj.SetAPIVersion(kyvernoGroup + "/v1")
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		obj.SetKind(kyvernoPolicyKind)
+		obj.SetNamespace(parts[0])
+		obj.SetName(parts[1])
+	} else {
+		obj.SetKind(kyvernoClusterPolicyKind)
+		obj.SetName(ref)
+	}
+	return obj
+}
+
+func subtractPolicyRefs(refs []string, keep []string) []string {
+	kept := map[string]bool{}
+	for _, k := range keep {
+		kept[k] = true
+	}
+	var rest []string
+	for _, ref := range refs {
+		if !kept[ref] {
+			rest = append(rest, ref)
+		}
+	}
+	return rest
+}
+
+// findPolicyBundlesForConfigMap maps a ConfigMap to the PolicyBundles loading policies from it.
+func (r *PolicyBundleReconciler) findPolicyBundlesForConfigMap(obj client.Object) []reconcile.Request {
+	var bundles kcptoolsv1alpha1.PolicyBundleList
+	if err := r.List(context.Background(), &bundles, client.InNamespace(obj.GetNamespace()), client.MatchingFields{configMapRefIndexKey: obj.GetName()}); err != nil {
+		return nil
+	}
+	return policyBundleRequests(bundles)
+}
+
+// findPolicyBundlesForPolicyControl maps a PolicyControl to the PolicyBundles in its namespace,
+// since any of them may select the PolicyControl.
+func (r *PolicyBundleReconciler) findPolicyBundlesForPolicyControl(obj client.Object) []reconcile.Request {
+	var bundles kcptoolsv1alpha1.PolicyBundleList
+	if err := r.List(context.Background(), &bundles, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	return policyBundleRequests(bundles)
+}
+
+func policyBundleRequests(bundles kcptoolsv1alpha1.PolicyBundleList) []reconcile.Request {
+	requests := make([]reconcile.Request, 0, len(bundles.Items))
+	for _, b := range bundles.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: b.GetNamespace(), Name: b.GetName()},
+		})
+	}
+	return requests
+}
+
+// policyControlTargetChanged passes the events of PolicyControls which may change the targets of the
+// PolicyBundles, leaving out the status updates of the probes, compliance and edge status.
+var policyControlTargetChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPC, ok := e.ObjectOld.(*kcptoolsv1alpha1.PolicyControl)
+		if !ok {
+			return false
+		}
+		newPC, ok := e.ObjectNew.(*kcptoolsv1alpha1.PolicyControl)
+		if !ok {
+			return false
+		}
+		return oldPC.GetGeneration() != newPC.GetGeneration() ||
+			!equality.Semantic.DeepEqual(oldPC.GetLabels(), newPC.GetLabels()) ||
+			oldPC.Status.WorkspaceName != newPC.Status.WorkspaceName
+	},
+	GenericFunc: func(e event.GenericEvent) bool { return false },
+}
+
+func indexConfigMapRef(obj client.Object) []string {
+	bundle, ok := obj.(*kcptoolsv1alpha1.PolicyBundle)
+	if !ok || bundle.Spec.ConfigMapRef == nil {
+		return nil
+	}
+	return []string{bundle.Spec.ConfigMapRef.Name}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PolicyBundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &kcptoolsv1alpha1.PolicyBundle{}, configMapRefIndexKey, indexConfigMapRef); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kcptoolsv1alpha1.PolicyBundle{}).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.findPolicyBundlesForConfigMap),
+		).
+		Watches(
+			&source.Kind{Type: &kcptoolsv1alpha1.PolicyControl{}},
+			handler.EnqueueRequestsFromMapFunc(r.findPolicyBundlesForPolicyControl),
+			builder.WithPredicates(policyControlTargetChanged),
+		).
+		Complete(r)
+}
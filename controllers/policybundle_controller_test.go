@@ -0,0 +1,234 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+// Policies imported into the workspace by a syncer started with --resources=kyvernoes,policies
+var policiesAPI = fakeAPI{policyGVR, kyvernoPolicyKind, true}
+
+// testClusterPolicy is a ClusterPolicy manifest requiring the label on Pods.
+func testClusterPolicy(label string) string {
+	return `apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-labels
+spec:
+  validationFailureAction: Enforce
+  rules:
+  - name: check-label
+    match:
+      resources:
+        kinds: ["Pod"]
+    validate:
+      message: "the label ` + label + ` is required"
+      pattern:
+        metadata:
+          labels:
+            ` + label + `: "?*"
+`
+}
+
+// bindSyncTarget binds the workspace path to a new SyncTarget name through a Location and a Placement.
+func bindSyncTarget(kcp *fakeKcp, path, name string) {
+	kcp.create(path, syncTargetResource, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "workload.kcp.dev/v1alpha1", "kind": "SyncTarget", "metadata": map[string]interface{}{"name": name},
+	}})
+	kcp.create(path, locationResource, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "scheduling.kcp.dev/v1alpha1", "kind": "Location", "metadata": map[string]interface{}{"name": "default"},
+	}})
+	kcp.create(path, placementResource, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "scheduling.kcp.dev/v1alpha1", "kind": "Placement", "metadata": map[string]interface{}{"name": "default"},
+		"status": map[string]interface{}{
+			"selectedLocation": map[string]interface{}{"path": path, "locationName": "default"},
+		},
+	}})
+}
+
+// statusUpdateCounter counts the status updates made through its client.
+type statusUpdateCounter struct {
+	client.Client
+	updates int
+}
+
+func (c *statusUpdateCounter) Status() client.StatusWriter {
+	return &countingStatusWriter{StatusWriter: c.Client.Status(), counter: c}
+}
+
+type countingStatusWriter struct {
+	client.StatusWriter
+	counter *statusUpdateCounter
+}
+
+func (w *countingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	w.counter.updates++
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+var _ = Describe("PolicyBundle controller", func() {
+	var (
+		env        *policyControlEnv
+		reconciler *PolicyBundleReconciler
+		cm         *corev1.ConfigMap
+		bundle     *kcptoolsv1alpha1.PolicyBundle
+	)
+
+	reconcileBundle := func() (ctrl.Result, *kcptoolsv1alpha1.PolicyBundle) {
+		result, err := reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bundle)})
+		Expect(err).NotTo(HaveOccurred())
+		var live kcptoolsv1alpha1.PolicyBundle
+		Expect(env.pcc.Get(env.ctx, client.ObjectKeyFromObject(bundle), &live)).To(Succeed())
+		return result, &live
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		env.kcp.addWorkspace("root:edge3", operatorGroupsAPI, subscriptionsAPI, kyvernoesAPI, policiesAPI)
+		pc := newTestPolicyControl("pccr-edge3", "root:edge3")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		// binds the Kyverno APIs in the workspace
+		env.reconcile(pc)
+		reconciler = &PolicyBundleReconciler{Client: env.pcc, Scheme: scheme.Scheme}
+
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "policies", Namespace: testNamespace},
+			Data:       map[string]string{"require-labels.yaml": testClusterPolicy("team")},
+		}
+		Expect(env.pcc.Create(env.ctx, cm)).To(Succeed())
+		bundle = &kcptoolsv1alpha1.PolicyBundle{
+			ObjectMeta: metav1.ObjectMeta{Name: "baseline", Namespace: testNamespace},
+			Spec: kcptoolsv1alpha1.PolicyBundleSpec{
+				ConfigMapRef: &corev1.LocalObjectReference{Name: "policies"},
+				Targets:      kcptoolsv1alpha1.PolicyBundleTargets{Workspaces: []string{"root:edge3"}},
+			},
+		}
+	})
+
+	It("places the policies into the workspace and updates them in place", func() {
+		Expect(env.pcc.Create(env.ctx, bundle)).To(Succeed())
+		_, live := reconcileBundle()
+		Expect(live.Status.Targets).To(HaveLen(1))
+		Expect(live.Status.Targets[0].Phase).To(Equal(TargetPhaseApplied))
+		Expect(live.Status.Targets[0].Policies).To(Equal([]string{"require-labels"}))
+		Expect(meta.IsStatusConditionTrue(live.Status.Conditions, ConditionTypeReady)).To(BeTrue())
+		policy := env.kcp.get("root:edge3", clusterPolicyGVR, "", "require-labels")
+		Expect(policy).NotTo(BeNil())
+		Expect(policy.GetLabels()).To(HaveKeyWithValue(policyBundleLabel, "baseline"))
+
+		By("updating the policy, which the workspace only accepts with its resourceVersion")
+		cm.Data["require-labels.yaml"] = testClusterPolicy("owner")
+		Expect(env.pcc.Update(env.ctx, cm)).To(Succeed())
+		_, live = reconcileBundle()
+		Expect(live.Status.Targets[0].Phase).To(Equal(TargetPhaseApplied), live.Status.Targets[0].Message)
+		policy = env.kcp.get("root:edge3", clusterPolicyGVR, "", "require-labels")
+		rules, _, _ := unstructured.NestedSlice(policy.Object, "spec", "rules")
+		Expect(rules).To(HaveLen(1))
+		message, _, _ := unstructured.NestedString(rules[0].(map[string]interface{}), "validate", "message")
+		Expect(message).To(Equal("the label owner is required"))
+	})
+
+	It("leaves an unchanged status alone", func() {
+		Expect(env.pcc.Create(env.ctx, bundle)).To(Succeed())
+		counter := &statusUpdateCounter{Client: env.pcc}
+		reconciler.Client = counter
+		reconcileBundle()
+		Expect(counter.updates).To(Equal(1))
+		reconcileBundle()
+		Expect(counter.updates).To(Equal(1))
+	})
+
+	It("is triggered by the PolicyControl changes which may change the targets only", func() {
+		var pc kcptoolsv1alpha1.PolicyControl
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "pccr-edge3"}, &pc)).To(Succeed())
+		changed := func(mutate func(*kcptoolsv1alpha1.PolicyControl)) bool {
+			updated := pc.DeepCopy()
+			mutate(updated)
+			return policyControlTargetChanged.Update(event.UpdateEvent{ObjectOld: &pc, ObjectNew: updated})
+		}
+		Expect(changed(func(pc *kcptoolsv1alpha1.PolicyControl) { pc.Generation++ })).To(BeTrue())
+		Expect(changed(func(pc *kcptoolsv1alpha1.PolicyControl) { pc.Labels = map[string]string{"team": "a"} })).To(BeTrue())
+		Expect(changed(func(pc *kcptoolsv1alpha1.PolicyControl) { pc.Status.WorkspaceName = "renamed" })).To(BeTrue())
+		Expect(changed(func(pc *kcptoolsv1alpha1.PolicyControl) {
+			pc.Status.Compliance = &kcptoolsv1alpha1.ComplianceCounts{Pass: 1}
+			meta.SetStatusCondition(&pc.Status.Conditions, metav1.Condition{
+				Type: "Probed", Status: metav1.ConditionTrue, Reason: "Probed", LastTransitionTime: metav1.Now(),
+			})
+		})).To(BeFalse())
+	})
+
+	Context("with edge namespaces", func() {
+		BeforeEach(func() {
+			bundle.Spec.Targets.EdgeNamespaces = []string{"edge-policies"}
+			env.kcp.create("root:edge3", namespaceGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{"name": "edge-policies"},
+			}})
+			Expect(env.pcc.Create(env.ctx, bundle)).To(Succeed())
+		})
+
+		It("fails the edge target when the workspace is not bound to any SyncTarget", func() {
+			result, live := reconcileBundle()
+			Expect(live.Status.Targets).To(HaveLen(2))
+			Expect(live.Status.Targets[1].Type).To(Equal(TargetTypeEdge))
+			Expect(live.Status.Targets[1].Phase).To(Equal(TargetPhaseFailed))
+			Expect(live.Status.Targets[1].Message).To(ContainSubstring("not bound to any SyncTarget"))
+			Expect(meta.FindStatusCondition(live.Status.Conditions, ConditionTypeReady).Reason).To(Equal("RolloutFailed"))
+			Expect(result.RequeueAfter).To(Equal(policyBundleRetryAfter))
+		})
+
+		It("reports the edge target applied once the Policies are synced to every SyncTarget", func() {
+			bindSyncTarget(env.kcp, "root:edge3", "cluster-a")
+
+			By("waiting for kcp to sync the Policies")
+			result, live := reconcileBundle()
+			Expect(live.Status.Targets[1].Phase).To(Equal(TargetPhasePending))
+			Expect(live.Status.Targets[1].Message).To(ContainSubstring("root:edge3:cluster-a"))
+			Expect(live.Status.Targets[1].Policies).To(Equal([]string{"edge-policies/require-labels"}))
+			Expect(meta.FindStatusCondition(live.Status.Conditions, ConditionTypeReady).Reason).To(Equal("RollingOut"))
+			Expect(result.RequeueAfter).To(Equal(policyBundleRetryAfter))
+			policy := env.kcp.get("root:edge3", policyGVR, "edge-policies", "require-labels")
+			Expect(policy).NotTo(BeNil())
+			Expect(policy.GetKind()).To(Equal(kyvernoPolicyKind))
+
+			By("reporting the Policies synced")
+			env.kcp.update("root:edge3", policyGVR, "edge-policies", "require-labels", func(obj *unstructured.Unstructured) {
+				obj.SetLabels(map[string]string{
+					policyBundleLabel: "baseline",
+					syncTargetStateLabelPrefix + syncTargetKey("root:edge3", "cluster-a"): syncTargetStateSync,
+				})
+			})
+			_, live = reconcileBundle()
+			Expect(live.Status.Targets[1].Phase).To(Equal(TargetPhaseApplied))
+			Expect(meta.IsStatusConditionTrue(live.Status.Conditions, ConditionTypeReady)).To(BeTrue())
+		})
+	})
+})
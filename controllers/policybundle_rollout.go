@@ -0,0 +1,330 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+const (
+	RolloutStrategyDirect = "Direct"
+	RolloutStrategyStaged = "Staged"
+
+	RolloutPhaseAuditing   = "Auditing"
+	RolloutPhaseEnforcing  = "Enforcing"
+	RolloutPhaseRolledBack = "RolledBack"
+
+	validationFailureActionAudit   = "Audit"
+	validationFailureActionEnforce = "Enforce"
+
+	rolloutCheckInterval  = time.Minute
+	defaultRollbackWindow = 10 * time.Minute
+
+	// reason and source of the events the Kyverno admission controller records on a policy denying a request
+	// once it is enforced
+	kyvernoPolicyViolationReason   = "PolicyViolation"
+	kyvernoAdmissionEventComponent = "kyverno-admission"
+)
+
+var (
+	policyReportGVR        = schema.GroupVersionResource{Group: "wgpolicyk8s.io", Version: "v1alpha2", Resource: "policyreports"}
+	clusterPolicyReportGVR = schema.GroupVersionResource{Group: "wgpolicyk8s.io", Version: "v1alpha2", Resource: "clusterpolicyreports"}
+)
+
+// progressRollout advances the staged rollout of the bundle. It returns the validationFailureAction the policies
+// have to be applied with ("" keeps them as given) and when the rollout has to be checked again (0 for never).
+func (r *PolicyBundleReconciler) progressRollout(
+	ctx context.Context,
+	logger logr.Logger,
+	bundle *kcptoolsv1alpha1.PolicyBundle,
+	pcs []kcptoolsv1alpha1.PolicyControl,
+	policies []unstructured.Unstructured,
+) (string, time.Duration) {
+	rollout := bundle.Spec.Rollout
+	if rollout == nil || rollout.Strategy != RolloutStrategyStaged {
+		bundle.Status.Rollout = nil
+		return "", 0
+	}
+
+	now := metav1.Now()
+	hash := hashPolicies(policies)
+	status := bundle.Status.Rollout
+	if status == nil || status.PoliciesHash != hash {
+		bundle.Status.Rollout = &kcptoolsv1alpha1.PolicyBundleRolloutStatus{
+			Phase:          RolloutPhaseAuditing,
+			PoliciesHash:   hash,
+			AuditStartTime: &now,
+			Message:        fmt.Sprintf("policies are audited for %s before enforcement", rollout.SoakDuration.Duration),
+		}
+		return validationFailureActionAudit, rollout.SoakDuration.Duration
+	}
+
+	action := validationFailureActionAudit
+	if status.Phase == RolloutPhaseEnforcing {
+		action = validationFailureActionEnforce
+	}
+	if rollout.Paused {
+		status.Message = fmt.Sprintf("rollout is paused in %s", status.Phase)
+		return action, 0
+	}
+
+	names := policyNames(policies)
+	switch status.Phase {
+	case RolloutPhaseAuditing:
+		if remaining := rollout.SoakDuration.Duration - now.Sub(status.AuditStartTime.Time); remaining > 0 {
+			return action, remaining
+		}
+		violations, err := r.countViolations(ctx, logger, pcs, names)
+		if err != nil {
+			status.Message = fmt.Sprintf("failed to count violations: %s", err.Error())
+			return action, rolloutCheckInterval
+		}
+		status.Violations = violations
+		if violations > rollout.MaxViolations {
+			status.Message = fmt.Sprintf("%d violations exceed the maximum of %d for promotion", violations, rollout.MaxViolations)
+			return action, rolloutCheckInterval
+		}
+		logger.Info(fmt.Sprintf("promote policies of PolicyBundle %s to Enforce with %d violations", bundle.GetName(), violations))
+		status.Phase = RolloutPhaseEnforcing
+		status.EnforceStartTime = &now
+		status.Message = fmt.Sprintf("promoted to Enforce with %d violations", violations)
+		if rollout.RollbackDenialThreshold == 0 {
+			return validationFailureActionEnforce, 0
+		}
+		// the events recorded while auditing are not denials, so the first window starts from their counts
+		status.DenialWindowStartTime = nil
+		if denials, edgeDenials, err := r.countDenials(ctx, logger, bundle, pcs, names); err != nil {
+			logger.Error(err, "failed to count admission denials")
+		} else {
+			startDenialWindow(status, now, denials, edgeDenials)
+		}
+		return validationFailureActionEnforce, rolloutCheckInterval
+	case RolloutPhaseEnforcing:
+		if rollout.RollbackDenialThreshold == 0 {
+			return action, 0
+		}
+		denials, edgeDenials, err := r.countDenials(ctx, logger, bundle, pcs, names)
+		if err != nil {
+			status.Message = fmt.Sprintf("failed to count admission denials: %s", err.Error())
+			return action, rolloutCheckInterval
+		}
+		window := rollout.RollbackWindow.Duration
+		if window == 0 {
+			window = defaultRollbackWindow
+		}
+		// events expire, so counts below the baseline start a new window
+		if status.DenialWindowStartTime == nil || denials < status.DenialBaseline || edgeDenials < status.EdgeDenialBaseline {
+			startDenialWindow(status, now, denials, edgeDenials)
+		}
+		status.Denials = denials - status.DenialBaseline
+		status.EdgeDenials = edgeDenials - status.EdgeDenialBaseline
+		if total := status.Denials + status.EdgeDenials; total >= rollout.RollbackDenialThreshold {
+			logger.Info(fmt.Sprintf("roll back policies of PolicyBundle %s to Audit after %d denials within %s", bundle.GetName(), total, window))
+			status.Phase = RolloutPhaseRolledBack
+			status.Message = fmt.Sprintf("rolled back to Audit after %d admission denials within %s (%d on the edge clusters, threshold %d)",
+				total, window, status.EdgeDenials, rollout.RollbackDenialThreshold)
+			return validationFailureActionAudit, 0
+		}
+		remaining := window - now.Sub(status.DenialWindowStartTime.Time)
+		if remaining <= 0 {
+			startDenialWindow(status, now, denials, edgeDenials)
+			remaining = window
+		}
+		return action, shorterRequeue(rolloutCheckInterval, remaining)
+	default:
+		// RolledBack stays in Audit until the policies change
+		return validationFailureActionAudit, 0
+	}
+}
+
+// withValidationFailureAction returns copies of the policies with spec.validationFailureAction set to action.
+func withValidationFailureAction(policies []unstructured.Unstructured, action string) ([]unstructured.Unstructured, error) {
+	if action == "" {
+		return policies, nil
+	}
+	staged := make([]unstructured.Unstructured, 0, len(policies))
+	for _, p := range policies {
+		obj := p.DeepCopy()
+		if err := unstructured.SetNestedField(obj.Object, action, "spec", "validationFailureAction"); err != nil {
+			return nil, err
+		}
+		staged = append(staged, *obj)
+	}
+	return staged, nil
+}
+
+// countViolations sums the failed results of the policies in the PolicyReports and ClusterPolicyReports of the workspaces.
+func (r *PolicyBundleReconciler) countViolations(
+	ctx context.Context,
+	logger logr.Logger,
+	pcs []kcptoolsv1alpha1.PolicyControl,
+	names map[string]bool,
+) (int32, error) {
+	var violations int32
+	for _, pc := range pcs {
+		config, _, err := getPolicyControlWorkspaceConfigs(ctx, r.Client, logger, pc)
+		if err != nil {
+			return 0, err
+		}
+		dyClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return 0, err
+		}
+		reports, err := listPolicyReports(ctx, dyClient)
+		if err != nil {
+			return 0, err
+		}
+		for _, report := range reports {
+			for _, result := range policyReportResults(report) {
+				if names[fmt.Sprint(result["policy"])] && result["result"] == "fail" {
+					violations++
+				}
+			}
+		}
+	}
+	return violations, nil
+}
+
+// listPolicyReports returns the PolicyReports of all namespaces and the ClusterPolicyReports.
+func listPolicyReports(ctx context.Context, dyClient dynamic.Interface) ([]unstructured.Unstructured, error) {
+	var reports []unstructured.Unstructured
+	for _, gvr := range []schema.GroupVersionResource{policyReportGVR, clusterPolicyReportGVR} {
+		list, err := dyClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, list.Items...)
+	}
+	return reports, nil
+}
+
+func policyReportResults(report unstructured.Unstructured) []map[string]interface{} {
+	var results []map[string]interface{}
+	items, _, _ := unstructured.NestedSlice(report.Object, "results")
+	for _, item := range items {
+		if result, ok := item.(map[string]interface{}); ok {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// startDenialWindow starts a rollback window at now from the current counts of the denials.
+func startDenialWindow(status *kcptoolsv1alpha1.PolicyBundleRolloutStatus, now metav1.Time, denials, edgeDenials int32) {
+	status.DenialWindowStartTime = &now
+	status.DenialBaseline, status.EdgeDenialBaseline = denials, edgeDenials
+	status.Denials, status.EdgeDenials = 0, 0
+}
+
+// countDenials sums the counts of the PolicyViolation events the Kyverno admission controller recorded on the
+// policies in the workspaces. Events of the background scan report existing resources rather than denied requests
+// and are not counted. The admission events of the Kyverno of the edge clusters are not synced back to the
+// workspaces, so the denials on the edge clusters are counted from the failed results of the policies of the edge
+// namespaces in the PolicyReports the syncer brings back from the edge clusters instead.
+func (r *PolicyBundleReconciler) countDenials(
+	ctx context.Context,
+	logger logr.Logger,
+	bundle *kcptoolsv1alpha1.PolicyBundle,
+	pcs []kcptoolsv1alpha1.PolicyControl,
+	names map[string]bool,
+) (int32, int32, error) {
+	var denials, edgeDenials int32
+	for _, pc := range pcs {
+		config, _, err := getPolicyControlWorkspaceConfigs(ctx, r.Client, logger, pc)
+		if err != nil {
+			return 0, 0, err
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return 0, 0, err
+		}
+		events, err := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{FieldSelector: "reason=" + kyvernoPolicyViolationReason})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, event := range events.Items {
+			if event.Reason != kyvernoPolicyViolationReason || event.Source.Component != kyvernoAdmissionEventComponent {
+				continue
+			}
+			kind := event.InvolvedObject.Kind
+			if (kind != kyvernoPolicyKind && kind != kyvernoClusterPolicyKind) || !names[event.InvolvedObject.Name] {
+				continue
+			}
+			count := event.Count
+			if count == 0 {
+				count = 1
+			}
+			denials += count
+		}
+
+		dyClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, ns := range bundle.Spec.Targets.EdgeNamespaces {
+			reports, err := dyClient.Resource(policyReportGVR).Namespace(ns).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return 0, 0, err
+			}
+			for _, report := range reports.Items {
+				if reportSyncTarget(report) == "" {
+					continue
+				}
+				for _, result := range policyReportResults(report) {
+					// namespaced policies may be reported as <namespace>/<name>
+					policy := strings.TrimPrefix(fmt.Sprint(result["policy"]), ns+"/")
+					if names[policy] && result["result"] == "fail" {
+						edgeDenials++
+					}
+				}
+			}
+		}
+	}
+	return denials, edgeDenials, nil
+}
+
+func policyNames(policies []unstructured.Unstructured) map[string]bool {
+	names := map[string]bool{}
+	for _, p := range policies {
+		names[p.GetName()] = true
+	}
+	return names
+}
+
+func hashPolicies(policies []unstructured.Unstructured) string {
+	h := sha256.New()
+	for _, p := range policies {
+		b, _ := json.Marshal(p.Object)
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
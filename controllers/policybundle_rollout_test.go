@@ -0,0 +1,241 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+var eventGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+var _ = Describe("PolicyBundle staged rollout", func() {
+	var (
+		env        *policyControlEnv
+		reconciler *PolicyBundleReconciler
+		bundle     *kcptoolsv1alpha1.PolicyBundle
+	)
+
+	reconcileBundle := func() (ctrl.Result, *kcptoolsv1alpha1.PolicyBundle) {
+		result, err := reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bundle)})
+		Expect(err).NotTo(HaveOccurred())
+		var live kcptoolsv1alpha1.PolicyBundle
+		Expect(env.pcc.Get(env.ctx, client.ObjectKeyFromObject(bundle), &live)).To(Succeed())
+		return result, &live
+	}
+	// updateRollout changes the rollout status as if the time had passed
+	updateRollout := func(mutate func(*kcptoolsv1alpha1.PolicyBundleRolloutStatus)) {
+		var live kcptoolsv1alpha1.PolicyBundle
+		Expect(env.pcc.Get(env.ctx, client.ObjectKeyFromObject(bundle), &live)).To(Succeed())
+		mutate(live.Status.Rollout)
+		Expect(env.pcc.Status().Update(env.ctx, &live)).To(Succeed())
+	}
+	action := func(namespace, name string) string {
+		gvr := clusterPolicyGVR
+		if namespace != "" {
+			gvr = policyGVR
+		}
+		policy := env.kcp.get("root:edge3", gvr, namespace, name)
+		Expect(policy).NotTo(BeNil())
+		value, _, _ := unstructured.NestedString(policy.Object, "spec", "validationFailureAction")
+		return value
+	}
+	// recordViolations records the PolicyViolation event of a Kyverno component on the policy, or raises its count
+	recordViolations := func(component, namespace, kind, name string, count int32) {
+		eventName := name + "." + component
+		eventNamespace := namespace
+		if eventNamespace == "" {
+			eventNamespace = corev1.NamespaceDefault
+		}
+		if env.kcp.get("root:edge3", eventGVR, eventNamespace, eventName) != nil {
+			env.kcp.update("root:edge3", eventGVR, eventNamespace, eventName, func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(obj.Object, int64(count), "count")
+			})
+			return
+		}
+		env.kcp.create("root:edge3", eventGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Event",
+			"metadata":   map[string]interface{}{"name": eventName, "namespace": eventNamespace},
+			"involvedObject": map[string]interface{}{
+				"apiVersion": "kyverno.io/v1", "kind": kind, "namespace": namespace, "name": name,
+			},
+			"reason":  kyvernoPolicyViolationReason,
+			"message": "Pod default/nginx: [check-label] fail",
+			"source":  map[string]interface{}{"component": component},
+			"count":   int64(count),
+		}})
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		env.kcp.addWorkspace("root:edge3", operatorGroupsAPI, subscriptionsAPI, kyvernoesAPI, policiesAPI)
+		pc := newTestPolicyControl("pccr-edge3", "root:edge3")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		reconciler = &PolicyBundleReconciler{Client: env.pcc, Scheme: scheme.Scheme}
+		// the events of ClusterPolicies are recorded in the default namespace
+		for _, ns := range []string{corev1.NamespaceDefault, "edge-policies"} {
+			env.kcp.create("root:edge3", namespaceGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{"name": ns},
+			}})
+		}
+		bindSyncTarget(env.kcp, "root:edge3", "cluster-a")
+
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "policies", Namespace: testNamespace},
+			Data:       map[string]string{"require-labels.yaml": testClusterPolicy("team")},
+		}
+		Expect(env.pcc.Create(env.ctx, cm)).To(Succeed())
+		bundle = &kcptoolsv1alpha1.PolicyBundle{
+			ObjectMeta: metav1.ObjectMeta{Name: "baseline", Namespace: testNamespace},
+			Spec: kcptoolsv1alpha1.PolicyBundleSpec{
+				ConfigMapRef: &corev1.LocalObjectReference{Name: "policies"},
+				Targets: kcptoolsv1alpha1.PolicyBundleTargets{
+					Workspaces:     []string{"root:edge3"},
+					EdgeNamespaces: []string{"edge-policies"},
+				},
+				Rollout: &kcptoolsv1alpha1.PolicyBundleRollout{
+					Strategy:                RolloutStrategyStaged,
+					SoakDuration:            metav1.Duration{Duration: time.Hour},
+					RollbackDenialThreshold: 3,
+					RollbackWindow:          metav1.Duration{Duration: 10 * time.Minute},
+				},
+			},
+		}
+		Expect(env.pcc.Create(env.ctx, bundle)).To(Succeed())
+
+		By("auditing the policies first")
+		result, live := reconcileBundle()
+		Expect(live.Status.Rollout.Phase).To(Equal(RolloutPhaseAuditing))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour))
+		Expect(action("", "require-labels")).To(Equal(validationFailureActionAudit))
+		Expect(action("edge-policies", "require-labels")).To(Equal(validationFailureActionAudit))
+		// violations of the audit phase are not denials
+		recordViolations(kyvernoAdmissionEventComponent, "", kyvernoClusterPolicyKind, "require-labels", 7)
+
+		By("promoting the policies once the soak period passed")
+		updateRollout(func(status *kcptoolsv1alpha1.PolicyBundleRolloutStatus) {
+			status.AuditStartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+		})
+		_, live = reconcileBundle()
+		Expect(live.Status.Rollout.Phase).To(Equal(RolloutPhaseEnforcing), live.Status.Rollout.Message)
+		Expect(live.Status.Rollout.DenialBaseline).To(Equal(int32(7)))
+		Expect(action("", "require-labels")).To(Equal(validationFailureActionEnforce))
+		Expect(action("edge-policies", "require-labels")).To(Equal(validationFailureActionEnforce))
+	})
+
+	It("rolls back when the denials within the window reach the threshold", func() {
+		recordViolations(kyvernoAdmissionEventComponent, "", kyvernoClusterPolicyKind, "require-labels", 9)
+		// the background scan reports existing resources, not denied requests
+		recordViolations("kyverno-scan", "", kyvernoClusterPolicyKind, "require-labels", 50)
+		_, live := reconcileBundle()
+		Expect(live.Status.Rollout.Phase).To(Equal(RolloutPhaseEnforcing))
+		Expect(live.Status.Rollout.Denials).To(Equal(int32(2)))
+
+		recordViolations(kyvernoAdmissionEventComponent, "", kyvernoClusterPolicyKind, "require-labels", 10)
+		_, live = reconcileBundle()
+		Expect(live.Status.Rollout.Phase).To(Equal(RolloutPhaseRolledBack))
+		Expect(live.Status.Rollout.Denials).To(Equal(int32(3)))
+		Expect(action("", "require-labels")).To(Equal(validationFailureActionAudit))
+		Expect(action("edge-policies", "require-labels")).To(Equal(validationFailureActionAudit))
+	})
+
+	It("starts a new window once the window passed", func() {
+		recordViolations(kyvernoAdmissionEventComponent, "", kyvernoClusterPolicyKind, "require-labels", 9)
+		updateRollout(func(status *kcptoolsv1alpha1.PolicyBundleRolloutStatus) {
+			status.DenialWindowStartTime = &metav1.Time{Time: time.Now().Add(-11 * time.Minute)}
+		})
+		result, live := reconcileBundle()
+		Expect(live.Status.Rollout.Phase).To(Equal(RolloutPhaseEnforcing))
+		Expect(live.Status.Rollout.DenialBaseline).To(Equal(int32(9)))
+		Expect(result.RequeueAfter).To(Equal(rolloutCheckInterval))
+
+		// two denials in each of two windows stay below the rate of three per window
+		recordViolations(kyvernoAdmissionEventComponent, "", kyvernoClusterPolicyKind, "require-labels", 11)
+		_, live = reconcileBundle()
+		Expect(live.Status.Rollout.Phase).To(Equal(RolloutPhaseEnforcing))
+		Expect(live.Status.Rollout.Denials).To(Equal(int32(2)))
+		Expect(action("", "require-labels")).To(Equal(validationFailureActionEnforce))
+	})
+
+	It("counts the denials on the edge clusters from the PolicyReports synced back", func() {
+		// reportFailures creates the PolicyReport the syncer brings back from the edge cluster, or updates its results
+		reportFailures := func(failures int) {
+			results := []interface{}{
+				map[string]interface{}{"policy": "require-labels", "rule": "check-label", "result": "pass"},
+				map[string]interface{}{"policy": "other-policy", "rule": "check", "result": "fail"},
+			}
+			for i := 0; i < failures; i++ {
+				results = append(results, map[string]interface{}{"policy": "edge-policies/require-labels", "rule": "check-label", "result": "fail"})
+			}
+			if env.kcp.get("root:edge3", policyReportGVR, "edge-policies", "polr-ns-edge-policies") != nil {
+				env.kcp.update("root:edge3", policyReportGVR, "edge-policies", "polr-ns-edge-policies", func(obj *unstructured.Unstructured) {
+					_ = unstructured.SetNestedSlice(obj.Object, results, "results")
+				})
+				return
+			}
+			env.kcp.create("root:edge3", policyReportGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "wgpolicyk8s.io/v1alpha2",
+				"kind":       "PolicyReport",
+				"metadata": map[string]interface{}{
+					"name":      "polr-ns-edge-policies",
+					"namespace": "edge-policies",
+					"labels": map[string]interface{}{
+						syncTargetStateLabelPrefix + syncTargetKey("root:edge3", "cluster-a"): syncTargetStateSync,
+					},
+				},
+				"results": results,
+			}})
+		}
+		// a report of the workspace itself is not from an edge cluster
+		env.kcp.create("root:edge3", policyReportGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "wgpolicyk8s.io/v1alpha2",
+			"kind":       "PolicyReport",
+			"metadata":   map[string]interface{}{"name": "polr-workspace", "namespace": "edge-policies"},
+			"results": []interface{}{
+				map[string]interface{}{"policy": "require-labels", "rule": "check-label", "result": "fail"},
+			},
+		}})
+		reportFailures(0)
+		_, live := reconcileBundle()
+		Expect(live.Status.Rollout.EdgeDenials).To(BeZero())
+
+		reportFailures(2)
+		_, live = reconcileBundle()
+		Expect(live.Status.Rollout.EdgeDenials).To(Equal(int32(2)))
+		Expect(live.Status.Rollout.Denials).To(BeZero())
+
+		recordViolations(kyvernoAdmissionEventComponent, "", kyvernoClusterPolicyKind, "require-labels", 8)
+		_, live = reconcileBundle()
+		Expect(live.Status.Rollout.Phase).To(Equal(RolloutPhaseRolledBack))
+		Expect(live.Status.Rollout.Message).To(ContainSubstring("2 on the edge clusters"))
+		Expect(action("edge-policies", "require-labels")).To(Equal(validationFailureActionAudit))
+	})
+})
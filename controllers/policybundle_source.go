@@ -0,0 +1,388 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
+)
+
+const (
+	kyvernoGroup             = "kyverno.io"
+	kyvernoPolicyKind        = "Policy"
+	kyvernoClusterPolicyKind = "ClusterPolicy"
+
+	dockerHubRegistry = "registry-1.docker.io"
+	// media types of the manifests accepted from the registry, image indexes first
+	ociManifestMediaTypes = "application/vnd.oci.image.index.v1+json, application/vnd.docker.distribution.manifest.list.v2+json, " +
+		"application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// ociHTTPClient pulls the OCI artifacts. A registry that does not answer within the timeout fails the reconcile
+// of the PolicyBundle rather than blocking its worker.
+var ociHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// loadPolicies collects the Kyverno policies of the bundle from its inline, ConfigMap and OCI artifact sources.
+func loadPolicies(
+	ctx context.Context,
+	c client.Reader,
+	bundle *kcptoolsv1alpha1.PolicyBundle,
+) ([]unstructured.Unstructured, error) {
+	var policies []unstructured.Unstructured
+
+	for i, raw := range bundle.Spec.Policies {
+		objs, err := manifests.Decode(raw.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inline policy %d: %w", i, err)
+		}
+		policies = append(policies, objs...)
+	}
+
+	if ref := bundle.Spec.ConfigMapRef; ref != nil {
+		var cm corev1.ConfigMap
+		if err := c.Get(ctx, client.ObjectKey{Namespace: bundle.GetNamespace(), Name: ref.Name}, &cm); err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(cm.Data))
+		for k := range cm.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			objs, err := manifests.Decode([]byte(cm.Data[k]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy in ConfigMap %s key %s: %w", ref.Name, k, err)
+			}
+			policies = append(policies, objs...)
+		}
+	}
+
+	if artifact := bundle.Spec.OCIArtifact; artifact != nil {
+		objs, err := pullPoliciesFromOCI(ctx, c, bundle.GetNamespace(), artifact)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull %s: %w", artifact.Image, err)
+		}
+		policies = append(policies, objs...)
+	}
+
+	for _, p := range policies {
+		gvk := p.GroupVersionKind()
+		if gvk.Group != kyvernoGroup || (gvk.Kind != kyvernoPolicyKind && gvk.Kind != kyvernoClusterPolicyKind) {
+			return nil, fmt.Errorf("%s %s is neither a Kyverno Policy nor ClusterPolicy", gvk.String(), p.GetName())
+		}
+	}
+	return policies, nil
+}
+
+// ociManifest is an image manifest, or an image index (manifest list) when Manifests is set.
+type ociManifest struct {
+	MediaType string `json:"mediaType"`
+	Layers    []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+type ociRegistryClient struct {
+	registry string
+	username string
+	password string
+	token    string
+}
+
+// pullPoliciesFromOCI fetches an OCI artifact through the registry HTTP API and decodes the policies in its layers.
+// Layers are either YAML documents (as pushed by "kyverno oci push") or gzipped tarballs of YAML files.
+func pullPoliciesFromOCI(
+	ctx context.Context,
+	c client.Reader,
+	namespace string,
+	artifact *kcptoolsv1alpha1.OCIArtifact,
+) ([]unstructured.Unstructured, error) {
+	registry, repository, reference := parseImageReference(artifact.Image)
+	rc := &ociRegistryClient{registry: registry}
+	if artifact.PullSecret != "" {
+		var secret corev1.Secret
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: artifact.PullSecret}, &secret); err != nil {
+			return nil, err
+		}
+		if err := rc.setCredentials(secret.Data[corev1.DockerConfigJsonKey]); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := rc.manifest(ctx, repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Manifests) > 0 {
+		// an image index, e.g. pushed for several platforms, whose manifests all carry the same policies
+		digest := selectIndexManifest(manifest.Manifests)
+		if manifest, err = rc.manifest(ctx, repository, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	var policies []unstructured.Unstructured
+	for _, layer := range manifest.Layers {
+		blob, err := rc.get(ctx, fmt.Sprintf("/v2/%s/blobs/%s", repository, layer.Digest), "*/*")
+		if err != nil {
+			return nil, err
+		}
+		var docs [][]byte
+		if strings.HasSuffix(layer.MediaType, "tar+gzip") {
+			docs, err = extractYAMLFromTarGz(blob)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			docs = [][]byte{blob}
+		}
+		for _, doc := range docs {
+			objs, err := manifests.Decode(doc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy in layer %s: %w", layer.Digest, err)
+			}
+			policies = append(policies, objs...)
+		}
+	}
+	return policies, nil
+}
+
+// manifest fetches the manifest or image index of reference.
+func (rc *ociRegistryClient) manifest(ctx context.Context, repository, reference string) (*ociManifest, error) {
+	body, err := rc.get(ctx, fmt.Sprintf("/v2/%s/manifests/%s", repository, reference), ociManifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// selectIndexManifest picks the manifest of an image index for the platform of the operator, or the first one.
+func selectIndexManifest(descriptors []ociDescriptor) string {
+	for _, d := range descriptors {
+		if d.Platform != nil && d.Platform.OS == runtime.GOOS && d.Platform.Architecture == runtime.GOARCH {
+			return d.Digest
+		}
+	}
+	return descriptors[0].Digest
+}
+
+// parseImageReference splits an image reference into registry host, repository and tag or digest.
+// Docker Hub references, with or without docker.io, are pulled from its registry API host.
+func parseImageReference(image string) (string, string, string) {
+	registry := dockerHubRegistry
+	repository := image
+	if i := strings.Index(image, "/"); i != -1 {
+		host := image[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			registry, repository = host, image[i+1:]
+		}
+	}
+	switch registry {
+	case "docker.io", "index.docker.io", "registry.hub.docker.com":
+		registry = dockerHubRegistry
+	}
+	if registry == dockerHubRegistry && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	reference := "latest"
+	if i := strings.Index(repository, "@"); i != -1 {
+		repository, reference = repository[:i], repository[i+1:]
+	} else if i := strings.LastIndex(repository, ":"); i != -1 {
+		repository, reference = repository[:i], repository[i+1:]
+	}
+	return registry, repository, reference
+}
+
+func (rc *ociRegistryClient) setCredentials(dockerConfigJSON []byte) error {
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(dockerConfigJSON, &config); err != nil {
+		return err
+	}
+	for server, auth := range config.Auths {
+		host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+		host = strings.SplitN(host, "/", 2)[0]
+		if host == "index.docker.io" || host == "docker.io" {
+			host = dockerHubRegistry
+		}
+		if host != rc.registry {
+			continue
+		}
+		rc.username, rc.password = auth.Username, auth.Password
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return err
+			}
+			if pair := strings.SplitN(string(decoded), ":", 2); len(pair) == 2 {
+				rc.username, rc.password = pair[0], pair[1]
+			}
+		}
+	}
+	return nil
+}
+
+func (rc *ociRegistryClient) get(ctx context.Context, path string, accept string) ([]byte, error) {
+	resp, err := rc.do(ctx, path, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && rc.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := rc.authorize(ctx, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = rc.do(ctx, path, accept); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (rc *ociRegistryClient) do(ctx context.Context, path string, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+rc.registry+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if rc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+rc.token)
+	} else if rc.username != "" {
+		req.SetBasicAuth(rc.username, rc.password)
+	}
+	return ociHTTPClient.Do(req)
+}
+
+// authorize obtains a bearer token following the WWW-Authenticate challenge of the registry.
+func (rc *ociRegistryClient) authorize(ctx context.Context, challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, kv := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		if pair := strings.SplitN(strings.TrimSpace(kv), "=", 2); len(pair) == 2 {
+			params[pair[0]] = strings.Trim(pair[1], `"`)
+		}
+	}
+	query := url.Values{}
+	for _, k := range []string{"service", "scope"} {
+		if v, ok := params[k]; ok {
+			query.Set(k, v)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if rc.username != "" {
+		req.SetBasicAuth(rc.username, rc.password)
+	}
+	resp, err := ociHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request returned %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	rc.token = token.Token
+	if rc.token == "" {
+		rc.token = token.AccessToken
+	}
+	return nil
+}
+
+func extractYAMLFromTarGz(blob []byte) ([][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	var docs [][]byte
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ext := filepath.Ext(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		doc, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
@@ -0,0 +1,192 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+// fakeRegistry serves the repository "org/policies" as a registry requiring a bearer token obtained with basic
+// auth. The tag v1 is an image index whose linux/amd64 manifest has a YAML layer and a gzipped tarball layer.
+type fakeRegistry struct {
+	server *httptest.Server
+	blobs  map[string][]byte
+	// requests of the registry, as "<method> <path>"
+	requests []string
+}
+
+func newFakeRegistry() *fakeRegistry {
+	reg := &fakeRegistry{blobs: map[string][]byte{
+		"sha256:yaml":   []byte(testClusterPolicy("team")),
+		"sha256:targz":  tarGz(map[string]string{"owner.yaml": strings.Replace(testClusterPolicy("owner"), "require-labels", "require-owner", 1), "README.md": "#"}),
+		"sha256:amd64":  []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"mediaType":"application/vnd.cncf.kyverno.policy.layer.v1+yaml","digest":"sha256:yaml"},{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:targz"}]}`),
+		"sha256:s390x":  []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`),
+		"v1":            []byte(`{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"digest":"sha256:s390x","platform":{"os":"linux","architecture":"s390x"}},{"digest":"sha256:amd64","platform":{"os":"linux","architecture":"amd64"}}]}`),
+		"sha256:single": []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"mediaType":"application/vnd.cncf.kyverno.policy.layer.v1+yaml","digest":"sha256:yaml"}]}`),
+	}}
+	reg.server = httptest.NewTLSServer(http.HandlerFunc(reg.serveHTTP))
+	return reg
+}
+
+func (reg *fakeRegistry) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.requests = append(reg.requests, r.Method+" "+r.URL.Path)
+	if r.URL.Path == "/token" {
+		if user, password, ok := r.BasicAuth(); !ok || user != "robot" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token":"pull-token"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer pull-token" {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:org/policies:pull"`, reg.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	for _, prefix := range []string{"/v2/org/policies/manifests/", "/v2/org/policies/blobs/"} {
+		if blob, ok := reg.blobs[strings.TrimPrefix(r.URL.Path, prefix)]; ok && strings.HasPrefix(r.URL.Path, prefix) {
+			_, _ = w.Write(blob)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// host is the registry host of image references.
+func (reg *fakeRegistry) host() string {
+	return strings.TrimPrefix(reg.server.URL, "https://")
+}
+
+func tarGz(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gz.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("PolicyBundle OCI source", func() {
+	var (
+		ctx    context.Context
+		reg    *fakeRegistry
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		reg = newFakeRegistry()
+		DeferCleanup(reg.server.Close)
+		httpClient := ociHTTPClient
+		ociHTTPClient = reg.server.Client()
+		ociHTTPClient.Timeout = time.Second
+		DeferCleanup(func() { ociHTTPClient = httpClient })
+
+		auth := base64.StdEncoding.EncodeToString([]byte("robot:secret"))
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+				fmt.Sprintf(`{"auths":{"https://%s":{"auth":"%s"}}}`, reg.host(), auth))},
+		}
+	})
+
+	pull := func(image string) ([]string, error) {
+		c, namespace := newPCOClient(ctx, secret)
+		objs, err := pullPoliciesFromOCI(ctx, c, namespace, &kcptoolsv1alpha1.OCIArtifact{Image: image, PullSecret: "registry"})
+		var names []string
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		return names, err
+	}
+
+	It("resolves an image index to the manifest of the platform and decodes its layers", func() {
+		names, err := pull(reg.host() + "/org/policies:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(Equal([]string{"require-labels", "require-owner"}))
+		Expect(reg.requests).To(ContainElements(
+			"GET /token",
+			"GET /v2/org/policies/manifests/v1",
+			"GET /v2/org/policies/manifests/sha256:amd64",
+			"GET /v2/org/policies/blobs/sha256:targz",
+		))
+	})
+
+	It("pulls an image manifest by digest", func() {
+		names, err := pull(reg.host() + "/org/policies@sha256:single")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(Equal([]string{"require-labels"}))
+	})
+
+	It("fails without the credentials of the registry", func() {
+		secret.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{}}`)
+		_, err := pull(reg.host() + "/org/policies:v1")
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+
+	It("gives up on a registry that does not answer", func() {
+		slow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		DeferCleanup(slow.Close)
+		ociHTTPClient = slow.Client()
+		ociHTTPClient.Timeout = 100 * time.Millisecond
+		_, err := pull(strings.TrimPrefix(slow.URL, "https://") + "/org/policies:v1")
+		Expect(err).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+	})
+
+	DescribeTable("parses image references",
+		func(image, registry, repository, reference string) {
+			r, repo, ref := parseImageReference(image)
+			Expect([]string{r, repo, ref}).To(Equal([]string{registry, repository, reference}))
+		},
+		Entry("official image", "kyverno", "registry-1.docker.io", "library/kyverno", "latest"),
+		Entry("Docker Hub user image", "org/policies:v1", "registry-1.docker.io", "org/policies", "v1"),
+		Entry("docker.io host", "docker.io/org/policies:v1", "registry-1.docker.io", "org/policies", "v1"),
+		Entry("docker.io official image", "docker.io/kyverno", "registry-1.docker.io", "library/kyverno", "latest"),
+		Entry("index.docker.io host", "index.docker.io/org/policies:v1", "registry-1.docker.io", "org/policies", "v1"),
+		Entry("registry with port", "localhost:5000/org/policies:v1", "localhost:5000", "org/policies", "v1"),
+		Entry("digest", "ghcr.io/org/policies@sha256:abc", "ghcr.io", "org/policies", "sha256:abc"),
+	)
+})
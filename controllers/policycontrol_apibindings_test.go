@@ -0,0 +1,123 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+var _ = Describe("Workspace APIBindings", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		env.kcp.addWorkspace("root:compute")
+		env.kcp.addAPIExport("root:compute", "kubernetes-compute", deploymentsAPI, podsAPI)
+		env.kcp.addAPIExport("root:compute", "extras", podsAPI)
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		pc.Spec.KyvernoInWorkspace.KubernetesAPIBinding = kcptoolsv1alpha1.APIBinding{
+			Path:       "root:compute",
+			ExportName: "kubernetes-compute",
+		}
+	})
+
+	It("binds the configured Kubernetes export and the additional exports", func() {
+		pc.Spec.KyvernoInWorkspace.AdditionalAPIBindings = []kcptoolsv1alpha1.APIBinding{{Path: "root:compute", ExportName: "extras"}}
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+
+		kubernetes := env.kcp.get("root:edge1", apiBindingGVR, "", "kyverno-required-resources")
+		Expect(kubernetes).NotTo(BeNil())
+		reference, _, _ := unstructured.NestedStringMap(kubernetes.Object, "spec", "reference", "workspace")
+		Expect(reference).To(Equal(map[string]string{"path": "root:compute", "exportName": "kubernetes-compute"}))
+		Expect(env.kcp.get("root:edge1", apiBindingGVR, "", "extras")).NotTo(BeNil())
+
+		status := env.latest(pc).Status
+		Expect(meta.IsStatusConditionTrue(status.Conditions, ConditionTypeAPIBindingsReady)).To(BeTrue())
+		Expect(status.APIBindings).To(ConsistOf(
+			kcptoolsv1alpha1.APIBindingStatus{Name: "kyverno-required-resources", Path: "root:compute", ExportName: "kubernetes-compute", Ready: true},
+			kcptoolsv1alpha1.APIBindingStatus{Name: "kyverno", Path: testProviderWorkspace, ExportName: "kyverno", Ready: true},
+			kcptoolsv1alpha1.APIBindingStatus{Name: "extras", Path: "root:compute", ExportName: "extras", Ready: true},
+		))
+	})
+
+	It("reports a binding whose export does not exist", func() {
+		pc.Spec.KyvernoInWorkspace.AdditionalAPIBindings = []kcptoolsv1alpha1.APIBinding{
+			{Name: "policy-apis", Path: "root:compute", ExportName: "missing"},
+		}
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		Expect(env.reconcile(pc).RequeueAfter).To(Equal(workspaceAPIsRequeueAfter))
+
+		status := env.latest(pc).Status
+		bound := meta.FindStatusCondition(status.Conditions, ConditionTypeAPIBindingsReady)
+		Expect(bound).NotTo(BeNil())
+		Expect(bound.Status).To(Equal(metav1.ConditionFalse))
+		Expect(bound.Reason).To(Equal(ConditionReasonNotReady))
+		Expect(bound.Message).To(HavePrefix("not ready: policy-apis (InitialBindingCompleted: APIExportNotFound"))
+		Expect(status.APIBindings).To(ContainElement(And(
+			HaveField("Name", "policy-apis"),
+			HaveField("Ready", false),
+			HaveField("Message", ContainSubstring("APIExport root:compute|missing not found")),
+		)))
+	})
+
+	It("reports the permission claims of an export the binding does not accept", func() {
+		pc.Spec.KyvernoInWorkspace.AdditionalAPIBindings = []kcptoolsv1alpha1.APIBinding{{
+			Path:                     "root:compute",
+			ExportName:               "extras",
+			AcceptedPermissionClaims: []kcptoolsv1alpha1.PermissionClaim{{Resource: "configmaps"}},
+		}}
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+
+		binding := env.kcp.get("root:edge1", apiBindingGVR, "", "extras")
+		claims, _, _ := unstructured.NestedSlice(binding.Object, "spec", "permissionClaims")
+		Expect(claims).To(Equal([]interface{}{map[string]interface{}{"group": "", "resource": "configmaps", "state": "Accepted"}}))
+		Expect(meta.IsStatusConditionTrue(env.latest(pc).Status.Conditions, ConditionTypeAPIBindingsReady)).To(BeTrue())
+
+		By("claiming Secrets in the export")
+		env.kcp.update("root:edge1", apiBindingGVR, "", "extras", func(obj *unstructured.Unstructured) {
+			exported := []interface{}{
+				map[string]interface{}{"group": "", "resource": "configmaps"},
+				map[string]interface{}{"group": "", "resource": "secrets"},
+			}
+			Expect(unstructured.SetNestedSlice(obj.Object, exported, "status", "exportPermissionClaims")).To(Succeed())
+		})
+		env.reconcile(pc)
+
+		status := env.latest(pc).Status
+		bound := meta.FindStatusCondition(status.Conditions, ConditionTypeAPIBindingsReady)
+		Expect(bound.Status).To(Equal(metav1.ConditionFalse))
+		Expect(bound.Reason).To(Equal(ConditionReasonPermissionClaimsNotAccepted))
+		Expect(bound.Message).To(Equal("permission claims not accepted: extras: secrets."))
+		Expect(status.APIBindings).To(ContainElement(And(
+			HaveField("Name", "extras"),
+			HaveField("Ready", true),
+			HaveField("UnacceptedPermissionClaims", []kcptoolsv1alpha1.PermissionClaim{{Resource: "secrets"}}),
+		)))
+	})
+})
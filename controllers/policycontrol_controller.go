@@ -21,46 +21,67 @@ import (
 	"fmt"
 	"os"
 
-	corev1 "k8s.io/api/core/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
 )
 
 // PolicyControlReconciler reconciles a PolicyControl object
 type PolicyControlReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
+// Override the Kyverno manifests embedded in the manifests package and the APIBinding importing the
+// Kubernetes resources into the workspace when set.
 var WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR string = os.Getenv("WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR")
 var WORKSPACE_APIBINDINGS_MANIFEST string = os.Getenv("WORKSPACE_APIBINDINGS_MANIFEST")
 
-// TODO: Remove syncer dependency once required CRDs can get installed through APIResourceSchemas not syncer
+// CheckManifestOverrides fails when WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR or WORKSPACE_APIBINDINGS_MANIFEST
+// is set but provides no manifest, so that a misconfigured operator does not start installing nothing.
+func CheckManifestOverrides() error {
+	if _, err := manifests.Kyverno("", WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR); err != nil {
+		return err
+	}
+	if WORKSPACE_APIBINDINGS_MANIFEST == "" {
+		return nil
+	}
+	_, err := manifests.APIBindings(WORKSPACE_APIBINDINGS_MANIFEST)
+	return err
+}
+
+// Image of the syncer installed when spec.policy_control_cluster.installSyncer is set
 var SYNCER_IMAGE string = getEnv("SYNCER_IMAGE", "ghcr.io/kcp-dev/kcp/syncer:554c247")
 
 //+kubebuilder:rbac:groups=ibm.github.com,resources=policycontrols,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=ibm.github.com,resources=policycontrols/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=ibm.github.com,resources=policycontrols/finalizers,verbs=update
+//+kubebuilder:rbac:groups=ibm.github.com,resources=policycontroltemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=roles;rolebindings;clusterroles;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs=get;list;watch;create;update;patch;delete
-
-// TODO: As of now, need following RBACs for policy-control-operator to install syncer in the PCO cluster.
-//       Once we find a different approach to import CRDs instead of syncing, we can remove the following RBACs.
-//+kubebuilder:rbac:groups="",resources=configmaps;secrets;serviceaccounts;services,verbs="*"
-//+kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch
-//+kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs="*"
-//+kubebuilder:rbac:groups="apps",resources=deployments,verbs="*"
+//+kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses;networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets;services;serviceaccounts;resourcequotas,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="apiextensions.k8s.io",resources=customresourcedefinitions,verbs=get;watch;list
-//+kubebuilder:rbac:groups="",resources=kyvernoes;policies,verbs="*"
-//+kubebuilder:rbac:groups="kyverno.io",resources=policies,verbs="*"
-//+kubebuilder:rbac:groups="operator.kyverno.io",resources=kyvernoes,verbs="*"
-//+kubebuilder:rbac:groups="operators.coreos.com",resources=catalogsources;operatorgroups;subscriptions,verbs="*"
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,34 +97,63 @@ func (r *PolicyControlReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	logger.V(1).Info(fmt.Sprintf("namespace=%s, name=%s", req.NamespacedName.Namespace, req.NamespacedName.Name))
 
+	ctx, span := tracer.Start(ctx, "PolicyControl.Reconcile", trace.WithAttributes(
+		attribute.String("policycontrol.namespace", req.Namespace),
+		attribute.String("policycontrol.name", req.Name),
+	))
+	defer span.End()
+
 	var pc kcptoolsv1alpha1.PolicyControl
 	err := r.Get(ctx, req.NamespacedName, &pc)
 	if errors.IsNotFound(err) {
 		return ctrl.Result{}, nil
 	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-	// TODO: Until swithing to use KCP Go library or REST API, we use kcp command with kubeconfig file specified.
-	//		 Once switched, remove this part.
-	kcpKubeConfigSecret := pc.Spec.PolicyControlCluster.KcpKubeConfigSecret
-	var kcpSecret corev1.Secret
-	if err := r.Get(ctx, client.ObjectKey{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: kcpKubeConfigSecret.Name}, &kcpSecret); err != nil {
+	// the Kyverno of the workspace is torn down before a deleted PolicyControl goes away
+	if !pc.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, logger, pc)
+	}
+	if !isDryRun(&pc) && !controllerutil.ContainsFinalizer(&pc, policyControlFinalizer) {
+		base := pc.DeepCopy()
+		controllerutil.AddFinalizer(&pc, policyControlFinalizer)
+		if err := r.Patch(ctx, &pc, client.MergeFrom(base)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// fill the fields left empty in the PolicyControl with the defaults of the referred template
+	pc, err = applyTemplate(ctx, r.Client, logger, pc)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
-	file, err := os.CreateTemp("", "*")
+	span.SetAttributes(attribute.String("kcp.workspace", pc.Spec.Workspace))
+
+	// a shared Kyverno pool has as many shards as the largest count of its PolicyControls
+	pc, err = r.applyShardPool(ctx, logger, pc)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	if _, err := file.Write(kcpSecret.Data[kcpKubeConfigSecret.Key]); err != nil {
+
+	// the objects of the Policy Control Cluster are named after the workspace
+	if err := r.assignWorkspaceName(ctx, logger, &pc); err != nil {
 		return ctrl.Result{}, err
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			logger.Error(err, "failed to close "+file.Name())
-		}
-		if err := os.Remove(file.Name()); err != nil {
-			logger.Error(err, "failed to remove "+file.Name())
-		}
-	}()
+
+	// TODO: Until swithing to use KCP Go library or REST API, we use kcp command with kubeconfig file specified.
+	//		 Once switched, remove this part.
+	kcpKubeConfig, cleanup, err := writeKcpKubeConfig(ctx, r.Client, logger, pc)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	defer cleanup()
+
+	// in dry-run mode only compute what the phases below would change
+	if isDryRun(&pc) {
+		return r.plan(ctx, logger, pc, kcpKubeConfig)
+	}
 
 	/*
 		Sync pcc
@@ -114,7 +164,20 @@ func (r *PolicyControlReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		popd
 	*/
 
-	if _, err := r.syncPCO(ctx, req, logger, pc, file.Name(), req.NamespacedName.Namespace); err != nil {
+	if pointer.BoolDeref(pc.Spec.PolicyControlCluster.InstallSyncer, false) {
+		phaseCtx, endPhase := startReconcilePhase(ctx, phaseSyncPCO, pc)
+		_, err = r.syncPCO(phaseCtx, req, logger, pc, kcpKubeConfig, req.NamespacedName.Namespace)
+		endPhase(err)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// the workspace binds the Kyverno CRDs from an APIExport
+	phaseCtx, endPhase := startReconcilePhase(ctx, phasePublishKyvernoAPIs, pc)
+	err = r.publishKyvernoAPIs(phaseCtx, logger, pc, kcpKubeConfig)
+	endPhase(err)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -127,7 +190,13 @@ func (r *PolicyControlReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		    popd
 	*/
 
-	if _, err := r.installKyvernoOnEdge(ctx, req, logger, pc, file.Name()); err != nil {
+	phaseCtx, endPhase = startReconcilePhase(ctx, phaseInstallKyvernoOnEdge, pc)
+	_, err = r.installKyvernoOnEdge(phaseCtx, req, logger, pc, kcpKubeConfig)
+	if err == nil {
+		err = r.updateEdgeClustersStatus(phaseCtx, logger, &pc, kcpKubeConfig)
+	}
+	endPhase(err)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -140,16 +209,78 @@ func (r *PolicyControlReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		    popd
 	*/
 
-	if _, err := r.installKyvernoOnWorkspace(ctx, req, logger, pc, file.Name()); err != nil {
+	phaseCtx, endPhase = startReconcilePhase(ctx, phaseInstallKyvernoOnWorkspace, pc)
+	result, err := r.installKyvernoOnWorkspace(phaseCtx, req, logger, pc, kcpKubeConfig)
+	endPhase(err)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// the workspace phase patched the status of its own copy
+	var latest kcptoolsv1alpha1.PolicyControl
+	if err := r.Get(ctx, req.NamespacedName, &latest); err != nil {
+		return ctrl.Result{}, err
+	}
+	pc.Status, pc.ResourceVersion = latest.Status, latest.ResourceVersion
+
+	phaseCtx, endPhase = startReconcilePhase(ctx, phaseEnforceFailurePolicy, pc)
+	failOpenAfter, err := r.enforceFailurePolicy(phaseCtx, logger, &pc, kcpKubeConfig)
+	endPhase(err)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// check that kcp reaches Kyverno and that it enforces policies once it is deployed
+	if result.RequeueAfter == 0 {
+		phaseCtx, endPhase = startReconcilePhase(ctx, phaseProbeWebhook, pc)
+		err = r.probeWebhook(phaseCtx, logger, &pc)
+		endPhase(err)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		phaseCtx, endPhase = startReconcilePhase(ctx, phaseProbeEnforcement, pc)
+		err = r.probeEnforcement(phaseCtx, logger, &pc, kcpKubeConfig)
+		endPhase(err)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// requeued while the workspace manifests are pending, and to pick up edge clusters joining the workspace
+	if result.RequeueAfter == 0 {
+		result.RequeueAfter = edgeClustersRefreshInterval
+	}
+	// and to follow the availability of the Kyverno Deployment when it may fail open
+	if failOpenAfter > 0 && failOpenAfter < result.RequeueAfter {
+		result.RequeueAfter = failOpenAfter
+	}
+	return result, nil
 }
 
+// policyControlChanged passes the events of PolicyControls whose spec or annotations changed, leaving out the
+// status updates of the reconciler itself and of the ComplianceSummaries. The deletion of a PolicyControl
+// holding the finalizer raises its generation.
+var policyControlChanged = predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{})
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *PolicyControlReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &kcptoolsv1alpha1.PolicyControl{}, templateRefIndexKey, indexTemplateRef); err != nil {
+		return err
+	}
+	if err := metrics.Registry.Register(newFleetCollector(mgr.GetClient(), mgr.GetAPIReader())); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&kcptoolsv1alpha1.PolicyControl{}).
+		For(&kcptoolsv1alpha1.PolicyControl{}, builder.WithPredicates(policyControlChanged)).
+		Watches(
+			&source.Kind{Type: &kcptoolsv1alpha1.PolicyControlTemplate{}},
+			handler.EnqueueRequestsFromMapFunc(r.findPolicyControlsForTemplate),
+		).
+		Watches(
+			&source.Kind{Type: &kcptoolsv1alpha1.PolicyControl{}},
+			handler.EnqueueRequestsFromMapFunc(r.findPolicyControlsSharingShards),
+			builder.WithPredicates(shardPoolChanged),
+		).
 		Complete(r)
 }
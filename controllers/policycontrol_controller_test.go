@@ -0,0 +1,349 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	defaultTestNamespace  = "default"
+	testProviderWorkspace = "root:policy-control-cluster"
+)
+
+// testNamespace is the namespace of the Policy Control Cluster used by the current spec.
+var testNamespace = defaultTestNamespace
+
+var (
+	// APIs of the "kubernetes" APIExport the workspaces bind
+	deploymentsAPI = fakeAPI{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "Deployment", true}
+	podsAPI        = fakeAPI{schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "Pod", true}
+	// APIs the syncer of the edge clusters imports into the workspaces
+	operatorGroupsAPI = fakeAPI{schema.GroupVersionResource{Group: "operators.coreos.com", Version: "v1", Resource: "operatorgroups"}, "OperatorGroup", true}
+	subscriptionsAPI  = fakeAPI{subscriptionGVR, "Subscription", true}
+	kyvernoesAPI      = fakeAPI{schema.GroupVersionResource{Group: "operator.kyverno.io", Version: "v1alpha1", Resource: "kyvernoes"}, "Kyverno", true}
+
+	namespaceGVR     = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	secretGVR        = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	clusterRoleGVR   = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+	apiBindingGVR    = schema.GroupVersionResource{Group: "apis.kcp.dev", Version: "v1alpha1", Resource: "apibindings"}
+	validatingGVR    = schema.GroupVersionResource{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingwebhookconfigurations"}
+	policyReportsCRD = "policyreports.wgpolicyk8s.io"
+)
+
+// newTestPolicyControl returns a PolicyControl of the workspace like config/samples/pccr-edge1.yaml.
+func newTestPolicyControl(name, workspace string) *kcptoolsv1alpha1.PolicyControl {
+	return &kcptoolsv1alpha1.PolicyControl{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: kcptoolsv1alpha1.PolicyControlSpec{
+			Workspace: workspace,
+			PolicyControlCluster: kcptoolsv1alpha1.PolicyControlCluster{
+				Namespace:   testNamespace,
+				IngressName: "policy-control-cluster",
+				IngressHost: "policy-control-cluster.local",
+				IngressPort: 19443,
+				IngressTLSSecret: kcptoolsv1alpha1.TLSSecret{
+					Name:          "policy-control-cluster-tls-secret",
+					KeyForPrivKey: "tls.key",
+					KeyForCert:    "tls.crt",
+					KeyForCacert:  "ca.crt",
+				},
+				KcpKubeConfigSecret: kcptoolsv1alpha1.KcpKubeConfigSecret{Name: "kcp-kubeconfig-secret", Key: "kubeconfig.yaml"},
+			},
+			KyvernoInWorkspace: kcptoolsv1alpha1.KyvernoInWorkspace{
+				NamespaceForAPIResources: "kyverno",
+				KyvernoImage:             "kyverno-local:1.0.0",
+			},
+			KyvernoInCluster: kcptoolsv1alpha1.KyvernoInCluster{
+				InstallNamespace: "kyverno-incluster",
+				OperatorGroup:    kcptoolsv1alpha1.OperatorGroup{Name: "kyverno-operator-group"},
+				Subscription:     kcptoolsv1alpha1.Subscription{Name: "kyverno-operator", OLMNamespace: "olm"},
+				KyvernoCR:        kcptoolsv1alpha1.KyvernoCR{Name: "kyverno"},
+			},
+		},
+	}
+}
+
+// drainEvents returns the events recorded since the last call.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// policyControlEnv runs a PolicyControlReconciler against fakeKcp, serving the provider workspace with the
+// "kubernetes" APIExport and the workspaces root:edge1 and root:edge2 with the APIs their syncer imports, and
+// a Policy Control Cluster holding the kcp kubeconfig and the ingress TLS secret.
+type policyControlEnv struct {
+	ctx        context.Context
+	kcp        *fakeKcp
+	pcc        client.Client
+	recorder   *record.FakeRecorder
+	reconciler *PolicyControlReconciler
+}
+
+// newPolicyControlEnv sets up the environment of a spec, and tears it down once the spec is done.
+func newPolicyControlEnv() *policyControlEnv {
+	e := &policyControlEnv{ctx: context.Background()}
+	e.kcp = newFakeKcp()
+	DeferCleanup(e.kcp.close)
+	run := runKcpCommand
+	runKcpCommand = e.kcp.run
+	DeferCleanup(func() { runKcpCommand = run })
+
+	e.kcp.addWorkspace(testProviderWorkspace)
+	e.kcp.addAPIExport(testProviderWorkspace, "kubernetes", deploymentsAPI, podsAPI)
+	e.kcp.addWorkspace("root:edge1", operatorGroupsAPI, subscriptionsAPI, kyvernoesAPI)
+	e.kcp.addWorkspace("root:edge2", operatorGroupsAPI, subscriptionsAPI, kyvernoesAPI)
+
+	e.pcc, testNamespace = newPCOClient(e.ctx,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "kcp-kubeconfig-secret"},
+			Data:       map[string][]byte{"kubeconfig.yaml": e.kcp.kubeConfig()},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy-control-cluster-tls-secret"},
+			Data: map[string][]byte{
+				"tls.key": []byte("key"),
+				"tls.crt": []byte("cert"),
+				"ca.crt":  []byte("ca"),
+			},
+		},
+	)
+	DeferCleanup(func() { testNamespace = defaultTestNamespace })
+	e.recorder = record.NewFakeRecorder(1024)
+	e.reconciler = &PolicyControlReconciler{Client: e.pcc, Scheme: scheme.Scheme, Recorder: e.recorder}
+	return e
+}
+
+// reconcile runs a reconcile of pc, which has to succeed.
+func (e *policyControlEnv) reconcile(pc *kcptoolsv1alpha1.PolicyControl) ctrl.Result {
+	result, err := e.reconciler.Reconcile(e.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pc)})
+	Expect(err).NotTo(HaveOccurred())
+	return result
+}
+
+// latest returns the live pc.
+func (e *policyControlEnv) latest(pc *kcptoolsv1alpha1.PolicyControl) *kcptoolsv1alpha1.PolicyControl {
+	var live kcptoolsv1alpha1.PolicyControl
+	Expect(e.pcc.Get(e.ctx, client.ObjectKeyFromObject(pc), &live)).To(Succeed())
+	return &live
+}
+
+// ingressPaths returns the backend of every path of the shared ingress.
+func (e *policyControlEnv) ingressPaths() map[string]string {
+	var ingress networkingv1.Ingress
+	Expect(e.pcc.Get(e.ctx, client.ObjectKey{Namespace: testNamespace, Name: "kyverno-ingress"}, &ingress)).To(Succeed())
+	Expect(ingress.Spec.Rules).To(HaveLen(1))
+	paths := map[string]string{}
+	for _, p := range ingress.Spec.Rules[0].HTTP.Paths {
+		paths[p.Path] = p.Backend.Service.Name
+	}
+	return paths
+}
+
+// secretValue returns the value of key in secret, whether the client keeps stringData as written like the
+// fake client, or the API server moved it to data.
+func secretValue(secret *corev1.Secret, key string) string {
+	if value, ok := secret.StringData[key]; ok {
+		return value
+	}
+	return string(secret.Data[key])
+}
+
+var _ = Describe("PolicyControl controller", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+	})
+
+	It("installs Kyverno for the workspace on the first reconcile", func() {
+		result := env.reconcile(pc)
+		Expect(result.RequeueAfter).To(Equal(edgeClustersRefreshInterval))
+
+		By("publishing the Kyverno APIs in the provider workspace")
+		export := env.kcp.get(testProviderWorkspace, apiExportResource, "", "kyverno")
+		Expect(export).NotTo(BeNil())
+		schemas, _, _ := unstructured.NestedStringSlice(export.Object, "spec", "latestResourceSchemas")
+		Expect(schemas).To(ContainElement(HaveSuffix(".clusterpolicies.kyverno.io")))
+
+		By("installing the workspace manifests and binding the APIs")
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).NotTo(BeNil())
+		Expect(env.kcp.get("root:edge1", crdGVR, "", policyReportsCRD)).NotTo(BeNil())
+		Expect(env.kcp.list("root:edge1", clusterRoleGVR)).NotTo(BeEmpty())
+		for _, name := range []string{"kyverno-required-resources", "kyverno"} {
+			binding := env.kcp.get("root:edge1", apiBindingGVR, "", name)
+			Expect(binding).NotTo(BeNil())
+			Expect(conditionTrue(*binding, "Ready")).To(BeTrue())
+		}
+		Expect(env.kcp.get("root:edge1", secretGVR, "kyverno", "kyverno-svc-remote.kyverno.svc.kyverno-tls-pair")).NotTo(BeNil())
+		Expect(env.kcp.get("root:edge1", secretGVR, "kyverno", "kyverno-svc-remote.kyverno.svc.kyverno-tls-ca")).NotTo(BeNil())
+
+		By("installing the Kyverno operator for the edge clusters")
+		Expect(env.kcp.get("root:edge1", operatorGroupsAPI.GroupVersionResource, "kyverno-incluster", "kyverno-operator-group")).NotTo(BeNil())
+		Expect(env.kcp.get("root:edge1", subscriptionsAPI.GroupVersionResource, "kyverno-incluster", "kyverno-operator")).NotTo(BeNil())
+		Expect(env.kcp.get("root:edge1", kyvernoesAPI.GroupVersionResource, "kyverno-incluster", "kyverno")).NotTo(BeNil())
+
+		By("deploying the standalone Kyverno in the Policy Control Cluster")
+		var secret corev1.Secret
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &secret)).To(Succeed())
+		Expect(secretValue(&secret, "target-kubeconfig.yaml")).To(ContainSubstring(env.kcp.server.URL + "/clusters/root:edge1"))
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &corev1.Service{})).To(Succeed())
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &appsv1.Deployment{})).To(Succeed())
+		Expect(env.ingressPaths()).To(Equal(map[string]string{"/root--edge1(/|$)(.*)": "root--edge1"}))
+
+		By("reporting the outcome in the status")
+		status := env.latest(pc).Status
+		Expect(status.WorkspaceName).To(Equal("root--edge1"))
+		Expect(meta.IsStatusConditionTrue(status.Conditions, ConditionTypeWorkspaceManifestsApplied)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(status.Conditions, ConditionTypeAPIBindingsReady)).To(BeTrue())
+		Expect(status.APIBindings).To(HaveLen(2))
+		Expect(meta.FindStatusCondition(status.Conditions, ConditionTypeEdgeKyvernoInstalled).Reason).To(Equal(ConditionReasonNoSyncTargets))
+		Expect(meta.FindStatusCondition(status.Conditions, ConditionTypeWebhookReachable).Reason).To(Equal(ConditionReasonTLSFailed))
+		Expect(status.Enforcement).To(HaveLen(1))
+		Expect(status.Enforcement[0].Message).To(Equal("the canary ConfigMap was admitted"))
+		Expect(drainEvents(env.recorder)).To(ContainElements(
+			ContainSubstring(EventReasonNamespaceCreated),
+			ContainSubstring(EventReasonSecretDistributed),
+			ContainSubstring(EventReasonIngressPathChanged),
+		))
+	})
+
+	It("switches the workspace to a shared Kyverno when the mode is updated", func() {
+		env.reconcile(pc)
+
+		live := env.latest(pc)
+		live.Spec.PolicyControlCluster.KyvernoMode = resources.KyvernoModeShared
+		live.Spec.PolicyControlCluster.SharedKyverno.Shards = 2
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+
+		shard := resources.AssignShard(live)
+		Expect(env.latest(pc).Status.Shard).To(Equal(shard))
+		var bundle corev1.Secret
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: shard}, &bundle)).To(Succeed())
+		Expect(bundle.Data).To(HaveKey("root--edge1.yaml"))
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: shard}, &appsv1.Deployment{})).To(Succeed())
+		err := env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &appsv1.Deployment{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(env.ingressPaths()).To(Equal(map[string]string{"/root--edge1(/|$)(.*)": shard}))
+	})
+
+	It("repairs drift of the installed objects", func() {
+		env.reconcile(pc)
+
+		clusterRole := env.kcp.list("root:edge1", clusterRoleGVR)[0].GetName()
+		env.kcp.delete("root:edge1", clusterRoleGVR, "", clusterRole)
+		env.kcp.update("root:edge1", configMapGVR, "kyverno", "kyverno-metrics", func(obj *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(obj.Object, "1h", "data", "metricsRefreshInterval")
+		})
+		env.kcp.delete("root:edge1", apiBindingGVR, "", "kyverno")
+		Expect(env.pcc.Delete(env.ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "root--edge1"}})).To(Succeed())
+		env.reconcile(pc)
+
+		Expect(env.kcp.get("root:edge1", clusterRoleGVR, "", clusterRole)).NotTo(BeNil())
+		metrics := env.kcp.get("root:edge1", configMapGVR, "kyverno", "kyverno-metrics")
+		Expect(metrics.Object["data"]).To(HaveKeyWithValue("metricsRefreshInterval", "24h"))
+		Expect(env.kcp.get("root:edge1", apiBindingGVR, "", "kyverno")).NotTo(BeNil())
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &corev1.Service{})).To(Succeed())
+	})
+
+	It("shares the ingress between the workspaces with a path for each", func() {
+		other := newTestPolicyControl("pccr-edge2", "root:edge2")
+		Expect(env.pcc.Create(env.ctx, other)).To(Succeed())
+
+		env.reconcile(pc)
+		env.reconcile(other)
+		paths := map[string]string{
+			"/root--edge1(/|$)(.*)": "root--edge1",
+			"/root--edge2(/|$)(.*)": "root--edge2",
+		}
+		Expect(env.ingressPaths()).To(Equal(paths))
+
+		By("keeping a single path per workspace on later reconciles")
+		env.reconcile(pc)
+		env.reconcile(other)
+		Expect(env.ingressPaths()).To(Equal(paths))
+	})
+
+	It("tears down the workspace before releasing a deleted PolicyControl and leaves kcp alone afterwards", func() {
+		env.reconcile(pc)
+		Expect(env.latest(pc).Finalizers).To(ContainElement(policyControlFinalizer))
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).NotTo(BeNil())
+		Expect(env.pcc.Delete(env.ctx, env.latest(pc))).To(Succeed())
+
+		By("removing the Kyverno objects from the workspace through kcp")
+		env.kcp.commands = nil
+		Expect(env.reconcile(pc)).To(Equal(ctrl.Result{}))
+		Expect(env.kcp.commands).To(ContainElement(ContainSubstring("root:edge1")))
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).To(BeNil())
+		Expect(env.kcp.list("root:edge1", apiBindingGVR)).To(HaveLen(1))
+		Expect(env.kcp.get("root:edge1", apiBindingGVR, "", "kyverno-required-resources")).NotTo(BeNil())
+		Expect(isGone(env.ctx, env.pcc, pc)).To(BeTrue())
+
+		By("not reaching kcp for the PolicyControl once it is gone")
+		env.kcp.commands = nil
+		Expect(env.reconcile(pc)).To(Equal(ctrl.Result{}))
+		Expect(env.kcp.commands).To(BeEmpty())
+	})
+
+	It("leaves out the status updates of PolicyControls", func() {
+		old := newTestPolicyControl("pccr-edge1", "root:edge1")
+		old.Generation = 1
+		reported := old.DeepCopy()
+		reported.Status.Compliance = &kcptoolsv1alpha1.ComplianceCounts{Pass: 1}
+		Expect(policyControlChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: reported})).To(BeFalse())
+		changed := old.DeepCopy()
+		changed.Generation = 2
+		Expect(policyControlChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: changed})).To(BeTrue())
+		dryRun := old.DeepCopy()
+		dryRun.Annotations = map[string]string{DryRunAnnotation: "true"}
+		Expect(policyControlChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: dryRun})).To(BeTrue())
+	})
+})
@@ -0,0 +1,293 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	// ConditionTypeEdgeKyvernoInstalled tells whether Kyverno is installed on all edge clusters of the workspace,
+	// see status.edgeClusters for the details.
+	ConditionTypeEdgeKyvernoInstalled = "EdgeKyvernoInstalled"
+
+	ConditionReasonInstalled     = "Installed"
+	ConditionReasonInstalling    = "Installing"
+	ConditionReasonNoSyncTargets = "NoSyncTargets"
+
+	EdgePhasePending    = "Pending"
+	EdgePhaseInstalling = "Installing"
+	EdgePhaseInstalled  = "Installed"
+
+	// annotation kcp sets on the objects synced to several SyncTargets, holding the status on the one of the key
+	syncTargetStatusAnnotationPrefix = "experimental.status.workload.kcp.dev/"
+	// value of the state.workload.kcp.dev/<key> label once the object is synced
+	syncTargetStateSync = "Sync"
+	// state of a Subscription whose operator is installed at the latest known version
+	subscriptionStateAtLatestKnown = "AtLatestKnown"
+)
+
+var (
+	// how often the edge clusters are enumerated again to pick up those joining the workspace
+	edgeClustersRefreshInterval = 5 * time.Minute
+
+	placementResource  = schema.GroupVersionResource{Group: "scheduling.kcp.dev", Version: "v1alpha1", Resource: "placements"}
+	locationResource   = schema.GroupVersionResource{Group: "scheduling.kcp.dev", Version: "v1alpha1", Resource: "locations"}
+	syncTargetResource = schema.GroupVersionResource{Group: "workload.kcp.dev", Version: "v1alpha1", Resource: "synctargets"}
+	subscriptionGVR    = schema.GroupVersionResource{Group: "operators.coreos.com", Version: "v1alpha1", Resource: "subscriptions"}
+)
+
+// updateEdgeClustersStatus records the state of the Kyverno installation on every SyncTarget the workspace of pc
+// is bound to in status.edgeClusters and the EdgeKyvernoInstalled condition.
+func (r *PolicyControlReconciler) updateEdgeClustersStatus(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	kcpKubeConfig string,
+) error {
+	config, _, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+	if err != nil {
+		return err
+	}
+	dyClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	logger.V(4).Info("enumerate the SyncTargets the workspace is bound to")
+	edges := map[string]*kcptoolsv1alpha1.EdgeClusterStatus{}
+	// SyncTargets of the Locations selected by the Placements of the workspace, including those not synced yet
+	targets, err := placedSyncTargets(ctx, logger, dyClient, config)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		edges[t.SyncTarget] = &kcptoolsv1alpha1.EdgeClusterStatus{SyncTarget: t.SyncTarget, Name: t.Name, Path: t.Path}
+	}
+	// SyncTargets the install namespace is scheduled to
+	ns, err := dyClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}).
+		Get(ctx, pc.Spec.KyvernoInCluster.InstallNamespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for key := range syncTargetStates(ns) {
+		if edges[key] == nil {
+			edges[key] = &kcptoolsv1alpha1.EdgeClusterStatus{SyncTarget: key}
+		}
+	}
+
+	subscription := resources.BuildSubscriptionForKyverno(pc)
+	live, err := dyClient.Resource(subscriptionGVR).Namespace(subscription.GetNamespace()).
+		Get(ctx, subscription.GetName(), metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	statuses := make([]kcptoolsv1alpha1.EdgeClusterStatus, 0, len(edges))
+	for _, key := range sortedEdgeKeys(edges) {
+		edge := edges[key]
+		edgeSubscriptionStatus(edge, live)
+		statuses = append(statuses, *edge)
+	}
+	return r.setEdgeClustersStatus(ctx, logger, pc, statuses)
+}
+
+// edgeSubscriptionStatus fills the phase of edge from the Subscription synced to it.
+func edgeSubscriptionStatus(edge *kcptoolsv1alpha1.EdgeClusterStatus, subscription *unstructured.Unstructured) {
+	edge.Phase = EdgePhasePending
+	if subscription == nil {
+		edge.Message = "the Subscription of Kyverno does not exist"
+		return
+	}
+	states := syncTargetStates(subscription)
+	if states[edge.SyncTarget] != syncTargetStateSync {
+		edge.Message = "the Subscription of Kyverno is not synced yet"
+		return
+	}
+	status, _, _ := unstructured.NestedMap(subscription.Object, "status")
+	if raw, ok := subscription.GetAnnotations()[syncTargetStatusAnnotationPrefix+edge.SyncTarget]; ok {
+		status = map[string]interface{}{}
+		if err := json.Unmarshal([]byte(raw), &status); err != nil {
+			edge.Message = fmt.Sprintf("failed to decode the status of the Subscription: %s", err.Error())
+			return
+		}
+	} else if len(states) > 1 {
+		// without the per SyncTarget annotation, the status of the object is not the one of this cluster
+		status = nil
+	}
+	state, _ := status["state"].(string)
+	edge.InstalledCSV, _ = status["installedCSV"].(string)
+	edge.Phase = EdgePhaseInstalling
+	edge.Message = fmt.Sprintf("Subscription state %q", state)
+	if state == subscriptionStateAtLatestKnown {
+		edge.Phase = EdgePhaseInstalled
+		edge.Message = ""
+	}
+}
+
+// placedSyncTargets lists the SyncTargets of the Locations selected by the Placements of the workspace.
+// Workspaces without the scheduling APIs have none.
+func placedSyncTargets(
+	ctx context.Context,
+	logger logr.Logger,
+	dyClient dynamic.Interface,
+	config *rest.Config,
+) ([]kcptoolsv1alpha1.EdgeClusterStatus, error) {
+	placements, err := dyClient.Resource(placementResource).List(ctx, metav1.ListOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var targets []kcptoolsv1alpha1.EdgeClusterStatus
+	for _, placement := range placements.Items {
+		path, _, _ := unstructured.NestedString(placement.Object, "status", "selectedLocation", "path")
+		locationName, _, _ := unstructured.NestedString(placement.Object, "status", "selectedLocation", "locationName")
+		if path == "" || locationName == "" {
+			continue
+		}
+		locationClient, err := dynamic.NewForConfig(clusterConfig(config, path))
+		if err != nil {
+			return nil, err
+		}
+		location, err := locationClient.Resource(locationResource).Get(ctx, locationName, metav1.GetOptions{})
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("failed to get Location %s of Placement %s", locationName, placement.GetName()))
+			continue
+		}
+		selector := labels.Everything()
+		if instanceSelector, ok, _ := unstructured.NestedMap(location.Object, "spec", "instanceSelector"); ok {
+			var ls metav1.LabelSelector
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(instanceSelector, &ls); err != nil {
+				return nil, err
+			}
+			if selector, err = metav1.LabelSelectorAsSelector(&ls); err != nil {
+				return nil, err
+			}
+		}
+		syncTargets, err := locationClient.Resource(syncTargetResource).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range syncTargets.Items {
+			targets = append(targets, kcptoolsv1alpha1.EdgeClusterStatus{
+				SyncTarget: syncTargetKey(path, st.GetName()),
+				Name:       st.GetName(),
+				Path:       path,
+			})
+		}
+	}
+	return targets, nil
+}
+
+// syncTargetStates returns the state.workload.kcp.dev/<key> labels of obj by SyncTarget key.
+func syncTargetStates(obj *unstructured.Unstructured) map[string]string {
+	states := map[string]string{}
+	for k, v := range obj.GetLabels() {
+		if strings.HasPrefix(k, syncTargetStateLabelPrefix) {
+			states[strings.TrimPrefix(k, syncTargetStateLabelPrefix)] = v
+		}
+	}
+	return states
+}
+
+// syncTargetKey is the key kcp derives from the workspace and name of a SyncTarget for its labels.
+func syncTargetKey(path, name string) string {
+	hash := sha256.Sum224([]byte(path + name))
+	return new(big.Int).SetBytes(hash[:]).Text(62)
+}
+
+func sortedEdgeKeys(edges map[string]*kcptoolsv1alpha1.EdgeClusterStatus) []string {
+	keys := make([]string, 0, len(edges))
+	for k := range edges {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setEdgeClustersStatus writes edges and the EdgeKyvernoInstalled condition into the status of pc when they change.
+func (r *PolicyControlReconciler) setEdgeClustersStatus(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	edges []kcptoolsv1alpha1.EdgeClusterStatus,
+) error {
+	installed := metav1.Condition{
+		Type:    ConditionTypeEdgeKyvernoInstalled,
+		Status:  metav1.ConditionTrue,
+		Reason:  ConditionReasonInstalled,
+		Message: fmt.Sprintf("Kyverno is installed on all %d edge clusters", len(edges)),
+	}
+	var notInstalled []string
+	for _, e := range edges {
+		if e.Phase != EdgePhaseInstalled {
+			notInstalled = append(notInstalled, fmt.Sprintf("%s (%s)", edgeName(e), e.Phase))
+		}
+	}
+	switch {
+	case len(edges) == 0:
+		installed.Status = metav1.ConditionFalse
+		installed.Reason = ConditionReasonNoSyncTargets
+		installed.Message = "the workspace is not bound to any SyncTarget"
+	case len(notInstalled) > 0:
+		installed.Status = metav1.ConditionFalse
+		installed.Reason = ConditionReasonInstalling
+		installed.Message = "not installed: " + strings.Join(notInstalled, ", ")
+	}
+
+	if conditionUnchanged(pc.Status.Conditions, installed) && equality.Semantic.DeepEqual(pc.Status.EdgeClusters, edges) {
+		return nil
+	}
+	base := pc.DeepCopy()
+	meta.SetStatusCondition(&pc.Status.Conditions, installed)
+	pc.Status.EdgeClusters = edges
+	if err := r.patchStatus(ctx, pc, base); err != nil {
+		logger.Error(err, "failed to update status")
+		return err
+	}
+	return nil
+}
+
+func edgeName(e kcptoolsv1alpha1.EdgeClusterStatus) string {
+	if e.Name != "" {
+		return e.Path + ":" + e.Name
+	}
+	return e.SyncTarget
+}
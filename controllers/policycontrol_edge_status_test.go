@@ -0,0 +1,134 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+var _ = Describe("Edge cluster status", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	// syncSubscription marks the Subscription of Kyverno synced to the SyncTargets of keys and sets its status.
+	syncSubscription := func(status map[string]interface{}, annotations map[string]string, keys ...string) {
+		env.kcp.update("root:edge1", subscriptionsAPI.GroupVersionResource, "kyverno-incluster", "kyverno-operator",
+			func(obj *unstructured.Unstructured) {
+				labels := obj.GetLabels()
+				if labels == nil {
+					labels = map[string]string{}
+				}
+				for _, key := range keys {
+					labels[syncTargetStateLabelPrefix+key] = syncTargetStateSync
+				}
+				obj.SetLabels(labels)
+				obj.SetAnnotations(annotations)
+				if status != nil {
+					Expect(unstructured.SetNestedMap(obj.Object, status, "status")).To(Succeed())
+				}
+			})
+	}
+
+	edgeCondition := func() *metav1.Condition {
+		return meta.FindStatusCondition(env.latest(pc).Status.Conditions, ConditionTypeEdgeKyvernoInstalled)
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+	})
+
+	It("follows the Subscription of a placed SyncTarget until Kyverno is installed", func() {
+		bindSyncTarget(env.kcp, "root:edge1", "cluster-a")
+		key := syncTargetKey("root:edge1", "cluster-a")
+		Expect(env.reconcile(pc).RequeueAfter).To(Equal(edgeClustersRefreshInterval))
+
+		By("reporting the cluster Pending until the Subscription is synced to it")
+		Expect(env.latest(pc).Status.EdgeClusters).To(Equal([]kcptoolsv1alpha1.EdgeClusterStatus{{
+			SyncTarget: key, Name: "cluster-a", Path: "root:edge1",
+			Phase: EdgePhasePending, Message: "the Subscription of Kyverno is not synced yet",
+		}}))
+		Expect(edgeCondition().Reason).To(Equal(ConditionReasonInstalling))
+		Expect(edgeCondition().Message).To(Equal("not installed: root:edge1:cluster-a (Pending)"))
+
+		By("reporting it Installing while OLM upgrades the operator")
+		syncSubscription(map[string]interface{}{"state": "UpgradePending"}, nil, key)
+		env.reconcile(pc)
+		Expect(env.latest(pc).Status.EdgeClusters[0].Phase).To(Equal(EdgePhaseInstalling))
+		Expect(env.latest(pc).Status.EdgeClusters[0].Message).To(Equal(`Subscription state "UpgradePending"`))
+
+		By("reporting it Installed once the operator is at the latest known version")
+		syncSubscription(map[string]interface{}{"state": "AtLatestKnown", "installedCSV": "kyverno-operator.v1.8.0"}, nil, key)
+		env.reconcile(pc)
+		Expect(env.latest(pc).Status.EdgeClusters).To(Equal([]kcptoolsv1alpha1.EdgeClusterStatus{{
+			SyncTarget: key, Name: "cluster-a", Path: "root:edge1",
+			Phase: EdgePhaseInstalled, InstalledCSV: "kyverno-operator.v1.8.0",
+		}}))
+		Expect(edgeCondition().Status).To(Equal(metav1.ConditionTrue))
+		Expect(edgeCondition().Reason).To(Equal(ConditionReasonInstalled))
+	})
+
+	It("reads the status of each SyncTarget from its status annotation", func() {
+		bindSyncTarget(env.kcp, "root:edge1", "cluster-a")
+		env.kcp.create("root:edge1", syncTargetResource, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "workload.kcp.dev/v1alpha1", "kind": "SyncTarget", "metadata": map[string]interface{}{"name": "cluster-b"},
+		}})
+		keyA, keyB := syncTargetKey("root:edge1", "cluster-a"), syncTargetKey("root:edge1", "cluster-b")
+		env.reconcile(pc)
+
+		syncSubscription(map[string]interface{}{"state": "AtLatestKnown"}, map[string]string{
+			syncTargetStatusAnnotationPrefix + keyA: `{"state":"AtLatestKnown","installedCSV":"kyverno-operator.v1.8.0"}`,
+		}, keyA, keyB)
+		env.reconcile(pc)
+
+		edges := map[string]kcptoolsv1alpha1.EdgeClusterStatus{}
+		for _, e := range env.latest(pc).Status.EdgeClusters {
+			edges[e.Name] = e
+		}
+		Expect(edges).To(HaveLen(2))
+		Expect(edges["cluster-a"].Phase).To(Equal(EdgePhaseInstalled))
+		Expect(edges["cluster-a"].InstalledCSV).To(Equal("kyverno-operator.v1.8.0"))
+		// the status of the object is not the one of cluster-b when it is synced to several clusters
+		Expect(edges["cluster-b"].Phase).To(Equal(EdgePhaseInstalling))
+		Expect(edges["cluster-b"].Message).To(Equal(`Subscription state ""`))
+		Expect(edgeCondition().Message).To(Equal("not installed: root:edge1:cluster-b (Installing)"))
+	})
+
+	It("reports the SyncTargets the install namespace is scheduled to without a Placement", func() {
+		env.reconcile(pc)
+		Expect(edgeCondition().Reason).To(Equal(ConditionReasonNoSyncTargets))
+
+		env.kcp.update("root:edge1", namespaceGVR, "", "kyverno-incluster", func(obj *unstructured.Unstructured) {
+			obj.SetLabels(map[string]string{syncTargetStateLabelPrefix + "abc": syncTargetStateSync})
+		})
+		env.reconcile(pc)
+		Expect(env.latest(pc).Status.EdgeClusters).To(Equal([]kcptoolsv1alpha1.EdgeClusterStatus{{
+			SyncTarget: "abc", Phase: EdgePhasePending, Message: "the Subscription of Kyverno is not synced yet",
+		}}))
+		Expect(edgeCondition().Message).To(Equal("not installed: abc (Pending)"))
+	})
+})
@@ -0,0 +1,245 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	// ConditionTypeEnforcementVerified tells whether the canary probes were caught by Kyverno in the workspace and
+	// on every edge cluster, see status.enforcement for the details.
+	ConditionTypeEnforcementVerified = "EnforcementVerified"
+
+	ConditionReasonVerified    = "Verified"
+	ConditionReasonNotVerified = "NotVerified"
+
+	// EnforcementTargetWorkspace is the target of the probe of the workspace in status.enforcement.
+	EnforcementTargetWorkspace = "Workspace"
+
+	policyReportResultFail = "fail"
+)
+
+var (
+	// how often the canary probes run
+	enforcementProbeInterval = 5 * time.Minute
+
+	clusterPolicyGVR = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}
+	policyGVR        = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "policies"}
+	configMapGVR     = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+)
+
+// probeEnforcement checks that admission control is active for the workspace of pc and its edge clusters, at most
+// once per enforcementProbeInterval. The workspace is probed with a dry-run request creating a ConfigMap the canary
+// ClusterPolicy denies. Dry-run requests do not reach the edge clusters, so a canary ConfigMap is written to the
+// install namespace synced to them instead, and an edge cluster is verified once the PolicyReport synced back from
+// it holds the failed result of the canary Policy for a write made since the previous probe.
+func (r *PolicyControlReconciler) probeEnforcement(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	kcpKubeConfig string,
+) error {
+	now := metav1.Now()
+	previous := map[string]kcptoolsv1alpha1.EnforcementStatus{}
+	for _, e := range pc.Status.Enforcement {
+		previous[e.Target] = e
+	}
+	since := previous[EnforcementTargetWorkspace].LastProbeTime
+	if since != nil && now.Sub(since.Time) < enforcementProbeInterval {
+		return nil
+	}
+
+	config, _, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+	if err != nil {
+		return err
+	}
+	dyClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	logger.V(4).Info("probe policy enforcement of the workspace with the canary ConfigMap")
+	workspace := kcptoolsv1alpha1.EnforcementStatus{Target: EnforcementTargetWorkspace, LastProbeTime: &now}
+	if err := applyUnstructured(ctx, dyClient, clusterPolicyGVR, resources.BuildCanaryClusterPolicy(pc)); err != nil {
+		workspace.Message = fmt.Sprintf("failed to apply the canary ClusterPolicy: %s", err.Error())
+	} else {
+		canary := resources.BuildCanaryConfigMap(pc.Spec.KyvernoInWorkspace.NamespaceForAPIResources, now.Time)
+		_, err := clientset.CoreV1().ConfigMaps(canary.GetNamespace()).Create(ctx, canary, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+		switch {
+		case err == nil:
+			workspace.Message = "the canary ConfigMap was admitted"
+		// any rejection names the canary ConfigMap, only the denial by the canary rule carries its message
+		case strings.Contains(err.Error(), resources.CanaryMessage):
+			workspace.Verified = true
+		default:
+			workspace.Message = fmt.Sprintf("the canary ConfigMap was rejected for another reason: %s", err.Error())
+		}
+	}
+	workspace.LastVerifiedTime = verifiedTime(workspace.Verified, &now, previous[workspace.Target])
+	statuses := []kcptoolsv1alpha1.EnforcementStatus{workspace}
+
+	logger.V(4).Info("probe policy enforcement of the edge clusters with the canary ConfigMap")
+	edgeErr := applyUnstructured(ctx, dyClient, policyGVR, resources.BuildCanaryEdgePolicy(pc))
+	var reported map[string]time.Time
+	if edgeErr == nil {
+		reported, edgeErr = canaryReports(ctx, dyClient, pc.Spec.KyvernoInCluster.InstallNamespace)
+	}
+	if edgeErr == nil {
+		// written after reading the reports, so that the next probe only accepts results of this write
+		canary := resources.BuildCanaryConfigMap(pc.Spec.KyvernoInCluster.InstallNamespace, now.Time)
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(canary)
+		if err == nil {
+			err = applyUnstructured(ctx, dyClient, configMapGVR, &unstructured.Unstructured{Object: obj})
+		}
+		edgeErr = err
+	}
+	for _, edge := range pc.Status.EdgeClusters {
+		status := kcptoolsv1alpha1.EnforcementStatus{Target: edge.SyncTarget, LastProbeTime: &now}
+		if edge.Name != "" {
+			status.Name = edgeName(edge)
+		}
+		last, found := reported[edge.SyncTarget]
+		switch {
+		case edgeErr != nil:
+			status.Message = fmt.Sprintf("failed to probe the edge clusters: %s", edgeErr.Error())
+		case since == nil:
+			status.Message = "waiting for the result of the first probe"
+		case !found || last.Before(since.Time):
+			status.Message = "the canary ConfigMap was not reported since the previous probe"
+		default:
+			status.Verified = true
+			t := metav1.NewTime(last)
+			status.LastVerifiedTime = &t
+		}
+		if !status.Verified {
+			status.LastVerifiedTime = previous[status.Target].LastVerifiedTime
+		}
+		statuses = append(statuses, status)
+	}
+	return r.setEnforcementStatus(ctx, logger, pc, statuses)
+}
+
+// canaryReports returns the time of the latest failed result of the canary Policy for the canary ConfigMap in the
+// PolicyReports of namespace, by the SyncTarget key of the edge cluster the report was synced from.
+func canaryReports(ctx context.Context, dyClient dynamic.Interface, namespace string) (map[string]time.Time, error) {
+	reports, err := dyClient.Resource(policyReportGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	reported := map[string]time.Time{}
+	for _, report := range reports.Items {
+		syncTarget := reportSyncTarget(report)
+		if syncTarget == "" {
+			continue
+		}
+		for _, result := range policyReportResults(report) {
+			if result["policy"] != resources.CanaryName || result["result"] != policyReportResultFail {
+				continue
+			}
+			seconds, _, _ := unstructured.NestedInt64(result, "timestamp", "seconds")
+			if t := time.Unix(seconds, 0); t.After(reported[syncTarget]) {
+				reported[syncTarget] = t
+			}
+		}
+	}
+	return reported, nil
+}
+
+func verifiedTime(verified bool, now *metav1.Time, previous kcptoolsv1alpha1.EnforcementStatus) *metav1.Time {
+	if verified {
+		return now
+	}
+	return previous.LastVerifiedTime
+}
+
+// applyUnstructured server-side applies obj with the resource gvr, marked as created by the operator.
+func applyUnstructured(ctx context.Context, dyClient dynamic.Interface, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	markCreated(obj)
+	var ri dynamic.ResourceInterface = dyClient.Resource(gvr)
+	if obj.GetNamespace() != "" {
+		ri = dyClient.Resource(gvr).Namespace(obj.GetNamespace())
+	}
+	_, err := ri.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: workspaceFieldManager, Force: true})
+	return err
+}
+
+// setEnforcementStatus writes statuses and the EnforcementVerified condition into the status of pc when they change.
+func (r *PolicyControlReconciler) setEnforcementStatus(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	statuses []kcptoolsv1alpha1.EnforcementStatus,
+) error {
+	verified := metav1.Condition{
+		Type:    ConditionTypeEnforcementVerified,
+		Status:  metav1.ConditionTrue,
+		Reason:  ConditionReasonVerified,
+		Message: "the canary was caught in the workspace and on all edge clusters",
+	}
+	var notVerified []string
+	for _, s := range statuses {
+		if !s.Verified {
+			name := s.Target
+			if s.Name != "" {
+				name = s.Name
+			}
+			notVerified = append(notVerified, fmt.Sprintf("%s (%s)", name, s.Message))
+		}
+	}
+	if len(notVerified) > 0 {
+		verified.Status = metav1.ConditionFalse
+		verified.Reason = ConditionReasonNotVerified
+		verified.Message = "not verified: " + strings.Join(notVerified, ", ")
+	}
+
+	if conditionUnchanged(pc.Status.Conditions, verified) && equality.Semantic.DeepEqual(pc.Status.Enforcement, statuses) {
+		return nil
+	}
+	base := pc.DeepCopy()
+	meta.SetStatusCondition(&pc.Status.Conditions, verified)
+	pc.Status.Enforcement = statuses
+	if err := r.patchStatus(ctx, pc, base); err != nil {
+		logger.Error(err, "failed to update status")
+		return err
+	}
+	if verified.Status != metav1.ConditionTrue {
+		r.Recorder.Eventf(pc, corev1.EventTypeWarning, EventReasonEnforcementNotVerified, "%s", verified.Message)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var _ = Describe("Enforcement probe", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	// denyCanary rejects the canary ConfigMaps of the workspace the way the Kyverno webhook does.
+	denyCanary := func() {
+		env.kcp.setAdmission(func(path string, obj *unstructured.Unstructured) error {
+			if path == pc.Spec.Workspace && obj.GetKind() == "ConfigMap" && obj.GetNamespace() == "kyverno" &&
+				obj.GetLabels()[resources.CanaryLabel] == "true" {
+				return apierrors.NewBadRequest(fmt.Sprintf(`admission webhook "validate.kyverno.svc-fail" denied the request: `+
+					"resource ConfigMap/kyverno/%s was blocked due to the following policies %s: deny-canary: %s",
+					obj.GetName(), resources.CanaryName, resources.CanaryMessage))
+			}
+			return nil
+		})
+	}
+
+	// canaryReport reports the canary ConfigMap denied at t by the canary Policy on the edge cluster of key.
+	canaryReport := func(key string, t time.Time) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "wgpolicyk8s.io/v1alpha2",
+			"kind":       "PolicyReport",
+			"metadata": map[string]interface{}{
+				"name":      "polr-ns-kyverno-incluster",
+				"namespace": "kyverno-incluster",
+				"labels":    map[string]interface{}{syncTargetStateLabelPrefix + key: syncTargetStateSync},
+			},
+			"results": []interface{}{map[string]interface{}{
+				"policy":    resources.CanaryName,
+				"rule":      "deny-canary",
+				"result":    policyReportResultFail,
+				"timestamp": map[string]interface{}{"seconds": t.Unix(), "nanos": int64(0)},
+			}},
+		}}
+	}
+
+	enforcement := func() map[string]kcptoolsv1alpha1.EnforcementStatus {
+		statuses := map[string]kcptoolsv1alpha1.EnforcementStatus{}
+		for _, s := range env.latest(pc).Status.Enforcement {
+			statuses[s.Target] = s
+		}
+		return statuses
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+	})
+
+	probeOnEveryReconcile := func() {
+		interval := enforcementProbeInterval
+		enforcementProbeInterval = 0
+		DeferCleanup(func() { enforcementProbeInterval = interval })
+	}
+
+	It("verifies the workspace once Kyverno denies the canary ConfigMap", func() {
+		env.reconcile(pc)
+		Expect(env.kcp.get("root:edge1", clusterPolicyGVR, "", resources.CanaryName)).NotTo(BeNil())
+		// the workspace is probed with a dry-run request
+		Expect(env.kcp.get("root:edge1", configMapGVR, "kyverno", resources.CanaryName)).To(BeNil())
+		workspace := enforcement()[EnforcementTargetWorkspace]
+		Expect(workspace.Verified).To(BeFalse())
+		Expect(workspace.Message).To(Equal("the canary ConfigMap was admitted"))
+		Expect(workspace.LastVerifiedTime).To(BeNil())
+		Expect(drainEvents(env.recorder)).To(ContainElement(
+			"Warning " + EventReasonEnforcementNotVerified + " not verified: Workspace (the canary ConfigMap was admitted)"))
+
+		By("not probing again within the probe interval")
+		denyCanary()
+		env.reconcile(pc)
+		Expect(enforcement()[EnforcementTargetWorkspace]).To(Equal(workspace))
+
+		By("verifying the workspace on the next probe")
+		probeOnEveryReconcile()
+		env.reconcile(pc)
+		workspace = enforcement()[EnforcementTargetWorkspace]
+		Expect(workspace.Verified).To(BeTrue())
+		Expect(workspace.Message).To(BeEmpty())
+		Expect(workspace.LastVerifiedTime).To(Equal(workspace.LastProbeTime))
+		Expect(meta.IsStatusConditionTrue(env.latest(pc).Status.Conditions, ConditionTypeEnforcementVerified)).To(BeTrue())
+	})
+
+	It("does not take a rejection for another reason as enforcement", func() {
+		probeOnEveryReconcile()
+		env.reconcile(pc)
+		env.kcp.setAdmission(func(path string, obj *unstructured.Unstructured) error {
+			if obj.GetKind() == "ConfigMap" && obj.GetName() == resources.CanaryName {
+				return apierrors.NewForbidden(configMapGVR.GroupResource(), obj.GetName(), fmt.Errorf("quota exceeded"))
+			}
+			return nil
+		})
+		env.reconcile(pc)
+		workspace := enforcement()[EnforcementTargetWorkspace]
+		Expect(workspace.Verified).To(BeFalse())
+		Expect(workspace.Message).To(HavePrefix("the canary ConfigMap was rejected for another reason: "))
+		Expect(workspace.Message).To(ContainSubstring("quota exceeded"))
+	})
+
+	It("verifies an edge cluster once it reports the canary ConfigMap written by the previous probe", func() {
+		// the edge clusters serve Policies to the workspace through its syncer
+		env.kcp.addWorkspace("root:edge3", operatorGroupsAPI, subscriptionsAPI, kyvernoesAPI, policiesAPI)
+		pc = newTestPolicyControl("pccr-edge3", "root:edge3")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		probeOnEveryReconcile()
+		denyCanary()
+		bindSyncTarget(env.kcp, "root:edge3", "cluster-a")
+		key := syncTargetKey("root:edge3", "cluster-a")
+
+		By("writing the canary ConfigMap synced to the edge clusters")
+		env.reconcile(pc)
+		Expect(env.kcp.get("root:edge3", policyGVR, "kyverno-incluster", resources.CanaryName)).NotTo(BeNil())
+		canary := env.kcp.get("root:edge3", configMapGVR, "kyverno-incluster", resources.CanaryName)
+		Expect(canary).NotTo(BeNil())
+		Expect(canary.GetAnnotations()).To(HaveKey(resources.CanaryProbeTimeAnnotation))
+		edge := enforcement()[key]
+		Expect(edge.Name).To(Equal("root:edge3:cluster-a"))
+		Expect(edge.Verified).To(BeFalse())
+		Expect(edge.Message).To(Equal("waiting for the result of the first probe"))
+
+		By("verifying the cluster once its PolicyReport holds the result of that write")
+		reported := time.Now().Truncate(time.Second)
+		env.kcp.create("root:edge3", policyReportGVR, canaryReport(key, reported))
+		env.reconcile(pc)
+		edge = enforcement()[key]
+		Expect(edge.Verified).To(BeTrue())
+		Expect(edge.LastVerifiedTime.Time).To(BeTemporally("==", reported))
+		Expect(meta.IsStatusConditionTrue(env.latest(pc).Status.Conditions, ConditionTypeEnforcementVerified)).To(BeTrue())
+
+		By("not verifying it on a result older than the previous probe")
+		env.kcp.update("root:edge3", policyReportGVR, "kyverno-incluster", "polr-ns-kyverno-incluster", func(obj *unstructured.Unstructured) {
+			obj.Object["results"] = canaryReport(key, reported.Add(-time.Hour)).Object["results"]
+		})
+		env.reconcile(pc)
+		edge = enforcement()[key]
+		Expect(edge.Verified).To(BeFalse())
+		Expect(edge.Message).To(Equal("the canary ConfigMap was not reported since the previous probe"))
+		Expect(edge.LastVerifiedTime.Time).To(BeTemporally("==", reported))
+		condition := meta.FindStatusCondition(env.latest(pc).Status.Conditions, ConditionTypeEnforcementVerified)
+		Expect(condition.Reason).To(Equal(ConditionReasonNotVerified))
+		Expect(condition.Message).To(ContainSubstring("root:edge3:cluster-a (the canary ConfigMap was not reported since the previous probe)"))
+	})
+})
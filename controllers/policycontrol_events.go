@@ -0,0 +1,45 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+// Reasons of the events recorded on PolicyControls. They are part of the API surface that alerts
+// are built on, so existing values must not be changed.
+const (
+	EventReasonSyncerInstalled        = "SyncerInstalled"
+	EventReasonSyncerInstallFailed    = "SyncerInstallFailed"
+	EventReasonKcpConnectionFailed    = "KcpConnectionFailed"
+	EventReasonNamespaceCreated       = "NamespaceCreated"
+	EventReasonNamespaceCreateFailed  = "NamespaceCreateFailed"
+	EventReasonOLMObjectCreated       = "OLMObjectCreated"
+	EventReasonOLMObjectCreateFailed  = "OLMObjectCreateFailed"
+	EventReasonManifestApplyFailed    = "ManifestApplyFailed"
+	EventReasonSecretDistributed      = "SecretDistributed"
+	EventReasonSecretDistributeFailed = "SecretDistributeFailed"
+	EventReasonIngressPathChanged     = "IngressPathChanged"
+	EventReasonIngressUpdateFailed    = "IngressUpdateFailed"
+	EventReasonKyvernoDeployed        = "KyvernoDeployed"
+	EventReasonKyvernoDeployFailed    = "KyvernoDeployFailed"
+	EventReasonKyvernoTornDown        = "KyvernoTornDown"
+	EventReasonKyvernoTeardownFailed  = "KyvernoTeardownFailed"
+	EventReasonPlanned                = "Planned"
+	EventReasonAPIExportFailed        = "APIExportFailed"
+	EventReasonEnforcementNotVerified = "EnforcementNotVerified"
+	EventReasonWebhookUnreachable     = "WebhookUnreachable"
+	EventReasonAdmissionFailOpen      = "AdmissionFailOpen"
+	EventReasonFailurePolicyRestored  = "FailurePolicyRestored"
+	EventReasonWorkspaceNameConflict  = "WorkspaceNameConflict"
+)
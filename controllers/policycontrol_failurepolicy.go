@@ -0,0 +1,208 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	// ConditionTypeAdmissionDegraded tells whether the Kyverno policies of the workspace were switched to fail open
+	// because the Kyverno Deployment has been unavailable longer than degradedFailOpenAfter.
+	ConditionTypeAdmissionDegraded = "AdmissionDegraded"
+
+	ConditionReasonKyvernoUnavailable = "KyvernoUnavailable"
+	ConditionReasonKyvernoAvailable   = "KyvernoAvailable"
+
+	// label Kyverno puts on the webhook configurations it manages
+	kyvernoWebhookManagedByLabel = "webhook.kyverno.io/managed-by=kyverno"
+
+	// OriginalFailurePolicyAnnotation holds the failure policy a Kyverno policy had before the operator set its own,
+	// empty when it had none, so that it is restored once the operator no longer sets one.
+	OriginalFailurePolicyAnnotation = "ibm.github.com/original-failure-policy"
+)
+
+// recheck interval of the Kyverno Deployment while the policies fail open, so that their failure policy is
+// restored soon after it is available again
+var failOpenRecheckInterval = 30 * time.Second
+
+// enforceFailurePolicy sets the failure policy of pc on the Kyverno policies of the workspace, or "Ignore" while
+// the Kyverno Deployment serving the workspace has been unavailable longer than degradedFailOpenAfter.
+// It returns when the Deployment has to be checked again: once it will have been unavailable long enough to fail
+// open, and shortly while failing open so that the failure policy is restored soon after it recovers.
+func (r *PolicyControlReconciler) enforceFailurePolicy(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	kcpKubeConfig string,
+) (time.Duration, error) {
+	configured := pc.Spec.KyvernoInWorkspace.FailurePolicy
+	window := pc.Spec.KyvernoInWorkspace.DegradedFailOpenAfter
+	// once both are cleared, the policies get their original failure policy back first
+	if configured == "" && window == nil && pc.Status.EffectiveFailurePolicy == "" {
+		return 0, nil
+	}
+
+	degraded := metav1.Condition{
+		Type:    ConditionTypeAdmissionDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  ConditionReasonKyvernoAvailable,
+		Message: "the Kyverno Deployment is available",
+	}
+	effective := configured
+	var requeueAfter time.Duration
+	unavailableSince, err := r.kyvernoUnavailableSince(ctx, pc)
+	if err != nil {
+		return 0, err
+	}
+	if window != nil && unavailableSince != nil {
+		unavailable := time.Since(unavailableSince.Time)
+		degraded.Reason = ConditionReasonKyvernoUnavailable
+		degraded.Message = fmt.Sprintf("the Kyverno Deployment is unavailable since %s", unavailableSince.UTC().Format(time.RFC3339))
+		if unavailable >= window.Duration {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Message += fmt.Sprintf(", longer than %s: the policies fail open", window.Duration)
+			effective = string(admissionregistrationv1.Ignore)
+			requeueAfter = failOpenRecheckInterval
+		} else {
+			requeueAfter = window.Duration - unavailable
+		}
+	}
+
+	if effective != "" || pc.Status.EffectiveFailurePolicy != "" {
+		config, _, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+		if err != nil {
+			return 0, err
+		}
+		dyClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return 0, err
+		}
+		logger.V(4).Info(fmt.Sprintf("set failure policy %q on the Kyverno policies", effective))
+		if err := setPolicyFailurePolicy(ctx, dyClient, effective); err != nil {
+			logger.Error(err, "failed to set the failure policy of the Kyverno policies")
+			return 0, err
+		}
+	}
+
+	wasDegraded := meta.IsStatusConditionTrue(pc.Status.Conditions, ConditionTypeAdmissionDegraded)
+	if conditionUnchanged(pc.Status.Conditions, degraded) && pc.Status.EffectiveFailurePolicy == effective {
+		return requeueAfter, nil
+	}
+	base := pc.DeepCopy()
+	meta.SetStatusCondition(&pc.Status.Conditions, degraded)
+	pc.Status.EffectiveFailurePolicy = effective
+	if err := r.patchStatus(ctx, pc, base); err != nil {
+		logger.Error(err, "failed to update status")
+		return 0, err
+	}
+	switch {
+	case degraded.Status == metav1.ConditionTrue && !wasDegraded:
+		r.Recorder.Eventf(pc, corev1.EventTypeWarning, EventReasonAdmissionFailOpen, "%s", degraded.Message)
+	case degraded.Status != metav1.ConditionTrue && wasDegraded:
+		r.Recorder.Eventf(pc, corev1.EventTypeNormal, EventReasonFailurePolicyRestored,
+			"the Kyverno Deployment is available again, failure policy %q restored", configured)
+	}
+	return requeueAfter, nil
+}
+
+// kyvernoUnavailableSince returns when the Deployment of the Kyverno serving the workspace of pc became
+// unavailable, nil while it is available or not created yet.
+func (r *PolicyControlReconciler) kyvernoUnavailableSince(ctx context.Context, pc *kcptoolsv1alpha1.PolicyControl) (*metav1.Time, error) {
+	var deployment appsv1.Deployment
+	key := client.ObjectKey{Namespace: resources.KyvernoNamespace(pc), Name: resources.KyvernoInstanceName(pc)}
+	if err := r.Get(ctx, key, &deployment); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, c := range deployment.Status.Conditions {
+		if c.Type == appsv1.DeploymentAvailable && c.Status != corev1.ConditionTrue {
+			return &c.LastTransitionTime, nil
+		}
+	}
+	return nil, nil
+}
+
+// setPolicyFailurePolicy sets spec.failurePolicy on the ClusterPolicies and Policies of the workspace whose
+// failure policy differs. Kyverno registers the webhooks of a policy with its failure policy, so the failure
+// policy survives Kyverno reconciling its webhook configurations, which reverts changes made to them directly.
+// The failure policy a policy had before is kept in OriginalFailurePolicyAnnotation. An empty policy restores it
+// on the policies the operator changed, leaving the others to their authors.
+func setPolicyFailurePolicy(ctx context.Context, dyClient dynamic.Interface, policy string) error {
+	for _, gvr := range []schema.GroupVersionResource{clusterPolicyGVR, policyGVR} {
+		list, err := dyClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+		if errors.IsNotFound(err) {
+			// namespaced Policies are only served once the syncer imports them
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, p := range list.Items {
+			current, _, _ := unstructured.NestedString(p.Object, "spec", "failurePolicy")
+			original, changed := p.GetAnnotations()[OriginalFailurePolicyAnnotation]
+			var patch []byte
+			switch {
+			case policy == "" && changed:
+				patch = []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null}},"spec":{"failurePolicy":%s}}`,
+					OriginalFailurePolicyAnnotation, failurePolicyValue(original)))
+			case policy == "" || current == policy:
+				continue
+			case changed:
+				patch = []byte(fmt.Sprintf(`{"spec":{"failurePolicy":%s}}`, failurePolicyValue(policy)))
+			default:
+				patch = []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}},"spec":{"failurePolicy":%s}}`,
+					OriginalFailurePolicyAnnotation, current, failurePolicyValue(policy)))
+			}
+			_, err := dyClient.Resource(gvr).Namespace(p.GetNamespace()).Patch(ctx, p.GetName(), types.MergePatchType, patch,
+				metav1.PatchOptions{FieldManager: workspaceFieldManager})
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// failurePolicyValue returns policy as a JSON merge patch value, null removing the failure policy when empty.
+func failurePolicyValue(policy string) string {
+	if policy == "" {
+		return "null"
+	}
+	return strconv.Quote(policy)
+}
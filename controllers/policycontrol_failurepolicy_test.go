@@ -0,0 +1,163 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var _ = Describe("PolicyControl failure policy", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	// failurePolicy returns the failure policy of the ClusterPolicy, "unset" when it has none
+	failurePolicy := func(name string) string {
+		policy := env.kcp.get("root:edge1", clusterPolicyGVR, "", name)
+		Expect(policy).NotTo(BeNil())
+		if value, found, _ := unstructured.NestedString(policy.Object, "spec", "failurePolicy"); found {
+			return value
+		}
+		return "unset"
+	}
+	// originalFailurePolicy returns the failure policy the ClusterPolicy had before the operator changed it, "none"
+	// when the operator did not change it
+	originalFailurePolicy := func(name string) string {
+		original, found := env.kcp.get("root:edge1", clusterPolicyGVR, "", name).GetAnnotations()[OriginalFailurePolicyAnnotation]
+		if !found {
+			return "none"
+		}
+		return original
+	}
+	// createPolicies creates ClusterPolicies without failure policy and with the failure policies their authors chose
+	createPolicies := func() {
+		for name, spec := range map[string]map[string]interface{}{
+			"require-labels":  {"validationFailureAction": "Enforce"},
+			"disallow-latest": {"validationFailureAction": "Enforce", "failurePolicy": "Fail"},
+			"allow-debug":     {"validationFailureAction": "Audit", "failurePolicy": "Ignore"},
+		} {
+			env.kcp.create("root:edge1", clusterPolicyGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": name},
+				"spec":     spec,
+			}})
+		}
+	}
+	setFailurePolicy := func(value string) {
+		live := env.latest(pc)
+		live.Spec.KyvernoInWorkspace.FailurePolicy = value
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+	})
+
+	It("sets the failure policy on the Kyverno policies and leaves the webhooks to Kyverno", func() {
+		env.kcp.create("root:edge1", validatingGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":   "kyverno-resource-validating-webhook-cfg",
+				"labels": map[string]interface{}{"webhook.kyverno.io/managed-by": "kyverno"},
+			},
+			"webhooks": []interface{}{map[string]interface{}{"name": "validate.kyverno.svc-fail", "failurePolicy": "Fail"}},
+		}})
+		createPolicies()
+
+		setFailurePolicy("Ignore")
+		for _, name := range []string{"require-labels", "disallow-latest", "allow-debug"} {
+			Expect(failurePolicy(name)).To(Equal("Ignore"))
+		}
+		Expect(originalFailurePolicy("require-labels")).To(Equal(""))
+		Expect(originalFailurePolicy("disallow-latest")).To(Equal("Fail"))
+		Expect(originalFailurePolicy("allow-debug")).To(Equal("none"))
+		webhook := env.kcp.get("root:edge1", validatingGVR, "", "kyverno-resource-validating-webhook-cfg")
+		webhooks, _, _ := unstructured.NestedSlice(webhook.Object, "webhooks")
+		Expect(webhooks[0]).To(HaveKeyWithValue("failurePolicy", "Fail"))
+		Expect(env.latest(pc).Status.EffectiveFailurePolicy).To(Equal("Ignore"))
+
+		By("setting it on the policies created later")
+		env.kcp.create("root:edge1", clusterPolicyGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "restrict-image-registries"},
+			"spec":     map[string]interface{}{"validationFailureAction": "Audit"},
+		}})
+		env.reconcile(pc)
+		Expect(failurePolicy("restrict-image-registries")).To(Equal("Ignore"))
+
+		By("restoring the failure policies the operator changed once it is cleared")
+		setFailurePolicy("")
+		for _, name := range []string{"require-labels", "restrict-image-registries"} {
+			Expect(failurePolicy(name)).To(Equal("unset"))
+		}
+		Expect(failurePolicy("disallow-latest")).To(Equal("Fail"))
+		Expect(failurePolicy("allow-debug")).To(Equal("Ignore"))
+		for _, name := range []string{"require-labels", "disallow-latest", "restrict-image-registries", "allow-debug"} {
+			Expect(originalFailurePolicy(name)).To(Equal("none"))
+		}
+		Expect(env.latest(pc).Status.EffectiveFailurePolicy).To(BeEmpty())
+	})
+
+	It("fails open while Kyverno is unavailable and restores the failure policies of the authors after", func() {
+		createPolicies()
+		live := env.latest(pc)
+		live.Spec.KyvernoInWorkspace.DegradedFailOpenAfter = &metav1.Duration{Duration: 10 * time.Minute}
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		setAvailable := func(status corev1.ConditionStatus) {
+			var deployment appsv1.Deployment
+			key := client.ObjectKey{Namespace: resources.KyvernoNamespace(pc), Name: resources.KyvernoInstanceName(pc)}
+			Expect(env.pcc.Get(env.ctx, key, &deployment)).To(Succeed())
+			deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+				Type:               appsv1.DeploymentAvailable,
+				Status:             status,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+			}}
+			Expect(env.pcc.Status().Update(env.ctx, &deployment)).To(Succeed())
+		}
+
+		setAvailable(corev1.ConditionFalse)
+		Expect(env.reconcile(pc).RequeueAfter).To(Equal(failOpenRecheckInterval))
+		Expect(meta.IsStatusConditionTrue(env.latest(pc).Status.Conditions, ConditionTypeAdmissionDegraded)).To(BeTrue())
+		for _, name := range []string{"require-labels", "disallow-latest", "allow-debug"} {
+			Expect(failurePolicy(name)).To(Equal("Ignore"))
+		}
+
+		By("restoring only the failure policies the operator changed once Kyverno is available")
+		setAvailable(corev1.ConditionTrue)
+		env.reconcile(pc)
+		Expect(meta.IsStatusConditionTrue(env.latest(pc).Status.Conditions, ConditionTypeAdmissionDegraded)).To(BeFalse())
+		Expect(failurePolicy("require-labels")).To(Equal("unset"))
+		Expect(failurePolicy("disallow-latest")).To(Equal("Fail"))
+		Expect(failurePolicy("allow-debug")).To(Equal("Ignore"))
+		Expect(originalFailurePolicy("disallow-latest")).To(Equal("none"))
+	})
+})
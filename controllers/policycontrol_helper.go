@@ -19,13 +19,16 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -88,7 +91,7 @@ func (r *PolicyControlReconciler) createOrUpdateTypedResourceByUnstructured(
 	return r.createOrUpdateTypedResource(ctx, logger, pc, typedObj, isSetControllerReference)
 }
 
-func (r *PolicyControlReconciler) createOrUpdateUnstructuredResource(
+func createOrUpdateUnstructuredResource(
 	ctx context.Context,
 	logger logr.Logger,
 	dyClient dynamic.Interface,
@@ -96,7 +99,7 @@ func (r *PolicyControlReconciler) createOrUpdateUnstructuredResource(
 	obj unstructured.Unstructured,
 	ignoreUpdateError bool,
 ) (ctrl.Result, error) {
-	_, err := dyClient.Resource(restMapping.Resource).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+	live, err := dyClient.Resource(restMapping.Resource).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
 	if err != nil {
 		_, err = dyClient.Resource(restMapping.Resource).Namespace(obj.GetNamespace()).Create(ctx, &obj, metav1.CreateOptions{})
 		if err != nil {
@@ -104,6 +107,8 @@ func (r *PolicyControlReconciler) createOrUpdateUnstructuredResource(
 			return ctrl.Result{}, err
 		}
 	} else if err == nil {
+		// an update has to carry the resourceVersion it is based on
+		obj.SetResourceVersion(live.GetResourceVersion())
 		_, err = dyClient.Resource(restMapping.Resource).Namespace(obj.GetNamespace()).Update(ctx, &obj, metav1.UpdateOptions{})
 		if err != nil {
 			logger.Error(err, "failed to update Resource")
@@ -117,23 +122,17 @@ func (r *PolicyControlReconciler) createOrUpdateUnstructuredResource(
 	return ctrl.Result{}, nil
 }
 
-func (r *PolicyControlReconciler) createOrUpdateUnstructuredResourceFromFile(
+// patchStatus patches the status of pc with its changes from base. The spec of pc is kept rather than replaced by
+// the stored one the API server returns, as it is the effective spec with the template defaults merged in.
+func (r *PolicyControlReconciler) patchStatus(
 	ctx context.Context,
-	logger logr.Logger,
-	restMapper meta.RESTMapper,
-	dyClient dynamic.Interface,
-	path string,
-	ignoreUpdateError bool,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	base *kcptoolsv1alpha1.PolicyControl,
 ) error {
-	obj, mapping, err := getUnstructuredFromFile(logger, path, restMapper)
-	if err != nil {
-		return err
-	}
-	_, err = r.createOrUpdateUnstructuredResource(ctx, logger, dyClient, *mapping, obj, ignoreUpdateError)
-	if err != nil {
-		return err
-	}
-	return nil
+	spec := pc.Spec.DeepCopy()
+	err := r.Status().Patch(ctx, pc, client.MergeFrom(base))
+	pc.Spec = *spec
+	return err
 }
 
 func (r *PolicyControlReconciler) createOrUpdate(
@@ -157,3 +156,50 @@ func (r *PolicyControlReconciler) createOrUpdate(
 	}
 	return nil
 }
+
+// writeKcpKubeConfig writes the KCP kubeconfig referred by pc to a temporary file for the kcp command.
+// The returned func removes the file.
+func writeKcpKubeConfig(
+	ctx context.Context,
+	c client.Reader,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) (string, func(), error) {
+	kcpKubeConfigSecret := pc.Spec.PolicyControlCluster.KcpKubeConfigSecret
+	var kcpSecret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: kcpKubeConfigSecret.Name}, &kcpSecret); err != nil {
+		return "", nil, err
+	}
+	file, err := os.CreateTemp("", "*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		if err := file.Close(); err != nil {
+			logger.Error(err, "failed to close "+file.Name())
+		}
+		if err := os.Remove(file.Name()); err != nil {
+			logger.Error(err, "failed to remove "+file.Name())
+		}
+	}
+	if _, err := file.Write(kcpSecret.Data[kcpKubeConfigSecret.Key]); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return file.Name(), cleanup, nil
+}
+
+// getPolicyControlWorkspaceConfigs returns the rest config and RESTMapper of the workspace managed by pc.
+func getPolicyControlWorkspaceConfigs(
+	ctx context.Context,
+	c client.Reader,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) (*rest.Config, meta.RESTMapper, error) {
+	kcpKubeConfig, cleanup, err := writeKcpKubeConfig(ctx, c, logger, pc)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+	return getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+}
@@ -0,0 +1,385 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-logr/logr"
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/render"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	// DryRunAnnotation set to "true" on a PolicyControl makes the reconciler only compute the plan of its changes.
+	DryRunAnnotation = "ibm.github.com/dry-run"
+
+	planFieldManager = "policy-control-operator-plan"
+	planConfigMapKey = "plan.yaml"
+
+	PlanActionCreate    = "Create"
+	PlanActionUpdate    = "Update"
+	PlanActionUnchanged = "Unchanged"
+	PlanActionFailed    = "Failed"
+
+	PlanTargetPolicyControlCluster = "PolicyControlCluster"
+	PlanTargetWorkspace            = "Workspace"
+	PlanTargetAPIProvider          = "APIProvider"
+)
+
+// planScheme knows the kinds built by the resources package, including the OLM ones placed into the workspace.
+var planScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(planScheme))
+	utilruntime.Must(operatorsv1.AddToScheme(planScheme))
+	utilruntime.Must(operatorsv1alpha1.AddToScheme(planScheme))
+}
+
+// planEntry is the planned change of a single object.
+type planEntry struct {
+	Target    string `json:"target"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	// Fields changed by an update, as dotted paths
+	Changes []string `json:"changes,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+func isDryRun(pc *kcptoolsv1alpha1.PolicyControl) bool {
+	return pc.GetAnnotations()[DryRunAnnotation] == "true"
+}
+
+// plan computes the objects a reconcile of pc would create or update, diffs them against the live state with
+// server-side dry-run requests and writes the result into a ConfigMap and the PolicyControl status.
+// Nothing but the plan ConfigMap and the status is changed.
+func (r *PolicyControlReconciler) plan(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+	kcpKubeConfig string,
+) (ctrl.Result, error) {
+	var entries []planEntry
+
+	pcoConfig, err := getPCOClusterConfig()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	pcoClient, err := dynamic.NewForConfig(pcoConfig)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	pco := &planner{ctx: ctx, target: PlanTargetPolicyControlCluster, dyClient: pcoClient, mapper: r.RESTMapper()}
+
+	// generating the syncer manifests creates the SyncTarget in kcp, so the syncer cannot be planned
+	if pointer.BoolDeref(pc.Spec.PolicyControlCluster.InstallSyncer, false) {
+		entries = append(entries, planEntry{
+			Target:  PlanTargetPolicyControlCluster,
+			Kind:    "SyncTarget",
+			Name:    pc.Spec.PolicyControlCluster.IngressName,
+			Action:  PlanActionUnchanged,
+			Message: "syncer manifests are not planned because generating them registers the SyncTarget in kcp",
+		})
+	}
+
+	providerPath := resources.KyvernoAPIExport(&pc).Path
+	providerConfig, providerMapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, providerPath, logger)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	providerClient, err := dynamic.NewForConfig(providerConfig)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	provider := &planner{ctx: ctx, target: PlanTargetAPIProvider, dyClient: providerClient, mapper: providerMapper}
+	apis, err := render.KyvernoAPIs(&pc, render.Options{KyvernoManifestsDir: WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR})
+	if err != nil {
+		provider.entries = append(provider.entries, planEntry{Target: PlanTargetAPIProvider, Action: PlanActionFailed, Message: err.Error()})
+	}
+	for i := range apis {
+		provider.add(&apis[i])
+	}
+
+	wsConfig, wsMapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	wsClient, err := dynamic.NewForConfig(wsConfig)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	ws := &planner{ctx: ctx, target: PlanTargetWorkspace, dyClient: wsClient, mapper: wsMapper}
+
+	crTlsSecret := pc.Spec.PolicyControlCluster.IngressTLSSecret
+	var tlsSecret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: crTlsSecret.Name}, &tlsSecret); err != nil {
+		return ctrl.Result{}, err
+	}
+	kubeConfig, err := getWorkspaceKubeConfig(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	secrets := render.Secrets{
+		WorkspaceKubeConfig: kubeConfig,
+		TLSKey:              string(tlsSecret.Data[crTlsSecret.KeyForPrivKey]),
+		TLSCert:             string(tlsSecret.Data[crTlsSecret.KeyForCert]),
+		TLSCACert:           string(tlsSecret.Data[crTlsSecret.KeyForCacert]),
+	}
+
+	// the same objects as rendered for GitOps, see the render package
+	wsObjs, err := render.WorkspaceObjects(&pc, render.Options{
+		KyvernoManifestsDir: WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR,
+		APIBindingsManifest: WORKSPACE_APIBINDINGS_MANIFEST,
+	}, secrets)
+	if err != nil {
+		ws.entries = append(ws.entries, planEntry{Target: PlanTargetWorkspace, Action: PlanActionFailed, Message: err.Error()})
+	}
+	for _, obj := range wsObjs {
+		ws.add(obj)
+	}
+
+	var current *networkingv1.Ingress
+	ingress := &networkingv1.Ingress{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: resources.KyvernoNamespace(&pc), Name: naming.IngressName}, ingress); err == nil {
+		current = ingress
+	}
+	if updated, err := render.Ingress(&pc, current); err != nil {
+		pco.entries = append(pco.entries, planEntry{Target: PlanTargetPolicyControlCluster, Kind: "Ingress",
+			Namespace: ingress.GetNamespace(), Name: ingress.GetName(), Action: PlanActionFailed, Message: err.Error()})
+	} else {
+		pco.add(updated)
+	}
+	for _, obj := range render.PolicyControlClusterObjects(&pc, secrets) {
+		pco.add(obj)
+	}
+
+	entries = append(entries, pco.entries...)
+	entries = append(entries, provider.entries...)
+	entries = append(entries, ws.entries...)
+	return ctrl.Result{}, r.writePlan(ctx, logger, pc, entries)
+}
+
+// writePlan stores the entries in the plan ConfigMap of pc and summarizes them in its status.
+func (r *PolicyControlReconciler) writePlan(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+	entries []planEntry,
+) error {
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: pc.GetName() + "-plan", Namespace: pc.GetNamespace()}}
+	if _, err := ctrl.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Data = map[string]string{planConfigMapKey: string(data)}
+		return ctrl.SetControllerReference(&pc, cm, r.Scheme)
+	}); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to write plan ConfigMap %s", cm.GetName()))
+		return err
+	}
+
+	now := metav1.Now()
+	summary := &kcptoolsv1alpha1.PolicyControlPlan{ConfigMap: cm.GetName(), GeneratedTime: &now}
+	for _, e := range entries {
+		switch e.Action {
+		case PlanActionCreate:
+			summary.Create++
+		case PlanActionUpdate:
+			summary.Update++
+		case PlanActionUnchanged:
+			summary.Unchanged++
+		default:
+			summary.Failed++
+		}
+	}
+	// status updates trigger another reconcile, so only record a plan that differs from the previous one
+	if prev := pc.Status.Plan; prev != nil {
+		unchanged := *prev
+		unchanged.GeneratedTime = summary.GeneratedTime
+		if unchanged == *summary {
+			return nil
+		}
+	}
+	pc.Status.Plan = summary
+	if err := r.Status().Update(ctx, &pc); err != nil {
+		logger.Error(err, "failed to update status")
+		return err
+	}
+	r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonPlanned,
+		"planned %d creates, %d updates, %d unchanged and %d failed objects in ConfigMap %s",
+		summary.Create, summary.Update, summary.Unchanged, summary.Failed, cm.GetName())
+	return nil
+}
+
+// planner diffs desired objects against a cluster.
+type planner struct {
+	ctx      context.Context
+	target   string
+	dyClient dynamic.Interface
+	mapper   meta.RESTMapper
+	entries  []planEntry
+}
+
+func (p *planner) add(obj runtime.Object) {
+	desired, err := toUnstructured(obj)
+	if err != nil {
+		p.entries = append(p.entries, planEntry{Target: p.target, Action: PlanActionFailed, Message: err.Error()})
+		return
+	}
+	entry := planEntry{Target: p.target, Kind: desired.GetKind(), Namespace: desired.GetNamespace(), Name: desired.GetName()}
+	entry.Action, entry.Changes, err = p.diff(desired)
+	if err != nil {
+		entry.Action, entry.Message = PlanActionFailed, err.Error()
+	}
+	p.entries = append(p.entries, entry)
+}
+
+// diff runs the change of the desired object as a server-side dry-run and compares the outcome with the live object.
+func (p *planner) diff(desired *unstructured.Unstructured) (string, []string, error) {
+	gvk := desired.GroupVersionKind()
+	mapping, err := p.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return "", nil, err
+	}
+	var ri dynamic.ResourceInterface = p.dyClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		ri = p.dyClient.Resource(mapping.Resource).Namespace(desired.GetNamespace())
+	}
+
+	live, err := ri.Get(p.ctx, desired.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if _, err := ri.Create(p.ctx, desired, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}); err != nil {
+			return "", nil, err
+		}
+		return PlanActionCreate, nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	data, err := json.Marshal(desired)
+	if err != nil {
+		return "", nil, err
+	}
+	force := true
+	applied, err := ri.Patch(p.ctx, desired.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		DryRun:       []string{metav1.DryRunAll},
+		FieldManager: planFieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	changes := diffFields("", comparable(live).Object, comparable(applied).Object)
+	if len(changes) == 0 {
+		return PlanActionUnchanged, nil, nil
+	}
+	return PlanActionUpdate, changes, nil
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+	gvk, err := apiutil.GVKForObject(obj, planScheme)
+	if err != nil {
+		return nil, err
+	}
+	// the unstructured converter panics on the nil *metav1.Time fields without omitempty of the OLM objects
+	// (status.lastUpdated of an OperatorGroup), JSON leaves them null
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{}
+	if err := json.Unmarshal(data, &u.Object); err != nil {
+		return nil, err
+	}
+	u.SetGroupVersionKind(gvk)
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u, nil
+}
+
+// comparable drops the fields maintained by the API server.
+func comparable(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	c := obj.DeepCopy()
+	for _, f := range []string{"managedFields", "resourceVersion", "generation", "creationTimestamp", "uid", "selfLink"} {
+		unstructured.RemoveNestedField(c.Object, "metadata", f)
+	}
+	unstructured.RemoveNestedField(c.Object, "status")
+	return c
+}
+
+// diffFields returns the paths of the fields that differ between a and b.
+func diffFields(prefix string, a, b interface{}) []string {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		if prefix == "" {
+			prefix = "."
+		}
+		return []string{prefix}
+	}
+	keys := map[string]bool{}
+	for k := range am {
+		keys[k] = true
+	}
+	for k := range bm {
+		keys[k] = true
+	}
+	var changes []string
+	for k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		changes = append(changes, diffFields(path, am[k], bm[k])...)
+	}
+	sort.Strings(changes)
+	return changes
+}
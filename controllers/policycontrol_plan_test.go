@@ -0,0 +1,131 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+var _ = Describe("Dry-run plan", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	// planned returns the entries of the plan ConfigMap of pc.
+	planned := func() []planEntry {
+		var cm corev1.ConfigMap
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: pc.GetName() + "-plan"}, &cm)).To(Succeed())
+		var entries []planEntry
+		Expect(yaml.Unmarshal([]byte(cm.Data[planConfigMapKey]), &entries)).To(Succeed())
+		return entries
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		// the Policy Control Cluster is planned through the kubeconfig of the operator
+		kubeConfig := filepath.Join(GinkgoT().TempDir(), "kubeconfig")
+		Expect(os.WriteFile(kubeConfig, env.kcp.kubeConfig(), 0o600)).To(Succeed())
+		setEnv("KUBECONFIG", kubeConfig)
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+	})
+
+	It("plans the objects of a new workspace without creating them", func() {
+		live := env.latest(pc)
+		live.Annotations = map[string]string{DryRunAnnotation: "true"}
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+
+		status := env.latest(pc).Status.Plan
+		Expect(status).NotTo(BeNil())
+		Expect(status.ConfigMap).To(Equal("pccr-edge1-plan"))
+		Expect(status.Create).To(BeNumerically(">", 0))
+		Expect(planned()).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Target": Equal(PlanTargetWorkspace),
+			"Kind":   Equal("Namespace"),
+			"Name":   Equal("kyverno"),
+			"Action": Equal(PlanActionCreate),
+		})))
+		Expect(drainEvents(env.recorder)).To(ContainElement(ContainSubstring(EventReasonPlanned)))
+
+		By("leaving kcp and the Policy Control Cluster untouched")
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).To(BeNil())
+		Expect(env.kcp.list("root:edge1", apiBindingGVR)).To(BeEmpty())
+		err := env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &appsv1.Deployment{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(env.latest(pc).Finalizers).To(BeEmpty())
+	})
+
+	It("reports the fields a reconcile would change on drifted objects", func() {
+		env.reconcile(pc)
+		env.kcp.update("root:edge1", configMapGVR, "kyverno", "kyverno-metrics", func(obj *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(obj.Object, "1h", "data", "metricsRefreshInterval")
+		})
+		live := env.latest(pc)
+		live.Annotations = map[string]string{DryRunAnnotation: "true"}
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+
+		Expect(planned()).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Target":  Equal(PlanTargetWorkspace),
+			"Kind":    Equal("ConfigMap"),
+			"Name":    Equal("kyverno-metrics"),
+			"Action":  Equal(PlanActionUpdate),
+			"Changes": ConsistOf("data.metricsRefreshInterval"),
+		})))
+		Expect(planned()).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Target": Equal(PlanTargetWorkspace),
+			"Kind":   Equal("Namespace"),
+			"Name":   Equal("kyverno"),
+			"Action": Equal(PlanActionUnchanged),
+		})))
+		metrics := env.kcp.get("root:edge1", configMapGVR, "kyverno", "kyverno-metrics")
+		Expect(metrics.Object["data"]).To(HaveKeyWithValue("metricsRefreshInterval", "1h"))
+	})
+})
+
+var _ = Describe("diffFields", func() {
+	DescribeTable("returns the paths of the changed fields",
+		func(a, b map[string]interface{}, want []string) {
+			Expect(diffFields("", a, b)).To(Equal(want))
+		},
+		Entry("equal objects", map[string]interface{}{"a": "1"}, map[string]interface{}{"a": "1"}, nil),
+		Entry("changed, added and removed fields",
+			map[string]interface{}{"data": map[string]interface{}{"a": "1", "b": "2"}},
+			map[string]interface{}{"data": map[string]interface{}{"a": "2", "c": "3"}},
+			[]string{"data.a", "data.b", "data.c"}),
+		Entry("changed lists as a whole",
+			map[string]interface{}{"spec": map[string]interface{}{"args": []interface{}{"a"}}},
+			map[string]interface{}{"spec": map[string]interface{}{"args": []interface{}{"a", "b"}}},
+			[]string{"spec.args"}),
+	)
+})
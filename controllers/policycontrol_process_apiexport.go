@@ -0,0 +1,79 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/dynamic"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/render"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+// publishKyvernoAPIs creates the APIResourceSchemas of the Kyverno CRDs and the APIExport serving them in the
+// provider workspace of pc, so that the workspace binds the Kyverno APIs instead of importing them through a syncer.
+func (r *PolicyControlReconciler) publishKyvernoAPIs(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+	kcpKubeConfig string,
+) error {
+	path := resources.KyvernoAPIExport(&pc).Path
+
+	objs, err := render.KyvernoAPIs(&pc, render.Options{KyvernoManifestsDir: WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR})
+	if err != nil {
+		logger.Error(err, "failed to build the Kyverno APIExport")
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonAPIExportFailed,
+			"failed to build the Kyverno APIExport: %s", err.Error())
+		return err
+	}
+
+	config, mapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, path, logger)
+	if err != nil {
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKcpConnectionFailed,
+			"failed to connect to workspace %s: %s", path, err.Error())
+		return err
+	}
+	dyClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	applier := &workspaceApplier{
+		logger:   logger,
+		pc:       pc,
+		dyClient: dyClient,
+		mapper:   mapper,
+		refreshMapper: func(ctx context.Context) (meta.RESTMapper, error) {
+			_, mapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, path, logger)
+			return mapper, err
+		},
+	}
+	logger.V(4).Info(fmt.Sprintf("publish the Kyverno APIs through the APIExport %s in workspace %s", resources.KyvernoAPIExport(&pc).Name, path))
+	if _, err := applier.apply(ctx, objs); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to publish the Kyverno APIs in workspace %s", path))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonAPIExportFailed,
+			"failed to publish the Kyverno APIs in workspace %s: %s", path, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var _ = Describe("Kyverno APIExport", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+	})
+
+	It("publishes the Kyverno CRDs in the configured workspace and binds them instead of installing them", func() {
+		env.kcp.addWorkspace("root:compute")
+		pc.Spec.KyvernoInWorkspace.KyvernoAPIExport = kcptoolsv1alpha1.KyvernoAPIExport{Path: "root:compute", Name: "kyverno-apis"}
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+
+		By("creating versioned schemas and the APIExport serving them")
+		export := env.kcp.get("root:compute", apiExportResource, "", "kyverno-apis")
+		Expect(export).NotTo(BeNil())
+		schemas, _, _ := unstructured.NestedStringSlice(export.Object, "spec", "latestResourceSchemas")
+		clusterPolicies := resources.APIResourceSchemaName(manifests.DefaultKyvernoVersion, "clusterpolicies", resources.KyvernoAPIGroup)
+		Expect(schemas).To(ContainElement(clusterPolicies))
+		for _, name := range schemas {
+			Expect(env.kcp.get("root:compute", apiResourceSchemaResource, "", name)).NotTo(BeNil())
+		}
+		Expect(env.kcp.get(testProviderWorkspace, apiExportResource, "", "kyverno")).To(BeNil())
+
+		By("binding the export in the workspace")
+		binding := env.kcp.get("root:edge1", apiBindingGVR, "", "kyverno-apis")
+		Expect(binding).NotTo(BeNil())
+		Expect(conditionTrue(*binding, "Ready")).To(BeTrue())
+		for _, crd := range env.kcp.list("root:edge1", crdGVR) {
+			group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+			Expect(group).NotTo(Equal(resources.KyvernoAPIGroup), "CRD %s is installed into the workspace", crd.GetName())
+		}
+		Expect(env.kcp.list("root:edge1", crdGVR)).NotTo(BeEmpty())
+	})
+
+	It("does not run the syncer unless installSyncer is set", func() {
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		Expect(env.kcp.commands).NotTo(ContainElement(ContainSubstring("kubectl kcp workload sync")))
+
+		pc = env.latest(pc)
+		pc.Spec.PolicyControlCluster.InstallSyncer = pointer.Bool(true)
+		Expect(env.pcc.Update(env.ctx, pc)).To(Succeed())
+		env.kcp.commands = nil
+		_, err := env.reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pc)})
+		// fakeKcp does not generate syncer manifests
+		Expect(err).To(HaveOccurred())
+		Expect(env.kcp.commands).To(ContainElement(ContainSubstring("kubectl kcp workload sync policy-control-cluster")))
+	})
+})
@@ -41,8 +41,10 @@ func (r *PolicyControlReconciler) installKyvernoOnEdge(
 	kcpKubeConfig string,
 ) (ctrl.Result, error) {
 
-	config, mapper, err := getWorkspaceConfigs(kcpKubeConfig, pc.Spec.Workspace, logger)
+	config, mapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
 	if err != nil {
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKcpConnectionFailed,
+			"failed to connect to workspace %s: %s", pc.Spec.Workspace, err.Error())
 		return ctrl.Result{}, err
 	}
 
@@ -53,17 +55,23 @@ func (r *PolicyControlReconciler) installKyvernoOnEdge(
 	}
 	namespace := pc.Spec.KyvernoInCluster.InstallNamespace
 	nsSpec := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	markCreated(nsSpec)
 	_, err = clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
 	if err != nil {
 		_, err = clientset.CoreV1().Namespaces().Create(ctx, nsSpec, metav1.CreateOptions{})
 		if err != nil {
 			logger.Error(err, "failed to create Resource")
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonNamespaceCreateFailed,
+				"failed to create namespace %s in workspace %s: %s", namespace, pc.Spec.Workspace, err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonNamespaceCreated,
+			"created namespace %s in workspace %s", namespace, pc.Spec.Workspace)
 	}
 
 	// create OperatorGroup
 	operatorGroupObj := resources.BuildOperatorGroupForKyverno(&pc)
+	markCreated(operatorGroupObj)
 	operatorClientset, err := operatorsv1.NewForConfig(config)
 	if err != nil {
 		logger.Error(err, "failed to create k8s client for OperatorGroup")
@@ -73,12 +81,17 @@ func (r *PolicyControlReconciler) installKyvernoOnEdge(
 	if err != nil {
 		if _, err := operatorClientset.OperatorGroups(operatorGroupObj.GetNamespace()).Create(ctx, operatorGroupObj, metav1.CreateOptions{}); err != nil {
 			logger.Error(err, "failed to create OperatorGroup")
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonOLMObjectCreateFailed,
+				"failed to create OperatorGroup %s/%s: %s", operatorGroupObj.GetNamespace(), operatorGroupObj.GetName(), err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonOLMObjectCreated,
+			"created OperatorGroup %s/%s", operatorGroupObj.GetNamespace(), operatorGroupObj.GetName())
 	}
 
 	// create Subscription
 	subscriptionObj := resources.BuildSubscriptionForKyverno(&pc)
+	markCreated(subscriptionObj)
 	subscriptionClientset, err := operatorsv1alpha1.NewForConfig(config)
 	if err != nil {
 		logger.Error(err, "failed to create k8s client for Subscription")
@@ -88,21 +101,28 @@ func (r *PolicyControlReconciler) installKyvernoOnEdge(
 	if err != nil {
 		if _, err := subscriptionClientset.Subscriptions(subscriptionObj.GetNamespace()).Create(ctx, subscriptionObj, metav1.CreateOptions{}); err != nil {
 			logger.Error(err, "failed to create Subscription")
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonOLMObjectCreateFailed,
+				"failed to create Subscription %s/%s: %s", subscriptionObj.GetNamespace(), subscriptionObj.GetName(), err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonOLMObjectCreated,
+			"created Subscription %s/%s", subscriptionObj.GetNamespace(), subscriptionObj.GetName())
 	}
 
 	// create KyvernoCR
 	dyClient, _ := dynamic.NewForConfig(config)
 	kyvernoCRObj := resources.BuildKyvernoCR(&pc)
+	markCreated(kyvernoCRObj)
 	mapping, err := getMapping(logger, *kyvernoCRObj, mapper)
 	if err != nil {
 		logger.Error(err, "failed to map KyvernoCR (Kyverno) to registered Kinds")
 		return ctrl.Result{}, err
 	}
-	_, err = r.createOrUpdateUnstructuredResource(ctx, logger, dyClient, *mapping, *kyvernoCRObj, true)
+	_, err = createOrUpdateUnstructuredResource(ctx, logger, dyClient, *mapping, *kyvernoCRObj, true)
 	if err != nil {
 		logger.Error(err, "failed to create KyvernoCR")
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonOLMObjectCreateFailed,
+			"failed to create Kyverno %s: %s", kyvernoCRObj.GetName(), err.Error())
 		return ctrl.Result{}, err
 	}
 
@@ -0,0 +1,187 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+// installWorkspaceNamespace creates the namespace the standalone Kyverno of an isolated workspace runs in, with
+// the ServiceAccount of the Kyverno pod, the NetworkPolicy admitting only the ingress controller and the
+// ResourceQuota. Changes of namespaceIsolation are applied to the existing objects.
+func (r *PolicyControlReconciler) installWorkspaceNamespace(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) error {
+	desiredNamespace := resources.BuildNamespaceForKyverno(&pc)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: desiredNamespace.Name}}
+	result, err := ctrl.CreateOrUpdate(ctx, r.Client, namespace, func() error {
+		if namespace.Labels == nil {
+			namespace.Labels = map[string]string{}
+		}
+		for k, v := range desiredNamespace.Labels {
+			namespace.Labels[k] = v
+		}
+		// the annotation is only set on creation, a namespace of another workspace is not taken over
+		if namespace.ResourceVersion == "" {
+			namespace.Annotations = desiredNamespace.Annotations
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("failed to create namespace %s", namespace.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonNamespaceCreateFailed,
+			"failed to create namespace %s for the Kyverno of workspace %s: %s", namespace.GetName(), pc.Spec.Workspace, err.Error())
+		return err
+	}
+	if result == controllerutil.OperationResultCreated {
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonNamespaceCreated,
+			"created namespace %s for the Kyverno of workspace %s", namespace.GetName(), pc.Spec.Workspace)
+	}
+
+	logger.V(4).Info("create service account, network policy and resource quota of the workspace namespace")
+	desiredServiceAccount := resources.BuildServiceAccountForKyverno(&pc)
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: desiredServiceAccount.Namespace, Name: desiredServiceAccount.Name}}
+	desiredNetworkPolicy := resources.BuildNetworkPolicyForKyverno(&pc)
+	networkPolicy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: desiredNetworkPolicy.Namespace, Name: desiredNetworkPolicy.Name}}
+	desiredQuota := resources.BuildResourceQuotaForKyverno(&pc)
+	quota := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Namespace: desiredQuota.Namespace, Name: desiredQuota.Name}}
+	isolation := []struct {
+		obj    client.Object
+		mutate controllerutil.MutateFn
+	}{
+		{serviceAccount, func() error {
+			serviceAccount.AutomountServiceAccountToken = desiredServiceAccount.AutomountServiceAccountToken
+			return nil
+		}},
+		{networkPolicy, func() error {
+			networkPolicy.Spec = desiredNetworkPolicy.Spec
+			return nil
+		}},
+		{quota, func() error {
+			quota.Spec.Hard = desiredQuota.Spec.Hard
+			return nil
+		}},
+	}
+	for _, o := range isolation {
+		if _, err := ctrl.CreateOrUpdate(ctx, r.Client, o.obj, o.mutate); err != nil {
+			logger.Error(err, fmt.Sprintf("failed to create %s in namespace %s", o.obj.GetName(), namespace.GetName()))
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoDeployFailed,
+				"failed to create %s in namespace %s: %s", o.obj.GetName(), namespace.GetName(), err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSharedNamespaceKyverno removes the standalone Kyverno and the ingress path an isolated workspace had in the
+// namespace of the Policy Control Cluster before it was isolated.
+func (r *PolicyControlReconciler) removeSharedNamespaceKyverno(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) error {
+	notIsolated := *pc.DeepCopy()
+	notIsolated.Spec.PolicyControlCluster.Isolation = resources.IsolationNone
+	if err := r.removeStandaloneKyverno(ctx, logger, notIsolated); err != nil {
+		return err
+	}
+	return r.removeIngressRule(ctx, logger, notIsolated)
+}
+
+// removeIngressRule removes the path of the workspace of pc from the ingress of its Kyverno namespace, and the
+// ingress once no path is left.
+func (r *PolicyControlReconciler) removeIngressRule(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) error {
+	ingress := &networkingv1.Ingress{}
+	key := client.ObjectKey{Namespace: resources.KyvernoNamespace(&pc), Name: naming.IngressName}
+	if err := r.Get(ctx, key, ingress); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !resources.RemoveIngressRuleForKyverno(&pc, ingress) {
+		return nil
+	}
+	paths := 0
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP != nil {
+			paths += len(rule.HTTP.Paths)
+		}
+	}
+	// an ingress rule needs at least one path
+	var err error
+	if paths == 0 {
+		err = r.Delete(ctx, ingress)
+	} else {
+		err = r.Update(ctx, ingress)
+	}
+	if client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to remove ingress rule %s", ingress.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonIngressUpdateFailed,
+			"failed to remove the path of workspace %s from ingress %s: %s", pc.Spec.Workspace, key, err.Error())
+		return err
+	}
+	r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonIngressPathChanged,
+		"removed the path of workspace %s from ingress %s", pc.Spec.Workspace, key)
+	return nil
+}
+
+// removeWorkspaceNamespace removes the namespace of the workspace, with the Kyverno running in it, once the
+// workspace is no longer isolated. Only a namespace recorded as created for the workspace is removed.
+func (r *PolicyControlReconciler) removeWorkspaceNamespace(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) error {
+	namespace := resources.BuildNamespaceForKyverno(&pc)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(namespace), namespace); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if namespace.Annotations[naming.WorkspaceAnnotation] != pc.Spec.Workspace || namespace.DeletionTimestamp != nil {
+		return nil
+	}
+	if err := r.Delete(ctx, namespace); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to delete namespace %s", namespace.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoTeardownFailed,
+			"failed to delete namespace %s of the isolated Kyverno of workspace %s: %s", namespace.GetName(), pc.Spec.Workspace, err.Error())
+		return err
+	}
+	r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonKyvernoTornDown,
+		"removed namespace %s of the isolated Kyverno of workspace %s", namespace.GetName(), pc.Spec.Workspace)
+	return nil
+}
@@ -0,0 +1,119 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var _ = Describe("Namespace isolation", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+	})
+
+	It("moves the Kyverno of an isolated workspace to a namespace of its own", func() {
+		env.reconcile(pc)
+		live := env.latest(pc)
+		live.Spec.PolicyControlCluster.Isolation = resources.IsolationNamespace
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+
+		By("creating the namespace with its ServiceAccount, NetworkPolicy and ResourceQuota")
+		isolated := "root--edge1"
+		var namespace corev1.Namespace
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Name: isolated}, &namespace)).To(Succeed())
+		Expect(namespace.Annotations).To(HaveKeyWithValue(naming.WorkspaceAnnotation, "root:edge1"))
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: isolated, Name: resources.KyvernoServiceAccountName}, &corev1.ServiceAccount{})).To(Succeed())
+		var networkPolicy networkingv1.NetworkPolicy
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: isolated, Name: resources.KyvernoNetworkPolicyName}, &networkPolicy)).To(Succeed())
+		Expect(networkPolicy.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels).To(HaveKeyWithValue(corev1.LabelMetadataName, "ingress-nginx"))
+		var quota corev1.ResourceQuota
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: isolated, Name: resources.KyvernoResourceQuotaName}, &quota)).To(Succeed())
+		Expect(quota.Spec.Hard).To(HaveKey(corev1.ResourcePods))
+
+		By("deploying Kyverno and its ingress in the namespace")
+		var deployment appsv1.Deployment
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: isolated, Name: "root--edge1"}, &deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.ServiceAccountName).To(Equal(resources.KyvernoServiceAccountName))
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: isolated, Name: "kyverno-ingress"}, &corev1.Secret{})).To(Succeed())
+		var ingress networkingv1.Ingress
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: isolated, Name: "kyverno-ingress"}, &ingress)).To(Succeed())
+		Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/root--edge1(/|$)(.*)"))
+
+		By("removing the Kyverno and the ingress path of the workspace from the namespace of the Policy Control Cluster")
+		err := env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &appsv1.Deployment{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "kyverno-ingress"}, &networkingv1.Ingress{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		By("applying changes of the ResourceQuota")
+		live = env.latest(pc)
+		live.Spec.PolicyControlCluster.NamespaceIsolation.ResourceQuota = corev1.ResourceList{corev1.ResourcePods: resource.MustParse("5")}
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+		Expect(env.pcc.Get(env.ctx, client.ObjectKeyFromObject(&quota), &quota)).To(Succeed())
+		Expect(quota.Spec.Hard).To(Equal(corev1.ResourceList{corev1.ResourcePods: resource.MustParse("5")}))
+
+		By("removing the namespace once the workspace is no longer isolated")
+		live = env.latest(pc)
+		live.Spec.PolicyControlCluster.Isolation = resources.IsolationNone
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+		Expect(isGone(env.ctx, env.pcc, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: isolated}})).To(BeTrue())
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &appsv1.Deployment{})).To(Succeed())
+		Expect(env.ingressPaths()).To(Equal(map[string]string{"/root--edge1(/|$)(.*)": "root--edge1"}))
+		Expect(drainEvents(env.recorder)).To(ContainElement(ContainSubstring("removed namespace root--edge1")))
+	})
+
+	It("leaves a namespace it did not create once the workspace is no longer isolated", func() {
+		Expect(env.pcc.Create(env.ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "root--edge1"}})).To(Succeed())
+		live := env.latest(pc)
+		live.Spec.PolicyControlCluster.Isolation = resources.IsolationNamespace
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+		var namespace corev1.Namespace
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Name: "root--edge1"}, &namespace)).To(Succeed())
+		Expect(namespace.Annotations).NotTo(HaveKey(naming.WorkspaceAnnotation))
+
+		live = env.latest(pc)
+		live.Spec.PolicyControlCluster.Isolation = resources.IsolationNone
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Name: "root--edge1"}, &namespace)).To(Succeed())
+		Expect(namespace.DeletionTimestamp).To(BeNil())
+	})
+})
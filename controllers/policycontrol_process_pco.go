@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/ghodss/yaml"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -37,6 +36,7 @@ import (
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 
 	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
 )
 
 func (r *PolicyControlReconciler) syncPCO(
@@ -48,30 +48,38 @@ func (r *PolicyControlReconciler) syncPCO(
 	namespace string,
 ) (ctrl.Result, error) {
 
-	syncerManfests, err := syncWorkspace(kcpKubeConfig, pc.Spec.Workspace, pc.Spec.PolicyControlCluster.IngressName, SYNCER_IMAGE, logger)
+	syncerManfests, err := syncWorkspace(ctx, kcpKubeConfig, pc.Spec.Workspace, pc.Spec.PolicyControlCluster.IngressName, SYNCER_IMAGE, logger)
 	if err != nil {
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSyncerInstallFailed,
+			"failed to generate syncer manifests for SyncTarget %s: %s", pc.Spec.PolicyControlCluster.IngressName, err.Error())
 		return ctrl.Result{}, err
 	}
 
-	config, err := getInClusterConfig()
-	if err != nil || config == nil {
-		config, _ = getOutOfClusterConfig()
+	config, err := getPCOClusterConfig()
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 	c := discovery.NewDiscoveryClientForConfigOrDie(config)
 	groupResources, _ := restmapper.GetAPIGroupResources(c)
 	mapper := restmapper.NewDiscoveryRESTMapper(groupResources)
 
+	objs, err := manifests.Decode([]byte(syncerManfests))
+	if err != nil {
+		logger.Error(err, "invalid syncer manifests")
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSyncerInstallFailed,
+			"failed to decode syncer manifests for SyncTarget %s: %s", pc.Spec.PolicyControlCluster.IngressName, err.Error())
+		return ctrl.Result{}, err
+	}
 	dyClient, _ := dynamic.NewForConfig(config)
-	for _, str := range strings.Split(syncerManfests, "---") {
-		var obj unstructured.Unstructured
-		if err := yaml.Unmarshal([]byte(str), &obj); err != nil {
-			logger.Error(err, "invalid yaml")
-			continue
-		}
+	for _, obj := range objs {
 		if _, err := r.createOrUpdateResource(ctx, req, logger, pc, dyClient, mapper, obj); err != nil {
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSyncerInstallFailed,
+				"failed to apply syncer %s %s: %s", obj.GetKind(), obj.GetName(), err.Error())
 			return ctrl.Result{}, err
 		}
 	}
+	r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonSyncerInstalled,
+		"syncer for SyncTarget %s installed", pc.Spec.PolicyControlCluster.IngressName)
 	return ctrl.Result{}, nil
 }
 
@@ -135,6 +143,6 @@ func (r *PolicyControlReconciler) createOrUpdateResource(
 	case "customresourcedefinitions":
 		return r.createOrUpdateTypedResourceByUnstructured(ctx, logger, pc, obj, &apiextensions.CustomResourceDefinition{}, false)
 	default:
-		return r.createOrUpdateUnstructuredResource(ctx, logger, dyClient, *mapping, obj, false)
+		return createOrUpdateUnstructuredResource(ctx, logger, dyClient, *mapping, obj, false)
 	}
 }
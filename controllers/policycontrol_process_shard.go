@@ -0,0 +1,318 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+// applyShardPool sets the shard count of pc to the size of the shared Kyverno pool of its Policy Control Cluster
+// namespace: the highest count any shared PolicyControl of the namespace asks for. All the workspaces of the pool
+// are then spread over the same shards, whichever PolicyControl carries the count.
+func (r *PolicyControlReconciler) applyShardPool(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) (kcptoolsv1alpha1.PolicyControl, error) {
+	if !resources.IsSharedKyverno(&pc) {
+		return pc, nil
+	}
+	peers, err := r.sharedPolicyControls(ctx, logger, pc.Spec.PolicyControlCluster.Namespace)
+	if err != nil {
+		logger.Error(err, "failed to list the PolicyControls sharing the Kyverno pool")
+		return pc, err
+	}
+	for _, peer := range peers {
+		if shards := peer.Spec.PolicyControlCluster.SharedKyverno.Shards; shards > pc.Spec.PolicyControlCluster.SharedKyverno.Shards {
+			logger.V(4).Info(fmt.Sprintf("use %d shards of the pool set by PolicyControl %s/%s", shards, peer.GetNamespace(), peer.GetName()))
+			pc.Spec.PolicyControlCluster.SharedKyverno.Shards = shards
+		}
+	}
+	return pc, nil
+}
+
+// sharedPolicyControls returns the effective specs of the PolicyControls served by the shared Kyverno pool of
+// the Policy Control Cluster namespace. PolicyControls being deleted or whose template is missing are left out.
+func (r *PolicyControlReconciler) sharedPolicyControls(
+	ctx context.Context,
+	logger logr.Logger,
+	namespace string,
+) ([]kcptoolsv1alpha1.PolicyControl, error) {
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := r.List(ctx, &pcList); err != nil {
+		return nil, err
+	}
+	var shared []kcptoolsv1alpha1.PolicyControl
+	for _, item := range pcList.Items {
+		if !item.DeletionTimestamp.IsZero() {
+			continue
+		}
+		merged, err := applyTemplate(ctx, r.Client, logger, item)
+		if err != nil {
+			continue
+		}
+		if resources.IsSharedKyverno(&merged) && merged.Spec.PolicyControlCluster.Namespace == namespace {
+			shared = append(shared, merged)
+		}
+	}
+	return shared, nil
+}
+
+// findPolicyControlsSharingShards maps a PolicyControl to the shared PolicyControls of its Policy Control Cluster
+// namespace, so that they are all moved as soon as the size of the pool changes.
+func (r *PolicyControlReconciler) findPolicyControlsSharingShards(obj client.Object) []reconcile.Request {
+	pc, ok := obj.(*kcptoolsv1alpha1.PolicyControl)
+	if !ok {
+		return nil
+	}
+	ctx := context.Background()
+	logger := ctrl.Log.WithName("shards")
+	merged, err := applyTemplate(ctx, r.Client, logger, *pc)
+	if err != nil {
+		return nil
+	}
+	peers, err := r.sharedPolicyControls(ctx, logger, merged.Spec.PolicyControlCluster.Namespace)
+	if err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, peer := range peers {
+		if peer.GetNamespace() == pc.GetNamespace() && peer.GetName() == pc.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: peer.GetNamespace(), Name: peer.GetName()},
+		})
+	}
+	return requests
+}
+
+// shardPoolChanged passes the events of PolicyControls which may change the size of a shared Kyverno pool.
+var shardPoolChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPC, ok := e.ObjectOld.(*kcptoolsv1alpha1.PolicyControl)
+		if !ok {
+			return false
+		}
+		newPC, ok := e.ObjectNew.(*kcptoolsv1alpha1.PolicyControl)
+		if !ok {
+			return false
+		}
+		return oldPC.Spec.TemplateRef != newPC.Spec.TemplateRef ||
+			oldPC.Spec.PolicyControlCluster.Namespace != newPC.Spec.PolicyControlCluster.Namespace ||
+			oldPC.Spec.PolicyControlCluster.KyvernoMode != newPC.Spec.PolicyControlCluster.KyvernoMode ||
+			oldPC.Spec.PolicyControlCluster.SharedKyverno.Shards != newPC.Spec.PolicyControlCluster.SharedKyverno.Shards ||
+			oldPC.DeletionTimestamp.IsZero() != newPC.DeletionTimestamp.IsZero()
+	},
+	GenericFunc: func(e event.GenericEvent) bool { return false },
+}
+
+// installSharedKyverno registers the workspace to the shared Kyverno instance it is assigned to,
+// and removes it from any other instance it was served by before.
+func (r *PolicyControlReconciler) installSharedKyverno(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+	kubeConfig string,
+) (ctrl.Result, error) {
+
+	shard := resources.AssignShard(&pc)
+
+	logger.V(4).Info(fmt.Sprintf("add the target workspace kubeconfig to the bundle of shared Kyverno %s", shard))
+	key := resources.ShardBundleKey(&pc)
+	bundle := resources.BuildShardSecretForKyverno(&pc, shard)
+	err := r.Get(ctx, client.ObjectKeyFromObject(bundle), bundle)
+	if errors.IsNotFound(err) {
+		bundle.Data[key] = []byte(kubeConfig)
+		if err := r.Create(ctx, bundle); err != nil {
+			logger.Error(err, fmt.Sprintf("failed to create kubeconfig bundle %s", bundle.GetName()))
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSecretDistributeFailed,
+				"failed to create kubeconfig bundle %s: %s", bundle.GetName(), err.Error())
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonSecretDistributed,
+			"added kubeconfig of workspace %s to new bundle %s", pc.Spec.Workspace, bundle.GetName())
+	} else if err != nil {
+		return ctrl.Result{}, err
+	} else if string(bundle.Data[key]) != kubeConfig {
+		if bundle.Data == nil {
+			bundle.Data = map[string][]byte{}
+		}
+		bundle.Data[key] = []byte(kubeConfig)
+		if err := r.Update(ctx, bundle); err != nil {
+			logger.Error(err, fmt.Sprintf("failed to update kubeconfig bundle %s", bundle.GetName()))
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSecretDistributeFailed,
+				"failed to update kubeconfig bundle %s: %s", bundle.GetName(), err.Error())
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonSecretDistributed,
+			"updated kubeconfig of workspace %s in bundle %s", pc.Spec.Workspace, bundle.GetName())
+	}
+
+	logger.V(4).Info("create service for shared Kyverno")
+	desiredService := resources.BuildShardServiceForKyverno(&pc, shard)
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: desiredService.Namespace, Name: desiredService.Name}}
+	if _, err := ctrl.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Labels = desiredService.Labels
+		service.Spec.Selector = desiredService.Spec.Selector
+		service.Spec.Ports = desiredService.Spec.Ports
+		return nil
+	}); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to create service for shared Kyverno %s", service.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoDeployFailed,
+			"failed to create service %s for shared Kyverno: %s", service.GetName(), err.Error())
+		return ctrl.Result{}, err
+	}
+
+	logger.V(4).Info("create deployment for shared Kyverno")
+	desiredDeployment := resources.BuildShardDeploymentForKyverno(&pc, shard)
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: desiredDeployment.Namespace, Name: desiredDeployment.Name}}
+	if _, err := ctrl.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		deployment.Labels = desiredDeployment.Labels
+		deployment.Spec.Replicas = desiredDeployment.Spec.Replicas
+		deployment.Spec.Template = desiredDeployment.Spec.Template
+		// the selector of a Deployment is immutable
+		if deployment.CreationTimestamp.IsZero() {
+			deployment.Spec.Selector = desiredDeployment.Spec.Selector
+		}
+		return nil
+	}); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to create deployment for shared Kyverno %s", deployment.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoDeployFailed,
+			"failed to create deployment %s for shared Kyverno: %s", deployment.GetName(), err.Error())
+		return ctrl.Result{}, err
+	}
+
+	if err := r.releaseOtherShards(ctx, logger, pc, shard); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.removeStandaloneKyverno(ctx, logger, pc); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if pc.Status.Shard != shard {
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonKyvernoDeployed,
+			"workspace %s is served by shared Kyverno %s", pc.Spec.Workspace, shard)
+		base := pc.DeepCopy()
+		pc.Status.Shard = shard
+		if err := r.patchStatus(ctx, &pc, base); err != nil {
+			logger.Error(err, "failed to update status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// releaseOtherShards removes the workspace from the bundles of all shards except the assigned one.
+// A shard left without any workspace is removed together with its deployment and service.
+func (r *PolicyControlReconciler) releaseOtherShards(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+	shard string,
+) error {
+	var bundles corev1.SecretList
+	if err := r.List(ctx, &bundles, client.InNamespace(pc.Spec.PolicyControlCluster.Namespace), client.HasLabels{resources.ShardLabel}); err != nil {
+		return err
+	}
+	key := resources.ShardBundleKey(&pc)
+	for i := range bundles.Items {
+		bundle := &bundles.Items[i]
+		if bundle.GetName() == shard {
+			continue
+		}
+		if _, ok := bundle.Data[key]; !ok {
+			continue
+		}
+		logger.V(4).Info(fmt.Sprintf("move workspace %s from shared Kyverno %s to %s", pc.Spec.Workspace, bundle.GetName(), shard))
+		delete(bundle.Data, key)
+		if len(bundle.Data) > 0 {
+			if err := r.Update(ctx, bundle); err != nil {
+				logger.Error(err, fmt.Sprintf("failed to update kubeconfig bundle %s", bundle.GetName()))
+				r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoTeardownFailed,
+					"failed to remove workspace %s from shared Kyverno %s: %s", pc.Spec.Workspace, bundle.GetName(), err.Error())
+				return err
+			}
+			r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonKyvernoTornDown,
+				"removed workspace %s from shared Kyverno %s", pc.Spec.Workspace, bundle.GetName())
+			continue
+		}
+		logger.V(4).Info(fmt.Sprintf("remove shared Kyverno %s serving no workspace", bundle.GetName()))
+		retired := []client.Object{
+			resources.BuildShardDeploymentForKyverno(&pc, bundle.GetName()),
+			resources.BuildShardServiceForKyverno(&pc, bundle.GetName()),
+			bundle,
+		}
+		for _, obj := range retired {
+			if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				logger.Error(err, fmt.Sprintf("failed to delete %s", obj.GetName()))
+				r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoTeardownFailed,
+					"failed to delete %s of shared Kyverno %s: %s", obj.GetName(), bundle.GetName(), err.Error())
+				return err
+			}
+		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonKyvernoTornDown,
+			"removed shared Kyverno %s serving no workspace", bundle.GetName())
+	}
+	return nil
+}
+
+// removeStandaloneKyverno deletes the standalone Kyverno of the workspace left over from the "Standalone" mode.
+func (r *PolicyControlReconciler) removeStandaloneKyverno(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) error {
+	standalone := []client.Object{
+		resources.BuildDeploymentForKyverno(&pc),
+		resources.BuildServiceForKyverno(&pc),
+		resources.BuildSecretForKyverno(&pc, ""),
+	}
+	deleted := false
+	for _, obj := range standalone {
+		err := r.Delete(ctx, obj)
+		if client.IgnoreNotFound(err) != nil {
+			logger.Error(err, fmt.Sprintf("failed to delete standalone Kyverno resource %s", obj.GetName()))
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoTeardownFailed,
+				"failed to delete standalone Kyverno resource %s: %s", obj.GetName(), err.Error())
+			return err
+		}
+		deleted = deleted || err == nil
+	}
+	if deleted {
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonKyvernoTornDown,
+			"removed standalone Kyverno of workspace %s", pc.Spec.Workspace)
+	}
+	return nil
+}
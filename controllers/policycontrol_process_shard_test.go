@@ -0,0 +1,105 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var _ = Describe("Shared Kyverno", func() {
+	var env *policyControlEnv
+
+	newSharedPolicyControl := func(name, workspace string, shards int32) *kcptoolsv1alpha1.PolicyControl {
+		pc := newTestPolicyControl(name, workspace)
+		pc.Spec.PolicyControlCluster.KyvernoMode = resources.KyvernoModeShared
+		pc.Spec.PolicyControlCluster.SharedKyverno.Shards = shards
+		pc.Spec.PolicyControlCluster.SharedKyverno.KyvernoImage = "kyverno-shared:1.0.0"
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		return pc
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+	})
+
+	It("applies spec changes to the Deployment and Service of the shard", func() {
+		pc := newSharedPolicyControl("pccr-edge1", "root:edge1", 1)
+		env.reconcile(pc)
+		shard := env.latest(pc).Status.Shard
+		Expect(shard).To(Equal(resources.ShardName(0)))
+
+		live := env.latest(pc)
+		live.Spec.PolicyControlCluster.SharedKyverno.KyvernoImage = "kyverno-shared:1.1.0"
+		live.Spec.PolicyControlCluster.IngressPort = 29443
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+
+		var deployment appsv1.Deployment
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: shard}, &deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("kyverno-shared:1.1.0"))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--serverIP=policy-control-cluster.local:29443"))
+		var service corev1.Service
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: shard}, &service)).To(Succeed())
+		Expect(service.Spec.Ports[0].Port).To(Equal(int32(29443)))
+	})
+
+	It("spreads the workspaces of a pool over the largest shard count of its PolicyControls", func() {
+		edge1 := newSharedPolicyControl("pccr-edge1", "root:edge1", 0)
+		edge2 := newSharedPolicyControl("pccr-edge2", "root:edge2", 8)
+		env.reconcile(edge1)
+		env.reconcile(edge2)
+
+		pool := env.latest(edge1).DeepCopy()
+		pool.Spec.PolicyControlCluster.SharedKyverno.Shards = 8
+		Expect(env.latest(edge1).Status.Shard).To(Equal(resources.AssignShard(pool)))
+		pool = env.latest(edge2).DeepCopy()
+		Expect(env.latest(edge2).Status.Shard).To(Equal(resources.AssignShard(pool)))
+
+		By("shrinking the pool once the PolicyControl asking for more shards is gone")
+		Expect(env.pcc.Delete(env.ctx, env.latest(edge2))).To(Succeed())
+		env.reconcile(edge1)
+		Expect(env.latest(edge1).Status.Shard).To(Equal(resources.ShardName(0)))
+	})
+
+	It("rebalances the other workspaces of the pool when its size changes", func() {
+		edge1 := newSharedPolicyControl("pccr-edge1", "root:edge1", 2)
+		edge2 := newSharedPolicyControl("pccr-edge2", "root:edge2", 2)
+		standalone := newTestPolicyControl("pccr-standalone", "root:edge3")
+		Expect(env.pcc.Create(env.ctx, standalone)).To(Succeed())
+
+		requests := env.reconciler.findPolicyControlsSharingShards(env.latest(edge2))
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].NamespacedName).To(Equal(client.ObjectKeyFromObject(edge1)))
+
+		old := env.latest(edge2)
+		resized := old.DeepCopy()
+		resized.Spec.PolicyControlCluster.SharedKyverno.Shards = 4
+		Expect(shardPoolChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: resized})).To(BeTrue())
+		relabeled := old.DeepCopy()
+		relabeled.Labels = map[string]string{"team": "a"}
+		Expect(shardPoolChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: relabeled})).To(BeFalse())
+	})
+})
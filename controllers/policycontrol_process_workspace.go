@@ -19,11 +19,13 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"path/filepath"
+	"strings"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
@@ -31,6 +33,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/render"
 	"github.com/IBM/policy-control-operator/resources"
 )
 
@@ -42,8 +46,10 @@ func (r *PolicyControlReconciler) installKyvernoOnWorkspace(
 	kcpKubeConfig string,
 ) (ctrl.Result, error) {
 
-	config, mapper, err := getWorkspaceConfigs(kcpKubeConfig, pc.Spec.Workspace, logger)
+	config, mapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
 	if err != nil {
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKcpConnectionFailed,
+			"failed to connect to workspace %s: %s", pc.Spec.Workspace, err.Error())
 		return ctrl.Result{}, err
 	}
 
@@ -54,35 +60,64 @@ func (r *PolicyControlReconciler) installKyvernoOnWorkspace(
 	}
 	namespace := pc.Spec.KyvernoInWorkspace.NamespaceForAPIResources
 	nsSpec := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	markCreated(nsSpec)
 	_, err = clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
 	if err != nil {
 		_, err = clientset.CoreV1().Namespaces().Create(ctx, nsSpec, metav1.CreateOptions{})
 		if err != nil {
 			logger.Error(err, "failed to create Resource")
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonNamespaceCreateFailed,
+				"failed to create namespace %s in workspace %s: %s", namespace, pc.Spec.Workspace, err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonNamespaceCreated,
+			"created namespace %s in workspace %s", namespace, pc.Spec.Workspace)
 	}
 
-	logger.V(4).Info("install Kyverno related manifests")
+	logger.V(4).Info("install Kyverno related manifests and the APIBindings importing k8s basic resource definitions (Pod and Daemonset fow now) so that a standalone Kyverno can run")
+	objs, err := render.WorkspaceManifests(&pc, render.Options{
+		KyvernoManifestsDir: WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR,
+		APIBindingsManifest: WORKSPACE_APIBINDINGS_MANIFEST,
+	})
+	if err != nil {
+		logger.Error(err, "failed to load workspace manifests")
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonManifestApplyFailed,
+			"failed to load manifests for workspace %s: %s", pc.Spec.Workspace, err.Error())
+		return ctrl.Result{}, err
+	}
 	dyClient, _ := dynamic.NewForConfig(config)
-	files, _ := filepath.Glob(fmt.Sprintf("%s/*.yaml", WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR))
-	for _, f := range files {
-		if err := r.createOrUpdateUnstructuredResourceFromFile(ctx, logger, mapper, dyClient, f, true); err != nil {
-			logger.Error(err, fmt.Sprintf("failed to create manifest %s", f))
-			return ctrl.Result{}, err
-		}
+	applier := &workspaceApplier{
+		logger:   logger,
+		pc:       pc,
+		dyClient: dyClient,
+		mapper:   mapper,
+		refreshMapper: func(ctx context.Context) (meta.RESTMapper, error) {
+			_, mapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+			return mapper, err
+		},
 	}
-
-	logger.V(4).Info("import k8s basic resource definitions (Pod and Daemonset fow now) so that a standalone Kyverno can run")
-	if err := r.createOrUpdateUnstructuredResourceFromFile(ctx, logger, mapper, dyClient, WORKSPACE_APIBINDINGS_MANIFEST, true); err != nil {
-		logger.Error(err, fmt.Sprintf("failed to create manifest %s", WORKSPACE_APIBINDINGS_MANIFEST))
+	pending, err := applier.apply(ctx, objs)
+	if condErr := r.setWorkspaceManifestsStatus(ctx, logger, &pc, pending, apiBindingStatuses(applier.live), err); condErr != nil && err == nil {
+		return ctrl.Result{}, condErr
+	}
+	if err != nil {
+		logger.Error(err, "failed to apply workspace manifests")
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonManifestApplyFailed,
+			"failed to apply manifests to workspace %s: %s", pc.Spec.Workspace, err.Error())
 		return ctrl.Result{}, err
 	}
+	if applier.blocked {
+		// Kyverno must not start before the APIs it watches are served
+		logger.V(4).Info(fmt.Sprintf("workspace manifests pending: %s", strings.Join(pending, ", ")))
+		return ctrl.Result{RequeueAfter: workspaceAPIsRequeueAfter}, nil
+	}
 
 	logger.V(4).Info("create secret for PCO cluster's TLS Key and cert that will be loaded by a standalone Kyverno")
 	crTlsSecret := pc.Spec.PolicyControlCluster.IngressTLSSecret
 	var tlsSecret corev1.Secret
 	if err := r.Get(ctx, client.ObjectKey{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: crTlsSecret.Name}, &tlsSecret); err != nil {
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSecretDistributeFailed,
+			"failed to get ingress TLS secret %s: %s", crTlsSecret.Name, err.Error())
 		return ctrl.Result{}, err
 	}
 	tlsKey := string(tlsSecret.Data[crTlsSecret.KeyForPrivKey])
@@ -90,64 +125,108 @@ func (r *PolicyControlReconciler) installKyvernoOnWorkspace(
 	tlsCACrt := string(tlsSecret.Data[crTlsSecret.KeyForCacert])
 
 	tlsKeyCertSecret := resources.BuildTLSKeyCertSecretForKyverno(&pc, tlsKey, tlsCert)
+	markCreated(tlsKeyCertSecret)
 	_, err = clientset.CoreV1().Secrets(tlsKeyCertSecret.GetNamespace()).Get(ctx, tlsKeyCertSecret.GetName(), metav1.GetOptions{})
 	if err != nil {
 		_, err = clientset.CoreV1().Secrets(tlsKeyCertSecret.GetNamespace()).Create(ctx, tlsKeyCertSecret, metav1.CreateOptions{})
 		if err != nil {
 			logger.Error(err, "failed to create Resource")
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSecretDistributeFailed,
+				"failed to create secret %s/%s in workspace %s: %s", tlsKeyCertSecret.GetNamespace(), tlsKeyCertSecret.GetName(), pc.Spec.Workspace, err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonSecretDistributed,
+			"created secret %s/%s in workspace %s", tlsKeyCertSecret.GetNamespace(), tlsKeyCertSecret.GetName(), pc.Spec.Workspace)
 	}
 
 	logger.V(4).Info("create secret for PCO cluster's CA cert that will be set in webhook configurations by a standalone Kyverno")
 	tlsCaSecret := resources.BuildTLSCASecretForKyverno(&pc, tlsCACrt)
+	markCreated(tlsCaSecret)
 	_, err = clientset.CoreV1().Secrets(tlsCaSecret.GetNamespace()).Get(ctx, tlsCaSecret.GetName(), metav1.GetOptions{})
 	if err != nil {
 		_, err = clientset.CoreV1().Secrets(tlsCaSecret.GetNamespace()).Create(ctx, tlsCaSecret, metav1.CreateOptions{})
 		if err != nil {
 			logger.Error(err, "failed to create Resource")
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSecretDistributeFailed,
+				"failed to create secret %s/%s in workspace %s: %s", tlsCaSecret.GetNamespace(), tlsCaSecret.GetName(), pc.Spec.Workspace, err.Error())
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonSecretDistributed,
+			"created secret %s/%s in workspace %s", tlsCaSecret.GetNamespace(), tlsCaSecret.GetName(), pc.Spec.Workspace)
+	}
+
+	if resources.IsNamespaceIsolated(&pc) {
+		logger.V(4).Info("create the namespace of the isolated workspace")
+		if err := r.installWorkspaceNamespace(ctx, logger, pc); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
 	logger.V(4).Info("create Ingress TLS Key Cert pair secret")
 	ingressSecret := &corev1.Secret{}
-	err = r.Get(ctx, client.ObjectKey{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: "kyverno-ingress"}, ingressSecret)
+	err = r.Get(ctx, client.ObjectKey{Namespace: resources.KyvernoNamespace(&pc), Name: naming.IngressName}, ingressSecret)
 	if err != nil {
 		ingressSecret = resources.BuildTLSKeyCertSecretForIngress(&pc, tlsKey, tlsCert)
 		if err := r.Create(ctx, ingressSecret); err != nil {
 			logger.Error(err, fmt.Sprintf("failed to create ingress %s", ingressSecret.GetName()))
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSecretDistributeFailed,
+				"failed to create ingress TLS secret %s: %s", ingressSecret.GetName(), err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonSecretDistributed,
+			"created ingress TLS secret %s", ingressSecret.GetName())
 	}
 
 	logger.V(4).Info("create ingress or add route to an existing ingress")
 	ingress := &networkingv1.Ingress{}
-	err = r.Get(ctx, client.ObjectKey{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: "kyverno-ingress"}, ingress)
+	err = r.Get(ctx, client.ObjectKey{Namespace: resources.KyvernoNamespace(&pc), Name: naming.IngressName}, ingress)
 	if err != nil {
 		ingress = resources.BuildIngressForKyverno(&pc)
 		if err := r.Create(ctx, ingress); err != nil {
 			logger.Error(err, fmt.Sprintf("failed to create ingress %s", ingress.GetName()))
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonIngressUpdateFailed,
+				"failed to create ingress %s: %s", ingress.GetName(), err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonIngressPathChanged,
+			"created ingress %s with the path of workspace %s", ingress.GetName(), pc.Spec.Workspace)
 	} else {
+		before := ingress.Spec.DeepCopy()
 		ingress, _ = resources.AddIngressRuleForKyverno(&pc, ingress)
 		if err := r.Update(ctx, ingress); err != nil {
 			logger.Error(err, fmt.Sprintf("failed to add ingress rule %s", ingress.GetName()))
+			r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonIngressUpdateFailed,
+				"failed to add the path of workspace %s to ingress %s: %s", pc.Spec.Workspace, ingress.GetName(), err.Error())
 			return ctrl.Result{}, err
 		}
+		if !equality.Semantic.DeepEqual(*before, ingress.Spec) {
+			r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonIngressPathChanged,
+				"updated the path of workspace %s in ingress %s", pc.Spec.Workspace, ingress.GetName())
+		}
 	}
 
 	// KUBECONFIG=$KUBECONFIG_PG_CLUSTER kubectl -n $PG_NAMESPACE  create secret generic kyverno-runtime-credentials-$norm_workspace --from-file=target-kubeconfig.yaml=$kcp_ws_kubeconfig
 	logger.V(4).Info("create secret for the target workspace kubeconfig that's consumed by a standalone Kyverno")
-	kubeConfig, err := getWorkspaceKubeConfig(kcpKubeConfig, pc.Spec.Workspace, logger)
+	kubeConfig, err := getWorkspaceKubeConfig(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
 	if err != nil {
 		logger.Error(err, fmt.Sprintf("failed to generate workspace (%s) kubeconfig", pc.Spec.Workspace))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKcpConnectionFailed,
+			"failed to generate kubeconfig of workspace %s: %s", pc.Spec.Workspace, err.Error())
 		return ctrl.Result{}, err
 	}
+	if resources.IsSharedKyverno(&pc) {
+		result, err := r.installSharedKyverno(ctx, logger, pc, kubeConfig)
+		if err != nil {
+			return result, err
+		}
+		// the workspace may have been isolated before
+		return result, r.removeWorkspaceNamespace(ctx, logger, pc)
+	}
 	secret := resources.BuildSecretForKyverno(&pc, kubeConfig)
 	if err := r.createOrUpdate(ctx, logger, secret); err != nil {
 		logger.Error(err, fmt.Sprintf("failed to create secrets for target workspace kubeconfig %s", secret.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonSecretDistributeFailed,
+			"failed to store kubeconfig of workspace %s in secret %s: %s", pc.Spec.Workspace, secret.GetName(), err.Error())
 		return ctrl.Result{}, err
 	}
 
@@ -156,6 +235,8 @@ func (r *PolicyControlReconciler) installKyvernoOnWorkspace(
 	service := resources.BuildServiceForKyverno(&pc)
 	if err := r.createOrUpdate(ctx, logger, service); err != nil {
 		logger.Error(err, fmt.Sprintf("failed to create service for for standalone Kyverno %s", service.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoDeployFailed,
+			"failed to create service %s for standalone Kyverno: %s", service.GetName(), err.Error())
 		return ctrl.Result{}, err
 	}
 
@@ -164,8 +245,29 @@ func (r *PolicyControlReconciler) installKyvernoOnWorkspace(
 	deployment := resources.BuildDeploymentForKyverno(&pc)
 	if err := r.createOrUpdate(ctx, logger, deployment); err != nil {
 		logger.Error(err, fmt.Sprintf("failed to create deployment for for standalone Kyverno %s", deployment.GetName()))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoDeployFailed,
+			"failed to create deployment %s for standalone Kyverno: %s", deployment.GetName(), err.Error())
 		return ctrl.Result{}, err
 	}
 
+	// the workspace may have been served by a shared Kyverno before
+	if err := r.releaseOtherShards(ctx, logger, pc, ""); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// or by a standalone Kyverno in another namespace, before it was isolated or since it is no longer
+	if resources.IsNamespaceIsolated(&pc) {
+		err = r.removeSharedNamespaceKyverno(ctx, logger, pc)
+	} else {
+		err = r.removeWorkspaceNamespace(ctx, logger, pc)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if len(pending) > 0 {
+		logger.V(4).Info(fmt.Sprintf("workspace manifests pending: %s", strings.Join(pending, ", ")))
+		return ctrl.Result{RequeueAfter: workspaceManifestsRequeueAfter}, nil
+	}
 	return ctrl.Result{}, nil
 }
@@ -0,0 +1,289 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
+	"github.com/IBM/policy-control-operator/render"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	// policyControlFinalizer keeps a deleted PolicyControl until the Kyverno of its workspace is torn down.
+	policyControlFinalizer = "ibm.github.com/policycontrol-cleanup"
+
+	// SkipTeardownAnnotation set to "true" on a deleted PolicyControl releases it without tearing anything down,
+	// e.g. once the teardown keeps failing on objects the operator is not allowed to delete.
+	SkipTeardownAnnotation = "ibm.github.com/skip-teardown"
+
+	// CreatedByLabel marks the objects the operator created in a workspace, the only ones removed on teardown.
+	CreatedByLabel    = "ibm.github.com/created-by"
+	createdByOperator = "policy-control-operator"
+)
+
+var (
+	workspaceResource                 = schema.GroupVersionResource{Group: "tenancy.kcp.dev", Version: "v1beta1", Resource: "workspaces"}
+	validatingWebhookConfigurationGVR = schema.GroupVersionResource{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingwebhookconfigurations"}
+	mutatingWebhookConfigurationGVR   = schema.GroupVersionResource{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "mutatingwebhookconfigurations"}
+)
+
+// finalize tears down the Kyverno of the workspace of the deleted pc and then releases the PolicyControl.
+// PolicyControls in dry-run mode created nothing and are released right away.
+func (r *PolicyControlReconciler) finalize(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) error {
+	if !controllerutil.ContainsFinalizer(&pc, policyControlFinalizer) {
+		return nil
+	}
+	if pc.GetAnnotations()[SkipTeardownAnnotation] == "true" {
+		logger.Info(fmt.Sprintf("release PolicyControl %s without tearing down the Kyverno of workspace %s", pc.GetName(), pc.Spec.Workspace))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoTeardownFailed,
+			"skipped the teardown of the Kyverno of workspace %s as requested by %s", pc.Spec.Workspace, SkipTeardownAnnotation)
+	} else if !isDryRun(&pc) {
+		// the template may be gone already, its defaults then no longer name the objects to remove
+		effective, err := applyTemplate(ctx, r.Client, logger, pc)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("failed to apply the template of PolicyControl %s, tearing down without it", pc.GetName()))
+			effective = pc
+		}
+		if err := r.tearDown(ctx, logger, effective); err != nil {
+			return err
+		}
+	}
+	base := pc.DeepCopy()
+	controllerutil.RemoveFinalizer(&pc, policyControlFinalizer)
+	return r.Patch(ctx, &pc, client.MergeFrom(base))
+}
+
+// tearDown removes what the operator created for the workspace of pc: the standalone Kyverno, or the share of the
+// workspace in a shared one, with the ingress path and the namespace of an isolated workspace in the Policy Control
+// Cluster, then the Kyverno objects of the workspace. Kyverno is stopped first so that it does not register its
+// webhooks again once they are removed from the workspace.
+func (r *PolicyControlReconciler) tearDown(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) error {
+	logger.V(4).Info(fmt.Sprintf("tear down the Kyverno of workspace %s", pc.Spec.Workspace))
+	if resources.IsSharedKyverno(&pc) {
+		if err := r.releaseOtherShards(ctx, logger, pc, ""); err != nil {
+			return err
+		}
+	} else if err := r.removeStandaloneKyverno(ctx, logger, pc); err != nil {
+		return err
+	}
+	if err := r.removeIngressRule(ctx, logger, pc); err != nil {
+		return err
+	}
+	if resources.IsNamespaceIsolated(&pc) {
+		if err := r.removeWorkspaceNamespace(ctx, logger, pc); err != nil {
+			return err
+		}
+	}
+
+	kcpKubeConfig, cleanup, err := writeKcpKubeConfig(ctx, r.Client, logger, pc)
+	if errors.IsNotFound(err) {
+		// e.g. deleted together with the namespace of the PolicyControl, kcp is out of reach then
+		logger.Info(fmt.Sprintf("the kcp kubeconfig secret is gone, leaving the objects in workspace %s", pc.Spec.Workspace))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoTeardownFailed,
+			"left the Kyverno objects in workspace %s as the kcp kubeconfig secret %s is gone",
+			pc.Spec.Workspace, pc.Spec.PolicyControlCluster.KcpKubeConfigSecret.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if err := r.removeWorkspaceObjects(ctx, logger, pc, kcpKubeConfig); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to remove the Kyverno objects from workspace %s", pc.Spec.Workspace))
+		r.Recorder.Eventf(&pc, corev1.EventTypeWarning, EventReasonKyvernoTeardownFailed,
+			"failed to remove the Kyverno objects from workspace %s, set %s to \"true\" to release the PolicyControl without them: %s",
+			pc.Spec.Workspace, SkipTeardownAnnotation, err.Error())
+		return err
+	}
+	r.Recorder.Eventf(&pc, corev1.EventTypeNormal, EventReasonKyvernoTornDown,
+		"removed the Kyverno of workspace %s", pc.Spec.Workspace)
+	return nil
+}
+
+// removeWorkspaceObjects deletes the canary policies, the webhook configurations Kyverno registered and the objects
+// the operator created in the workspace of pc, the latter in the reverse order of their creation. Objects which are
+// not labelled as created by the operator, e.g. namespaces existing before, and the APIBindings importing the
+// Kubernetes resources, which workloads of the workspace may use as well, are left in place. A failed deletion does
+// not stop the others. Nothing is left to remove from a workspace that no longer exists.
+func (r *PolicyControlReconciler) removeWorkspaceObjects(
+	ctx context.Context,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+	kcpKubeConfig string,
+) error {
+	config, mapper, err := getWorkspaceConfigs(ctx, kcpKubeConfig, pc.Spec.Workspace, logger)
+	if err != nil {
+		return err
+	}
+	if i := strings.LastIndex(pc.Spec.Workspace, ":"); i > 0 {
+		parentClient, err := dynamic.NewForConfig(clusterConfig(config, pc.Spec.Workspace[:i]))
+		if err != nil {
+			return err
+		}
+		_, err = parentClient.Resource(workspaceResource).Get(ctx, pc.Spec.Workspace[i+1:], metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			logger.V(4).Info(fmt.Sprintf("workspace %s is gone", pc.Spec.Workspace))
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	dyClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	objs, err := render.WorkspaceObjects(&pc, render.Options{
+		KyvernoManifestsDir: WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR,
+		APIBindingsManifest: WORKSPACE_APIBINDINGS_MANIFEST,
+	}, render.PlaceholderSecrets())
+	if err != nil {
+		return err
+	}
+	removed := []*unstructured.Unstructured{resources.BuildCanaryClusterPolicy(&pc), resources.BuildCanaryEdgePolicy(&pc)}
+	for _, gvr := range []schema.GroupVersionResource{validatingWebhookConfigurationGVR, mutatingWebhookConfigurationGVR} {
+		webhooks, err := dyClient.Resource(gvr).List(ctx, metav1.ListOptions{LabelSelector: kyvernoWebhookManagedByLabel})
+		if err != nil {
+			return err
+		}
+		for i := range webhooks.Items {
+			removed = append(removed, &webhooks.Items[i])
+		}
+	}
+	for i := len(objs) - 1; i >= 0; i-- {
+		// only the kind and name are needed to delete the object
+		gvk, err := apiutil.GVKForObject(objs[i], planScheme)
+		if err != nil {
+			return err
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace(objs[i].GetNamespace())
+		obj.SetName(objs[i].GetName())
+		removed = append(removed, obj)
+	}
+
+	kept, err := kubernetesAPIBindingNames(&pc)
+	if err != nil {
+		return err
+	}
+	kyvernoWebhook, err := labels.Parse(kyvernoWebhookManagedByLabel)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, obj := range removed {
+		gvk := obj.GroupVersionKind()
+		if gvk.Kind == "APIBinding" && kept[obj.GetName()] {
+			continue
+		}
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			// the API is not served (any more), e.g. once the APIBinding providing it is removed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var ri dynamic.ResourceInterface = dyClient.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			ri = dyClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+		}
+		live, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get %s %s: %w", obj.GetKind(), objectName(*obj), err))
+			continue
+		}
+		if !createdByOperatorOrKyverno(live, kyvernoWebhook) {
+			logger.V(4).Info(fmt.Sprintf("leave %s %s in workspace %s, the operator did not create it", obj.GetKind(), objectName(*obj), pc.Spec.Workspace))
+			continue
+		}
+		logger.V(4).Info(fmt.Sprintf("delete %s %s from workspace %s", obj.GetKind(), objectName(*obj), pc.Spec.Workspace))
+		uid := live.GetUID()
+		err = ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			errs = append(errs, fmt.Errorf("failed to delete %s %s: %w", obj.GetKind(), objectName(*obj), err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// kubernetesAPIBindingNames returns the names of the APIBindings of pc importing the Kubernetes resources, those of
+// WORKSPACE_APIBINDINGS_MANIFEST when it is set.
+func kubernetesAPIBindingNames(pc *kcptoolsv1alpha1.PolicyControl) (map[string]bool, error) {
+	if WORKSPACE_APIBINDINGS_MANIFEST == "" {
+		return map[string]bool{resources.KubernetesAPIBinding(pc).Name: true}, nil
+	}
+	m, err := manifests.APIBindings(WORKSPACE_APIBINDINGS_MANIFEST)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := m.Objects()
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, obj := range objs {
+		names[obj.GetName()] = true
+	}
+	return names, nil
+}
+
+// createdByOperatorOrKyverno tells whether obj carries CreatedByLabel, or is a webhook configuration Kyverno registered.
+func createdByOperatorOrKyverno(obj *unstructured.Unstructured, kyvernoWebhook labels.Selector) bool {
+	return obj.GetLabels()[CreatedByLabel] == createdByOperator || kyvernoWebhook.Matches(labels.Set(obj.GetLabels()))
+}
+
+// markCreated labels obj as created by the operator, so that it is removed on teardown.
+func markCreated(obj metav1.Object) {
+	l := obj.GetLabels()
+	if l == nil {
+		l = map[string]string{}
+	}
+	l[CreatedByLabel] = createdByOperator
+	obj.SetLabels(l)
+}
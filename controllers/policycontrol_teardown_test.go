@@ -0,0 +1,205 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var _ = Describe("PolicyControl teardown", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	// deleteAndReconcile deletes pc and runs the reconcile tearing down its Kyverno.
+	deleteAndReconcile := func(pc *kcptoolsv1alpha1.PolicyControl) {
+		Expect(env.pcc.Delete(env.ctx, env.latest(pc))).To(Succeed())
+		env.reconcile(pc)
+		Expect(isGone(env.ctx, env.pcc, pc)).To(BeTrue())
+	}
+	gone := func(obj client.Object) bool {
+		return isGone(env.ctx, env.pcc, obj)
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+	})
+
+	It("removes the standalone Kyverno, its ingress path and the objects of the workspace", func() {
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		other := newTestPolicyControl("pccr-edge2", "root:edge2")
+		Expect(env.pcc.Create(env.ctx, other)).To(Succeed())
+		env.reconcile(other)
+		env.kcp.create("root:edge1", validatingGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":   "kyverno-resource-validating-webhook-cfg",
+				"labels": map[string]interface{}{"webhook.kyverno.io/managed-by": "kyverno"},
+			},
+		}})
+		drainEvents(env.recorder)
+
+		deleteAndReconcile(pc)
+
+		By("removing the Kyverno of the workspace from the Policy Control Cluster")
+		key := client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}
+		Expect(gone(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}})).To(BeTrue())
+		Expect(gone(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}})).To(BeTrue())
+		Expect(gone(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}})).To(BeTrue())
+		Expect(env.ingressPaths()).To(Equal(map[string]string{"/root--edge2(/|$)(.*)": "root--edge2"}))
+
+		By("removing the Kyverno objects from the workspace")
+		Expect(env.kcp.get("root:edge1", validatingGVR, "", "kyverno-resource-validating-webhook-cfg")).To(BeNil())
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).To(BeNil())
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno-incluster")).To(BeNil())
+		Expect(env.kcp.get("root:edge1", crdGVR, "", policyReportsCRD)).To(BeNil())
+		Expect(env.kcp.get("root:edge1", subscriptionGVR, "kyverno-incluster", "kyverno-operator")).To(BeNil())
+
+		By("keeping the APIBinding of the Kubernetes resources, which workloads of the workspace may use")
+		var bindings []string
+		for _, binding := range env.kcp.list("root:edge1", apiBindingGVR) {
+			bindings = append(bindings, binding.GetName())
+		}
+		Expect(bindings).To(Equal([]string{"kyverno-required-resources"}))
+
+		By("leaving the other workspace alone")
+		Expect(env.kcp.get("root:edge2", namespaceGVR, "", "kyverno")).NotTo(BeNil())
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge2"}, &appsv1.Deployment{})).To(Succeed())
+		Expect(drainEvents(env.recorder)).To(ContainElement(ContainSubstring(EventReasonKyvernoTornDown)))
+	})
+
+	It("leaves the objects the operator did not create", func() {
+		env.kcp.create("root:edge1", namespaceGVR, &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "kyverno", "labels": map[string]interface{}{"team": "a"}},
+		}})
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno").GetLabels()).NotTo(HaveKey(CreatedByLabel))
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno-incluster").GetLabels()).To(HaveKeyWithValue(CreatedByLabel, createdByOperator))
+		Expect(env.kcp.get("root:edge1", clusterRoleGVR, "", "kyverno:policies").GetLabels()).To(HaveKeyWithValue(CreatedByLabel, createdByOperator))
+		// an object of the same name which someone else put in place
+		env.kcp.update("root:edge1", clusterRoleGVR, "", "kyverno:policies", func(obj *unstructured.Unstructured) {
+			obj.SetLabels(nil)
+		})
+
+		deleteAndReconcile(pc)
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).NotTo(BeNil())
+		Expect(env.kcp.get("root:edge1", clusterRoleGVR, "", "kyverno:policies")).NotTo(BeNil())
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno-incluster")).To(BeNil())
+	})
+
+	It("keeps the PolicyControl while objects cannot be deleted until the teardown is skipped", func() {
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		env.kcp.setAdmission(func(path string, obj *unstructured.Unstructured) error {
+			if obj.GetKind() == "Namespace" && obj.GetName() == "kyverno-incluster" {
+				return apierrors.NewForbidden(namespaceGVR.GroupResource(), obj.GetName(), fmt.Errorf("not allowed"))
+			}
+			return nil
+		})
+		drainEvents(env.recorder)
+
+		Expect(env.pcc.Delete(env.ctx, env.latest(pc))).To(Succeed())
+		_, err := env.reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pc)})
+		Expect(err).To(MatchError(ContainSubstring("failed to delete Namespace kyverno-incluster")))
+		Expect(drainEvents(env.recorder)).To(ContainElement(And(
+			ContainSubstring(EventReasonKyvernoTeardownFailed), ContainSubstring(SkipTeardownAnnotation))))
+		Expect(env.latest(pc).GetFinalizers()).To(ContainElement(policyControlFinalizer))
+		By("removing the other objects nevertheless")
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).To(BeNil())
+		Expect(env.kcp.get("root:edge1", crdGVR, "", policyReportsCRD)).To(BeNil())
+
+		By("releasing the PolicyControl once the teardown is skipped")
+		live := env.latest(pc)
+		live.SetAnnotations(map[string]string{SkipTeardownAnnotation: "true"})
+		Expect(env.pcc.Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+		err = env.pcc.Get(env.ctx, client.ObjectKeyFromObject(pc), &kcptoolsv1alpha1.PolicyControl{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno-incluster")).NotTo(BeNil())
+		Expect(drainEvents(env.recorder)).To(ContainElement(ContainSubstring("skipped the teardown")))
+	})
+
+	It("removes the namespace of an isolated workspace", func() {
+		pc.Spec.PolicyControlCluster.Isolation = resources.IsolationNamespace
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		namespace := &corev1.Namespace{}
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Name: "root--edge1"}, namespace)).To(Succeed())
+
+		deleteAndReconcile(pc)
+		Expect(gone(namespace)).To(BeTrue())
+		Expect(gone(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "root--edge1", Name: "kyverno-ingress"}})).To(BeTrue())
+	})
+
+	It("removes the workspace from its shared Kyverno", func() {
+		pc.Spec.PolicyControlCluster.KyvernoMode = resources.KyvernoModeShared
+		pc.Spec.PolicyControlCluster.SharedKyverno.Shards = 1
+		other := newTestPolicyControl("pccr-edge2", "root:edge2")
+		other.Spec.PolicyControlCluster = *pc.Spec.PolicyControlCluster.DeepCopy()
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		Expect(env.pcc.Create(env.ctx, other)).To(Succeed())
+		env.reconcile(pc)
+		env.reconcile(other)
+		shard := env.latest(pc).Status.Shard
+
+		deleteAndReconcile(pc)
+		var bundle corev1.Secret
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: shard}, &bundle)).To(Succeed())
+		Expect(bundle.Data).NotTo(HaveKey(resources.ShardBundleKey(pc)))
+		Expect(bundle.Data).To(HaveKey(resources.ShardBundleKey(env.latest(other))))
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: shard}, &appsv1.Deployment{})).To(Succeed())
+		Expect(env.ingressPaths()).To(HaveLen(1))
+	})
+
+	It("releases the PolicyControl of a workspace that is gone", func() {
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		env.kcp.delete("root", workspaceGVR, "", "edge1")
+
+		deleteAndReconcile(pc)
+		Expect(env.kcp.get("root:edge1", namespaceGVR, "", "kyverno")).NotTo(BeNil())
+	})
+
+	It("releases the PolicyControl when kcp is out of reach", func() {
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+		Expect(env.pcc.Delete(env.ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "kcp-kubeconfig-secret"}})).To(Succeed())
+		drainEvents(env.recorder)
+
+		deleteAndReconcile(pc)
+		Expect(gone(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "root--edge1"}})).To(BeTrue())
+		Expect(drainEvents(env.recorder)).To(ContainElement(ContainSubstring(EventReasonKyvernoTeardownFailed)))
+	})
+})
@@ -0,0 +1,90 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const templateRefIndexKey = "spec.templateRef"
+
+// applyTemplate returns the effective PolicyControl, i.e. pc with the defaults of its PolicyControlTemplate merged in.
+func applyTemplate(
+	ctx context.Context,
+	c client.Reader,
+	logger logr.Logger,
+	pc kcptoolsv1alpha1.PolicyControl,
+) (kcptoolsv1alpha1.PolicyControl, error) {
+	if pc.Spec.TemplateRef == "" {
+		return pc, nil
+	}
+	var tmpl kcptoolsv1alpha1.PolicyControlTemplate
+	if err := c.Get(ctx, client.ObjectKey{Name: pc.Spec.TemplateRef}, &tmpl); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to get PolicyControlTemplate %s", pc.Spec.TemplateRef))
+		return pc, err
+	}
+	merged, err := resources.MergeTemplate(&pc, &tmpl)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("failed to merge PolicyControlTemplate %s", pc.Spec.TemplateRef))
+		return pc, err
+	}
+	return *merged, nil
+}
+
+// findPolicyControlsForTemplate maps a PolicyControlTemplate to the PolicyControls referring to it,
+// and to the PolicyControls sharing a Kyverno pool with them, whose size the template may change.
+func (r *PolicyControlReconciler) findPolicyControlsForTemplate(obj client.Object) []reconcile.Request {
+	var pcList kcptoolsv1alpha1.PolicyControlList
+	if err := r.List(context.Background(), &pcList, client.MatchingFields{templateRefIndexKey: obj.GetName()}); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(pcList.Items))
+	seen := map[types.NamespacedName]bool{}
+	add := func(req reconcile.Request) {
+		if !seen[req.NamespacedName] {
+			seen[req.NamespacedName] = true
+			requests = append(requests, req)
+		}
+	}
+	for i := range pcList.Items {
+		pc := &pcList.Items[i]
+		add(reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: pc.GetNamespace(), Name: pc.GetName()},
+		})
+		for _, req := range r.findPolicyControlsSharingShards(pc) {
+			add(req)
+		}
+	}
+	return requests
+}
+
+func indexTemplateRef(obj client.Object) []string {
+	pc, ok := obj.(*kcptoolsv1alpha1.PolicyControl)
+	if !ok || pc.Spec.TemplateRef == "" {
+		return nil
+	}
+	return []string{pc.Spec.TemplateRef}
+}
@@ -0,0 +1,58 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+var _ = Describe("PolicyControlTemplate", func() {
+	var env *policyControlEnv
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+	})
+
+	It("installs Kyverno with the defaults of the template", func() {
+		tmpl := &kcptoolsv1alpha1.PolicyControlTemplate{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "defaults-"},
+			Spec: kcptoolsv1alpha1.PolicyControlTemplateSpec{
+				KyvernoInWorkspace: kcptoolsv1alpha1.KyvernoInWorkspace{KyvernoImage: "kyverno-template:1.0.0"},
+			},
+		}
+		Expect(env.pcc.Create(env.ctx, tmpl)).To(Succeed())
+		DeferCleanup(func() { Expect(client.IgnoreNotFound(env.pcc.Delete(env.ctx, tmpl))).To(Succeed()) })
+		pc := newTestPolicyControl("pccr-edge1", "root:edge1")
+		pc.Spec.TemplateRef = tmpl.GetName()
+		pc.Spec.KyvernoInWorkspace.KyvernoImage = ""
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+
+		// the status written on the way must not drop the defaults from the effective spec
+		env.reconcile(pc)
+		var deployment appsv1.Deployment
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("kyverno-template:1.0.0"))
+		Expect(env.latest(pc).Spec.KyvernoInWorkspace.KyvernoImage).To(BeEmpty())
+	})
+})
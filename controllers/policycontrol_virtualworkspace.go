@@ -0,0 +1,479 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	// annotation kcp sets on the objects listed across workspaces, holding their logical cluster
+	kcpClusterAnnotation = "kcp.dev/cluster"
+
+	// SourceClusterAnnotation, SourceNamespaceAnnotation and SourceNameAnnotation identify the PolicyControl
+	// in a consumer workspace a mirrored PolicyControl is created for.
+	SourceClusterAnnotation   = "ibm.github.com/source-cluster"
+	SourceNamespaceAnnotation = "ibm.github.com/source-namespace"
+	SourceNameAnnotation      = "ibm.github.com/source-name"
+	// label of the mirrored PolicyControls, holding the name of the APIExport they come from
+	virtualWorkspaceLabel = "ibm.github.com/apiexport"
+
+	policyControlCRDName   = "policycontrols.ibm.github.com"
+	virtualWorkspaceResync = 30 * time.Second
+	virtualWorkspaceWait   = 2 * time.Second
+)
+
+var (
+	policyControlResource     = schema.GroupVersionResource{Group: "ibm.github.com", Version: "v1alpha1", Resource: "policycontrols"}
+	crdGVK                    = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+	apiResourceSchemaResource = schema.GroupVersionResource{Group: "apis.kcp.dev", Version: "v1alpha1", Resource: "apiresourceschemas"}
+	apiExportResource         = schema.GroupVersionResource{Group: "apis.kcp.dev", Version: "v1alpha1", Resource: "apiexports"}
+)
+
+// VirtualWorkspaceSyncer serves PolicyControls created in consumer workspaces. It publishes the PolicyControl
+// CRD of the Policy Control Cluster as an APIExport, watches the PolicyControls of all workspaces binding it
+// through the virtual workspace of the APIExport and mirrors each of them into Namespace, where the
+// PolicyControlReconciler reconciles it. The status of the mirror is copied back to the consumer workspace, and a
+// deleted PolicyControl is released once its mirror, and with it its Kyverno, is gone.
+type VirtualWorkspaceSyncer struct {
+	// Client of the Policy Control Cluster
+	Client client.Client
+	// Config of kcp with permissions on the workspace ExportWorkspace and the workspaces of the tenants
+	KcpConfig       *rest.Config
+	ExportWorkspace string
+	ExportName      string
+	// PolicyControlTemplate providing the Policy Control Cluster settings of the mirrored PolicyControls
+	Template string
+	// Namespace of the mirrored PolicyControls in the Policy Control Cluster
+	Namespace string
+	Logger    logr.Logger
+
+	// config of the virtual workspace of the APIExport
+	vwConfig *rest.Config
+	// PolicyControls of all workspaces, keyed by clusterKey
+	store cache.Store
+}
+
+// SetupWithManager runs the syncer as a controller of mgr. It reconciles the PolicyControls of the consumer
+// workspaces, named by tenantRequest, on the changes of the PolicyControls served by the virtual workspace and of
+// their mirrors.
+func (s *VirtualWorkspaceSyncer) SetupWithManager(mgr ctrl.Manager) error {
+	s.store = cache.NewStore(clusterKey)
+	c, err := controller.New("policycontrol-virtualworkspace", mgr, controller.Options{Reconciler: s})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(&tenantSource{syncer: s}, handler.EnqueueRequestsFromMapFunc(tenantRequest)); err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &kcptoolsv1alpha1.PolicyControl{}}, handler.EnqueueRequestsFromMapFunc(s.mirrorRequest))
+}
+
+// tenantRequest names the PolicyControl obj of a consumer workspace by its namespace and the cluster-aware name
+// "<cluster>|<name>", as namespaces and names are not unique across workspaces.
+func tenantRequest(obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetAnnotations()[kcpClusterAnnotation] + "|" + obj.GetName(),
+	}}}
+}
+
+// mirrorRequest names the PolicyControl of a consumer workspace obj is the mirror of.
+func (s *VirtualWorkspaceSyncer) mirrorRequest(obj client.Object) []reconcile.Request {
+	if obj.GetLabels()[virtualWorkspaceLabel] != s.ExportName {
+		return nil
+	}
+	annotations := obj.GetAnnotations()
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: annotations[SourceNamespaceAnnotation],
+		Name:      annotations[SourceClusterAnnotation] + "|" + annotations[SourceNameAnnotation],
+	}}}
+}
+
+// Reconcile creates, updates or deletes the mirror of the PolicyControl of a consumer workspace named by req and
+// copies its status back. The PolicyControl is kept with a finalizer until its mirror is deleted, which the
+// PolicyControlReconciler holds back until the Kyverno of the workspace is torn down.
+func (s *VirtualWorkspaceSyncer) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	cluster, name, _ := strings.Cut(req.Name, "|")
+	namespace := req.Namespace
+	key := fmt.Sprintf("%s|%s/%s", cluster, namespace, name)
+	mirror := &kcptoolsv1alpha1.PolicyControl{ObjectMeta: metav1.ObjectMeta{
+		Name:      mirrorName(cluster, namespace, name),
+		Namespace: s.Namespace,
+	}}
+
+	obj, exists, err := s.store.GetByKey(key)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !exists {
+		// deleted without its finalizer, or its workspace no longer binds the APIExport
+		s.Logger.V(4).Info(fmt.Sprintf("delete mirror %s of PolicyControl %s", mirror.GetName(), key))
+		return ctrl.Result{}, client.IgnoreNotFound(s.Client.Delete(ctx, mirror))
+	}
+	tenant := obj.(*unstructured.Unstructured)
+	if tenant.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, s.release(ctx, cluster, tenant, mirror)
+	}
+	if !controllerutil.ContainsFinalizer(tenant, policyControlFinalizer) {
+		s.Logger.V(4).Info(fmt.Sprintf("add finalizer to PolicyControl %s", key))
+		finalizers := append(tenant.GetFinalizers(), policyControlFinalizer)
+		if err := s.patchTenant(ctx, cluster, tenant, map[string]interface{}{"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": tenant.GetResourceVersion(),
+		}}); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	var pc kcptoolsv1alpha1.PolicyControl
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(tenant.Object, &pc); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if _, err := ctrl.CreateOrUpdate(ctx, s.Client, mirror, func() error {
+		mirror.SetLabels(map[string]string{virtualWorkspaceLabel: s.ExportName})
+		annotations := map[string]string{
+			SourceClusterAnnotation:   cluster,
+			SourceNamespaceAnnotation: namespace,
+			SourceNameAnnotation:      name,
+		}
+		if v, ok := tenant.GetAnnotations()[DryRunAnnotation]; ok {
+			annotations[DryRunAnnotation] = v
+		}
+		mirror.SetAnnotations(annotations)
+		mirror.Spec = mirrorSpec(cluster, s.Template, pc.Spec)
+		return nil
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if equality.Semantic.DeepEqual(pc.Status, mirror.Status) {
+		return ctrl.Result{}, nil
+	}
+	s.Logger.V(4).Info(fmt.Sprintf("copy status of mirror %s to PolicyControl %s", mirror.GetName(), key))
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&mirror.Status)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, s.patchTenant(ctx, cluster, tenant, map[string]interface{}{"status": status}, "status")
+}
+
+// release deletes the mirror of the deleted PolicyControl tenant and removes the finalizer of tenant once the
+// mirror is gone. The deletion of the mirror queues tenant again.
+func (s *VirtualWorkspaceSyncer) release(
+	ctx context.Context,
+	cluster string,
+	tenant *unstructured.Unstructured,
+	mirror *kcptoolsv1alpha1.PolicyControl,
+) error {
+	if err := s.Client.Get(ctx, client.ObjectKeyFromObject(mirror), mirror); err == nil {
+		if mirror.DeletionTimestamp != nil {
+			s.Logger.V(4).Info(fmt.Sprintf("wait for the teardown of mirror %s", mirror.GetName()))
+			return nil
+		}
+		s.Logger.V(4).Info(fmt.Sprintf("delete mirror %s of deleted PolicyControl %s", mirror.GetName(), tenant.GetName()))
+		return client.IgnoreNotFound(s.Client.Delete(ctx, mirror))
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	if !controllerutil.ContainsFinalizer(tenant, policyControlFinalizer) {
+		return nil
+	}
+	s.Logger.V(4).Info(fmt.Sprintf("remove finalizer of deleted PolicyControl %s", tenant.GetName()))
+	var finalizers []string
+	for _, f := range tenant.GetFinalizers() {
+		if f != policyControlFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	return s.patchTenant(ctx, cluster, tenant, map[string]interface{}{"metadata": map[string]interface{}{
+		"finalizers":      finalizers,
+		"resourceVersion": tenant.GetResourceVersion(),
+	}})
+}
+
+// patchTenant merge-patches the PolicyControl tenant of the consumer workspace cluster, or the subresources of it.
+func (s *VirtualWorkspaceSyncer) patchTenant(
+	ctx context.Context,
+	cluster string,
+	tenant *unstructured.Unstructured,
+	patch map[string]interface{},
+	subresources ...string,
+) error {
+	tenantClient, err := dynamic.NewForConfig(clusterConfig(s.vwConfig, cluster))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = tenantClient.Resource(policyControlResource).Namespace(tenant.GetNamespace()).
+		Patch(ctx, tenant.GetName(), types.MergePatchType, data, metav1.PatchOptions{}, subresources...)
+	return err
+}
+
+// tenantSource lists and watches the PolicyControls of all workspaces through the virtual workspace of the
+// APIExport, which it publishes first, into the store of the syncer and passes every change to the controller.
+type tenantSource struct {
+	syncer *VirtualWorkspaceSyncer
+	synced chan struct{}
+}
+
+// Start publishes the APIExport and starts the reflector filling the store of the syncer.
+func (t *tenantSource) Start(
+	ctx context.Context,
+	h handler.EventHandler,
+	queue workqueue.RateLimitingInterface,
+	_ ...predicate.Predicate,
+) error {
+	s := t.syncer
+	url, err := s.publish(ctx)
+	if err != nil {
+		s.Logger.Error(err, fmt.Sprintf("failed to publish the APIExport %s in workspace %s", s.ExportName, s.ExportWorkspace))
+		return err
+	}
+	s.Logger.Info(fmt.Sprintf("serving PolicyControls of the workspaces binding the APIExport %s at %s", s.ExportName, url))
+	s.vwConfig = rest.CopyConfig(s.KcpConfig)
+	s.vwConfig.Host = url
+
+	wildcard, err := dynamic.NewForConfig(clusterConfig(s.vwConfig, "*"))
+	if err != nil {
+		return err
+	}
+	t.synced = make(chan struct{})
+	store := &tenantStore{Store: s.store, handler: h, queue: queue, synced: t.synced}
+	// the informers of client-go key objects by namespace and name only, which are not unique across workspaces
+	reflector := cache.NewReflector(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return wildcard.Resource(policyControlResource).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return wildcard.Resource(policyControlResource).Watch(ctx, options)
+		},
+	}, &unstructured.Unstructured{}, store, virtualWorkspaceResync)
+	go reflector.Run(ctx.Done())
+	return nil
+}
+
+// WaitForSync waits for the first list of the PolicyControls, so that no mirror is deleted for a PolicyControl
+// that is not listed yet.
+func (t *tenantSource) WaitForSync(ctx context.Context) error {
+	select {
+	case <-t.synced:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to list the PolicyControls of the APIExport %s: %w", t.syncer.ExportName, ctx.Err())
+	}
+}
+
+// tenantStore passes the PolicyControls added, updated, deleted or resynced by the reflector to handler.
+type tenantStore struct {
+	cache.Store
+	handler handler.EventHandler
+	queue   workqueue.RateLimitingInterface
+	synced  chan struct{}
+	once    sync.Once
+}
+
+func (t *tenantStore) Add(obj interface{}) error {
+	if err := t.Store.Add(obj); err != nil {
+		return err
+	}
+	t.enqueue(obj)
+	return nil
+}
+
+func (t *tenantStore) Update(obj interface{}) error {
+	if err := t.Store.Update(obj); err != nil {
+		return err
+	}
+	t.enqueue(obj)
+	return nil
+}
+
+func (t *tenantStore) Delete(obj interface{}) error {
+	if err := t.Store.Delete(obj); err != nil {
+		return err
+	}
+	t.enqueue(obj)
+	return nil
+}
+
+// Replace passes the PolicyControls of list and the ones it no longer contains.
+func (t *tenantStore) Replace(list []interface{}, resourceVersion string) error {
+	previous := t.Store.List()
+	if err := t.Store.Replace(list, resourceVersion); err != nil {
+		return err
+	}
+	for _, obj := range append(previous, list...) {
+		t.enqueue(obj)
+	}
+	t.once.Do(func() { close(t.synced) })
+	return nil
+}
+
+func (t *tenantStore) Resync() error {
+	for _, obj := range t.Store.List() {
+		t.enqueue(obj)
+	}
+	return nil
+}
+
+func (t *tenantStore) enqueue(obj interface{}) {
+	if o, ok := obj.(client.Object); ok {
+		t.handler.Generic(event.GenericEvent{Object: o}, t.queue)
+	}
+}
+
+// mirrorSpec takes the fields a tenant may choose from spec. The workspace is always the one of the tenant,
+// and the Policy Control Cluster settings come from the PolicyControlTemplate of the operator.
+// The APIBindings and the OLM objects are created with the kcp credentials of the operator, so they come from the
+// template as well: a tenant choosing them could bind any APIExport without holding bind on it.
+func mirrorSpec(cluster, template string, spec kcptoolsv1alpha1.PolicyControlSpec) kcptoolsv1alpha1.PolicyControlSpec {
+	return kcptoolsv1alpha1.PolicyControlSpec{
+		Workspace:   cluster,
+		TemplateRef: template,
+		KyvernoInWorkspace: kcptoolsv1alpha1.KyvernoInWorkspace{
+			NamespaceForAPIResources: spec.KyvernoInWorkspace.NamespaceForAPIResources,
+			KyvernoVersion:           spec.KyvernoInWorkspace.KyvernoVersion,
+		},
+	}
+}
+
+// publish creates the APIResourceSchema of the PolicyControl CRD and the APIExport serving it in ExportWorkspace,
+// and returns the URL of the virtual workspace of the APIExport once kcp reports it.
+func (s *VirtualWorkspaceSyncer) publish(ctx context.Context) (string, error) {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(crdGVK)
+	if err := s.Client.Get(ctx, client.ObjectKey{Name: policyControlCRDName}, crd); err != nil {
+		return "", err
+	}
+	// schemas are immutable, so every revision of the CRD gets its own
+	spec, err := json.Marshal(crd.Object["spec"])
+	if err != nil {
+		return "", err
+	}
+	apiSchema, err := resources.BuildAPIResourceSchema(crd, fmt.Sprintf("v%x", sha256.Sum256(spec))[:9])
+	if err != nil {
+		return "", err
+	}
+	export := resources.BuildAPIExport(s.ExportName, []string{apiSchema.GetName()})
+
+	kcp, err := dynamic.NewForConfig(clusterConfig(s.KcpConfig, s.ExportWorkspace))
+	if err != nil {
+		return "", err
+	}
+	if _, err := kcp.Resource(apiResourceSchemaResource).Get(ctx, apiSchema.GetName(), metav1.GetOptions{}); errors.IsNotFound(err) {
+		if _, err := kcp.Resource(apiResourceSchemaResource).Create(ctx, apiSchema, metav1.CreateOptions{}); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+	if _, err := kcp.Resource(apiExportResource).Apply(ctx, export.GetName(), export,
+		metav1.ApplyOptions{FieldManager: workspaceFieldManager, Force: true}); err != nil {
+		return "", err
+	}
+
+	var url string
+	err = wait.PollImmediateUntilWithContext(ctx, virtualWorkspaceWait, func(ctx context.Context) (bool, error) {
+		live, err := kcp.Resource(apiExportResource).Get(ctx, s.ExportName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		workspaces, _, _ := unstructured.NestedSlice(live.Object, "status", "virtualWorkspaces")
+		for _, w := range workspaces {
+			if u, ok := w.(map[string]interface{})["url"].(string); ok && u != "" {
+				url = u
+				return true, nil
+			}
+		}
+		s.Logger.V(4).Info(fmt.Sprintf("waiting for the virtual workspace URL of the APIExport %s", s.ExportName))
+		return false, nil
+	})
+	return url, err
+}
+
+// clusterConfig points config at the logical cluster (workspace) cluster, "*" for all workspaces.
+func clusterConfig(config *rest.Config, cluster string) *rest.Config {
+	c := rest.CopyConfig(config)
+	if i := strings.Index(c.Host, "/clusters/"); i >= 0 {
+		c.Host = c.Host[:i]
+	}
+	c.Host = strings.TrimSuffix(c.Host, "/") + "/clusters/" + cluster
+	return c
+}
+
+// clusterKey keys obj by its logical cluster, namespace and name.
+func clusterKey(obj interface{}) (string, error) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return d.Key, nil
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|%s/%s", m.GetAnnotations()[kcpClusterAnnotation], m.GetNamespace(), m.GetName()), nil
+}
+
+// mirrorName is unique for the PolicyControl name in namespace of cluster. name is truncated so that the
+// hash suffix keeps the mirror name a valid object name.
+func mirrorName(cluster, namespace, name string) string {
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(cluster+"|"+namespace+"/"+name)))[:8]
+	base := name
+	if limit := validation.DNS1123SubdomainMaxLength - len(hash) - 1; len(base) > limit {
+		base = strings.TrimRight(base[:limit], ".-")
+	}
+	return base + "-" + hash
+}
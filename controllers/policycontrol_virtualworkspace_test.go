@@ -0,0 +1,214 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+var policyControlsAPI = fakeAPI{policyControlResource, "PolicyControl", true}
+
+// tenantPolicyControl returns the PolicyControl name of the consumer workspace cluster, as listed from the virtual
+// workspace.
+func tenantPolicyControl(cluster, name string) *unstructured.Unstructured {
+	pc := newTestPolicyControl(name, "")
+	pc.Namespace = "default"
+	pc.Spec.PolicyControlCluster = kcptoolsv1alpha1.PolicyControlCluster{}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pc)
+	Expect(err).NotTo(HaveOccurred())
+	tenant := &unstructured.Unstructured{Object: obj}
+	tenant.SetAnnotations(map[string]string{kcpClusterAnnotation: cluster})
+	return tenant
+}
+
+var _ = Describe("VirtualWorkspaceSyncer", func() {
+	const cluster = "root:tenant"
+	var (
+		env     *policyControlEnv
+		syncer  *VirtualWorkspaceSyncer
+		request ctrl.Request
+		mirror  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	// sync reconciles the PolicyControl of the tenant as listed from the virtual workspace.
+	sync := func() {
+		if tenant := env.kcp.get(cluster, policyControlResource, "default", "pccr"); tenant != nil {
+			Expect(syncer.store.Update(tenant)).To(Succeed())
+		}
+		_, err := syncer.Reconcile(env.ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		env.kcp.addWorkspace(cluster, operatorGroupsAPI, subscriptionsAPI, kyvernoesAPI, policyControlsAPI)
+		env.kcp.create(cluster, namespaceAPI.GroupVersionResource, &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "default"},
+		}})
+		env.kcp.create(cluster, policyControlResource, tenantPolicyControl(cluster, "pccr"))
+
+		tmpl := &kcptoolsv1alpha1.PolicyControlTemplate{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "tenants-"},
+			Spec: kcptoolsv1alpha1.PolicyControlTemplateSpec{
+				PolicyControlCluster: newTestPolicyControl("", "").Spec.PolicyControlCluster,
+				KyvernoInWorkspace:   kcptoolsv1alpha1.KyvernoInWorkspace{KyvernoImage: "kyverno-local:1.0.0"},
+				KyvernoInCluster:     newTestPolicyControl("", "").Spec.KyvernoInCluster,
+			},
+		}
+		Expect(env.pcc.Create(env.ctx, tmpl)).To(Succeed())
+		DeferCleanup(func() { Expect(client.IgnoreNotFound(env.pcc.Delete(env.ctx, tmpl))).To(Succeed()) })
+
+		syncer = &VirtualWorkspaceSyncer{
+			Client:     env.pcc,
+			ExportName: "policycontrols.ibm.github.com",
+			Template:   tmpl.GetName(),
+			Namespace:  testNamespace,
+			Logger:     logr.Discard(),
+			vwConfig:   &rest.Config{Host: env.kcp.server.URL, BearerToken: "admin-token"},
+			store:      cache.NewStore(clusterKey),
+		}
+		request = tenantRequest(env.kcp.get(cluster, policyControlResource, "default", "pccr"))[0]
+		mirror = &kcptoolsv1alpha1.PolicyControl{ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      mirrorName(cluster, "default", "pccr"),
+		}}
+	})
+
+	It("mirrors the PolicyControl of a consumer workspace and copies the status of the mirror back", func() {
+		sync()
+		live := env.latest(mirror)
+		Expect(live.Spec.Workspace).To(Equal(cluster))
+		Expect(live.Spec.TemplateRef).To(Equal(syncer.Template))
+		Expect(live.Annotations).To(HaveKeyWithValue(SourceClusterAnnotation, cluster))
+		Expect(syncer.mirrorRequest(live)).To(Equal([]ctrl.Request{request}))
+		Expect(env.kcp.get(cluster, policyControlResource, "default", "pccr").GetFinalizers()).To(ConsistOf(policyControlFinalizer))
+
+		By("copying the status written by the PolicyControlReconciler")
+		env.reconcile(mirror)
+		sync()
+		workspaceName, _, _ := unstructured.NestedString(env.kcp.get(cluster, policyControlResource, "default", "pccr").Object, "status", "workspaceName")
+		Expect(workspaceName).To(Equal("root--tenant"))
+	})
+
+	It("leaves the APIBindings and the OLM settings to the template", func() {
+		env.kcp.update(cluster, policyControlResource, "default", "pccr", func(obj *unstructured.Unstructured) {
+			bindings := []interface{}{map[string]interface{}{"path": "root:other", "exportName": "private"}}
+			Expect(unstructured.SetNestedSlice(obj.Object, bindings, "spec", "kyverno_in_workspace", "additionalAPIBindings")).To(Succeed())
+			Expect(unstructured.SetNestedField(obj.Object, "olm-elsewhere", "spec", "kyverno_in_cluster", "subscription", "olmNamespace")).To(Succeed())
+		})
+		sync()
+		live := env.latest(mirror)
+		Expect(live.Spec.KyvernoInWorkspace.AdditionalAPIBindings).To(BeEmpty())
+		Expect(live.Spec.KyvernoInCluster).To(BeZero())
+
+		env.reconcile(mirror)
+		Expect(env.kcp.get(cluster, apiBindingGVR, "", "private")).To(BeNil())
+		subscription := env.kcp.get(cluster, subscriptionsAPI.GroupVersionResource, "kyverno-incluster", "kyverno-operator")
+		Expect(subscription).NotTo(BeNil())
+		sourceNamespace, _, _ := unstructured.NestedString(subscription.Object, "spec", "sourceNamespace")
+		Expect(sourceNamespace).To(Equal("olm"))
+	})
+
+	It("tears down the Kyverno of a deleted PolicyControl before releasing it", func() {
+		sync()
+		env.reconcile(mirror)
+		Expect(env.kcp.get(cluster, namespaceGVR, "", "kyverno")).NotTo(BeNil())
+
+		env.kcp.update(cluster, policyControlResource, "default", "pccr", func(obj *unstructured.Unstructured) {
+			now := metav1.Now()
+			obj.SetDeletionTimestamp(&now)
+		})
+		sync()
+		Expect(env.latest(mirror).DeletionTimestamp).NotTo(BeNil())
+		Expect(env.kcp.get(cluster, policyControlResource, "default", "pccr").GetFinalizers()).To(ConsistOf(policyControlFinalizer))
+
+		By("releasing the PolicyControl once the mirror is torn down")
+		env.reconcile(mirror)
+		Expect(isGone(env.ctx, env.pcc, mirror)).To(BeTrue())
+		Expect(env.kcp.get(cluster, namespaceGVR, "", "kyverno")).To(BeNil())
+		sync()
+		Expect(env.kcp.get(cluster, policyControlResource, "default", "pccr").GetFinalizers()).To(BeEmpty())
+	})
+
+	It("deletes the mirror of a PolicyControl that is no longer served", func() {
+		sync()
+		Expect(syncer.store.Delete(env.kcp.get(cluster, policyControlResource, "default", "pccr"))).To(Succeed())
+		_, err := syncer.Reconcile(env.ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(isGone(env.ctx, env.pcc, mirror)).To(BeTrue())
+	})
+
+	It("keeps the names of the mirrors of long PolicyControl names valid and unique", func() {
+		long := strings.Repeat("a", 240) + "." + strings.Repeat("b", validation.DNS1123SubdomainMaxLength-241)
+		names := map[string]bool{}
+		for _, name := range []string{long, long[:len(long)-1] + "c", long[:244]} {
+			mirrored := mirrorName(cluster, "default", name)
+			Expect(validation.IsDNS1123Subdomain(mirrored)).To(BeEmpty(), mirrored)
+			Expect(mirrored).To(HavePrefix(name[:200]))
+			names[mirrored] = true
+		}
+		Expect(names).To(HaveLen(3))
+		Expect(mirrorName(cluster, "default", "pccr")).To(MatchRegexp(`^pccr-[0-9a-f]{8}$`))
+	})
+
+	It("queues the PolicyControls listed by the reflector and the ones no longer listed", func() {
+		queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		DeferCleanup(queue.ShutDown)
+		synced := make(chan struct{})
+		store := &tenantStore{
+			Store:   cache.NewStore(clusterKey),
+			handler: handler.EnqueueRequestsFromMapFunc(tenantRequest),
+			queue:   queue,
+			synced:  synced,
+		}
+		a, b := tenantPolicyControl("root:a", "pccr"), tenantPolicyControl("root:b", "pccr")
+		Expect(store.Replace([]interface{}{a, b}, "1")).To(Succeed())
+		Expect(synced).To(BeClosed())
+		Expect(queue.Len()).To(Equal(2))
+		for queue.Len() > 0 {
+			item, _ := queue.Get()
+			queue.Done(item)
+		}
+
+		Expect(store.Replace([]interface{}{a}, "2")).To(Succeed())
+		Expect(store.ListKeys()).To(ConsistOf("root:a|default/pccr"))
+		var queued []interface{}
+		for queue.Len() > 0 {
+			item, _ := queue.Get()
+			queued = append(queued, item)
+			queue.Done(item)
+		}
+		Expect(queued).To(ConsistOf(tenantRequest(a)[0], tenantRequest(b)[0]))
+	})
+})
@@ -0,0 +1,146 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+const (
+	// ConditionTypeWebhookReachable tells whether the health endpoint of the Kyverno serving the workspace answers
+	// through the advertised URL kcp calls the webhooks at, over TLS verified with the CA bundle of the ingress.
+	ConditionTypeWebhookReachable = "WebhookReachable"
+
+	ConditionReasonReachable         = "Reachable"
+	ConditionReasonDNSFailed         = "DNSFailed"
+	ConditionReasonConnectionFailed  = "ConnectionFailed"
+	ConditionReasonTLSFailed         = "TLSFailed"
+	ConditionReasonHealthCheckFailed = "HealthCheckFailed"
+
+	// health endpoint of the Kyverno webhook server, reached through the rewrite of the ingress path
+	kyvernoHealthPath = "health/liveness"
+)
+
+var webhookProbeTimeout = 10 * time.Second
+
+// probeWebhook calls the Kyverno health endpoint under the advertised URL of pc and records the outcome in the
+// WebhookReachable condition.
+func (r *PolicyControlReconciler) probeWebhook(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+) error {
+	crTlsSecret := pc.Spec.PolicyControlCluster.IngressTLSSecret
+	var tlsSecret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: crTlsSecret.Name}, &tlsSecret); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to get ingress TLS secret %s", crTlsSecret.Name))
+		return err
+	}
+
+	url := fmt.Sprintf("https://%s/%s", resources.AdvertisedURL(pc), kyvernoHealthPath)
+	logger.V(4).Info(fmt.Sprintf("probe the Kyverno webhook at %s", url))
+	reachable := webhookReachability(ctx, url, tlsSecret.Data[crTlsSecret.KeyForCacert])
+
+	if conditionUnchanged(pc.Status.Conditions, reachable) {
+		return nil
+	}
+	base := pc.DeepCopy()
+	meta.SetStatusCondition(&pc.Status.Conditions, reachable)
+	if err := r.patchStatus(ctx, pc, base); err != nil {
+		logger.Error(err, "failed to update status")
+		return err
+	}
+	if reachable.Status != metav1.ConditionTrue {
+		r.Recorder.Eventf(pc, corev1.EventTypeWarning, EventReasonWebhookUnreachable, "%s", reachable.Message)
+	}
+	return nil
+}
+
+// webhookReachability sends a GET request to url, trusting only the certificates of caBundle, and classifies
+// the outcome.
+func webhookReachability(ctx context.Context, url string, caBundle []byte) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    ConditionTypeWebhookReachable,
+		Status:  metav1.ConditionFalse,
+		Reason:  ConditionReasonTLSFailed,
+		Message: "the ingress TLS secret holds no valid CA certificate",
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return condition
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		condition.Reason, condition.Message = ConditionReasonConnectionFailed, err.Error()
+		return condition
+	}
+	// the certificate chain and its SANs are verified against the host of the advertised URL. A transport is built
+	// per probe for the CA bundle of the PolicyControl, so it keeps no connection open once the probe is done.
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	httpClient := &http.Client{Transport: transport}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		var dnsErr *net.DNSError
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		var header tls.RecordHeaderError
+		switch {
+		case errors.As(err, &dnsErr):
+			condition.Reason = ConditionReasonDNSFailed
+		case errors.As(err, &unknownAuthority), errors.As(err, &hostname), errors.As(err, &invalid), errors.As(err, &header):
+			condition.Reason = ConditionReasonTLSFailed
+		default:
+			condition.Reason = ConditionReasonConnectionFailed
+		}
+		condition.Message = err.Error()
+		return condition
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		condition.Reason = ConditionReasonHealthCheckFailed
+		condition.Message = fmt.Sprintf("GET %s returned %s; check the path rewrite of the ingress", url, resp.Status)
+		return condition
+	}
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = ConditionReasonReachable
+	condition.Message = fmt.Sprintf("the Kyverno health endpoint answers at %s", url)
+	return condition
+}
@@ -0,0 +1,164 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// selfSignedCA returns the PEM of a new self-signed CA certificate.
+func selfSignedCA() []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+var _ = Describe("Webhook probe", func() {
+	Context("webhookReachability", func() {
+		var (
+			server *httptest.Server
+			ca     []byte
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/root--edge1/"+kyvernoHealthPath {
+					http.NotFound(w, r)
+				}
+			}))
+			DeferCleanup(server.Close)
+			ca = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		})
+
+		// url returns the URL of path on server, reached through host
+		url := func(host, path string) string {
+			port := server.URL[strings.LastIndex(server.URL, ":")+1:]
+			return fmt.Sprintf("https://%s:%s/%s", host, port, path)
+		}
+
+		probe := func(url string, caBundle []byte) metav1.Condition {
+			condition := webhookReachability(context.Background(), url, caBundle)
+			Expect(condition.Type).To(Equal(ConditionTypeWebhookReachable))
+			return condition
+		}
+
+		It("reports the health endpoint reachable over TLS verified with the CA bundle", func() {
+			u := url("127.0.0.1", "root--edge1/"+kyvernoHealthPath)
+			condition := probe(u, ca)
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal(ConditionReasonReachable))
+			Expect(condition.Message).To(Equal("the Kyverno health endpoint answers at " + u))
+		})
+
+		It("closes its connection once the probe is done", func() {
+			var open int32
+			closing := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			closing.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				switch state {
+				case http.StateNew:
+					atomic.AddInt32(&open, 1)
+				case http.StateClosed, http.StateHijacked:
+					atomic.AddInt32(&open, -1)
+				}
+			}
+			closing.StartTLS()
+			DeferCleanup(closing.Close)
+
+			Expect(probe(closing.URL+"/"+kyvernoHealthPath, ca).Reason).To(Equal(ConditionReasonReachable))
+			Eventually(func() int32 { return atomic.LoadInt32(&open) }).Should(BeZero())
+		})
+
+		It("reports a path the ingress does not route to the health endpoint", func() {
+			u := url("127.0.0.1", "root--edge2/"+kyvernoHealthPath)
+			condition := probe(u, ca)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(ConditionReasonHealthCheckFailed))
+			Expect(condition.Message).To(Equal("GET " + u + " returned 404 Not Found; check the path rewrite of the ingress"))
+		})
+
+		It("reports TLS failures", func() {
+			By("rejecting a CA bundle without certificates")
+			condition := probe(url("127.0.0.1", kyvernoHealthPath), []byte("ca"))
+			Expect(condition.Reason).To(Equal(ConditionReasonTLSFailed))
+			Expect(condition.Message).To(Equal("the ingress TLS secret holds no valid CA certificate"))
+
+			By("rejecting a certificate signed by another CA")
+			Expect(probe(url("127.0.0.1", kyvernoHealthPath), selfSignedCA()).Reason).To(Equal(ConditionReasonTLSFailed))
+
+			By("rejecting a certificate not valid for the advertised host")
+			condition = probe(url("localhost", kyvernoHealthPath), ca)
+			Expect(condition.Reason).To(Equal(ConditionReasonTLSFailed))
+			Expect(condition.Message).To(ContainSubstring("localhost"))
+		})
+
+		It("reports a host that does not resolve and a port nothing listens on", func() {
+			Expect(probe(url("kyverno.invalid", kyvernoHealthPath), ca).Reason).To(Equal(ConditionReasonDNSFailed))
+
+			u := url("127.0.0.1", kyvernoHealthPath)
+			server.Close()
+			Expect(probe(u, ca).Reason).To(Equal(ConditionReasonConnectionFailed))
+		})
+	})
+
+	It("records an unreachable webhook once in the status and the events", func() {
+		env := newPolicyControlEnv()
+		pc := newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		unreachable := "Warning " + EventReasonWebhookUnreachable + " the ingress TLS secret holds no valid CA certificate"
+
+		env.reconcile(pc)
+		Expect(drainEvents(env.recorder)).To(ContainElement(unreachable))
+		Expect(env.latest(pc).Status.Conditions).To(ContainElement(And(
+			HaveField("Type", ConditionTypeWebhookReachable),
+			HaveField("Status", metav1.ConditionFalse),
+			HaveField("Reason", ConditionReasonTLSFailed),
+		)))
+
+		env.reconcile(pc)
+		Expect(drainEvents(env.recorder)).NotTo(ContainElement(unreachable))
+	})
+})
@@ -0,0 +1,364 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
+)
+
+const (
+	// ConditionTypeWorkspaceManifestsApplied tells whether the Kyverno manifests and APIBindings are applied to the
+	// workspace and ready. Its message lists the objects still pending.
+	ConditionTypeWorkspaceManifestsApplied = "WorkspaceManifestsApplied"
+
+	// ConditionTypeAPIBindingsReady tells whether the APIBindings of the workspace are ready and accept all
+	// permission claims of their APIExports, see status.apiBindings for the details.
+	ConditionTypeAPIBindingsReady = "APIBindingsReady"
+
+	ConditionReasonApplied                     = "Applied"
+	ConditionReasonPending                     = "Pending"
+	ConditionReasonApplyFailed                 = "ApplyFailed"
+	ConditionReasonReady                       = "Ready"
+	ConditionReasonNotReady                    = "NotReady"
+	ConditionReasonPermissionClaimsNotAccepted = "PermissionClaimsNotAccepted"
+
+	workspaceFieldManager = "policy-control-operator"
+)
+
+var (
+	// requeue delay while the APIs of a stage are not served yet, so that the later stages are not applied
+	workspaceAPIsRequeueAfter = 5 * time.Second
+	// requeue delay while manifests are pending
+	workspaceManifestsRequeueAfter = 30 * time.Second
+)
+
+// workspaceApplier applies manifests to a workspace stage by stage, see manifests.Stage.
+type workspaceApplier struct {
+	logger   logr.Logger
+	pc       kcptoolsv1alpha1.PolicyControl
+	dyClient dynamic.Interface
+	mapper   meta.RESTMapper
+	// rediscovers the resources of the workspace once CRDs and APIBindings added new ones
+	refreshMapper func(ctx context.Context) (meta.RESTMapper, error)
+	refreshed     bool
+	// set when the APIs of a stage were not served yet, so that the later stages were not applied
+	blocked bool
+	// last observed state of the applied objects
+	live []unstructured.Unstructured
+}
+
+// apply applies objs in dependency order and applies the next stage only once the Namespaces, CRDs and APIBindings
+// of a stage are ready. It returns the objects that are not ready yet; when the APIs of a stage are not ready, the
+// later stages are not applied and reported as pending too, and the caller has to requeue.
+func (a *workspaceApplier) apply(ctx context.Context, objs []unstructured.Unstructured) ([]string, error) {
+	manifests.SortByStage(objs)
+	var pending []string
+	for start := 0; start < len(objs); {
+		stage := manifests.Stage(objs[start])
+		end := start
+		for end < len(objs) && manifests.Stage(objs[end]) == stage {
+			end++
+		}
+		applied := make([]unstructured.Unstructured, 0, end-start)
+		for _, obj := range objs[start:end] {
+			live, err := a.applyObject(ctx, obj)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply %s %s: %w", obj.GetKind(), objectName(obj), err)
+			}
+			applied = append(applied, *live)
+		}
+
+		notReady := a.notReady(ctx, applied)
+		a.live = append(a.live, applied...)
+		pending = append(pending, notReady...)
+		if len(notReady) > 0 && stage <= manifests.StageAPIs {
+			a.blocked = true
+			for _, obj := range objs[end:] {
+				pending = append(pending, fmt.Sprintf("%s %s (not applied yet)", obj.GetKind(), objectName(obj)))
+			}
+			return pending, nil
+		}
+		start = end
+	}
+	return pending, nil
+}
+
+// applyObject server-side applies obj, so that fields set by others (e.g. aggregated ClusterRole rules) are kept.
+func (a *workspaceApplier) applyObject(ctx context.Context, obj unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	ctx, span := tracer.Start(ctx, "apply manifest", policyControlAttributes(a.pc),
+		trace.WithAttributes(attribute.String("manifest", obj.GetKind()+" "+objectName(obj))))
+	mapping, err := a.mapper.RESTMapping(obj.GroupVersionKind().GroupKind(), obj.GroupVersionKind().Version)
+	if meta.IsNoMatchError(err) && !a.refreshed && a.refreshMapper != nil {
+		// the kind may be served by a CRD or APIBinding applied in an earlier stage
+		a.refreshed = true
+		if a.mapper, err = a.refreshMapper(ctx); err == nil {
+			mapping, err = a.mapper.RESTMapping(obj.GroupVersionKind().GroupKind(), obj.GroupVersionKind().Version)
+		}
+	}
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	var ri dynamic.ResourceInterface = a.dyClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		ri = a.dyClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	}
+	obj = *obj.DeepCopy()
+	created := true
+	if obj.GetKind() == "Namespace" {
+		// a namespace existing before, e.g. one of the tenant, is not marked, so that it is kept on teardown
+		existing, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		created = errors.IsNotFound(err) || (err == nil && existing.GetLabels()[CreatedByLabel] == createdByOperator)
+	}
+	if created {
+		markCreated(&obj)
+	}
+	live, err := ri.Apply(ctx, obj.GetName(), &obj, metav1.ApplyOptions{FieldManager: workspaceFieldManager, Force: true})
+	endSpan(span, err)
+	return live, err
+}
+
+// notReady returns the objects of objs that are not ready, reading again the objects whose applied state is not
+// ready yet.
+func (a *workspaceApplier) notReady(ctx context.Context, objs []unstructured.Unstructured) []string {
+	var notReady []string
+	for i, obj := range objs {
+		if ready, _ := objectReady(obj); ready {
+			continue
+		}
+		mapping, err := a.mapper.RESTMapping(obj.GroupVersionKind().GroupKind(), obj.GroupVersionKind().Version)
+		if err == nil {
+			var live *unstructured.Unstructured
+			live, err = a.dyClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if err == nil {
+				objs[i] = *live
+			}
+		}
+		ready, reason := objectReady(objs[i])
+		if err != nil {
+			reason = err.Error()
+		}
+		if !ready || err != nil {
+			notReady = append(notReady, fmt.Sprintf("%s %s (%s)", obj.GetKind(), objectName(obj), reason))
+		}
+	}
+	return notReady
+}
+
+// objectReady tells whether obj is ready for its dependents, and why not.
+func objectReady(obj unstructured.Unstructured) (bool, string) {
+	switch obj.GetKind() {
+	case "Namespace":
+		phase, found, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		return !found || phase == "Active", fmt.Sprintf("phase is %s", phase)
+	case "CustomResourceDefinition":
+		return conditionTrue(obj, "Established"), "not Established"
+	case "APIBinding":
+		return apiBindingReady(obj)
+	case "Deployment", "StatefulSet":
+		replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+		ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+		return ready >= replicas, fmt.Sprintf("%d/%d replicas ready", ready, replicas)
+	case "DaemonSet":
+		desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+		ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberReady")
+		return ready >= desired, fmt.Sprintf("%d/%d pods ready", ready, desired)
+	}
+	return true, ""
+}
+
+// apiBindingReady requires the InitialBindingCompleted and Ready conditions of a binding.
+// The reasons of all false conditions are returned, e.g. PermissionClaimsValid when claims are not accepted.
+func apiBindingReady(obj unstructured.Unstructured) (bool, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if len(conditions) == 0 {
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		return phase == "Bound", fmt.Sprintf("phase is %s", phase)
+	}
+	var reasons []string
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["status"] == string(metav1.ConditionTrue) {
+			continue
+		}
+		reason := fmt.Sprintf("%v: %v", condition["type"], condition["reason"])
+		if message, ok := condition["message"].(string); ok && message != "" {
+			reason += " " + message
+		}
+		reasons = append(reasons, reason)
+	}
+	ready := conditionTrue(obj, "InitialBindingCompleted") && conditionTrue(obj, "Ready")
+	if ready || len(reasons) > 0 {
+		return ready, strings.Join(reasons, "; ")
+	}
+	return false, "InitialBindingCompleted or Ready not reported"
+}
+
+// apiBindingStatuses reports the state of the APIBindings among the live objects.
+func apiBindingStatuses(live []unstructured.Unstructured) []kcptoolsv1alpha1.APIBindingStatus {
+	var statuses []kcptoolsv1alpha1.APIBindingStatus
+	for _, obj := range live {
+		if obj.GetKind() != "APIBinding" {
+			continue
+		}
+		status := kcptoolsv1alpha1.APIBindingStatus{Name: obj.GetName()}
+		status.Path, _, _ = unstructured.NestedString(obj.Object, "spec", "reference", "workspace", "path")
+		status.ExportName, _, _ = unstructured.NestedString(obj.Object, "spec", "reference", "workspace", "exportName")
+		var reason string
+		status.Ready, reason = apiBindingReady(obj)
+		if !status.Ready {
+			status.Message = reason
+		}
+
+		accepted := map[kcptoolsv1alpha1.PermissionClaim]bool{}
+		claims, _, _ := unstructured.NestedSlice(obj.Object, "spec", "permissionClaims")
+		for _, c := range claims {
+			if claim, ok := c.(map[string]interface{}); ok && claim["state"] == "Accepted" {
+				accepted[permissionClaim(claim)] = true
+			}
+		}
+		exported, _, _ := unstructured.NestedSlice(obj.Object, "status", "exportPermissionClaims")
+		for _, c := range exported {
+			if claim, ok := c.(map[string]interface{}); ok && !accepted[permissionClaim(claim)] {
+				status.UnacceptedPermissionClaims = append(status.UnacceptedPermissionClaims, permissionClaim(claim))
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func permissionClaim(claim map[string]interface{}) kcptoolsv1alpha1.PermissionClaim {
+	group, _ := claim["group"].(string)
+	resource, _ := claim["resource"].(string)
+	identityHash, _ := claim["identityHash"].(string)
+	return kcptoolsv1alpha1.PermissionClaim{Group: group, Resource: resource, IdentityHash: identityHash}
+}
+
+func conditionTrue(obj unstructured.Unstructured, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType {
+			return condition["status"] == string(metav1.ConditionTrue)
+		}
+	}
+	return false
+}
+
+func objectName(obj unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// setWorkspaceManifestsStatus records the outcome of applying the workspace manifests and the state of the
+// APIBindings in the status of pc. The status is only written when it changes.
+func (r *PolicyControlReconciler) setWorkspaceManifestsStatus(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	pending []string,
+	bindings []kcptoolsv1alpha1.APIBindingStatus,
+	applyErr error,
+) error {
+	applied := metav1.Condition{
+		Type:    ConditionTypeWorkspaceManifestsApplied,
+		Status:  metav1.ConditionTrue,
+		Reason:  ConditionReasonApplied,
+		Message: "all workspace manifests are applied and ready",
+	}
+	switch {
+	case applyErr != nil:
+		applied.Status = metav1.ConditionFalse
+		applied.Reason = ConditionReasonApplyFailed
+		applied.Message = applyErr.Error()
+	case len(pending) > 0:
+		applied.Status = metav1.ConditionFalse
+		applied.Reason = ConditionReasonPending
+		applied.Message = "pending: " + strings.Join(pending, ", ")
+	}
+
+	bound := metav1.Condition{
+		Type:    ConditionTypeAPIBindingsReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  ConditionReasonReady,
+		Message: "all APIBindings are ready",
+	}
+	var notReady, unaccepted []string
+	for _, b := range bindings {
+		if !b.Ready {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", b.Name, b.Message))
+		}
+		for _, claim := range b.UnacceptedPermissionClaims {
+			unaccepted = append(unaccepted, fmt.Sprintf("%s: %s.%s", b.Name, claim.Resource, claim.Group))
+		}
+	}
+	switch {
+	case len(unaccepted) > 0:
+		bound.Status = metav1.ConditionFalse
+		bound.Reason = ConditionReasonPermissionClaimsNotAccepted
+		bound.Message = "permission claims not accepted: " + strings.Join(unaccepted, ", ")
+		if len(notReady) > 0 {
+			bound.Message += "; not ready: " + strings.Join(notReady, ", ")
+		}
+	case len(notReady) > 0:
+		bound.Status = metav1.ConditionFalse
+		bound.Reason = ConditionReasonNotReady
+		bound.Message = "not ready: " + strings.Join(notReady, ", ")
+	}
+
+	if conditionUnchanged(pc.Status.Conditions, applied) && conditionUnchanged(pc.Status.Conditions, bound) &&
+		equality.Semantic.DeepEqual(pc.Status.APIBindings, bindings) {
+		return nil
+	}
+	base := pc.DeepCopy()
+	meta.SetStatusCondition(&pc.Status.Conditions, applied)
+	meta.SetStatusCondition(&pc.Status.Conditions, bound)
+	pc.Status.APIBindings = bindings
+	if err := r.patchStatus(ctx, pc, base); err != nil {
+		logger.Error(err, "failed to update status")
+		return err
+	}
+	return nil
+}
+
+func conditionUnchanged(conditions []metav1.Condition, condition metav1.Condition) bool {
+	current := meta.FindStatusCondition(conditions, condition.Type)
+	return current != nil && current.Status == condition.Status && current.Reason == condition.Reason &&
+		current.Message == condition.Message
+}
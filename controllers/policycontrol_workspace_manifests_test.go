@@ -0,0 +1,145 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
+)
+
+var _ = Describe("Workspace manifests", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+	})
+
+	It("requeues instead of waiting while the APIs of a stage are not served", func() {
+		export := env.kcp.get(testProviderWorkspace, apiExportResource, "", "kubernetes")
+		env.kcp.delete(testProviderWorkspace, apiExportResource, "", "kubernetes")
+
+		start := time.Now()
+		result := env.reconcile(pc)
+		Expect(time.Since(start)).To(BeNumerically("<", workspaceAPIsRequeueAfter))
+		Expect(result.RequeueAfter).To(Equal(workspaceAPIsRequeueAfter))
+
+		By("reporting the binding and the later stages as pending")
+		applied := meta.FindStatusCondition(env.latest(pc).Status.Conditions, ConditionTypeWorkspaceManifestsApplied)
+		Expect(applied).NotTo(BeNil())
+		Expect(applied.Status).To(Equal(metav1.ConditionFalse))
+		Expect(applied.Reason).To(Equal(ConditionReasonPending))
+		Expect(applied.Message).To(ContainSubstring("APIBinding kyverno-required-resources (InitialBindingCompleted: APIExportNotFound"))
+		Expect(applied.Message).To(ContainSubstring("(not applied yet)"))
+		Expect(env.kcp.list("root:edge1", clusterRoleGVR)).To(BeEmpty())
+		err := env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &appsv1.Deployment{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		By("applying the later stages once the APIs are served")
+		unstructured.RemoveNestedField(export.Object, "metadata", "resourceVersion")
+		env.kcp.create(testProviderWorkspace, apiExportResource, export)
+		Expect(env.reconcile(pc).RequeueAfter).To(Equal(edgeClustersRefreshInterval))
+		Expect(meta.IsStatusConditionTrue(env.latest(pc).Status.Conditions, ConditionTypeWorkspaceManifestsApplied)).To(BeTrue())
+		Expect(env.kcp.list("root:edge1", clusterRoleGVR)).NotTo(BeEmpty())
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "root--edge1"}, &appsv1.Deployment{})).To(Succeed())
+	})
+
+	It("requeues while workspace manifests are not ready yet", func() {
+		ms, err := manifests.Kyverno("", "")
+		Expect(err).NotTo(HaveOccurred())
+		dir := GinkgoT().TempDir()
+		for _, m := range ms {
+			Expect(os.WriteFile(filepath.Join(dir, m.Name), m.Data, 0o644)).To(Succeed())
+		}
+		Expect(os.WriteFile(filepath.Join(dir, "zz-deployment.yaml"), []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kyverno-helper
+  namespace: kyverno
+spec:
+  replicas: 1
+`), 0o644)).To(Succeed())
+		defer func(dir string) { WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR = dir }(WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR)
+		WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR = dir
+
+		Expect(env.reconcile(pc).RequeueAfter).To(Equal(workspaceManifestsRequeueAfter))
+		applied := meta.FindStatusCondition(env.latest(pc).Status.Conditions, ConditionTypeWorkspaceManifestsApplied)
+		Expect(applied).NotTo(BeNil())
+		Expect(applied.Reason).To(Equal(ConditionReasonPending))
+		Expect(applied.Message).To(ContainSubstring("kyverno-helper"))
+
+		By("waiting for the next refresh once everything is ready")
+		env.kcp.update("root:edge1", deploymentsAPI.GroupVersionResource, "kyverno", "kyverno-helper", func(obj *unstructured.Unstructured) {
+			Expect(unstructured.SetNestedField(obj.Object, int64(1), "status", "readyReplicas")).To(Succeed())
+		})
+		Expect(env.reconcile(pc).RequeueAfter).To(Equal(edgeClustersRefreshInterval))
+		Expect(meta.IsStatusConditionTrue(env.latest(pc).Status.Conditions, ConditionTypeWorkspaceManifestsApplied)).To(BeTrue())
+	})
+
+	It("installs the embedded Kyverno manifests of the selected version", func() {
+		pc.Spec.KyvernoInWorkspace.KyvernoVersion = manifests.DefaultKyvernoVersion
+		Expect(env.pcc.Update(env.ctx, pc)).To(Succeed())
+		env.reconcile(pc)
+
+		ms, err := manifests.Kyverno(manifests.DefaultKyvernoVersion, "")
+		Expect(err).NotTo(HaveOccurred())
+		var want []string
+		for _, m := range ms {
+			objs, err := m.Objects()
+			Expect(err).NotTo(HaveOccurred())
+			for _, obj := range objs {
+				if obj.GetKind() == "ClusterRole" {
+					want = append(want, obj.GetName())
+				}
+			}
+		}
+		Expect(want).NotTo(BeEmpty())
+		var got []string
+		for _, obj := range env.kcp.list("root:edge1", clusterRoleGVR) {
+			got = append(got, obj.GetName())
+		}
+		Expect(got).To(ContainElements(want))
+	})
+
+	It("reports an unknown Kyverno version without installing anything", func() {
+		pc.Spec.KyvernoInWorkspace.KyvernoVersion = "v0.1"
+		Expect(env.pcc.Update(env.ctx, pc)).To(Succeed())
+		_, err := env.reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pc)})
+		Expect(err).To(MatchError(ContainSubstring("unknown Kyverno version v0.1")))
+		Expect(drainEvents(env.recorder)).To(ContainElement(ContainSubstring("unknown Kyverno version v0.1")))
+		Expect(env.kcp.list("root:edge1", clusterRoleGVR)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,144 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+)
+
+// assignWorkspaceName chooses the name of the workspace of pc in the Policy Control Cluster and keeps it in
+// status.workspaceName, so that the objects named after the workspace are not renamed when the normalization
+// changes. The objects of PolicyControls created before the name was recorded keep the legacy name they were
+// created with. The name is rejected while it is owned by a different workspace: claimed by another
+// PolicyControl, or recorded on an existing standalone Kyverno Service or isolated namespace.
+func (r *PolicyControlReconciler) assignWorkspaceName(
+	ctx context.Context,
+	logger logr.Logger,
+	pc *kcptoolsv1alpha1.PolicyControl,
+) error {
+	if pc.Status.WorkspaceName != "" {
+		return nil
+	}
+	name := naming.Workspace(pc.Spec.Workspace)
+	legacy, err := r.legacyWorkspaceName(ctx, pc)
+	if err != nil {
+		return err
+	}
+	if legacy != "" {
+		logger.V(4).Info(fmt.Sprintf("keep the legacy name %s of workspace %s its objects were created with", legacy, pc.Spec.Workspace))
+		name = legacy
+	}
+
+	owner, err := r.workspaceNameOwner(ctx, pc, name)
+	if err != nil {
+		return err
+	}
+	if owner != "" {
+		err := fmt.Errorf("name %s of workspace %s is already used for %s", name, pc.Spec.Workspace, owner)
+		logger.Error(err, "workspace name conflict")
+		r.Recorder.Eventf(pc, corev1.EventTypeWarning, EventReasonWorkspaceNameConflict, "%s", err.Error())
+		return err
+	}
+
+	logger.V(4).Info(fmt.Sprintf("assign name %s to workspace %s", name, pc.Spec.Workspace))
+	base := pc.DeepCopy()
+	pc.Status.WorkspaceName = name
+	if err := r.patchStatus(ctx, pc, base); err != nil {
+		logger.Error(err, "failed to update status")
+		return err
+	}
+	return nil
+}
+
+// legacyWorkspaceName returns the name the workspace of pc was given before the normalization of naming.Workspace,
+// when it differs and the standalone Kyverno or the isolated namespace of the workspace exist under it, or "". The
+// objects recorded for another workspace normalized to the same legacy name are not adopted.
+func (r *PolicyControlReconciler) legacyWorkspaceName(ctx context.Context, pc *kcptoolsv1alpha1.PolicyControl) (string, error) {
+	legacy := strings.ReplaceAll(pc.Spec.Workspace, ":", "--")
+	// a name that is not a valid Service name never had objects created under it
+	if legacy == naming.Workspace(pc.Spec.Workspace) || len(validation.IsDNS1035Label(legacy)) != 0 {
+		return "", nil
+	}
+	namespace := pc.Spec.PolicyControlCluster.Namespace
+	for _, obj := range []client.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: legacy}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: legacy}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: legacy}},
+	} {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if owner, ok := obj.GetAnnotations()[naming.WorkspaceAnnotation]; ok && owner != pc.Spec.Workspace {
+			continue
+		}
+		return legacy, nil
+	}
+	return "", nil
+}
+
+// workspaceNameOwner returns what already uses name for another workspace than the one of pc, or "" if nothing does.
+// The objects created before the name was recorded on them are not owned by any workspace.
+func (r *PolicyControlReconciler) workspaceNameOwner(
+	ctx context.Context,
+	pc *kcptoolsv1alpha1.PolicyControl,
+	name string,
+) (string, error) {
+	var pcs kcptoolsv1alpha1.PolicyControlList
+	if err := r.List(ctx, &pcs); err != nil {
+		return "", err
+	}
+	for _, other := range pcs.Items {
+		if other.Status.WorkspaceName == name && other.Spec.Workspace != pc.Spec.Workspace {
+			return fmt.Sprintf("workspace %s of PolicyControl %s/%s", other.Spec.Workspace, other.Namespace, other.Name), nil
+		}
+	}
+
+	owners := []struct {
+		kind string
+		obj  client.Object
+	}{
+		{"Service", &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: pc.Spec.PolicyControlCluster.Namespace, Name: name}}},
+		{"Namespace", &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}},
+	}
+	for _, owner := range owners {
+		kind, obj := owner.kind, owner.obj
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if workspace, ok := obj.GetAnnotations()[naming.WorkspaceAnnotation]; ok && workspace != pc.Spec.Workspace {
+			return fmt.Sprintf("workspace %s by %s %s", workspace, kind, client.ObjectKeyFromObject(obj)), nil
+		}
+	}
+	return "", nil
+}
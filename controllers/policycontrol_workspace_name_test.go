@@ -0,0 +1,129 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+)
+
+var _ = Describe("Workspace name", func() {
+	var (
+		env *policyControlEnv
+		pc  *kcptoolsv1alpha1.PolicyControl
+	)
+
+	BeforeEach(func() {
+		env = newPolicyControlEnv()
+		pc = newTestPolicyControl("pccr-edge1", "root:edge1")
+		Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+	})
+
+	It("keeps the name chosen for the workspace and rejects names owned by another workspace", func() {
+		live := env.latest(pc)
+		live.Status.WorkspaceName = "edge1-legacy"
+		Expect(env.pcc.Status().Update(env.ctx, live)).To(Succeed())
+		env.reconcile(pc)
+		Expect(env.latest(pc).Status.WorkspaceName).To(Equal("edge1-legacy"))
+		Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: "edge1-legacy"}, &appsv1.Deployment{})).To(Succeed())
+		Expect(env.ingressPaths()).To(HaveKeyWithValue("/edge1-legacy(/|$)(.*)", "edge1-legacy"))
+
+		By("rejecting a name claimed by the PolicyControl of another workspace")
+		claimed := newTestPolicyControl("pccr-claimed", "root:edge2-old")
+		Expect(env.pcc.Create(env.ctx, claimed)).To(Succeed())
+		claimed.Status.WorkspaceName = "root--edge2"
+		Expect(env.pcc.Status().Update(env.ctx, claimed)).To(Succeed())
+		other := newTestPolicyControl("pccr-edge2", "root:edge2")
+		Expect(env.pcc.Create(env.ctx, other)).To(Succeed())
+		_, err := env.reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(other)})
+		Expect(err).To(MatchError(ContainSubstring("already used for workspace root:edge2-old")))
+		Expect(env.latest(other).Status.WorkspaceName).To(BeEmpty())
+		Expect(drainEvents(env.recorder)).To(ContainElement(ContainSubstring(EventReasonWorkspaceNameConflict)))
+
+		By("rejecting a name recorded on the Service of another workspace")
+		Expect(env.pcc.Delete(env.ctx, env.latest(claimed))).To(Succeed())
+		Expect(env.pcc.Create(env.ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   testNamespace,
+			Name:        "root--edge2",
+			Annotations: map[string]string{naming.WorkspaceAnnotation: "root:edge2-old"},
+		}})).To(Succeed())
+		_, err = env.reconciler.Reconcile(env.ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(other)})
+		Expect(err).To(MatchError(ContainSubstring("already used for workspace root:edge2-old by Service")))
+		Expect(env.kcp.commands).NotTo(ContainElement(ContainSubstring("root:edge2")))
+	})
+
+	Context("of a workspace whose legacy name is no longer its normalized name", func() {
+		const (
+			workspace = "root:a--b"
+			legacy    = "root--a--b"
+		)
+		var hashed = naming.Workspace(workspace)
+
+		BeforeEach(func() {
+			env.kcp.addWorkspace(workspace, operatorGroupsAPI, subscriptionsAPI, kyvernoesAPI)
+			pc = newTestPolicyControl("pccr-a-b", workspace)
+			Expect(env.pcc.Create(env.ctx, pc)).To(Succeed())
+		})
+
+		It("keeps the legacy name when the Kyverno of the workspace exists under it", func() {
+			Expect(env.pcc.Create(env.ctx, &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: legacy},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": legacy}},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": legacy}},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "kyverno", Image: "kyverno"}}},
+					},
+				},
+			})).To(Succeed())
+			env.reconcile(pc)
+
+			Expect(env.latest(pc).Status.WorkspaceName).To(Equal(legacy))
+			Expect(env.ingressPaths()).To(HaveKeyWithValue(naming.IngressPath(legacy), legacy))
+			err := env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: hashed}, &appsv1.Deployment{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("uses the normalized name when nothing exists under the legacy name", func() {
+			env.reconcile(pc)
+
+			Expect(env.latest(pc).Status.WorkspaceName).To(Equal(hashed))
+			Expect(env.pcc.Get(env.ctx, client.ObjectKey{Namespace: testNamespace, Name: hashed}, &appsv1.Deployment{})).To(Succeed())
+		})
+
+		It("leaves the legacy name to the workspace its objects were recorded for", func() {
+			Expect(env.pcc.Create(env.ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   testNamespace,
+				Name:        legacy,
+				Annotations: map[string]string{naming.WorkspaceAnnotation: "root:a:b"},
+			}})).To(Succeed())
+			env.reconcile(pc)
+
+			Expect(env.latest(pc).Status.WorkspaceName).To(Equal(hashed))
+		})
+	})
+})
@@ -0,0 +1,154 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+
+	kcptoolsv1alpha1 "github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+const (
+	tracerName         = "github.com/IBM/policy-control-operator/controllers"
+	defaultServiceName = "policy-control-operator"
+)
+
+var tracer = otel.Tracer(tracerName)
+
+// SetupTracing installs a global TracerProvider exporting spans with OTLP/HTTP. The exporter is configured by the
+// OTEL_EXPORTER_OTLP_* environment variables, e.g. OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// and OTEL_EXPORTER_OTLP_HEADERS. Tracing stays disabled when no endpoint is set.
+// The returned function flushes the pending spans and has to be called before the process exits.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(getEnv("OTEL_SERVICE_NAME", defaultServiceName)),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// WrapTransportForTracing makes every request sent with config a child span of the span in its context.
+func WrapTransportForTracing(config *rest.Config) *rest.Config {
+	if config != nil {
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &tracingRoundTripper{next: rt}
+		})
+	}
+	return config
+}
+
+type tracingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t *tracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests sent outside of a reconcile, e.g. by informers, are not traced
+	if !trace.SpanContextFromContext(req.Context()).IsValid() {
+		return t.next.RoundTrip(req)
+	}
+	ctx, span := tracer.Start(req.Context(), fmt.Sprintf("HTTP %s", req.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPURLKey.String(req.URL.String()),
+			semconv.NetPeerNameKey.String(req.URL.Hostname()),
+		),
+	)
+	defer span.End()
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// policyControlAttributes tags a span with the PolicyControl and the workspace it manages.
+func policyControlAttributes(pc kcptoolsv1alpha1.PolicyControl) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("policycontrol.namespace", pc.GetNamespace()),
+		attribute.String("policycontrol.name", pc.GetName()),
+		attribute.String("kcp.workspace", pc.Spec.Workspace),
+	)
+}
+
+// startReconcilePhase starts the span of a reconcile phase. The returned function ends it and
+// records the duration of the phase in the reconcilePhaseDuration histogram.
+func startReconcilePhase(ctx context.Context, phase string, pc kcptoolsv1alpha1.PolicyControl) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, phase, policyControlAttributes(pc))
+	return ctx, func(err error) {
+		observeReconcilePhase(phase, start, err)
+		endSpan(span, err)
+	}
+}
+
+// startKcpSpan starts a span for a call to kcp on behalf of the given workspace.
+func startKcpSpan(ctx context.Context, name string, workspace string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("kcp.workspace", workspace)),
+	)
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,119 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpReceiver records the trace export requests sent to it.
+type otlpReceiver struct {
+	mu       sync.Mutex
+	headers  []http.Header
+	requests []*coltracepb.ExportTraceServiceRequest
+}
+
+func (o *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	defer GinkgoRecover()
+	Expect(req.URL.Path).To(Equal("/v1/traces"))
+	body, err := io.ReadAll(req.Body)
+	Expect(err).NotTo(HaveOccurred())
+	var export coltracepb.ExportTraceServiceRequest
+	Expect(proto.Unmarshal(body, &export)).To(Succeed())
+	o.mu.Lock()
+	o.headers = append(o.headers, req.Header.Clone())
+	o.requests = append(o.requests, &export)
+	o.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write([]byte{})
+}
+
+// setEnv sets the environment variable for the current spec.
+func setEnv(key, value string) {
+	previous, found := os.LookupEnv(key)
+	Expect(os.Setenv(key, value)).To(Succeed())
+	DeferCleanup(func() {
+		if found {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+var _ = Describe("Tracing", func() {
+	BeforeEach(func() {
+		provider := otel.GetTracerProvider()
+		DeferCleanup(func() { otel.SetTracerProvider(provider) })
+		for _, key := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_HEADERS"} {
+			setEnv(key, "")
+		}
+	})
+
+	It("stays disabled without an endpoint", func() {
+		provider := otel.GetTracerProvider()
+		shutdown, err := SetupTracing(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(otel.GetTracerProvider()).To(BeIdenticalTo(provider))
+		Expect(shutdown(context.Background())).To(Succeed())
+	})
+
+	It("exports the spans with OTLP/HTTP to the endpoint of the environment", func() {
+		receiver := &otlpReceiver{}
+		server := httptest.NewServer(receiver)
+		DeferCleanup(server.Close)
+		setEnv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL)
+		setEnv("OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer collector-token")
+		setEnv("OTEL_SERVICE_NAME", "pco-test")
+
+		shutdown, err := SetupTracing(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		_, span := otel.GetTracerProvider().Tracer(tracerName).Start(context.Background(), phaseProbeWebhook)
+		span.End()
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		Expect(receiver.requests).To(HaveLen(1))
+		Expect(receiver.headers[0].Get("Authorization")).To(Equal("Bearer collector-token"))
+		Expect(receiver.headers[0].Get("Content-Type")).To(Equal("application/x-protobuf"))
+		resourceSpans := receiver.requests[0].GetResourceSpans()
+		Expect(resourceSpans).To(HaveLen(1))
+		var service string
+		for _, kv := range resourceSpans[0].GetResource().GetAttributes() {
+			if kv.GetKey() == "service.name" {
+				service = kv.GetValue().GetStringValue()
+			}
+		}
+		Expect(service).To(Equal("pco-test"))
+		spans := resourceSpans[0].GetScopeSpans()[0].GetSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].GetName()).To(Equal(phaseProbeWebhook))
+	})
+})
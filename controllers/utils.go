@@ -17,11 +17,11 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 
-	"github.com/ghodss/yaml"
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -45,7 +45,7 @@ func getInClusterConfig() (*rest.Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	return config, nil
+	return WrapTransportForTracing(config), nil
 }
 
 func getOutOfClusterConfig() (*rest.Config, error) {
@@ -53,20 +53,38 @@ func getOutOfClusterConfig() (*rest.Config, error) {
 	return getClusterConfigFromFile(kubeconfigPath)
 }
 
+// getPCOClusterConfig returns the config of the Policy Control Cluster the operator runs in.
+func getPCOClusterConfig() (*rest.Config, error) {
+	config, err := getInClusterConfig()
+	if err != nil || config == nil {
+		return getOutOfClusterConfig()
+	}
+	return config, nil
+}
+
 func getClusterConfigFromFile(kubeconfigPath string) (*rest.Config, error) {
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
 		return nil, err
 	}
-	return config, nil
+	return WrapTransportForTracing(config), nil
+}
+
+// runKcpCommand runs a kubectl kcp command line with the shell and returns its standard output.
+// Tests replace it to stand in for kcp.
+var runKcpCommand = func(ctx context.Context, command string) ([]byte, error) {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command).Output()
 }
 
 // KUBECONFIG=$KUBECONFIG_KCP_ADMIN kubectl kcp ws use $workspace
-func switchWorkspace(kcpKubeConfig string, workspace string, logger logr.Logger) {
+func switchWorkspace(ctx context.Context, kcpKubeConfig string, workspace string, logger logr.Logger) {
+	ctx, span := startKcpSpan(ctx, "kubectl kcp ws use", workspace)
 	command := fmt.Sprintf("KUBECONFIG=%s kubectl kcp ws use %s", kcpKubeConfig, workspace)
 	logger.V(4).Info(command)
-	result, err := exec.Command("/bin/sh", "-c", command).Output()
+	result, err := runKcpCommand(ctx, command)
+	endSpan(span, err)
 	if err != nil {
+		kcpFailures.WithLabelValues(kcpOperationSwitchWorkspace).Inc()
 		logger.Error(err, "Failed to switch workspace")
 
 	}
@@ -74,36 +92,51 @@ func switchWorkspace(kcpKubeConfig string, workspace string, logger logr.Logger)
 }
 
 // KUBECONFIG=$KUBECONFIG_KCP_ADMIN kubectl kcp workload sync $PG_CLUSTER --syncer-image $syncer_image -o $kustomize_dir/syncer.yaml --resources=kyvernoes,policies
-func syncWorkspace(kcpKubeConfig string, workspace string, targetCluster string, syncerImage string, logger logr.Logger) (string, error) {
-	switchWorkspace(kcpKubeConfig, workspace, logger)
+func syncWorkspace(ctx context.Context, kcpKubeConfig string, workspace string, targetCluster string, syncerImage string, logger logr.Logger) (string, error) {
+	switchWorkspace(ctx, kcpKubeConfig, workspace, logger)
+	ctx, span := startKcpSpan(ctx, "kubectl kcp workload sync", workspace)
 	command := fmt.Sprintf("KUBECONFIG=%s kubectl kcp workload sync %s --syncer-image %s -o - --resources=kyvernoes,policies", kcpKubeConfig, targetCluster, syncerImage)
 	logger.V(4).Info(command)
-	result, err := exec.Command("/bin/sh", "-c", command).Output()
+	result, err := runKcpCommand(ctx, command)
+	endSpan(span, err)
+	if err != nil {
+		kcpFailures.WithLabelValues(kcpOperationSyncWorkspace).Inc()
+	}
 	return string(result), err
 }
 
-func getWorkspaceKubeConfig(kcpKubeConfig string, workspace string, logger logr.Logger) (string, error) {
-	switchWorkspace(kcpKubeConfig, workspace, logger)
+func getWorkspaceKubeConfig(ctx context.Context, kcpKubeConfig string, workspace string, logger logr.Logger) (string, error) {
+	switchWorkspace(ctx, kcpKubeConfig, workspace, logger)
+	ctx, span := startKcpSpan(ctx, "kubectl config view", workspace)
 	command := fmt.Sprintf("KUBECONFIG=%s kubectl config view --minify --raw", kcpKubeConfig)
 	logger.V(4).Info(command)
-	result, err := exec.Command("/bin/sh", "-c", command).Output()
+	result, err := runKcpCommand(ctx, command)
+	endSpan(span, err)
+	if err != nil {
+		kcpFailures.WithLabelValues(kcpOperationGetKubeConfig).Inc()
+	}
 	return string(result), err
 }
 
 func getWorkspaceConfigs(
+	ctx context.Context,
 	kcpKubeConfig string,
 	workspace string,
 	logger logr.Logger,
 ) (*rest.Config, meta.RESTMapper, error) {
-	switchWorkspace(kcpKubeConfig, workspace, logger)
+	switchWorkspace(ctx, kcpKubeConfig, workspace, logger)
 	config, err := getClusterConfigFromFile(kcpKubeConfig)
 	if err != nil {
+		kcpFailures.WithLabelValues(kcpOperationGetKubeConfig).Inc()
 		return nil, nil, err
 	}
 
+	_, span := startKcpSpan(ctx, "discovery", workspace)
 	c := discovery.NewDiscoveryClientForConfigOrDie(config)
 	groupResources, err := restmapper.GetAPIGroupResources(c)
+	endSpan(span, err)
 	if err != nil {
+		kcpFailures.WithLabelValues(kcpOperationDiscovery).Inc()
 		return nil, nil, err
 	}
 
@@ -111,23 +144,6 @@ func getWorkspaceConfigs(
 	return config, mapper, nil
 }
 
-func getUnstructuredFromFile(
-	logger logr.Logger,
-	path string,
-	restMapper meta.RESTMapper,
-) (unstructured.Unstructured, *meta.RESTMapping, error) {
-	var obj unstructured.Unstructured
-	objBytes, err := os.ReadFile(path)
-	if err != nil {
-		return obj, nil, err
-	}
-	if err := yaml.Unmarshal(objBytes, &obj); err != nil {
-		return obj, nil, err
-	}
-	mapping, err := getMapping(logger, obj, restMapper)
-	return obj, mapping, err
-}
-
 func getMapping(
 	logger logr.Logger,
 	obj unstructured.Unstructured,
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -27,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -52,11 +54,22 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var apiExportKubeConfig, apiExportWorkspace, apiExportName, apiExportTemplate, apiExportNamespace string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&apiExportKubeConfig, "apiexport-kubeconfig", "",
+		"Kubeconfig of kcp. Setting it serves the PolicyControls created in the workspaces binding the APIExport "+
+			"of PolicyControl, see --apiexport-workspace and --apiexport-name.")
+	flag.StringVar(&apiExportWorkspace, "apiexport-workspace", "root:policy-control-cluster",
+		"Workspace the APIExport of PolicyControl is created in.")
+	flag.StringVar(&apiExportName, "apiexport-name", "policycontrols.ibm.github.com", "Name of the APIExport of PolicyControl.")
+	flag.StringVar(&apiExportTemplate, "apiexport-template", "",
+		"PolicyControlTemplate providing the Policy Control Cluster settings of the PolicyControls of the workspaces.")
+	flag.StringVar(&apiExportNamespace, "apiexport-namespace", "",
+		"Namespace the PolicyControls of the workspaces are mirrored to.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,7 +78,18 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if err := controllers.CheckManifestOverrides(); err != nil {
+		setupLog.Error(err, "invalid workspace manifests override")
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := controllers.SetupTracing(context.Background())
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(controllers.WrapTransportForTracing(ctrl.GetConfigOrDie()), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
@@ -90,14 +114,53 @@ func main() {
 	}
 
 	if err = (&controllers.PolicyControlReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("policycontrol-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PolicyControl")
+		os.Exit(1)
+	}
+	if err = (&controllers.PolicyBundleReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "PolicyControl")
+		setupLog.Error(err, "unable to create controller", "controller", "PolicyBundle")
+		os.Exit(1)
+	}
+	if err = (&controllers.ComplianceSummaryReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ComplianceSummary")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
+	if apiExportKubeConfig != "" {
+		if apiExportTemplate == "" || apiExportNamespace == "" {
+			setupLog.Error(nil, "--apiexport-template and --apiexport-namespace are required with --apiexport-kubeconfig")
+			os.Exit(1)
+		}
+		kcpConfig, err := clientcmd.BuildConfigFromFlags("", apiExportKubeConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to load kcp kubeconfig")
+			os.Exit(1)
+		}
+		if err := (&controllers.VirtualWorkspaceSyncer{
+			Client:          mgr.GetClient(),
+			KcpConfig:       controllers.WrapTransportForTracing(kcpConfig),
+			ExportWorkspace: apiExportWorkspace,
+			ExportName:      apiExportName,
+			Template:        apiExportTemplate,
+			Namespace:       apiExportNamespace,
+			Logger:          ctrl.Log.WithName("virtualworkspace"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "VirtualWorkspaceSyncer")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -112,4 +175,7 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "failed to flush traces")
+	}
 }
@@ -0,0 +1,98 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package manifests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// Objects decodes the objects of the manifest, see Decode.
+func (m Manifest) Objects() ([]unstructured.Unstructured, error) {
+	objs, err := Decode(m.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %w", m.Name, err)
+	}
+	return objs, nil
+}
+
+// Decode returns the objects of a YAML or JSON stream in order.
+// Documents are split at "---" separator lines only, empty documents are skipped
+// and the items of List kinds such as v1/List are returned in place of the list.
+func Decode(data []byte) ([]unstructured.Unstructured, error) {
+	var objs []unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for i := 0; ; i++ {
+		var obj unstructured.Unstructured
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("document %d: apiVersion and kind are required", i)
+		}
+		if !obj.IsList() {
+			objs = append(objs, obj)
+			continue
+		}
+		if err := obj.EachListItem(func(item runtime.Object) error {
+			objs = append(objs, *item.(*unstructured.Unstructured))
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+}
+
+// IsKustomization tells whether dir is a kustomize directory.
+func IsKustomization(dir string) bool {
+	for _, name := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Kustomize builds the kustomize directory dir into a single manifest.
+func Kustomize(dir string) (Manifest, error) {
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resMap, err := k.Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to build kustomization %s: %w", dir, err)
+	}
+	data, err := resMap.AsYaml()
+	if err != nil {
+		return Manifest{}, err
+	}
+	return Manifest{Name: filepath.Base(dir) + "/kustomization", Data: data}, nil
+}
@@ -0,0 +1,239 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package manifests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// names returns the objects as "<kind>/<name>".
+func names(objs []unstructured.Unstructured) []string {
+	var names []string
+	for _, obj := range objs {
+		names = append(names, obj.GetKind()+"/"+obj.GetName())
+	}
+	return names
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "multi-document stream",
+			data: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: b
+`,
+			want: []string{"ConfigMap/a", "Secret/b"},
+		},
+		{
+			name: "separator inside a value",
+			data: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  inline: a --- b
+  script: |
+    echo
+    ---
+    done
+`,
+			want: []string{"ConfigMap/a"},
+		},
+		{
+			name: "List kind",
+			data: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: b
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: c
+`,
+			want: []string{"ConfigMap/a", "Secret/b", "ConfigMap/c"},
+		},
+		{
+			name: "empty documents",
+			data: `---
+---
+# only a comment
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+`,
+			want: []string{"ConfigMap/a"},
+		},
+		{
+			name: "JSON",
+			data: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}`,
+			want: []string{"ConfigMap/a"},
+		},
+		{
+			name: "empty stream",
+			data: "",
+		},
+		{
+			name: "document without kind",
+			data: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+apiVersion: v1
+metadata:
+  name: b
+`,
+			wantErr: "document 1: apiVersion and kind are required",
+		},
+		{
+			name:    "invalid document",
+			data:    "kind: [",
+			wantErr: "document 0:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := Decode([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got := names(objs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeKeepsValues(t *testing.T) {
+	objs, err := Decode([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  script: |
+    echo
+    ---
+    done
+`))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got, _, _ := unstructured.NestedString(objs[0].Object, "data", "script"); got != "echo\n---\ndone\n" {
+		t.Errorf("data.script = %q, want %q", got, "echo\n---\ndone\n")
+	}
+}
+
+func TestKustomize(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "overlay")
+	files := map[string]string{
+		"kustomization.yaml": `resources:
+- configmap.yaml
+namePrefix: tenant-
+commonLabels:
+  app: kyverno
+`,
+		"configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: b
+`,
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if IsKustomization(dir) {
+		t.Errorf("IsKustomization() of an empty directory = true")
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !IsKustomization(dir) {
+		t.Fatalf("IsKustomization() = false")
+	}
+
+	m, err := Kustomize(dir)
+	if err != nil {
+		t.Fatalf("Kustomize() error = %v", err)
+	}
+	if m.Name != "overlay/kustomization" {
+		t.Errorf("Kustomize() name = %q, want %q", m.Name, "overlay/kustomization")
+	}
+	objs, err := m.Objects()
+	if err != nil {
+		t.Fatalf("Objects() error = %v", err)
+	}
+	if got, want := names(objs), []string{"ConfigMap/tenant-a", "Secret/tenant-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Objects() = %v, want %v", got, want)
+	}
+	for _, obj := range objs {
+		if obj.GetLabels()["app"] != "kyverno" {
+			t.Errorf("labels of %s = %v, want app=kyverno", obj.GetName(), obj.GetLabels())
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, "configmap.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Kustomize(dir); err == nil || !strings.Contains(err.Error(), "failed to build kustomization") {
+		t.Errorf("Kustomize() of a missing resource error = %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package manifests embeds the Kyverno manifests the operator installs into every workspace,
+// one bundle per supported Kyverno version under kyverno/<version>.
+package manifests
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultKyvernoVersion is the Kyverno bundle installed when a PolicyControl does not select one.
+const DefaultKyvernoVersion = "v1.8"
+
+//go:embed kyverno
+var embedded embed.FS
+
+// Manifest is a single YAML file of a bundle, holding one or more objects.
+type Manifest struct {
+	// Name of the file, for logs and events
+	Name string
+	Data []byte
+}
+
+// KyvernoVersions lists the embedded Kyverno bundles.
+func KyvernoVersions() []string {
+	entries, _ := embedded.ReadDir("kyverno")
+	versions := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			versions = append(versions, e.Name())
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Kyverno returns the Kyverno manifests of version, or those in overrideDir when it is set.
+// overrideDir is either a kustomize directory, which is built, or a directory of "*.yaml" files.
+// An override directory without any manifest is an error rather than installing nothing.
+func Kyverno(version string, overrideDir string) ([]Manifest, error) {
+	if overrideDir != "" && IsKustomization(overrideDir) {
+		m, err := Kustomize(overrideDir)
+		if err != nil {
+			return nil, err
+		}
+		return []Manifest{m}, nil
+	}
+	if overrideDir != "" {
+		files, err := filepath.Glob(filepath.Join(overrideDir, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("Kyverno manifests directory %s contains no *.yaml file", overrideDir)
+		}
+		manifests := make([]Manifest, 0, len(files))
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, Manifest{Name: filepath.Base(f), Data: data})
+		}
+		return manifests, nil
+	}
+
+	if version == "" {
+		version = DefaultKyvernoVersion
+	}
+	files, err := fs.Glob(embedded, path.Join("kyverno", version, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("unknown Kyverno version %s, supported versions are %s", version, strings.Join(KyvernoVersions(), ", "))
+	}
+	manifests := make([]Manifest, 0, len(files))
+	for _, f := range files {
+		data, err := embedded.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, Manifest{Name: path.Base(f), Data: data})
+	}
+	return manifests, nil
+}
+
+// APIBindings reads the manifest at path replacing the APIBinding built from the PolicyControl spec.
+func APIBindings(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return Manifest{Name: filepath.Base(path), Data: data}, nil
+}
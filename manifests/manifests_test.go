@@ -0,0 +1,168 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package manifests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files into a new directory and returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestKyvernoVersions(t *testing.T) {
+	versions := KyvernoVersions()
+	found := false
+	for _, v := range versions {
+		found = found || v == DefaultKyvernoVersion
+	}
+	if !found {
+		t.Errorf("KyvernoVersions() = %v, want it to hold the default version %s", versions, DefaultKyvernoVersion)
+	}
+}
+
+func TestKyverno(t *testing.T) {
+	configMap := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+`
+	tests := []struct {
+		name        string
+		version     string
+		overrideDir func(t *testing.T) string
+		// wantNames are file names that must be among the returned manifests
+		wantNames []string
+		wantCount int
+		wantErr   string
+	}{
+		{
+			name:      "default version",
+			wantNames: []string{"clusterpolicies.kyverno.io.yaml", "kyverno-service-account.yaml"},
+		},
+		{
+			name:      "explicit version",
+			version:   DefaultKyvernoVersion,
+			wantNames: []string{"clusterpolicies.kyverno.io.yaml", "kyverno-service-account.yaml"},
+		},
+		{
+			name:    "unknown version",
+			version: "v0.1",
+			wantErr: "unknown Kyverno version v0.1, supported versions are " + strings.Join(KyvernoVersions(), ", "),
+		},
+		{
+			name:    "override directory of manifests",
+			version: "v0.1",
+			overrideDir: func(t *testing.T) string {
+				return writeFiles(t, map[string]string{"a.yaml": configMap, "b.yaml": configMap, "README.md": "not a manifest"})
+			},
+			wantNames: []string{"a.yaml", "b.yaml"},
+			wantCount: 2,
+		},
+		{
+			name: "override kustomize directory",
+			overrideDir: func(t *testing.T) string {
+				return writeFiles(t, map[string]string{"kustomization.yaml": "resources:\n- a.yaml\n", "a.yaml": configMap})
+			},
+			wantCount: 1,
+		},
+		{
+			name: "empty override directory",
+			overrideDir: func(t *testing.T) string {
+				return writeFiles(t, map[string]string{"README.md": "not a manifest"})
+			},
+			wantErr: "contains no *.yaml file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := ""
+			if tt.overrideDir != nil {
+				dir = tt.overrideDir(t)
+			}
+			ms, err := Kyverno(tt.version, dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Kyverno() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Kyverno() error = %v", err)
+			}
+			if tt.wantCount != 0 && len(ms) != tt.wantCount {
+				t.Errorf("Kyverno() returned %d manifests, want %d", len(ms), tt.wantCount)
+			}
+			got := map[string]bool{}
+			for _, m := range ms {
+				if len(m.Data) == 0 {
+					t.Errorf("manifest %s is empty", m.Name)
+				}
+				got[m.Name] = true
+			}
+			for _, name := range tt.wantNames {
+				if !got[name] {
+					t.Errorf("Kyverno() lacks manifest %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestKyvernoEmbeddedManifestsDecode(t *testing.T) {
+	for _, version := range KyvernoVersions() {
+		ms, err := Kyverno(version, "")
+		if err != nil {
+			t.Fatalf("Kyverno(%s) error = %v", version, err)
+		}
+		for _, m := range ms {
+			objs, err := m.Objects()
+			if err != nil {
+				t.Errorf("manifest %s of %s does not decode: %v", m.Name, version, err)
+			}
+			if len(objs) == 0 {
+				t.Errorf("manifest %s of %s holds no object", m.Name, version)
+			}
+		}
+	}
+}
+
+func TestAPIBindings(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"apibindings.yaml": "kind: APIBinding\n"})
+	m, err := APIBindings(filepath.Join(dir, "apibindings.yaml"))
+	if err != nil {
+		t.Fatalf("APIBindings() error = %v", err)
+	}
+	if want := (Manifest{Name: "apibindings.yaml", Data: []byte("kind: APIBinding\n")}); !reflect.DeepEqual(m, want) {
+		t.Errorf("APIBindings() = %+v, want %+v", m, want)
+	}
+	if _, err := APIBindings(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("APIBindings() of a missing file succeeded")
+	}
+}
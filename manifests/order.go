@@ -0,0 +1,65 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package manifests
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Stages in which objects are applied, so that every object finds its dependencies in place.
+const (
+	StageNamespaces = iota
+	// CRDs and APIBindings make the resources served by the workspace available.
+	StageAPIs
+	StageRBACSubjects
+	StageRBACBindings
+	StageConfig
+	StageWorkloads
+)
+
+var stageOfKind = map[string]int{
+	"Namespace":                      StageNamespaces,
+	"CustomResourceDefinition":       StageAPIs,
+	"APIBinding":                     StageAPIs,
+	"ServiceAccount":                 StageRBACSubjects,
+	"ClusterRole":                    StageRBACSubjects,
+	"Role":                           StageRBACSubjects,
+	"ClusterRoleBinding":             StageRBACBindings,
+	"RoleBinding":                    StageRBACBindings,
+	"Deployment":                     StageWorkloads,
+	"StatefulSet":                    StageWorkloads,
+	"DaemonSet":                      StageWorkloads,
+	"Job":                            StageWorkloads,
+	"CronJob":                        StageWorkloads,
+	"MutatingWebhookConfiguration":   StageWorkloads,
+	"ValidatingWebhookConfiguration": StageWorkloads,
+}
+
+// Stage returns the stage obj is applied in. Kinds not listed are applied with the configuration.
+func Stage(obj unstructured.Unstructured) int {
+	if stage, ok := stageOfKind[obj.GetKind()]; ok {
+		return stage
+	}
+	return StageConfig
+}
+
+// SortByStage orders objs by stage, keeping the order of the objects within a stage.
+func SortByStage(objs []unstructured.Unstructured) {
+	sort.SliceStable(objs, func(i, j int) bool { return Stage(objs[i]) < Stage(objs[j]) })
+}
@@ -0,0 +1,130 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package naming defines the names of the objects the operator creates that other clusters and components depend
+// on: the ingress and the Kyverno instances of the Policy Control Cluster, the secrets Kyverno loads from the
+// workspaces, and the ingress path the webhooks of a workspace are called at. Changing any of them breaks the
+// installations made by earlier versions of the operator.
+package naming
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// IngressName is the Ingress of the Policy Control Cluster routing the path of every workspace to its Kyverno.
+	IngressName = "kyverno-ingress"
+	// IngressTLSSecretName is the secret of the Policy Control Cluster holding the key pair the ingress serves.
+	IngressTLSSecretName = "kyverno-ingress"
+	// IngressClassName is the class of the ingress controller serving IngressName.
+	IngressClassName = "nginx"
+
+	// KyvernoServiceName is the service name Kyverno registers its webhooks for (KYVERNO_SVC). Kyverno derives the
+	// names of the TLS secrets it loads from the workspace from it.
+	KyvernoServiceName = "kyverno-svc-remote"
+	// KyvernoTLSPairSecretName is the secret in the namespace for API resources of the workspace holding the key
+	// pair the Kyverno webhook server serves.
+	KyvernoTLSPairSecretName = KyvernoServiceName + ".kyverno.svc.kyverno-tls-pair"
+	// KyvernoTLSCASecretName is the secret in the namespace for API resources of the workspace holding the CA
+	// Kyverno sets in its webhook configurations, under KyvernoTLSCAKey.
+	KyvernoTLSCASecretName = KyvernoServiceName + ".kyverno.svc.kyverno-tls-ca"
+	KyvernoTLSCAKey        = "rootCA.crt"
+
+	// KubeConfigKey is the key of the workspace kubeconfig in the credentials secret of a standalone Kyverno.
+	KubeConfigKey = "target-kubeconfig.yaml"
+	// CredentialsVolumeName and CredentialsMountPath mount the credentials secret into the Kyverno container.
+	CredentialsVolumeName = "kyverno-runtime-credentials"
+	CredentialsMountPath  = "/tmp/kyverno-runtime-credentials"
+
+	// KyvernoContainerName is the container of the Kyverno Deployments.
+	KyvernoContainerName = "kyverno"
+	// KyvernoWebhookPort is the port the Kyverno webhook server listens on, the target port of its Service.
+	KyvernoWebhookPort = 9443
+
+	// AppLabel, WorkspaceLabel and ShardLabel select the pods of the Kyverno instances. AppLabel is always
+	// KyvernoAppLabelValue, WorkspaceLabel holds the normalized workspace of a standalone Kyverno and ShardLabel
+	// the name of a shared one.
+	AppLabel             = "app"
+	KyvernoAppLabelValue = "kyverno-controller"
+	WorkspaceLabel       = "workspace"
+	ShardLabel           = "kyverno-shard"
+
+	// WorkspaceAnnotation records the workspace a standalone Kyverno and its Service and credentials secret were
+	// created for, so that another workspace normalized to the same name is rejected.
+	WorkspaceAnnotation = "ibm.github.com/workspace"
+)
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// Workspace returns the normalized name of workspace used for the per-workspace objects of the Policy Control
+// Cluster and in the ingress path. It is the workspace path with ":" replaced by "--" when that is a valid DNS label
+// (as a Service name has to be) and cannot be produced by another path. Otherwise the path is lowercased, every run
+// of invalid characters is replaced by "-", and it is truncated to leave room for a "-" and the hash of the path.
+func Workspace(workspace string) string {
+	name := strings.ReplaceAll(workspace, ":", "--")
+	// "root:a--b" and "root:a:b" both give "root--a--b"
+	if len(validation.IsDNS1035Label(name)) == 0 && !strings.Contains(workspace, "--") {
+		return name
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(workspace))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.TrimLeft(name, "-0123456789")
+	if max := validation.DNS1035LabelMaxLength - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	name = strings.TrimRight(name, "-")
+	if name == "" {
+		name = "ws"
+	}
+	return name + suffix
+}
+
+// IngressPath returns the path of the ingress rule of the workspace normalized to name. The rewrite of the ingress
+// drops its first segment.
+func IngressPath(name string) string {
+	return fmt.Sprintf("/%s(/|$)(.*)", name)
+}
+
+// AdvertisedURL returns the address, without scheme, the webhooks of the workspace normalized to name call Kyverno
+// at through the ingress.
+func AdvertisedURL(ingressHost string, ingressPort int32, name string) string {
+	return fmt.Sprintf("%s/%s", AdvertisedURLPrefix(ingressHost, ingressPort), name)
+}
+
+// AdvertisedURLPrefix returns the address of the ingress shared Kyverno instances append the workspaces to.
+func AdvertisedURLPrefix(ingressHost string, ingressPort int32) string {
+	return fmt.Sprintf("%s:%d", ingressHost, ingressPort)
+}
+
+// ShardName returns the name of the Deployment, Service and kubeconfig bundle of the shared Kyverno index.
+func ShardName(index int32) string {
+	return fmt.Sprintf("kyverno-shard-%d", index)
+}
+
+// ShardBundleKey returns the key of the kubeconfig of the workspace normalized to name in the bundle of a shared
+// Kyverno.
+func ShardBundleKey(name string) string {
+	return name + ".yaml"
+}
@@ -0,0 +1,115 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package naming
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// The names are part of the contract with the Kyverno instances, the ingress and the workspaces installed by
+// earlier versions of the operator, so they are pinned literally.
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"IngressName", IngressName, "kyverno-ingress"},
+		{"IngressTLSSecretName", IngressTLSSecretName, "kyverno-ingress"},
+		{"IngressClassName", IngressClassName, "nginx"},
+		{"KyvernoServiceName", KyvernoServiceName, "kyverno-svc-remote"},
+		{"KyvernoTLSPairSecretName", KyvernoTLSPairSecretName, "kyverno-svc-remote.kyverno.svc.kyverno-tls-pair"},
+		{"KyvernoTLSCASecretName", KyvernoTLSCASecretName, "kyverno-svc-remote.kyverno.svc.kyverno-tls-ca"},
+		{"KyvernoTLSCAKey", KyvernoTLSCAKey, "rootCA.crt"},
+		{"KubeConfigKey", KubeConfigKey, "target-kubeconfig.yaml"},
+		{"CredentialsVolumeName", CredentialsVolumeName, "kyverno-runtime-credentials"},
+		{"CredentialsMountPath", CredentialsMountPath, "/tmp/kyverno-runtime-credentials"},
+		{"KyvernoContainerName", KyvernoContainerName, "kyverno"},
+		{"KyvernoWebhookPort", KyvernoWebhookPort, 9443},
+		{"AppLabel", AppLabel, "app"},
+		{"KyvernoAppLabelValue", KyvernoAppLabelValue, "kyverno-controller"},
+		{"WorkspaceLabel", WorkspaceLabel, "workspace"},
+		{"ShardLabel", ShardLabel, "kyverno-shard"},
+		{"WorkspaceAnnotation", WorkspaceAnnotation, "ibm.github.com/workspace"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"Workspace", Workspace("root:edge1"), "root--edge1"},
+		{"Workspace nested", Workspace("root:org:team"), "root--org--team"},
+		{"IngressPath", IngressPath("root--edge1"), "/root--edge1(/|$)(.*)"},
+		{"AdvertisedURL", AdvertisedURL("pcc.local", 19443, "root--edge1"), "pcc.local:19443/root--edge1"},
+		{"AdvertisedURLPrefix", AdvertisedURLPrefix("pcc.local", 443), "pcc.local:443"},
+		{"ShardName", ShardName(2), "kyverno-shard-2"},
+		{"ShardBundleKey", ShardBundleKey("root--edge1"), "root--edge1.yaml"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestWorkspace(t *testing.T) {
+	long := "root:" + strings.Repeat("a", 70)
+	tests := []struct {
+		name      string
+		workspace string
+		want      string
+	}{
+		{"valid path kept", "root:edge1", "root--edge1"},
+		{"double dash", "root:a--b", "root--a--b-" + hash("root:a--b")},
+		{"uppercase", "root:Edge1", "root--edge1-" + hash("root:Edge1")},
+		{"invalid characters", "root:edge_1.x", "root--edge-1-x-" + hash("root:edge_1.x")},
+		{"leading digit", "1:edge", "edge-" + hash("1:edge")},
+		{"only invalid characters", "_", "ws-" + hash("_")},
+		{"truncated", long, "root--" + strings.Repeat("a", 48) + "-" + hash(long)},
+	}
+	for _, tt := range tests {
+		if got := Workspace(tt.workspace); got != tt.want {
+			t.Errorf("%s: Workspace(%q) = %q, want %q", tt.name, tt.workspace, got, tt.want)
+		}
+		if errs := validation.IsDNS1035Label(Workspace(tt.workspace)); len(errs) > 0 {
+			t.Errorf("%s: Workspace(%q) is not a DNS label: %v", tt.name, tt.workspace, errs)
+		}
+	}
+
+	if Workspace("root:a--b") == Workspace("root:a:b") {
+		t.Errorf("root:a--b and root:a:b are normalized to the same name %q", Workspace("root:a:b"))
+	}
+}
+
+func hash(workspace string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(workspace))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
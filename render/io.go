@@ -0,0 +1,161 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
+)
+
+// scheme knows the kinds built by the resources package, including the OLM ones placed into the workspace.
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(operatorsv1.AddToScheme(scheme))
+	utilruntime.Must(operatorsv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+}
+
+// Read decodes the PolicyControls and PolicyControlTemplates of a YAML or JSON stream. Other kinds are skipped.
+func Read(r io.Reader) ([]v1alpha1.PolicyControl, map[string]*v1alpha1.PolicyControlTemplate, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	objs, err := manifests.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pcs []v1alpha1.PolicyControl
+	templates := map[string]*v1alpha1.PolicyControlTemplate{}
+	for _, obj := range objs {
+		if obj.GroupVersionKind().GroupVersion() != v1alpha1.GroupVersion {
+			continue
+		}
+		switch obj.GetKind() {
+		case "PolicyControl":
+			var pc v1alpha1.PolicyControl
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &pc); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode PolicyControl %s: %w", obj.GetName(), err)
+			}
+			pcs = append(pcs, pc)
+		case "PolicyControlTemplate":
+			var tmpl v1alpha1.PolicyControlTemplate
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &tmpl); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode PolicyControlTemplate %s: %w", obj.GetName(), err)
+			}
+			templates[tmpl.GetName()] = &tmpl
+		}
+	}
+	return pcs, templates, nil
+}
+
+// Write prints the objects of groups as a multi-document YAML stream.
+// Every document is headed by a comment naming its target cluster.
+func Write(w io.Writer, groups []Group) error {
+	for _, g := range groups {
+		for _, obj := range g.Objects {
+			gvk, err := apiutil.GVKForObject(obj, scheme)
+			if err != nil {
+				return err
+			}
+			obj.GetObjectKind().SetGroupVersionKind(gvk)
+			out, err := yaml.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "---\n# target: %s\n%s", g.Name(), out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFiles decodes the PolicyControls and PolicyControlTemplates of the given files, "-" being stdin.
+// A kustomize directory is built first.
+func ReadFiles(paths []string) ([]v1alpha1.PolicyControl, map[string]*v1alpha1.PolicyControlTemplate, error) {
+	var pcs []v1alpha1.PolicyControl
+	templates := map[string]*v1alpha1.PolicyControlTemplate{}
+	for _, path := range paths {
+		var r io.Reader = os.Stdin
+		if manifests.IsKustomization(path) {
+			m, err := manifests.Kustomize(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			r = bytes.NewReader(m.Data)
+		} else if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		filePCs, fileTemplates, err := Read(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		pcs = append(pcs, filePCs...)
+		for name, tmpl := range fileTemplates {
+			templates[name] = tmpl
+		}
+	}
+	return pcs, templates, nil
+}
+
+// WriteDir writes every group to its own file in dir, e.g. to be synced by one GitOps application per cluster:
+// policy-control-cluster.yaml, api-provider-<workspace>.yaml and workspace-<workspace>.yaml.
+func WriteDir(dir string, groups []Group) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, g := range groups {
+		name := "policy-control-cluster.yaml"
+		switch g.Target {
+		case TargetWorkspace:
+			name = fmt.Sprintf("workspace-%s.yaml", strings.ReplaceAll(g.Workspace, ":", "-"))
+		case TargetAPIProvider:
+			name = fmt.Sprintf("api-provider-%s.yaml", strings.ReplaceAll(g.Workspace, ":", "-"))
+		}
+		var buf bytes.Buffer
+		if err := Write(&buf, []Group{g}); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
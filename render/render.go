@@ -0,0 +1,348 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package render builds the manifests the operator creates for PolicyControls without talking to any cluster,
+// so that they can be committed to git and applied by a GitOps tool instead of the operator.
+// It uses the same resources.Build* functions as the operator.
+package render
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/manifests"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+// Placeholder stands in for the secret material the operator copies from the clusters at reconcile time.
+const Placeholder = "<redacted>"
+
+const (
+	TargetPolicyControlCluster = "PolicyControlCluster"
+	TargetWorkspace            = "Workspace"
+	// TargetAPIProvider is the workspace holding the APIExport of the Kyverno APIs.
+	TargetAPIProvider = "APIProvider"
+)
+
+// Secrets is the secret material put into the generated Secrets.
+type Secrets struct {
+	// Kubeconfig of the workspace, loaded by the Kyverno serving it.
+	WorkspaceKubeConfig string
+	TLSKey              string
+	TLSCert             string
+	TLSCACert           string
+}
+
+// PlaceholderSecrets replaces all secret material with Placeholder.
+func PlaceholderSecrets() Secrets {
+	return Secrets{
+		WorkspaceKubeConfig: Placeholder,
+		TLSKey:              Placeholder,
+		TLSCert:             Placeholder,
+		TLSCACert:           Placeholder,
+	}
+}
+
+// Options overrides the manifests embedded in the manifests package,
+// like WORKSPACE_KYVERNO_INSTALL_MANIFESTS_DIR and WORKSPACE_APIBINDINGS_MANIFEST of the operator.
+type Options struct {
+	KyvernoManifestsDir string
+	APIBindingsManifest string
+	// PolicyControlTemplates by name, merged into the PolicyControls referring to them.
+	Templates map[string]*v1alpha1.PolicyControlTemplate
+}
+
+// Group is the set of objects applied to one cluster.
+type Group struct {
+	Target string
+	// Workspace of a TargetWorkspace or TargetAPIProvider group.
+	Workspace string
+	Objects   []client.Object
+}
+
+// Name identifies the cluster of the group for humans.
+func (g Group) Name() string {
+	switch g.Target {
+	case TargetWorkspace:
+		return fmt.Sprintf("workspace %s", g.Workspace)
+	case TargetAPIProvider:
+		return fmt.Sprintf("API provider workspace %s", g.Workspace)
+	}
+	return "Policy Control Cluster"
+}
+
+// Render returns the objects of pcs grouped by target cluster, with secret material replaced by placeholders.
+// The Policy Control Cluster group comes first and holds the objects shared by the PolicyControls,
+// i.e. the Ingress carrying the paths of all workspaces and the bundle secrets of the shared Kyverno shards.
+// The API provider workspaces follow, then the workspaces of pcs.
+func Render(pcs []v1alpha1.PolicyControl, opts Options) ([]Group, error) {
+	pcc := Group{Target: TargetPolicyControlCluster}
+	var providers, workspaces []Group
+	// index of the group of each API provider workspace in providers
+	providerIndex := map[string]int{}
+	// index of the Ingress of each namespace in pcc.Objects
+	ingresses := map[client.ObjectKey]int{}
+	bundles := map[client.ObjectKey]*corev1.Secret{}
+	for i := range pcs {
+		pc, err := Effective(&pcs[i], opts.Templates)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := WorkspaceObjects(pc, opts, PlaceholderSecrets())
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, Group{Target: TargetWorkspace, Workspace: pc.Spec.Workspace, Objects: objs})
+
+		apis, err := KyvernoAPIs(pc, opts)
+		if err != nil {
+			return nil, err
+		}
+		path := resources.KyvernoAPIExport(pc).Path
+		provider, known := providerIndex[path]
+		if !known {
+			provider = len(providers)
+			providerIndex[path] = provider
+			providers = append(providers, Group{Target: TargetAPIProvider, Workspace: path})
+		}
+		for i := range apis {
+			providers[provider].Objects = appendUnique(providers[provider].Objects, &apis[i])
+		}
+
+		ingressKey := client.ObjectKey{Namespace: resources.KyvernoNamespace(pc), Name: naming.IngressName}
+		var current *networkingv1.Ingress
+		index, seen := ingresses[ingressKey]
+		if seen {
+			current = pcc.Objects[index].(*networkingv1.Ingress)
+		}
+		ingress, err := Ingress(pc, current)
+		if err != nil {
+			return nil, err
+		}
+		if seen {
+			pcc.Objects[index] = ingress
+		} else {
+			ingresses[ingressKey] = len(pcc.Objects)
+			pcc.Objects = append(pcc.Objects, ingress)
+		}
+
+		for _, obj := range PolicyControlClusterObjects(pc, PlaceholderSecrets()) {
+			secret, ok := obj.(*corev1.Secret)
+			if !ok || !resources.IsSharedKyverno(pc) || secret.GetName() != resources.AssignShard(pc) {
+				pcc.Objects = appendUnique(pcc.Objects, obj)
+				continue
+			}
+			// every workspace of a shard adds its kubeconfig to the bundle secret of the shard
+			key := client.ObjectKeyFromObject(secret)
+			if bundle, seen := bundles[key]; seen {
+				for k, v := range secret.Data {
+					bundle.Data[k] = v
+				}
+				continue
+			}
+			bundles[key] = secret
+			pcc.Objects = append(pcc.Objects, secret)
+		}
+	}
+	sort.SliceStable(providers, func(i, j int) bool { return providers[i].Workspace < providers[j].Workspace })
+	sort.SliceStable(workspaces, func(i, j int) bool { return workspaces[i].Workspace < workspaces[j].Workspace })
+	groups := append([]Group{pcc}, providers...)
+	return append(groups, workspaces...), nil
+}
+
+// Effective merges the PolicyControlTemplate referred to by pc, the same way the operator does.
+func Effective(pc *v1alpha1.PolicyControl, templates map[string]*v1alpha1.PolicyControlTemplate) (*v1alpha1.PolicyControl, error) {
+	if pc.Spec.TemplateRef == "" {
+		return pc.DeepCopy(), nil
+	}
+	tmpl, ok := templates[pc.Spec.TemplateRef]
+	if !ok {
+		return nil, fmt.Errorf("PolicyControl %s refers to PolicyControlTemplate %s which is not given", pc.GetName(), pc.Spec.TemplateRef)
+	}
+	return resources.MergeTemplate(pc, tmpl)
+}
+
+// WorkspaceObjects returns the objects the operator creates in the workspace of pc, in the order it creates them:
+// the OLM objects installing Kyverno on the edge clusters, the Kyverno manifests and APIBindings (see
+// WorkspaceManifests), and the TLS secrets.
+func WorkspaceObjects(pc *v1alpha1.PolicyControl, opts Options, secrets Secrets) ([]client.Object, error) {
+	objs := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: pc.Spec.KyvernoInCluster.InstallNamespace}},
+		resources.BuildOperatorGroupForKyverno(pc),
+		resources.BuildSubscriptionForKyverno(pc),
+		resources.BuildKyvernoCR(pc),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: pc.Spec.KyvernoInWorkspace.NamespaceForAPIResources}},
+	}
+	wsManifests, err := WorkspaceManifests(pc, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range wsManifests {
+		objs = append(objs, &wsManifests[i])
+	}
+	objs = append(objs,
+		resources.BuildTLSKeyCertSecretForKyverno(pc, secrets.TLSKey, secrets.TLSCert),
+		resources.BuildTLSCASecretForKyverno(pc, secrets.TLSCACert),
+	)
+	return objs, nil
+}
+
+// PolicyControlClusterObjects returns the objects the operator creates in the Policy Control Cluster for pc,
+// except for the Ingress shared by all workspaces, or by the isolated workspace, which is built by Ingress.
+func PolicyControlClusterObjects(pc *v1alpha1.PolicyControl, secrets Secrets) []client.Object {
+	var objs []client.Object
+	if resources.IsNamespaceIsolated(pc) {
+		objs = append(objs,
+			resources.BuildNamespaceForKyverno(pc),
+			resources.BuildServiceAccountForKyverno(pc),
+			resources.BuildNetworkPolicyForKyverno(pc),
+			resources.BuildResourceQuotaForKyverno(pc),
+		)
+	}
+	objs = append(objs, resources.BuildTLSKeyCertSecretForIngress(pc, secrets.TLSKey, secrets.TLSCert))
+	if resources.IsSharedKyverno(pc) {
+		shard := resources.AssignShard(pc)
+		bundle := resources.BuildShardSecretForKyverno(pc, shard)
+		bundle.Data[resources.ShardBundleKey(pc)] = []byte(secrets.WorkspaceKubeConfig)
+		return append(objs,
+			bundle,
+			resources.BuildShardServiceForKyverno(pc, shard),
+			resources.BuildShardDeploymentForKyverno(pc, shard),
+		)
+	}
+	return append(objs,
+		resources.BuildSecretForKyverno(pc, secrets.WorkspaceKubeConfig),
+		resources.BuildServiceForKyverno(pc),
+		resources.BuildDeploymentForKyverno(pc),
+	)
+}
+
+// Ingress returns the kyverno-ingress with the path of the workspace of pc added to current,
+// or a new one routing only that path when current is nil.
+func Ingress(pc *v1alpha1.PolicyControl, current *networkingv1.Ingress) (*networkingv1.Ingress, error) {
+	if current == nil {
+		return resources.BuildIngressForKyverno(pc), nil
+	}
+	return resources.AddIngressRuleForKyverno(pc, current.DeepCopy())
+}
+
+// WorkspaceManifests decodes the Kyverno manifests selected by pc and its APIBindings, in the order the operator
+// applies them (see manifests.Stage). The kyverno.io CRDs are left out as they are bound from the Kyverno APIExport.
+func WorkspaceManifests(pc *v1alpha1.PolicyControl, opts Options) ([]unstructured.Unstructured, error) {
+	kyverno, err := kyvernoManifests(pc, opts)
+	if err != nil {
+		return nil, err
+	}
+	var objs []unstructured.Unstructured
+	for i := range kyverno {
+		if !resources.IsExportedCRD(&kyverno[i]) {
+			objs = append(objs, kyverno[i])
+		}
+	}
+	bindings, err := APIBindings(pc, opts)
+	if err != nil {
+		return nil, err
+	}
+	objs = append(objs, bindings...)
+	manifests.SortByStage(objs)
+	return objs, nil
+}
+
+// KyvernoAPIs returns the APIResourceSchemas converted from the kyverno.io CRDs of the Kyverno manifests selected
+// by pc, followed by the APIExport serving them. They are created in the workspace resources.KyvernoAPIExport(pc).Path.
+func KyvernoAPIs(pc *v1alpha1.PolicyControl, opts Options) ([]unstructured.Unstructured, error) {
+	kyverno, err := kyvernoManifests(pc, opts)
+	if err != nil {
+		return nil, err
+	}
+	version := pc.Spec.KyvernoInWorkspace.KyvernoVersion
+	if version == "" {
+		version = manifests.DefaultKyvernoVersion
+	}
+	var objs []unstructured.Unstructured
+	var names []string
+	for i := range kyverno {
+		if !resources.IsExportedCRD(&kyverno[i]) {
+			continue
+		}
+		schema, err := resources.BuildAPIResourceSchema(&kyverno[i], version)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, *schema)
+		names = append(names, schema.GetName())
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("the Kyverno manifests of version %s hold no %s CRDs", version, resources.KyvernoAPIGroup)
+	}
+	return append(objs, *resources.BuildKyvernoAPIExport(pc, names)), nil
+}
+
+func kyvernoManifests(pc *v1alpha1.PolicyControl, opts Options) ([]unstructured.Unstructured, error) {
+	ms, err := manifests.Kyverno(pc.Spec.KyvernoInWorkspace.KyvernoVersion, opts.KyvernoManifestsDir)
+	if err != nil {
+		return nil, err
+	}
+	var objs []unstructured.Unstructured
+	for _, m := range ms {
+		mObjs, err := m.Objects()
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, mObjs...)
+	}
+	return objs, nil
+}
+
+// APIBindings returns the APIBindings of pc. The manifest in opts.APIBindingsManifest replaces the binding
+// importing the Kubernetes resources when it is set.
+func APIBindings(pc *v1alpha1.PolicyControl, opts Options) ([]unstructured.Unstructured, error) {
+	built := resources.BuildAPIBindings(pc)
+	var objs []unstructured.Unstructured
+	if opts.APIBindingsManifest != "" {
+		m, err := manifests.APIBindings(opts.APIBindingsManifest)
+		if err != nil {
+			return nil, err
+		}
+		if objs, err = m.Objects(); err != nil {
+			return nil, err
+		}
+		built = built[1:]
+	}
+	for _, obj := range built {
+		objs = append(objs, *obj)
+	}
+	return objs, nil
+}
+
+// appendUnique appends obj unless an object of the same type and key is already in objs,
+// e.g. the ingress TLS secret shared by the PolicyControls of a namespace.
+func appendUnique(objs []client.Object, obj client.Object) []client.Object {
+	for _, o := range objs {
+		if fmt.Sprintf("%T", o) == fmt.Sprintf("%T", obj) && client.ObjectKeyFromObject(o) == client.ObjectKeyFromObject(obj) {
+			return objs
+		}
+	}
+	return append(objs, obj)
+}
@@ -0,0 +1,246 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package render
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+	"github.com/IBM/policy-control-operator/resources"
+)
+
+var samples = []string{
+	"../config/samples/pccr-edge1.yaml",
+	"../config/samples/pccr-edge2-with-template.yaml",
+	"../config/samples/ibm_v1alpha1_policycontroltemplate.yaml",
+}
+
+func renderSamples(t *testing.T, mutate func(pc *v1alpha1.PolicyControl)) []Group {
+	t.Helper()
+	pcs, templates, err := ReadFiles(samples)
+	if err != nil {
+		t.Fatalf("ReadFiles() error = %v", err)
+	}
+	if len(pcs) != 2 || templates["policycontroltemplate-sample"] == nil {
+		t.Fatalf("ReadFiles() = %d PolicyControls and templates %v, want 2 and policycontroltemplate-sample", len(pcs), templates)
+	}
+	for i := range pcs {
+		if mutate != nil {
+			mutate(&pcs[i])
+		}
+	}
+	groups, err := Render(pcs, Options{Templates: templates})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return groups
+}
+
+func ingressPaths(ingress *networkingv1.Ingress) []string {
+	var paths []string
+	for _, rule := range ingress.Spec.Rules {
+		for _, path := range rule.HTTP.Paths {
+			paths = append(paths, path.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestRender(t *testing.T) {
+	groups := renderSamples(t, nil)
+
+	var targets []string
+	for _, g := range groups {
+		targets = append(targets, g.Target+" "+g.Workspace)
+	}
+	want := []string{
+		TargetPolicyControlCluster + " ",
+		TargetAPIProvider + " " + resources.KyvernoAPIExport(&v1alpha1.PolicyControl{}).Path,
+		TargetWorkspace + " root:edge1",
+		TargetWorkspace + " root:edge2",
+	}
+	if strings.Join(targets, ",") != strings.Join(want, ",") {
+		t.Fatalf("Render() groups = %v, want %v", targets, want)
+	}
+
+	var ingresses []*networkingv1.Ingress
+	var images []string
+	for _, obj := range groups[0].Objects {
+		switch o := obj.(type) {
+		case *networkingv1.Ingress:
+			ingresses = append(ingresses, o)
+		case *appsv1.Deployment:
+			images = append(images, o.Spec.Template.Spec.Containers[0].Image)
+		case *corev1.Secret:
+			for k, v := range o.Data {
+				if string(v) != Placeholder {
+					t.Errorf("secret %s key %s = %q, want %q", o.Name, k, v, Placeholder)
+				}
+			}
+		}
+	}
+	if len(ingresses) != 1 {
+		t.Fatalf("Policy Control Cluster holds %d Ingresses, want 1 shared by both workspaces", len(ingresses))
+	}
+	wantPaths := []string{naming.IngressPath(naming.Workspace("root:edge1")), naming.IngressPath(naming.Workspace("root:edge2"))}
+	sort.Strings(wantPaths)
+	if got := ingressPaths(ingresses[0]); strings.Join(got, ",") != strings.Join(wantPaths, ",") {
+		t.Errorf("Ingress paths = %v, want %v", got, wantPaths)
+	}
+	// the template of pccr-edge2 sets the same Kyverno image as pccr-edge1
+	if len(images) != 2 || images[0] != "kyverno-local:1.0.0" || images[1] != "kyverno-local:1.0.0" {
+		t.Errorf("Kyverno images = %v, want kyverno-local:1.0.0 for both workspaces", images)
+	}
+
+	exports := 0
+	for _, obj := range groups[1].Objects {
+		if obj.(*unstructured.Unstructured).GetKind() == "APIExport" {
+			exports++
+		}
+	}
+	if exports != 1 {
+		t.Errorf("API provider group holds %d APIExports, want 1 shared by both workspaces", exports)
+	}
+
+	for _, g := range groups[2:] {
+		for _, obj := range g.Objects {
+			if u, ok := obj.(*unstructured.Unstructured); ok && resources.IsExportedCRD(u) {
+				t.Errorf("workspace %s holds the exported CRD %s", g.Workspace, u.GetName())
+			}
+		}
+	}
+}
+
+func TestRenderSharedKyverno(t *testing.T) {
+	groups := renderSamples(t, func(pc *v1alpha1.PolicyControl) {
+		pc.Spec.PolicyControlCluster.KyvernoMode = resources.KyvernoModeShared
+	})
+
+	var bundles []*corev1.Secret
+	for _, obj := range groups[0].Objects {
+		if secret, ok := obj.(*corev1.Secret); ok && secret.Name == naming.ShardName(0) {
+			bundles = append(bundles, secret)
+		}
+	}
+	if len(bundles) != 1 {
+		t.Fatalf("Policy Control Cluster holds %d bundle secrets of %s, want 1", len(bundles), naming.ShardName(0))
+	}
+	for _, ws := range []string{"root:edge1", "root:edge2"} {
+		key := naming.ShardBundleKey(naming.Workspace(ws))
+		if string(bundles[0].Data[key]) != Placeholder {
+			t.Errorf("bundle secret key %s = %q, want %q", key, bundles[0].Data[key], Placeholder)
+		}
+	}
+}
+
+func TestEffectiveMissingTemplate(t *testing.T) {
+	pc := &v1alpha1.PolicyControl{Spec: v1alpha1.PolicyControlSpec{TemplateRef: "missing"}}
+	pc.Name = "pc"
+	_, err := Effective(pc, nil)
+	if err == nil || !strings.Contains(err.Error(), "PolicyControlTemplate missing which is not given") {
+		t.Errorf("Effective() error = %v, want the missing template to be named", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	stream := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+---
+apiVersion: ibm.github.com/v1alpha1
+kind: PolicyControl
+metadata:
+  name: pc
+spec:
+  workspace: root:a
+---
+apiVersion: ibm.github.com/v1alpha1
+kind: PolicyControlTemplate
+metadata:
+  name: tmpl
+`
+	pcs, templates, err := Read(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(pcs) != 1 || pcs[0].Spec.Workspace != "root:a" {
+		t.Errorf("Read() PolicyControls = %v, want only pc", pcs)
+	}
+	if len(templates) != 1 || templates["tmpl"] == nil {
+		t.Errorf("Read() templates = %v, want only tmpl", templates)
+	}
+}
+
+func TestWriteDir(t *testing.T) {
+	groups := renderSamples(t, nil)
+	dir := t.TempDir()
+	if err := WriteDir(dir, groups); err != nil {
+		t.Fatalf("WriteDir() error = %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	provider := strings.ReplaceAll(groups[1].Workspace, ":", "-")
+	want := []string{"api-provider-" + provider + ".yaml", "policy-control-cluster.yaml", "workspace-root-edge1.yaml", "workspace-root-edge2.yaml"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("WriteDir() files = %v, want %v", names, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "workspace-root-edge1.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := strings.Split(string(data), "---\n")[1:]
+	if len(docs) != len(groups[2].Objects) {
+		t.Errorf("workspace-root-edge1.yaml holds %d documents, want %d", len(docs), len(groups[2].Objects))
+	}
+	for _, doc := range docs {
+		if !strings.HasPrefix(doc, "# target: workspace root:edge1\n") {
+			t.Errorf("document does not name its target:\n%s", doc)
+		}
+	}
+}
+
+func TestWriteSetsKind(t *testing.T) {
+	var buf bytes.Buffer
+	g := Group{Target: TargetPolicyControlCluster, Objects: []client.Object{&corev1.Namespace{}}}
+	if err := Write(&buf, []Group{g}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "# target: Policy Control Cluster\n") || !strings.Contains(out, "kind: Namespace") {
+		t.Errorf("Write() = %q, want the target and kind of the Namespace", out)
+	}
+}
@@ -0,0 +1,107 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	defaultKubernetesAPIBindingName = "kyverno-required-resources"
+	defaultKubernetesAPIExportPath  = "root:policy-control-cluster"
+	defaultKubernetesAPIExportName  = "kubernetes"
+	permissionClaimStateAccepted    = "Accepted"
+	apiBindingAPIVersion            = "apis.kcp.dev/v1alpha1"
+	apiBindingKind                  = "APIBinding"
+)
+
+// KubernetesAPIBinding returns the binding importing the basic Kubernetes resources into the workspace of cr,
+// with its defaults filled in.
+func KubernetesAPIBinding(cr *v1alpha1.PolicyControl) v1alpha1.APIBinding {
+	binding := cr.Spec.KyvernoInWorkspace.KubernetesAPIBinding
+	if binding.Name == "" {
+		binding.Name = defaultKubernetesAPIBindingName
+	}
+	if binding.Path == "" {
+		binding.Path = defaultKubernetesAPIExportPath
+	}
+	if binding.ExportName == "" {
+		binding.ExportName = defaultKubernetesAPIExportName
+	}
+	return binding
+}
+
+// APIBindings returns all bindings created in the workspace of cr, the Kubernetes one first
+// and the Kyverno one second.
+func APIBindings(cr *v1alpha1.PolicyControl) []v1alpha1.APIBinding {
+	export := KyvernoAPIExport(cr)
+	bindings := []v1alpha1.APIBinding{
+		KubernetesAPIBinding(cr),
+		{Name: export.Name, Path: export.Path, ExportName: export.Name},
+	}
+	for _, binding := range cr.Spec.KyvernoInWorkspace.AdditionalAPIBindings {
+		if binding.Name == "" {
+			binding.Name = binding.ExportName
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings
+}
+
+func BuildAPIBindings(cr *v1alpha1.PolicyControl) []*unstructured.Unstructured {
+	bindings := APIBindings(cr)
+	objs := make([]*unstructured.Unstructured, 0, len(bindings))
+	for _, binding := range bindings {
+		objs = append(objs, buildAPIBinding(binding))
+	}
+	return objs
+}
+
+func buildAPIBinding(binding v1alpha1.APIBinding) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"reference": map[string]interface{}{
+			"workspace": map[string]interface{}{
+				"path":       binding.Path,
+				"exportName": binding.ExportName,
+			},
+		},
+	}
+	if len(binding.AcceptedPermissionClaims) > 0 {
+		claims := make([]interface{}, 0, len(binding.AcceptedPermissionClaims))
+		for _, claim := range binding.AcceptedPermissionClaims {
+			c := map[string]interface{}{
+				"group":    claim.Group,
+				"resource": claim.Resource,
+				"state":    permissionClaimStateAccepted,
+			}
+			if claim.IdentityHash != "" {
+				c["identityHash"] = claim.IdentityHash
+			}
+			claims = append(claims, c)
+		}
+		spec["permissionClaims"] = claims
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiBindingAPIVersion,
+		"kind":       apiBindingKind,
+		"metadata": map[string]interface{}{
+			"name": binding.Name,
+		},
+		"spec": spec,
+	}}
+}
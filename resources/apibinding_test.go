@@ -0,0 +1,111 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+func TestAPIBindings(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(cr *v1alpha1.PolicyControl)
+		want   []v1alpha1.APIBinding
+	}{
+		{
+			name:   "defaults",
+			mutate: func(cr *v1alpha1.PolicyControl) {},
+			want: []v1alpha1.APIBinding{
+				{Name: "kyverno-required-resources", Path: "root:policy-control-cluster", ExportName: "kubernetes"},
+				{Name: "kyverno", Path: "root:policy-control-cluster", ExportName: "kyverno"},
+			},
+		},
+		{
+			name: "configured Kubernetes binding",
+			mutate: func(cr *v1alpha1.PolicyControl) {
+				cr.Spec.KyvernoInWorkspace.KubernetesAPIBinding = v1alpha1.APIBinding{Path: "root:compute", ExportName: "kubernetes-compute"}
+			},
+			want: []v1alpha1.APIBinding{
+				{Name: "kyverno-required-resources", Path: "root:compute", ExportName: "kubernetes-compute"},
+				{Name: "kyverno", Path: "root:policy-control-cluster", ExportName: "kyverno"},
+			},
+		},
+		{
+			name: "additional bindings named after their export by default",
+			mutate: func(cr *v1alpha1.PolicyControl) {
+				cr.Spec.KyvernoInWorkspace.AdditionalAPIBindings = []v1alpha1.APIBinding{
+					{Path: "root:compute", ExportName: "certificates"},
+					{Name: "policy-apis", Path: "root:compute", ExportName: "policies"},
+				}
+			},
+			want: []v1alpha1.APIBinding{
+				{Name: "kyverno-required-resources", Path: "root:policy-control-cluster", ExportName: "kubernetes"},
+				{Name: "kyverno", Path: "root:policy-control-cluster", ExportName: "kyverno"},
+				{Name: "certificates", Path: "root:compute", ExportName: "certificates"},
+				{Name: "policy-apis", Path: "root:compute", ExportName: "policies"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testPolicyControl()
+			tt.mutate(cr)
+			if got := APIBindings(cr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("APIBindings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildAPIBindingsPermissionClaims(t *testing.T) {
+	cr := testPolicyControl()
+	cr.Spec.KyvernoInWorkspace.AdditionalAPIBindings = []v1alpha1.APIBinding{{
+		Path:       "root:compute",
+		ExportName: "certificates",
+		AcceptedPermissionClaims: []v1alpha1.PermissionClaim{
+			{Resource: "secrets"},
+			{Group: "cert-manager.io", Resource: "certificates", IdentityHash: "abc"},
+		},
+	}}
+	objs := BuildAPIBindings(cr)
+	if len(objs) != 3 {
+		t.Fatalf("BuildAPIBindings() returned %d bindings, want 3", len(objs))
+	}
+	if _, found := objs[0].Object["spec"].(map[string]interface{})["permissionClaims"]; found {
+		t.Errorf("binding %s has permission claims, want none", objs[0].GetName())
+	}
+	binding := objs[2]
+	if binding.GetAPIVersion() != "apis.kcp.dev/v1alpha1" || binding.GetKind() != "APIBinding" || binding.GetName() != "certificates" {
+		t.Errorf("BuildAPIBindings()[2] = %s %s %s, want apis.kcp.dev/v1alpha1 APIBinding certificates",
+			binding.GetAPIVersion(), binding.GetKind(), binding.GetName())
+	}
+	want := map[string]interface{}{
+		"reference": map[string]interface{}{
+			"workspace": map[string]interface{}{"path": "root:compute", "exportName": "certificates"},
+		},
+		"permissionClaims": []interface{}{
+			map[string]interface{}{"group": "", "resource": "secrets", "state": "Accepted"},
+			map[string]interface{}{"group": "cert-manager.io", "resource": "certificates", "state": "Accepted", "identityHash": "abc"},
+		},
+	}
+	if got := binding.Object["spec"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildAPIBindings()[2].spec = %v, want %v", got, want)
+	}
+}
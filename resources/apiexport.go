@@ -0,0 +1,133 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	defaultKyvernoAPIExportName = "kyverno"
+	// KyvernoAPIGroup is the group of the CRDs published through the Kyverno APIExport.
+	KyvernoAPIGroup          = "kyverno.io"
+	apiResourceSchemaKind    = "APIResourceSchema"
+	apiExportKind            = "APIExport"
+	customResourceDefinition = "CustomResourceDefinition"
+)
+
+// KyvernoAPIExport returns the APIExport serving the Kyverno APIs to the workspace of cr,
+// with its defaults filled in.
+func KyvernoAPIExport(cr *v1alpha1.PolicyControl) v1alpha1.KyvernoAPIExport {
+	export := cr.Spec.KyvernoInWorkspace.KyvernoAPIExport
+	if export.Path == "" {
+		export.Path = defaultKubernetesAPIExportPath
+	}
+	if export.Name == "" {
+		export.Name = defaultKyvernoAPIExportName
+	}
+	return export
+}
+
+// IsExportedCRD tells whether obj is a CRD served through the Kyverno APIExport instead of being
+// installed into the workspace.
+func IsExportedCRD(obj *unstructured.Unstructured) bool {
+	if obj.GetKind() != customResourceDefinition {
+		return false
+	}
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	return group == KyvernoAPIGroup
+}
+
+// BuildAPIResourceSchema converts crd into an APIResourceSchema. Schemas are immutable, so their
+// name carries the Kyverno manifests version (prefix).
+func BuildAPIResourceSchema(crd *unstructured.Unstructured, prefix string) (*unstructured.Unstructured, error) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	names, _, _ := unstructured.NestedMap(crd.Object, "spec", "names")
+	scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+	crdVersions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	plural, _ := names["plural"].(string)
+	if plural == "" || len(crdVersions) == 0 {
+		return nil, fmt.Errorf("CRD %s has no plural name or no versions", crd.GetName())
+	}
+
+	versions := make([]interface{}, 0, len(crdVersions))
+	for _, v := range crdVersions {
+		crdVersion, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("CRD %s has a malformed version", crd.GetName())
+		}
+		version := map[string]interface{}{}
+		for _, field := range []string{"name", "served", "storage", "subresources", "additionalPrinterColumns", "deprecated", "deprecationWarning"} {
+			if value, ok := crdVersion[field]; ok {
+				version[field] = value
+			}
+		}
+		schema, _, _ := unstructured.NestedMap(crdVersion, "schema", "openAPIV3Schema")
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+		}
+		version["schema"] = schema
+		versions = append(versions, version)
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiBindingAPIVersion,
+		"kind":       apiResourceSchemaKind,
+		"metadata": map[string]interface{}{
+			"name": APIResourceSchemaName(prefix, plural, group),
+		},
+		"spec": map[string]interface{}{
+			"group":    group,
+			"names":    names,
+			"scope":    scope,
+			"versions": versions,
+		},
+	}}, nil
+}
+
+// APIResourceSchemaName returns the name kcp expects for the schema of plural.group, e.g.
+// v1-8.clusterpolicies.kyverno.io for the version v1.8.
+func APIResourceSchemaName(prefix, plural, group string) string {
+	return fmt.Sprintf("%s.%s.%s", strings.ReplaceAll(prefix, ".", "-"), plural, group)
+}
+
+// BuildKyvernoAPIExport returns the APIExport of cr serving the given APIResourceSchemas.
+func BuildKyvernoAPIExport(cr *v1alpha1.PolicyControl, schemaNames []string) *unstructured.Unstructured {
+	return BuildAPIExport(KyvernoAPIExport(cr).Name, schemaNames)
+}
+
+// BuildAPIExport returns the APIExport name serving the given APIResourceSchemas.
+func BuildAPIExport(name string, schemaNames []string) *unstructured.Unstructured {
+	schemas := make([]interface{}, 0, len(schemaNames))
+	for _, name := range schemaNames {
+		schemas = append(schemas, name)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiBindingAPIVersion,
+		"kind":       apiExportKind,
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+		"spec": map[string]interface{}{
+			"latestResourceSchemas": schemas,
+		},
+	}}
+}
@@ -0,0 +1,131 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+func crd(group string, versions ...interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "clusterpolicies." + group},
+		"spec": map[string]interface{}{
+			"group":    group,
+			"scope":    "Cluster",
+			"names":    map[string]interface{}{"plural": "clusterpolicies", "kind": "ClusterPolicy"},
+			"versions": versions,
+		},
+	}}
+}
+
+func TestKyvernoAPIExport(t *testing.T) {
+	cr := testPolicyControl()
+	if got, want := KyvernoAPIExport(cr), (v1alpha1.KyvernoAPIExport{Path: "root:policy-control-cluster", Name: "kyverno"}); got != want {
+		t.Errorf("KyvernoAPIExport() = %+v, want the defaults %+v", got, want)
+	}
+	cr.Spec.KyvernoInWorkspace.KyvernoAPIExport = v1alpha1.KyvernoAPIExport{Path: "root:compute", Name: "kyverno-apis"}
+	if got, want := KyvernoAPIExport(cr), cr.Spec.KyvernoInWorkspace.KyvernoAPIExport; got != want {
+		t.Errorf("KyvernoAPIExport() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIsExportedCRD(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  *unstructured.Unstructured
+		want bool
+	}{
+		{"kyverno.io CRD", crd("kyverno.io"), true},
+		{"wgpolicyk8s.io CRD", crd("wgpolicyk8s.io"), false},
+		{"other kind", &unstructured.Unstructured{Object: map[string]interface{}{
+			"kind": "ClusterRole",
+			"spec": map[string]interface{}{"group": "kyverno.io"},
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsExportedCRD(tt.obj); got != tt.want {
+				t.Errorf("IsExportedCRD() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildAPIResourceSchema(t *testing.T) {
+	schema := map[string]interface{}{"type": "object", "properties": map[string]interface{}{"spec": map[string]interface{}{"type": "object"}}}
+	obj := crd("kyverno.io",
+		map[string]interface{}{
+			"name": "v1", "served": true, "storage": true,
+			"schema":       map[string]interface{}{"openAPIV3Schema": schema},
+			"subresources": map[string]interface{}{"status": map[string]interface{}{}},
+		},
+		map[string]interface{}{"name": "v2beta1", "served": true, "storage": false, "deprecated": true},
+	)
+	got, err := BuildAPIResourceSchema(obj, "v1.8")
+	if err != nil {
+		t.Fatalf("BuildAPIResourceSchema() error = %v", err)
+	}
+	if got.GetKind() != "APIResourceSchema" || got.GetName() != "v1-8.clusterpolicies.kyverno.io" {
+		t.Errorf("BuildAPIResourceSchema() = %s %s, want APIResourceSchema v1-8.clusterpolicies.kyverno.io", got.GetKind(), got.GetName())
+	}
+	want := map[string]interface{}{
+		"group": "kyverno.io",
+		"scope": "Cluster",
+		"names": map[string]interface{}{"plural": "clusterpolicies", "kind": "ClusterPolicy"},
+		"versions": []interface{}{
+			map[string]interface{}{
+				"name": "v1", "served": true, "storage": true,
+				"schema":       schema,
+				"subresources": map[string]interface{}{"status": map[string]interface{}{}},
+			},
+			// a version without a schema preserves all fields
+			map[string]interface{}{
+				"name": "v2beta1", "served": true, "storage": false, "deprecated": true,
+				"schema": map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got.Object["spec"], want) {
+		t.Errorf("BuildAPIResourceSchema().spec = %v, want %v", got.Object["spec"], want)
+	}
+
+	if _, err := BuildAPIResourceSchema(crd("kyverno.io"), "v1.8"); err == nil || !strings.Contains(err.Error(), "no plural name or no versions") {
+		t.Errorf("BuildAPIResourceSchema() of a CRD without versions error = %v", err)
+	}
+}
+
+func TestBuildKyvernoAPIExport(t *testing.T) {
+	cr := testPolicyControl()
+	cr.Spec.KyvernoInWorkspace.KyvernoAPIExport.Name = "kyverno-apis"
+	export := BuildKyvernoAPIExport(cr, []string{"v1-8.clusterpolicies.kyverno.io", "v1-8.policies.kyverno.io"})
+	if export.GetAPIVersion() != "apis.kcp.dev/v1alpha1" || export.GetKind() != "APIExport" || export.GetName() != "kyverno-apis" {
+		t.Errorf("BuildKyvernoAPIExport() = %s %s %s, want apis.kcp.dev/v1alpha1 APIExport kyverno-apis",
+			export.GetAPIVersion(), export.GetKind(), export.GetName())
+	}
+	schemas, _, _ := unstructured.NestedStringSlice(export.Object, "spec", "latestResourceSchemas")
+	if want := []string{"v1-8.clusterpolicies.kyverno.io", "v1-8.policies.kyverno.io"}; !reflect.DeepEqual(schemas, want) {
+		t.Errorf("BuildKyvernoAPIExport() schemas = %v, want %v", schemas, want)
+	}
+}
@@ -0,0 +1,95 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"time"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// CanaryName names the canary policies and the ConfigMap violating them.
+	CanaryName = "policy-control-canary"
+	// CanaryLabel marks the ConfigMaps the canary policies deny.
+	CanaryLabel = "ibm.github.com/canary"
+	// CanaryProbeTimeAnnotation holds the time of the probe that last wrote the canary ConfigMap.
+	CanaryProbeTimeAnnotation = "ibm.github.com/canary-probe-time"
+	// CanaryMessage is the message of the canary rule, which Kyverno puts into its denial of the canary ConfigMap.
+	CanaryMessage = "policy control canary: admission control is active"
+)
+
+// BuildCanaryClusterPolicy returns the ClusterPolicy of the workspace of cr denying the canary ConfigMaps
+// in the namespace for API resources.
+func BuildCanaryClusterPolicy(cr *v1alpha1.PolicyControl) *unstructured.Unstructured {
+	return buildCanaryPolicy("ClusterPolicy", "", "Enforce", cr.Spec.KyvernoInWorkspace.NamespaceForAPIResources)
+}
+
+// BuildCanaryEdgePolicy returns the Policy synced to the edge clusters with the install namespace of cr, reporting
+// the canary ConfigMap. It audits instead of enforcing so that the result reaches kcp in a PolicyReport.
+func BuildCanaryEdgePolicy(cr *v1alpha1.PolicyControl) *unstructured.Unstructured {
+	namespace := cr.Spec.KyvernoInCluster.InstallNamespace
+	return buildCanaryPolicy("Policy", namespace, "Audit", namespace)
+}
+
+func buildCanaryPolicy(kind, namespace, action, matchNamespace string) *unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": CanaryName}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "kyverno.io/v1",
+		"kind":       kind,
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"validationFailureAction": action,
+			"background":              false,
+			"rules": []interface{}{map[string]interface{}{
+				"name": "deny-canary",
+				"match": map[string]interface{}{"any": []interface{}{map[string]interface{}{
+					"resources": map[string]interface{}{
+						"kinds":      []interface{}{"ConfigMap"},
+						"namespaces": []interface{}{matchNamespace},
+						"selector": map[string]interface{}{
+							"matchLabels": map[string]interface{}{CanaryLabel: "true"},
+						},
+					},
+				}}},
+				"validate": map[string]interface{}{
+					"message": CanaryMessage,
+					"deny":    map[string]interface{}{},
+				},
+			}},
+		},
+	}}
+}
+
+// BuildCanaryConfigMap returns the ConfigMap violating the canary policies, written by the probe at probeTime.
+func BuildCanaryConfigMap(namespace string, probeTime time.Time) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        CanaryName,
+			Namespace:   namespace,
+			Labels:      map[string]string{CanaryLabel: "true"},
+			Annotations: map[string]string{CanaryProbeTimeAnnotation: probeTime.UTC().Format(time.RFC3339)},
+		},
+	}
+}
@@ -17,70 +17,70 @@
 package resources
 
 import (
-	"fmt"
-
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
 )
 
 func BuildDeploymentForKyverno(cr *v1alpha1.PolicyControl) *appsv1.Deployment {
 	normalizedWorkspace := normalizeWorkdpaceName(cr)
-	advertisedUrl := fmt.Sprintf("%s:%d/%s", cr.Spec.PolicyControlCluster.IngressHost, cr.Spec.PolicyControlCluster.IngressPort, normalizedWorkspace)
+	advertisedUrl := AdvertisedURL(cr)
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      normalizedWorkspace,
-			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Name:        normalizedWorkspace,
+			Namespace:   KyvernoNamespace(cr),
+			Annotations: workspaceAnnotations(cr),
 			Labels: map[string]string{
-				"app":       "kyverno-controller",
-				"workspace": normalizedWorkspace,
+				naming.AppLabel:       naming.KyvernoAppLabelValue,
+				naming.WorkspaceLabel: normalizedWorkspace,
 			},
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: int32Ptr(1),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
-					"app":       "kyverno-controller",
-					"workspace": normalizedWorkspace,
+					naming.AppLabel:       naming.KyvernoAppLabelValue,
+					naming.WorkspaceLabel: normalizedWorkspace,
 				},
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: map[string]string{
-						"app":       "kyverno-controller",
-						"workspace": normalizedWorkspace,
+						naming.AppLabel:       naming.KyvernoAppLabelValue,
+						naming.WorkspaceLabel: normalizedWorkspace,
 					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
-							Name:  "kyverno",
+							Name:  naming.KyvernoContainerName,
 							Image: cr.Spec.KyvernoInWorkspace.KyvernoImage,
 							Args: []string{
 								"-v=4",
-								"--kubeconfig=/tmp/kyverno-runtime-credentials/target-kubeconfig.yaml",
+								"--kubeconfig=" + naming.CredentialsMountPath + "/" + naming.KubeConfigKey,
 								"--serverIP=" + advertisedUrl,
 							},
 							Env: []corev1.EnvVar{{
 								Name:  "KYVERNO_SVC",
-								Value: "kyverno-svc-remote",
+								Value: naming.KyvernoServiceName,
 							}},
 							Ports: []corev1.ContainerPort{{
 								Name:          "http",
 								Protocol:      corev1.ProtocolTCP,
-								ContainerPort: 9443,
+								ContainerPort: naming.KyvernoWebhookPort,
 							}},
 							VolumeMounts: []corev1.VolumeMount{{
-								Name:      "kyverno-runtime-credentials",
-								MountPath: "/tmp/kyverno-runtime-credentials",
+								Name:      naming.CredentialsVolumeName,
+								MountPath: naming.CredentialsMountPath,
 								ReadOnly:  true,
 							}},
 						},
 					},
 					Volumes: []corev1.Volume{{
-						Name: "kyverno-runtime-credentials",
+						Name: naming.CredentialsVolumeName,
 						VolumeSource: corev1.VolumeSource{
 							Secret: &corev1.SecretVolumeSource{
 								SecretName: normalizedWorkspace,
@@ -91,5 +91,10 @@ func BuildDeploymentForKyverno(cr *v1alpha1.PolicyControl) *appsv1.Deployment {
 			},
 		},
 	}
+	if IsNamespaceIsolated(cr) {
+		automount := false
+		deployment.Spec.Template.Spec.ServiceAccountName = KyvernoServiceAccountName
+		deployment.Spec.Template.Spec.AutomountServiceAccountToken = &automount
+	}
 	return deployment
 }
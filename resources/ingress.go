@@ -23,16 +23,17 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
 )
 
 func BuildIngressForKyverno(cr *v1alpha1.PolicyControl) *networkingv1.Ingress {
 
 	ingressPath := buildIngressHTTPIngressPath(cr, getPath(cr))
-	ingresClass := "nginx"
+	ingresClass := naming.IngressClassName
 	ingress := &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "kyverno-ingress",
-			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Name:      naming.IngressName,
+			Namespace: KyvernoNamespace(cr),
 			Annotations: map[string]string{
 				"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
 				"nginx.ingress.kubernetes.io/rewrite-target":   "/$2",
@@ -42,7 +43,7 @@ func BuildIngressForKyverno(cr *v1alpha1.PolicyControl) *networkingv1.Ingress {
 			IngressClassName: &ingresClass,
 			TLS: []networkingv1.IngressTLS{{
 				Hosts:      []string{cr.Spec.PolicyControlCluster.IngressHost},
-				SecretName: "kyverno-ingress",
+				SecretName: naming.IngressTLSSecretName,
 			}},
 			Rules: []networkingv1.IngressRule{{
 				Host: cr.Spec.PolicyControlCluster.IngressHost,
@@ -89,26 +90,48 @@ func AddIngressRuleForKyverno(cr *v1alpha1.PolicyControl, ingress *networkingv1.
 		}
 	}
 
+	ingressPath := buildIngressHTTPIngressPath(cr, path)
 	if idxPath != -1 {
 		logger.Info(fmt.Sprintf("Path (%s) already exists in ingress (%s)", path, ingress.GetName()))
+		// the backend changes when the workspace is moved to another shared Kyverno instance
+		ingress.Spec.Rules[idxHost].HTTP.Paths[idxPath].Backend = ingressPath.Backend
 		return ingress, nil
 	}
 
-	ingressPath := buildIngressHTTPIngressPath(cr, path)
 	ingress.Spec.Rules[idxHost].HTTP.Paths = append(ingress.Spec.Rules[idxHost].HTTP.Paths, *ingressPath)
 
 	return ingress, nil
 }
 
+// RemoveIngressRuleForKyverno removes the path of the workspace of cr from ingress, and tells whether it was there.
+func RemoveIngressRuleForKyverno(cr *v1alpha1.PolicyControl, ingress *networkingv1.Ingress) bool {
+	path := getPath(cr)
+	removed := false
+	for i, r := range ingress.Spec.Rules {
+		if r.Host != cr.Spec.PolicyControlCluster.IngressHost || r.HTTP == nil {
+			continue
+		}
+		var paths []networkingv1.HTTPIngressPath
+		for _, p := range r.HTTP.Paths {
+			if p.Path == path {
+				removed = true
+				continue
+			}
+			paths = append(paths, p)
+		}
+		ingress.Spec.Rules[i].HTTP.Paths = paths
+	}
+	return removed
+}
+
 func buildIngressHTTPIngressPath(cr *v1alpha1.PolicyControl, path string) *networkingv1.HTTPIngressPath {
-	normalizedWorkspace := normalizeWorkdpaceName(cr)
 	pathPrefix := networkingv1.PathTypePrefix
 	ingressPath := &networkingv1.HTTPIngressPath{
 		Path:     path,
 		PathType: &pathPrefix,
 		Backend: networkingv1.IngressBackend{
 			Service: &networkingv1.IngressServiceBackend{
-				Name: normalizedWorkspace,
+				Name: kyvernoServiceName(cr),
 				Port: networkingv1.ServiceBackendPort{
 					Number: cr.Spec.PolicyControlCluster.IngressPort,
 				},
@@ -119,5 +142,5 @@ func buildIngressHTTPIngressPath(cr *v1alpha1.PolicyControl, path string) *netwo
 }
 
 func getPath(cr *v1alpha1.PolicyControl) string {
-	return fmt.Sprintf("/%s(/|$)(.*)", normalizeWorkdpaceName(cr))
+	return naming.IngressPath(normalizeWorkdpaceName(cr))
 }
@@ -0,0 +1,131 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+)
+
+const (
+	IsolationNone      = "None"
+	IsolationNamespace = "Namespace"
+
+	// names of the objects isolating the namespace of a workspace
+	KyvernoServiceAccountName = "kyverno"
+	KyvernoNetworkPolicyName  = "kyverno-ingress-only"
+	KyvernoResourceQuotaName  = "kyverno"
+
+	defaultIngressControllerNamespace = "ingress-nginx"
+)
+
+// IsNamespaceIsolated tells whether the standalone Kyverno of the workspace of cr runs in a namespace of its own.
+func IsNamespaceIsolated(cr *v1alpha1.PolicyControl) bool {
+	return !IsSharedKyverno(cr) && cr.Spec.PolicyControlCluster.Isolation == IsolationNamespace
+}
+
+// KyvernoNamespace is the namespace of the Kyverno serving the workspace of cr, and of the Ingress and ingress TLS
+// secret routing to it: the namespace named after the workspace when it is isolated, the namespace of the Policy
+// Control Cluster otherwise.
+func KyvernoNamespace(cr *v1alpha1.PolicyControl) string {
+	if IsNamespaceIsolated(cr) {
+		return normalizeWorkdpaceName(cr)
+	}
+	return cr.Spec.PolicyControlCluster.Namespace
+}
+
+func BuildNamespaceForKyverno(cr *v1alpha1.PolicyControl) *corev1.Namespace {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: normalizeWorkdpaceName(cr),
+			Labels: map[string]string{
+				naming.AppLabel:       naming.KyvernoAppLabelValue,
+				naming.WorkspaceLabel: normalizeWorkdpaceName(cr),
+			},
+			Annotations: workspaceAnnotations(cr),
+		},
+	}
+	return namespace
+}
+
+// BuildServiceAccountForKyverno is the identity of the isolated Kyverno pod. Kyverno only talks to the workspace
+// through its kubeconfig, so no token of the Policy Control Cluster is mounted.
+func BuildServiceAccountForKyverno(cr *v1alpha1.PolicyControl) *corev1.ServiceAccount {
+	automount := false
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      KyvernoServiceAccountName,
+			Namespace: KyvernoNamespace(cr),
+		},
+		AutomountServiceAccountToken: &automount,
+	}
+	return serviceAccount
+}
+
+// BuildNetworkPolicyForKyverno admits traffic to the Kyverno pod only from the ingress controller, on the webhook port.
+func BuildNetworkPolicyForKyverno(cr *v1alpha1.PolicyControl) *networkingv1.NetworkPolicy {
+	ingressControllerNamespace := cr.Spec.PolicyControlCluster.NamespaceIsolation.IngressControllerNamespace
+	if ingressControllerNamespace == "" {
+		ingressControllerNamespace = defaultIngressControllerNamespace
+	}
+	protocol := corev1.ProtocolTCP
+	port := intstr.FromInt(naming.KyvernoWebhookPort)
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      KyvernoNetworkPolicyName,
+			Namespace: KyvernoNamespace(cr),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: KyvernoPodLabels(cr)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{corev1.LabelMetadataName: ingressControllerNamespace},
+					},
+				}},
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}},
+			}},
+		},
+	}
+	return networkPolicy
+}
+
+func BuildResourceQuotaForKyverno(cr *v1alpha1.PolicyControl) *corev1.ResourceQuota {
+	hard := cr.Spec.PolicyControlCluster.NamespaceIsolation.ResourceQuota
+	if len(hard) == 0 {
+		hard = corev1.ResourceList{
+			corev1.ResourcePods:     resource.MustParse("2"),
+			corev1.ResourceServices: resource.MustParse("1"),
+			corev1.ResourceSecrets:  resource.MustParse("2"),
+		}
+	}
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      KyvernoResourceQuotaName,
+			Namespace: KyvernoNamespace(cr),
+		},
+		Spec: corev1.ResourceQuotaSpec{Hard: hard.DeepCopy()},
+	}
+	return quota
+}
@@ -0,0 +1,268 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+// The golden files in testdata hold the objects built for representative PolicyControls. The names in them are
+// relied on by the Kyverno instances, the ingress and the workspaces installed by earlier versions of the operator,
+// so a diff must be deliberate. Regenerate them with: go test ./resources -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var probeTime = time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// testPolicyControl returns the PolicyControl of config/samples/pccr-edge1.yaml.
+func testPolicyControl() *v1alpha1.PolicyControl {
+	return &v1alpha1.PolicyControl{
+		ObjectMeta: metav1.ObjectMeta{Name: "pccr-edge1", Namespace: "default"},
+		Spec: v1alpha1.PolicyControlSpec{
+			Workspace: "root:edge1",
+			PolicyControlCluster: v1alpha1.PolicyControlCluster{
+				Namespace:   "default",
+				IngressName: "policy-control-cluster",
+				IngressHost: "policy-control-cluster.local",
+				IngressPort: 19443,
+				IngressTLSSecret: v1alpha1.TLSSecret{
+					Name:          "policy-control-cluster-tls-secret",
+					KeyForPrivKey: "tls.key",
+					KeyForCert:    "tls.crt",
+					KeyForCacert:  "ca.crt",
+				},
+				KcpKubeConfigSecret: v1alpha1.KcpKubeConfigSecret{Name: "kcp-kubeconfig-secret", Key: "kubeconfig.yaml"},
+			},
+			KyvernoInWorkspace: v1alpha1.KyvernoInWorkspace{
+				NamespaceForAPIResources: "kyverno",
+				KyvernoImage:             "kyverno-local:1.0.0",
+			},
+			KyvernoInCluster: v1alpha1.KyvernoInCluster{
+				InstallNamespace: "kyverno-incluster",
+				OperatorGroup:    v1alpha1.OperatorGroup{Name: "kyverno-operator-group"},
+				Subscription:     v1alpha1.Subscription{Name: "kyverno-operator", OLMNamespace: "olm"},
+				KyvernoCR:        v1alpha1.KyvernoCR{Name: "kyverno"},
+			},
+		},
+	}
+}
+
+func nestedWorkspacePolicyControl() *v1alpha1.PolicyControl {
+	cr := testPolicyControl()
+	cr.Spec.Workspace = "root:org:team"
+	cr.Spec.PolicyControlCluster.Namespace = "policy-control"
+	cr.Spec.PolicyControlCluster.IngressPort = 443
+	cr.Spec.KyvernoInWorkspace.NamespaceForAPIResources = "kyverno-system"
+	cr.Spec.KyvernoInWorkspace.KyvernoAPIExport = v1alpha1.KyvernoAPIExport{Path: "root:org", Name: "kyverno-v1-8"}
+	cr.Spec.KyvernoInWorkspace.KubernetesAPIBinding = v1alpha1.APIBinding{Path: "root:compute", ExportName: "kubernetes"}
+	cr.Spec.KyvernoInWorkspace.AdditionalAPIBindings = []v1alpha1.APIBinding{{
+		Path:                     "root:org",
+		ExportName:               "certificates",
+		AcceptedPermissionClaims: []v1alpha1.PermissionClaim{{Resource: "secrets"}, {Group: "cert-manager.io", Resource: "issuers", IdentityHash: "abc123"}},
+	}}
+	return cr
+}
+
+func sharedPolicyControl() *v1alpha1.PolicyControl {
+	cr := testPolicyControl()
+	cr.Spec.PolicyControlCluster.KyvernoMode = KyvernoModeShared
+	cr.Spec.PolicyControlCluster.SharedKyverno = v1alpha1.SharedKyverno{Shards: 4, KyvernoImage: "kyverno-shared:1.0.0"}
+	return cr
+}
+
+func isolatedPolicyControl() *v1alpha1.PolicyControl {
+	cr := testPolicyControl()
+	cr.Spec.PolicyControlCluster.Isolation = IsolationNamespace
+	cr.Spec.PolicyControlCluster.NamespaceIsolation = v1alpha1.NamespaceIsolation{
+		IngressControllerNamespace: "ingress-system",
+		ResourceQuota:              corev1.ResourceList{corev1.ResourcePods: resource.MustParse("3")},
+	}
+	return cr
+}
+
+// object is an object built for a golden file, under the name of its builder.
+type object struct {
+	builder string
+	obj     interface{}
+}
+
+func buildObjects(cr *v1alpha1.PolicyControl) []object {
+	objs := []object{
+		{"names", map[string]interface{}{
+			"AdvertisedURL":       AdvertisedURL(cr),
+			"KyvernoInstanceName": KyvernoInstanceName(cr),
+			"KyvernoNamespace":    KyvernoNamespace(cr),
+			"KyvernoPodLabels":    KyvernoPodLabels(cr),
+			"ShardBundleKey":      ShardBundleKey(cr),
+		}},
+	}
+	if IsNamespaceIsolated(cr) {
+		objs = append(objs,
+			object{"BuildNamespaceForKyverno", BuildNamespaceForKyverno(cr)},
+			object{"BuildServiceAccountForKyverno", BuildServiceAccountForKyverno(cr)},
+			object{"BuildNetworkPolicyForKyverno", BuildNetworkPolicyForKyverno(cr)},
+			object{"BuildResourceQuotaForKyverno", BuildResourceQuotaForKyverno(cr)},
+		)
+	}
+	if IsSharedKyverno(cr) {
+		shard := AssignShard(cr)
+		objs = append(objs,
+			object{"BuildShardSecretForKyverno", BuildShardSecretForKyverno(cr, shard)},
+			object{"BuildShardServiceForKyverno", BuildShardServiceForKyverno(cr, shard)},
+			object{"BuildShardDeploymentForKyverno", BuildShardDeploymentForKyverno(cr, shard)},
+		)
+	} else {
+		objs = append(objs,
+			object{"BuildSecretForKyverno", BuildSecretForKyverno(cr, "<workspace kubeconfig>")},
+			object{"BuildServiceForKyverno", BuildServiceForKyverno(cr)},
+			object{"BuildDeploymentForKyverno", BuildDeploymentForKyverno(cr)},
+		)
+	}
+	objs = append(objs,
+		object{"BuildTLSCASecretForKyverno", BuildTLSCASecretForKyverno(cr, "<ca.crt>")},
+		object{"BuildTLSKeyCertSecretForKyverno", BuildTLSKeyCertSecretForKyverno(cr, "<tls.key>", "<tls.crt>")},
+		object{"BuildTLSKeyCertSecretForIngress", BuildTLSKeyCertSecretForIngress(cr, "<tls.key>", "<tls.crt>")},
+		object{"BuildIngressForKyverno", BuildIngressForKyverno(cr)},
+		object{"BuildOperatorGroupForKyverno", BuildOperatorGroupForKyverno(cr)},
+		object{"BuildSubscriptionForKyverno", BuildSubscriptionForKyverno(cr)},
+		object{"BuildKyvernoCR", BuildKyvernoCR(cr)},
+	)
+	for _, binding := range BuildAPIBindings(cr) {
+		objs = append(objs, object{"BuildAPIBindings", binding})
+	}
+	objs = append(objs,
+		object{"BuildKyvernoAPIExport", BuildKyvernoAPIExport(cr, []string{APIResourceSchemaName("v1.8", "clusterpolicies", KyvernoAPIGroup)})},
+		object{"BuildCanaryClusterPolicy", BuildCanaryClusterPolicy(cr)},
+		object{"BuildCanaryEdgePolicy", BuildCanaryEdgePolicy(cr)},
+		object{"BuildCanaryConfigMap", BuildCanaryConfigMap(cr.Spec.KyvernoInCluster.InstallNamespace, probeTime)},
+	)
+	return objs
+}
+
+func TestBuilders(t *testing.T) {
+	tests := []struct {
+		name string
+		cr   *v1alpha1.PolicyControl
+	}{
+		{name: "standalone", cr: testPolicyControl()},
+		{name: "nested-workspace", cr: nestedWorkspacePolicyControl()},
+		{name: "shared", cr: sharedPolicyControl()},
+		{name: "isolated", cr: isolatedPolicyControl()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compareGolden(t, tt.name, buildObjects(tt.cr))
+		})
+	}
+}
+
+func TestAddIngressRuleForKyverno(t *testing.T) {
+	other := testPolicyControl()
+	other.Spec.Workspace = "root:edge2"
+	otherHost := testPolicyControl()
+	otherHost.Spec.Workspace = "root:edge2"
+	otherHost.Spec.PolicyControlCluster.IngressHost = "other.local"
+
+	tests := []struct {
+		name    string
+		ingress *networkingv1.Ingress
+		cr      *v1alpha1.PolicyControl
+		wantErr bool
+	}{
+		{name: "add-path", ingress: BuildIngressForKyverno(testPolicyControl()), cr: other},
+		{name: "existing-path", ingress: BuildIngressForKyverno(testPolicyControl()), cr: testPolicyControl()},
+		{name: "move-to-shard", ingress: BuildIngressForKyverno(testPolicyControl()), cr: sharedPolicyControl()},
+		{name: "unknown-host", ingress: BuildIngressForKyverno(testPolicyControl()), cr: otherHost, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress, err := AddIngressRuleForKyverno(tt.cr, tt.ingress)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("AddIngressRuleForKyverno() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddIngressRuleForKyverno() failed: %v", err)
+			}
+			compareGolden(t, "add-ingress-rule-"+tt.name, []object{{"AddIngressRuleForKyverno", ingress}})
+		})
+	}
+}
+
+// compareGolden compares objs with testdata/<name>.yaml, or writes them to it with -update.
+func compareGolden(t *testing.T, name string, objs []object) {
+	t.Helper()
+	var got bytes.Buffer
+	for i, o := range objs {
+		data, err := yaml.Marshal(o.obj)
+		if err != nil {
+			t.Fatalf("failed to marshal %s: %v", o.builder, err)
+		}
+		if i > 0 {
+			got.WriteString("---\n")
+		}
+		fmt.Fprintf(&got, "# %s\n", o.builder)
+		got.Write(data)
+	}
+
+	path := filepath.Join("testdata", name+".yaml")
+	if *update {
+		if err := os.WriteFile(path, got.Bytes(), 0o644); err != nil {
+			t.Fatalf("failed to update %s: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s, run go test ./resources -update to create it: %v", path, err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("the objects differ from %s, run go test ./resources -update if the change is deliberate\ngot:\n%s", path, got.String())
+	}
+}
+
+func TestRemoveIngressRuleForKyverno(t *testing.T) {
+	other := testPolicyControl()
+	other.Spec.Workspace = "root:edge2"
+	ingress, err := AddIngressRuleForKyverno(other, BuildIngressForKyverno(testPolicyControl()))
+	if err != nil {
+		t.Fatalf("AddIngressRuleForKyverno() failed: %v", err)
+	}
+
+	if !RemoveIngressRuleForKyverno(testPolicyControl(), ingress) {
+		t.Errorf("RemoveIngressRuleForKyverno() = false, want true")
+	}
+	if RemoveIngressRuleForKyverno(testPolicyControl(), ingress) {
+		t.Errorf("RemoveIngressRuleForKyverno() of a removed path = true, want false")
+	}
+	compareGolden(t, "remove-ingress-rule", []object{{"RemoveIngressRuleForKyverno", ingress}})
+}
@@ -21,17 +21,19 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
 )
 
 func BuildSecretForKyverno(cr *v1alpha1.PolicyControl, kcpKubeConfig string) *corev1.Secret {
 	normalizedWorkspace := normalizeWorkdpaceName(cr)
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      normalizedWorkspace,
-			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Name:        normalizedWorkspace,
+			Namespace:   KyvernoNamespace(cr),
+			Annotations: workspaceAnnotations(cr),
 		},
 		Type:       corev1.SecretTypeOpaque,
-		StringData: map[string]string{"target-kubeconfig.yaml": kcpKubeConfig},
+		StringData: map[string]string{naming.KubeConfigKey: kcpKubeConfig},
 	}
 	return secret
 }
@@ -39,11 +41,11 @@ func BuildSecretForKyverno(cr *v1alpha1.PolicyControl, kcpKubeConfig string) *co
 func BuildTLSCASecretForKyverno(cr *v1alpha1.PolicyControl, tlsCACrt string) *corev1.Secret {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "kyverno-svc-remote.kyverno.svc.kyverno-tls-ca",
+			Name:      naming.KyvernoTLSCASecretName,
 			Namespace: cr.Spec.KyvernoInWorkspace.NamespaceForAPIResources,
 		},
 		Type:       corev1.SecretTypeOpaque,
-		StringData: map[string]string{"rootCA.crt": tlsCACrt},
+		StringData: map[string]string{naming.KyvernoTLSCAKey: tlsCACrt},
 	}
 	return secret
 }
@@ -51,7 +53,7 @@ func BuildTLSCASecretForKyverno(cr *v1alpha1.PolicyControl, tlsCACrt string) *co
 func BuildTLSKeyCertSecretForKyverno(cr *v1alpha1.PolicyControl, tlsKey string, tlsCrt string) *corev1.Secret {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "kyverno-svc-remote.kyverno.svc.kyverno-tls-pair",
+			Name:      naming.KyvernoTLSPairSecretName,
 			Namespace: cr.Spec.KyvernoInWorkspace.NamespaceForAPIResources,
 		},
 		Type:       corev1.SecretTypeTLS,
@@ -63,8 +65,8 @@ func BuildTLSKeyCertSecretForKyverno(cr *v1alpha1.PolicyControl, tlsKey string,
 func BuildTLSKeyCertSecretForIngress(cr *v1alpha1.PolicyControl, tlsKey string, tlsCrt string) *corev1.Secret {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "kyverno-ingress",
-			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Name:      naming.IngressTLSSecretName,
+			Namespace: KyvernoNamespace(cr),
 		},
 		Type:       corev1.SecretTypeTLS,
 		StringData: map[string]string{"tls.key": tlsKey, "tls.crt": tlsCrt},
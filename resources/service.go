@@ -22,21 +22,23 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
 )
 
 func BuildServiceForKyverno(cr *v1alpha1.PolicyControl) *corev1.Service {
 	normalizedWorkspace := normalizeWorkdpaceName(cr)
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      normalizedWorkspace,
-			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Name:        normalizedWorkspace,
+			Namespace:   KyvernoNamespace(cr),
+			Annotations: workspaceAnnotations(cr),
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{"app": "kyverno-controller", "workspace": normalizedWorkspace},
+			Selector: map[string]string{naming.AppLabel: naming.KyvernoAppLabelValue, naming.WorkspaceLabel: normalizedWorkspace},
 			Ports: []corev1.ServicePort{{
 				Protocol:   "TCP",
 				Port:       int32(cr.Spec.PolicyControlCluster.IngressPort),
-				TargetPort: intstr.FromInt(9443),
+				TargetPort: intstr.FromInt(naming.KyvernoWebhookPort),
 			}},
 		},
 	}
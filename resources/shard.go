@@ -0,0 +1,177 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
+)
+
+const (
+	KyvernoModeStandalone = "Standalone"
+	KyvernoModeShared     = "Shared"
+
+	// ShardLabel is set on every object belonging to a shared Kyverno instance.
+	ShardLabel = naming.ShardLabel
+)
+
+func IsSharedKyverno(cr *v1alpha1.PolicyControl) bool {
+	return cr.Spec.PolicyControlCluster.KyvernoMode == KyvernoModeShared
+}
+
+func ShardName(index int32) string {
+	return naming.ShardName(index)
+}
+
+// AssignShard picks the shared Kyverno instance serving the workspace of cr.
+// It uses rendezvous hashing so that adding a shard only moves the workspaces that the new shard wins,
+// and every other workspace stays where it is.
+func AssignShard(cr *v1alpha1.PolicyControl) string {
+	shards := cr.Spec.PolicyControlCluster.SharedKyverno.Shards
+	if shards < 1 {
+		shards = 1
+	}
+	var best int32
+	var bestScore uint64
+	for i := int32(0); i < shards; i++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(fmt.Sprintf("%s/%s", cr.Spec.Workspace, ShardName(i))))
+		if score := h.Sum64(); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return ShardName(best)
+}
+
+// ShardBundleKey is the key under which the workspace kubeconfig is stored in the shard kubeconfig bundle.
+func ShardBundleKey(cr *v1alpha1.PolicyControl) string {
+	return naming.ShardBundleKey(normalizeWorkdpaceName(cr))
+}
+
+// kyvernoServiceName is the Service the ingress path of the workspace is routed to.
+func kyvernoServiceName(cr *v1alpha1.PolicyControl) string {
+	if IsSharedKyverno(cr) {
+		return AssignShard(cr)
+	}
+	return normalizeWorkdpaceName(cr)
+}
+
+func shardLabels(shard string) map[string]string {
+	return map[string]string{
+		naming.AppLabel: naming.KyvernoAppLabelValue,
+		ShardLabel:      shard,
+	}
+}
+
+func BuildShardSecretForKyverno(cr *v1alpha1.PolicyControl, shard string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shard,
+			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Labels:    shardLabels(shard),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{},
+	}
+	return secret
+}
+
+func BuildShardServiceForKyverno(cr *v1alpha1.PolicyControl, shard string) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shard,
+			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Labels:    shardLabels(shard),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: shardLabels(shard),
+			Ports: []corev1.ServicePort{{
+				Protocol:   "TCP",
+				Port:       int32(cr.Spec.PolicyControlCluster.IngressPort),
+				TargetPort: intstr.FromInt(naming.KyvernoWebhookPort),
+			}},
+		},
+	}
+	return service
+}
+
+func BuildShardDeploymentForKyverno(cr *v1alpha1.PolicyControl, shard string) *appsv1.Deployment {
+	// every workspace in the bundle is advertised as <ingressHost>:<ingressPort>/<normalized workspace>
+	advertisedUrlPrefix := naming.AdvertisedURLPrefix(cr.Spec.PolicyControlCluster.IngressHost, cr.Spec.PolicyControlCluster.IngressPort)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shard,
+			Namespace: cr.Spec.PolicyControlCluster.Namespace,
+			Labels:    shardLabels(shard),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: shardLabels(shard),
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: shardLabels(shard),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  naming.KyvernoContainerName,
+							Image: cr.Spec.PolicyControlCluster.SharedKyverno.KyvernoImage,
+							Args: []string{
+								"-v=4",
+								"--kubeconfigDir=" + naming.CredentialsMountPath,
+								"--serverIP=" + advertisedUrlPrefix,
+							},
+							Env: []corev1.EnvVar{{
+								Name:  "KYVERNO_SVC",
+								Value: naming.KyvernoServiceName,
+							}},
+							Ports: []corev1.ContainerPort{{
+								Name:          "http",
+								Protocol:      corev1.ProtocolTCP,
+								ContainerPort: naming.KyvernoWebhookPort,
+							}},
+							VolumeMounts: []corev1.VolumeMount{{
+								Name:      naming.CredentialsVolumeName,
+								MountPath: naming.CredentialsMountPath,
+								ReadOnly:  true,
+							}},
+						},
+					},
+					Volumes: []corev1.Volume{{
+						Name: naming.CredentialsVolumeName,
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{
+								SecretName: shard,
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+	return deployment
+}
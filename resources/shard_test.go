@@ -0,0 +1,98 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+func sharedWorkspace(workspace string, shards int32) *v1alpha1.PolicyControl {
+	cr := testPolicyControl()
+	cr.Spec.Workspace = workspace
+	cr.Spec.PolicyControlCluster.KyvernoMode = KyvernoModeShared
+	cr.Spec.PolicyControlCluster.SharedKyverno.Shards = shards
+	return cr
+}
+
+func TestAssignShard(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int32
+		want   []string
+	}{
+		{"no count is a single shard", 0, []string{ShardName(0)}},
+		{"negative count is a single shard", -3, []string{ShardName(0)}},
+		{"one shard", 1, []string{ShardName(0)}},
+		{"three shards", 3, []string{ShardName(0), ShardName(1), ShardName(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				cr := sharedWorkspace(fmt.Sprintf("root:ws%d", i), tt.shards)
+				got := AssignShard(cr)
+				found := false
+				for _, shard := range tt.want {
+					found = found || got == shard
+				}
+				if !found {
+					t.Fatalf("AssignShard(%s) = %s, want one of %v", cr.Spec.Workspace, got, tt.want)
+				}
+				if again := AssignShard(cr); again != got {
+					t.Fatalf("AssignShard(%s) = %s, then %s", cr.Spec.Workspace, got, again)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignShardSpread(t *testing.T) {
+	const workspaces = 1000
+	counts := map[string]int{}
+	for i := 0; i < workspaces; i++ {
+		counts[AssignShard(sharedWorkspace(fmt.Sprintf("root:org%d:ws", i), 4))]++
+	}
+	if len(counts) != 4 {
+		t.Fatalf("AssignShard() used shards %v, want all 4", counts)
+	}
+	for shard, n := range counts {
+		if n < workspaces/8 || n > workspaces*3/8 {
+			t.Errorf("AssignShard() put %d of %d workspaces on %s, want about a quarter", n, workspaces, shard)
+		}
+	}
+}
+
+func TestAssignShardAddingAShard(t *testing.T) {
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		workspace := fmt.Sprintf("root:org%d:ws", i)
+		before := AssignShard(sharedWorkspace(workspace, 3))
+		after := AssignShard(sharedWorkspace(workspace, 4))
+		if before == after {
+			continue
+		}
+		moved++
+		if after != ShardName(3) {
+			t.Errorf("workspace %s moved from %s to %s, want only moves to the new shard %s", workspace, before, after, ShardName(3))
+		}
+	}
+	if moved == 0 {
+		t.Errorf("no workspace moved to the new shard")
+	}
+}
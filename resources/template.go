@@ -0,0 +1,50 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"github.com/imdario/mergo"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+// MergeTemplate returns a copy of cr whose empty spec fields are filled from tmpl.
+// Fields set on cr always win, so a PolicyControl only needs to carry its per-workspace overrides.
+func MergeTemplate(cr *v1alpha1.PolicyControl, tmpl *v1alpha1.PolicyControlTemplate) (*v1alpha1.PolicyControl, error) {
+	merged := cr.DeepCopy()
+	if tmpl == nil {
+		return merged, nil
+	}
+	defaults := v1alpha1.PolicyControlSpec{
+		PolicyControlCluster: tmpl.Spec.PolicyControlCluster,
+		KyvernoInWorkspace:   tmpl.Spec.KyvernoInWorkspace,
+		KyvernoInCluster:     tmpl.Spec.KyvernoInCluster,
+	}
+	if err := mergo.Merge(&merged.Spec, *defaults.DeepCopy()); err != nil {
+		return nil, err
+	}
+	// mergo takes a pointer to a zero value for empty and merges into it, so an explicit false or 0s set on cr
+	// would be replaced by the template
+	if cr.Spec.PolicyControlCluster.InstallSyncer != nil {
+		installSyncer := *cr.Spec.PolicyControlCluster.InstallSyncer
+		merged.Spec.PolicyControlCluster.InstallSyncer = &installSyncer
+	}
+	if cr.Spec.KyvernoInWorkspace.DegradedFailOpenAfter != nil {
+		merged.Spec.KyvernoInWorkspace.DegradedFailOpenAfter = cr.Spec.KyvernoInWorkspace.DegradedFailOpenAfter.DeepCopy()
+	}
+	return merged, nil
+}
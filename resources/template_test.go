@@ -0,0 +1,130 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"testing"
+	"time"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/IBM/policy-control-operator/api/v1alpha1"
+)
+
+func TestMergeTemplate(t *testing.T) {
+	tmpl := &v1alpha1.PolicyControlTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "defaults"},
+		Spec: v1alpha1.PolicyControlTemplateSpec{
+			PolicyControlCluster: v1alpha1.PolicyControlCluster{
+				Namespace:     "policy-control",
+				IngressHost:   "pcc.example.com",
+				IngressPort:   443,
+				InstallSyncer: pointer.Bool(true),
+			},
+			KyvernoInWorkspace: v1alpha1.KyvernoInWorkspace{
+				KyvernoImage:          "ghcr.io/kyverno/kyverno:v1.8.0",
+				FailurePolicy:         "Fail",
+				DegradedFailOpenAfter: &metav1.Duration{Duration: 5 * time.Minute},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		spec  v1alpha1.PolicyControlSpec
+		check func(t *testing.T, got v1alpha1.PolicyControlSpec)
+	}{{
+		name: "empty fields are filled from the template",
+		spec: v1alpha1.PolicyControlSpec{Workspace: "root:edge"},
+		check: func(t *testing.T, got v1alpha1.PolicyControlSpec) {
+			if got.PolicyControlCluster.Namespace != "policy-control" || got.PolicyControlCluster.IngressPort != 443 {
+				t.Errorf("PolicyControlCluster = %+v, want the template values", got.PolicyControlCluster)
+			}
+			if !pointer.BoolDeref(got.PolicyControlCluster.InstallSyncer, false) {
+				t.Errorf("InstallSyncer = %v, want true", got.PolicyControlCluster.InstallSyncer)
+			}
+			if got.KyvernoInWorkspace.DegradedFailOpenAfter.Duration != 5*time.Minute {
+				t.Errorf("DegradedFailOpenAfter = %v, want 5m", got.KyvernoInWorkspace.DegradedFailOpenAfter)
+			}
+		},
+	}, {
+		name: "set fields win",
+		spec: v1alpha1.PolicyControlSpec{
+			PolicyControlCluster: v1alpha1.PolicyControlCluster{Namespace: "tenant-a"},
+			KyvernoInWorkspace:   v1alpha1.KyvernoInWorkspace{FailurePolicy: "Ignore"},
+		},
+		check: func(t *testing.T, got v1alpha1.PolicyControlSpec) {
+			if got.PolicyControlCluster.Namespace != "tenant-a" {
+				t.Errorf("Namespace = %q, want tenant-a", got.PolicyControlCluster.Namespace)
+			}
+			if got.PolicyControlCluster.IngressHost != "pcc.example.com" {
+				t.Errorf("IngressHost = %q, want pcc.example.com", got.PolicyControlCluster.IngressHost)
+			}
+			if got.KyvernoInWorkspace.FailurePolicy != "Ignore" {
+				t.Errorf("FailurePolicy = %q, want Ignore", got.KyvernoInWorkspace.FailurePolicy)
+			}
+		},
+	}, {
+		name: "false overrides true",
+		spec: v1alpha1.PolicyControlSpec{
+			PolicyControlCluster: v1alpha1.PolicyControlCluster{InstallSyncer: pointer.Bool(false)},
+		},
+		check: func(t *testing.T, got v1alpha1.PolicyControlSpec) {
+			if got.PolicyControlCluster.InstallSyncer == nil || *got.PolicyControlCluster.InstallSyncer {
+				t.Errorf("InstallSyncer = %v, want false", got.PolicyControlCluster.InstallSyncer)
+			}
+		},
+	}, {
+		name: "zero duration overrides the template",
+		spec: v1alpha1.PolicyControlSpec{
+			KyvernoInWorkspace: v1alpha1.KyvernoInWorkspace{DegradedFailOpenAfter: &metav1.Duration{}},
+		},
+		check: func(t *testing.T, got v1alpha1.PolicyControlSpec) {
+			if got.KyvernoInWorkspace.DegradedFailOpenAfter == nil || got.KyvernoInWorkspace.DegradedFailOpenAfter.Duration != 0 {
+				t.Errorf("DegradedFailOpenAfter = %v, want 0s", got.KyvernoInWorkspace.DegradedFailOpenAfter)
+			}
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1alpha1.PolicyControl{Spec: tt.spec}
+			before := cr.DeepCopy()
+			got, err := MergeTemplate(cr, tmpl)
+			if err != nil {
+				t.Fatalf("MergeTemplate() failed: %v", err)
+			}
+			tt.check(t, got.Spec)
+			if !apiequality.Semantic.DeepEqual(before, cr) {
+				t.Errorf("MergeTemplate() modified its input")
+			}
+		})
+	}
+
+	t.Run("the template is not modified", func(t *testing.T) {
+		got, err := MergeTemplate(&v1alpha1.PolicyControl{}, tmpl)
+		if err != nil {
+			t.Fatalf("MergeTemplate() failed: %v", err)
+		}
+		*got.Spec.PolicyControlCluster.InstallSyncer = false
+		if !*tmpl.Spec.PolicyControlCluster.InstallSyncer {
+			t.Errorf("MergeTemplate() shares InstallSyncer with the template")
+		}
+	})
+}
@@ -17,16 +17,66 @@
 package resources
 
 import (
-	"strings"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
 
 	"github.com/IBM/policy-control-operator/api/v1alpha1"
+	"github.com/IBM/policy-control-operator/naming"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var log = logf.Log.WithName("controller_policycontrol")
 
+// normalizeWorkdpaceName returns the name chosen for the workspace of cr in its status, so that it does not change
+// with the normalization, or the normalized workspace before it is chosen.
 func normalizeWorkdpaceName(cr *v1alpha1.PolicyControl) string {
-	return strings.ReplaceAll(cr.Spec.Workspace, ":", "--") // since ":" is not allowed in url path.
+	if cr.Status.WorkspaceName != "" {
+		return cr.Status.WorkspaceName
+	}
+	return naming.Workspace(cr.Spec.Workspace)
+}
+
+// workspaceAnnotations records the workspace of cr on the objects named after it.
+func workspaceAnnotations(cr *v1alpha1.PolicyControl) map[string]string {
+	return map[string]string{naming.WorkspaceAnnotation: cr.Spec.Workspace}
+}
+
+// AdvertisedURL is the address, without scheme, under which the Kyverno serving the workspace of cr
+// is reached by the webhooks registered in the workspace.
+func AdvertisedURL(cr *v1alpha1.PolicyControl) string {
+	return naming.AdvertisedURL(cr.Spec.PolicyControlCluster.IngressHost, cr.Spec.PolicyControlCluster.IngressPort, normalizeWorkdpaceName(cr))
+}
+
+// KyvernoInstanceName is the name of the Deployment and Service of the Kyverno serving the workspace of cr,
+// i.e. the standalone Kyverno of the workspace or the shard it is assigned to.
+func KyvernoInstanceName(cr *v1alpha1.PolicyControl) string {
+	return kyvernoServiceName(cr)
+}
+
+// KyvernoPodLabels selects the pods of the Kyverno serving the workspace of cr.
+func KyvernoPodLabels(cr *v1alpha1.PolicyControl) map[string]string {
+	if IsSharedKyverno(cr) {
+		return shardLabels(AssignShard(cr))
+	}
+	return map[string]string{
+		naming.AppLabel:       naming.KyvernoAppLabelValue,
+		naming.WorkspaceLabel: normalizeWorkdpaceName(cr),
+	}
+}
+
+// CertificateNotAfter returns the expiry of the first certificate in the PEM data.
+func CertificateNotAfter(data []byte) (time.Time, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
 }
 
 func int32Ptr(i int32) *int32 {